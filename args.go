@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// --args "in:string,verbose:bool,n:int=3" (or a //goscript:args directive) declares typed arguments for wrapped
+// code. goscript adds the flag parsing to the start of the code, like a prelude, so the code reads them from a
+// parsed args struct (args.In, args.Verbose, args.N) and the arguments after the flags from args.Rest.
+
+// Set by --args.
+var argSpecs []string
+
+var argNameMatcher = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_-]*$`)
+
+// The Go type of each argument type, and the flag package function that declares a flag of it.
+var argTypes = map[string]struct{ goType, flagFunc string }{
+	"string":   {"string", "StringVar"},
+	"bool":     {"bool", "BoolVar"},
+	"int":      {"int", "IntVar"},
+	"int64":    {"int64", "Int64Var"},
+	"uint":     {"uint", "UintVar"},
+	"uint64":   {"uint64", "Uint64Var"},
+	"float":    {"float64", "Float64Var"},
+	"float64":  {"float64", "Float64Var"},
+	"duration": {"time.Duration", "DurationVar"},
+}
+
+// Parses argument specs, each <name>:<type>[=<default>], given as a comma-separated list.
+func parseArgSpecs(lists []string) ([]FlagSpec, error) {
+	specs := []FlagSpec{}
+	fields := map[string]string{}
+	for _, list := range lists {
+		for _, arg := range strings.Split(list, ",") {
+			arg = strings.TrimSpace(arg)
+			if arg == "" {
+				continue
+			}
+			name, rest, ok := strings.Cut(arg, ":")
+			kind, def, hasDefault := strings.Cut(rest, "=")
+			if !ok || !argNameMatcher.MatchString(name) {
+				return nil, fmt.Errorf("invalid argument %q: want <name>:<type>[=<default>]", arg)
+			}
+			if _, ok := argTypes[kind]; !ok {
+				return nil, fmt.Errorf("invalid argument %q: unknown type %q (string, bool, int, int64, uint, uint64, float, duration)", arg, kind)
+			}
+			if hasDefault {
+				if err := validFlagValue(kind, def); err != nil {
+					return nil, fmt.Errorf("invalid default for %s: %v", name, err)
+				}
+			}
+			field := argField(name)
+			if field == "Rest" {
+				return nil, fmt.Errorf("invalid argument %q: args.Rest holds the arguments after the flags", arg)
+			}
+			if other, ok := fields[field]; ok {
+				return nil, fmt.Errorf("arguments %s and %s would both be args.%s", other, name, field)
+			}
+			fields[field] = name
+			specs = append(specs, FlagSpec{Name: name, Type: kind, Default: def})
+		}
+	}
+	return specs, nil
+}
+
+// Returns the field of the args struct for an argument: its name in upper camel case (e.g. DryRun for dry-run).
+func argField(name string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '-' || r == '_' }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// Returns the Go expression for an argument's default value: its zero value if it has none.
+func argDefault(spec FlagSpec) string {
+	switch {
+	case spec.Type == "string":
+		return fmt.Sprintf("%q", spec.Default)
+	case spec.Default != "" && spec.Type == "duration":
+		d, _ := time.ParseDuration(spec.Default) //validated by parseArgSpecs
+		return fmt.Sprintf("%d /* %s */", d, spec.Default)
+	case spec.Default != "":
+		return spec.Default
+	case spec.Type == "bool":
+		return "false"
+	}
+	return "0"
+}
+
+// Returns the code that declares and parses the arguments, to add in front of the wrapped code.
+func argScaffolding(specs []FlagSpec) string {
+	var b strings.Builder
+	b.WriteString("var args struct {\n")
+	for _, spec := range specs {
+		fmt.Fprintf(&b, "\t%s %s\n", argField(spec.Name), argTypes[spec.Type].goType)
+	}
+	b.WriteString("\tRest []string\n}\n")
+	for _, spec := range specs {
+		fmt.Fprintf(&b, "flag.%s(&args.%s, %q, %s, \"\")\n", argTypes[spec.Type].flagFunc, argField(spec.Name), spec.Name, argDefault(spec))
+	}
+	b.WriteString("flag.Parse()\nargs.Rest = flag.Args()\n")
+	return b.String()
+}
+
+// Adds the flag parsing for the arguments declared with --args or //goscript:args to the start of the code.
+func addArgs(code string) string {
+	specs, err := parseArgSpecs(append(append([]string{}, argSpecs...), directiveArgs(code, "args")...))
+	check(err, 2, "")
+	if len(specs) == 0 {
+		return code
+	}
+	return argScaffolding(specs) + code
+}
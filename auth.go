@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// When --serve is shared, the clients allowed to call it are listed in the project config, each with the
+// commands it may run:
+//
+//	"serve": {
+//	    "clients": {
+//	        "ci":      {"token_env": "CI_TOKEN", "allow": ["deploy", "backup-db"]},
+//	        "chatbot": {"cn": "chatbot.internal", "allow": ["*"]}
+//	    },
+//	    "tls": {"cert": "server.pem", "key": "server-key.pem", "client_ca": "clients-ca.pem"}
+//	}
+//
+// A client authenticates with the token in its environment variable ("Authorization: Bearer <token>"), or,
+// when --serve uses TLS with a client CA, with a client certificate whose common name is its cn. A client may
+// call the routes of the commands in its allow list. The token of a route (token=env:<VAR>) still works on its
+// own, so existing callers keep working, and a route can leave out its token when clients are configured, so
+// only clients can call it. Every call to a route is recorded in .goscript/audit.jsonl: who made it, what was
+// run with which flags, and how it ended, including calls that were refused.
+
+type serveClient struct {
+	TokenEnv string   `json:"token_env"` //environment variable holding the client's token
+	CN       string   `json:"cn"`        //common name of the client's certificate
+	Allow    []string `json:"allow"`     //commands the client may run, or "*" for all
+}
+
+type serveConfig struct {
+	Clients map[string]serveClient `json:"clients"`
+	TLS     struct {
+		Cert     string `json:"cert"`
+		Key      string `json:"key"`
+		ClientCA string `json:"client_ca"` //CA that signs client certificates; enables client certificates
+	} `json:"tls"`
+}
+
+type auditEntry struct {
+	Time     time.Time `json:"time"`
+	Client   string    `json:"client"` //a client name, "route token" or "anonymous" for a token=none route
+	Remote   string    `json:"remote"`
+	Route    string    `json:"route"`
+	Command  string    `json:"command"`
+	Args     []string  `json:"args,omitempty"`
+	Status   int       `json:"status"`
+	ExitCode string    `json:"exit_code,omitempty"`
+	Denied   string    `json:"denied,omitempty"` //why the call was refused
+}
+
+var auditMutex sync.Mutex
+
+func auditFile() string {
+	return stateDir() + "/audit.jsonl"
+}
+
+// Checks the clients in the serve config, reporting and leaving out any that can't authenticate.
+func checkClients(config serveConfig) map[string]serveClient {
+	clients := map[string]serveClient{}
+	for name, client := range config.Clients {
+		switch {
+		case client.TokenEnv == "" && client.CN == "":
+			fmt.Fprintf(os.Stderr, "warning: client %s has neither a token_env nor a cn\n", name)
+			continue
+		case client.CN != "" && config.TLS.ClientCA == "":
+			fmt.Fprintf(os.Stderr, "warning: client %s has a cn, but no tls client_ca is configured to verify it\n", name)
+		case client.TokenEnv != "" && os.Getenv(client.TokenEnv) == "":
+			fmt.Fprintf(os.Stderr, "warning: %s, the token of client %s, is not set\n", client.TokenEnv, name)
+		}
+		clients[name] = client
+	}
+	return clients
+}
+
+// Returns the name of the client making the request, from its client certificate or bearer token, or "".
+func identifyClient(r *http.Request, clients map[string]serveClient) string {
+	cn := ""
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cn = r.TLS.VerifiedChains[0][0].Subject.CommonName
+	}
+	given, hasToken := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	for name, client := range clients {
+		if cn != "" && client.CN == cn {
+			return name
+		}
+		if expected := os.Getenv(client.TokenEnv); hasToken && client.TokenEnv != "" && expected != "" &&
+			subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1 {
+			return name
+		}
+	}
+	return ""
+}
+
+// Decides whether a request may call a route. Returns who is calling, for the audit log, and if the call is
+// refused, the HTTP status and the reason.
+func authorizeRoute(r *http.Request, rt route, clients map[string]serveClient) (who string, status int, denied string) {
+	if name := identifyClient(r, clients); name != "" {
+		if allow := clients[name].Allow; !slices.Contains(allow, "*") && !slices.Contains(allow, rt.command) {
+			return name, http.StatusForbidden, fmt.Sprintf("client %s may not run %s", name, rt.command)
+		}
+		return name, 0, ""
+	}
+	if rt.spec.Open {
+		return "anonymous", 0, ""
+	}
+	expected := os.Getenv(rt.spec.TokenEnv)
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if ok && rt.spec.TokenEnv != "" && expected != "" && subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1 {
+		return "route token", 0, ""
+	}
+	return "", http.StatusUnauthorized, "no valid token or client certificate"
+}
+
+// Appends an entry to the audit log.
+func recordAudit(entry auditEntry) {
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+	if check(os.MkdirAll(stateDir(), 0755), 1, "") {
+		return
+	}
+	file, err := os.OpenFile(auditFile(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if check(err, 1, "Unable to write the audit log "+auditFile()) {
+		return
+	}
+	defer file.Close()
+	line, err := json.Marshal(entry)
+	check(err, 2, "")
+	file.Write(append(line, '\n'))
+}
+
+// Returns the TLS configuration for --serve, or nil to serve plain HTTP. With a client CA, clients may present
+// a certificate signed by it; those that don't must use a token.
+func serveTLSConfig(config serveConfig) *tls.Config {
+	if config.TLS.Cert == "" && config.TLS.Key == "" {
+		return nil
+	}
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	cert, err := tls.LoadX509KeyPair(projectFile(config.TLS.Cert), projectFile(config.TLS.Key))
+	check(err, 2, "Unable to load the serve TLS certificate and key.")
+	tlsConfig.Certificates = []tls.Certificate{cert}
+	if config.TLS.ClientCA != "" {
+		pem, err := os.ReadFile(projectFile(config.TLS.ClientCA))
+		check(err, 2, "Unable to read the serve client CA.")
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			check(fmt.Errorf("no certificates in %s", config.TLS.ClientCA), 2, "")
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig
+}
+
+// Resolves a path in the project config against the project directory.
+func projectFile(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(projectDir, path)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// Calls that are run for their effect, so are never printed. Skipping them also avoids the cost of type checking
+// for the most common last statements.
+var effectCalls = []string{"Print", "Fatal", "Panic", "Exit", "Stdout", "Write", "Close", "Run", "Wait", "Sleep", "Remove", "Mkdir", "Chdir", "Set"}
+
+// Set by wrapCode when autoPrint wrapped the last statement.
+var autoPrinted bool
+
+// If the last statement of the code is a bare expression, wraps it in fmt.Println so its value is printed, the
+// way a REPL would (e.g. 'strings.ToUpper("hi")' prints HI). Other expressions are printed, except a channel receive,
+// which is there to wait. Calls are printed only if they return exactly one value that is not an error, which needs a type check of the code.
+// Returns the code unchanged if there is nothing to print.
+func autoPrint(code string, imports []string) (string, bool) {
+	header := "package main\n\nimport (\n" + strings.Join(imports, "\n") + "\n)\n\nfunc main() {\n"
+	src := header + code + "\n}\n"
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return code, false
+	}
+	var body *ast.BlockStmt
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Name.Name == "main" {
+			body = fn.Body
+		}
+	}
+	if body == nil || len(body.List) == 0 {
+		return code, false
+	}
+	stmt, ok := body.List[len(body.List)-1].(*ast.ExprStmt)
+	if !ok {
+		return code, false
+	}
+
+	//A receive on its own waits, as for <-done or <-ctx.Done(), rather than asks for a value
+	if unary, ok := ast.Unparen(stmt.X).(*ast.UnaryExpr); ok && unary.Op == token.ARROW {
+		return code, false
+	}
+	if call, ok := ast.Unparen(stmt.X).(*ast.CallExpr); ok {
+		name := ""
+		switch fun := call.Fun.(type) {
+		case *ast.SelectorExpr:
+			name = fun.Sel.Name
+		case *ast.Ident:
+			name = fun.Name
+		}
+		for _, prefix := range effectCalls {
+			if strings.HasPrefix(name, prefix) {
+				return code, false
+			}
+		}
+		if name == "panic" || name == "print" || name == "println" {
+			return code, false
+		}
+		info := &types.Info{Types: map[ast.Expr]types.TypeAndValue{}}
+		conf := types.Config{Importer: importer.Default(), Error: func(error) {}}
+		conf.Check("main", fset, []*ast.File{f}, info)
+		tv, ok := info.Types[stmt.X]
+		if !ok || tv.Type == nil {
+			return code, false
+		}
+		if _, isTuple := tv.Type.(*types.Tuple); isTuple || types.Identical(tv.Type, types.Universe.Lookup("error").Type()) {
+			return code, false
+		}
+	}
+
+	start := fset.Position(stmt.Pos()).Offset - len(header)
+	end := fset.Position(stmt.End()).Offset - len(header)
+	if start < 0 || end > len(code) {
+		return code, false
+	}
+	return code[:start] + "fmt.Println(" + code[start:end] + ")" + code[end:], true
+}
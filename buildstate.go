@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --recompile only rebuilds the commands whose binaries are out of date. After each build of a command, a hash of
+// what went into it (its source files, the go.mod and go.sum of its module, the go executable, the platform and the
+// environment that changes what go build produces) is saved in .goscript/builds.json, keyed by binary. A binary
+// whose hash still matches is up to date. A binary built before its hash was saved is up to date if it is newer
+// than its source files and go.mod. --recompile --force rebuilds every command.
+
+type buildState struct {
+	Key  string    `json:"key"`
+	Time time.Time `json:"time"`
+}
+
+var buildStateMutex sync.Mutex
+
+func buildStateFile() string {
+	return stateDir() + "/builds.json"
+}
+
+// Returns the name a binary's build state is saved under: its path in the bin directory. Binaries outside the
+// bin directory, and the scratch binaries of unnamed code, have no build state.
+func buildStateName(binFilename string) (string, bool) {
+	rel, err := filepath.Rel(projectDir+"/bin", binFilename)
+	if err != nil || strings.HasPrefix(rel, "..") || strings.HasPrefix(filepath.Base(rel), "gocmd-") {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// Returns the hash of what goes into building a command for the platform being built for.
+func buildStateKey(srcFilename string) string {
+	h := sha256.New()
+	h.Write([]byte(sourcesHash(srcFilename)))
+	hashBuildInputs(h, moduleDir(srcFilename))
+	goos, goarch := buildPlatform()
+	fmt.Fprintf(h, "\x00%s/%s", goos, goarch)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func readBuildStates() map[string]buildState {
+	states := map[string]buildState{}
+	if data, err := os.ReadFile(buildStateFile()); err == nil {
+		json.Unmarshal(data, &states)
+	}
+	return states
+}
+
+// Saves the build state of a binary that was just built.
+func recordBuildState(srcFilename, binFilename string) {
+	name, ok := buildStateName(binFilename)
+	if !ok {
+		return
+	}
+	buildStateMutex.Lock()
+	defer buildStateMutex.Unlock()
+	states := readBuildStates()
+	states[name] = buildState{Key: buildStateKey(srcFilename), Time: time.Now()}
+	data, err := json.MarshalIndent(states, "", "    ")
+	if check(err, 0, "") || check(os.MkdirAll(stateDir(), 0755), 0, "") {
+		return
+	}
+	//Write to a temporary file and rename, so a reader never sees a partly written file
+	tmp := buildStateFile() + ".tmp"
+	if check(os.WriteFile(tmp, data, 0644), 0, "Unable to save the build state.") {
+		return
+	}
+	check(os.Rename(tmp, buildStateFile()), 0, "Unable to save the build state.")
+}
+
+// Reports whether a command's binary is up to date with its source and dependencies.
+func binaryCurrent(states map[string]buildState, srcFilename, binFilename string) bool {
+	if !checkFileExists(binFilename) {
+		return false
+	}
+	name, _ := buildStateName(binFilename)
+	if state, ok := states[name]; ok {
+		return state.Key == buildStateKey(srcFilename)
+	}
+	return binaryUpToDate(srcFilename, binFilename)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Unnamed code run with --exec (one-liners and shebang scripts) is built once. The binary is kept in
+// <project>/cache under a hash of everything that goes into the build, so running the same code again skips
+// go build entirely. Set GOSCRIPT_NO_CACHE to always rebuild. Binaries not run for buildCacheMaxAge are removed;
+// the project defaults can change that and limit the size of the cache (see settings.go).
+
+const buildCacheMaxAge = 30 * 24 * time.Hour
+
+func buildCacheDir() string {
+	return projectDir + "/cache"
+}
+
+// Returns the cache key for a generated source file: a hash of the source, the project's go.mod and go.sum,
+// the go executable and the environment variables that change what go build produces.
+func buildCacheKey(src []byte) string {
+	h := sha256.New()
+	h.Write(src)
+	hashBuildInputs(h, projectDir)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Adds what goes into a build besides the source to a hash: the go.mod and go.sum of the module in modDir,
+// the go executable, the build flags and the environment variables that change what go build produces.
+func hashBuildInputs(h io.Writer, modDir string) {
+	for _, filename := range []string{modDir + "/go.mod", modDir + "/go.sum"} {
+		data, _ := os.ReadFile(filename)
+		fmt.Fprintf(h, "\x00%s\x00%s", filename, data)
+	}
+	goBin, _ := goExecutable()
+	if info, err := os.Stat(goBin); err == nil {
+		fmt.Fprintf(h, "\x00%s\x00%d\x00%d", goBin, info.Size(), info.ModTime().UnixNano())
+	}
+	fmt.Fprintf(h, "\x00%s", strings.Join(buildFlags(), "\x00"))
+	for _, name := range []string{"GOOS", "GOARCH", "GOFLAGS", "CGO_ENABLED", "GOEXPERIMENT"} {
+		fmt.Fprintf(h, "\x00%s=%s", name, os.Getenv(name))
+	}
+}
+
+// Returns the cached binary for the key, if there is one. Its modification time is updated so binaries in use
+// are not pruned.
+func cachedBinary(key string) (string, bool) {
+	if key == "" {
+		return "", false
+	}
+	filename := buildCacheDir() + "/" + key
+	if !checkFileExists(filename) {
+		return "", false
+	}
+	now := time.Now()
+	os.Chtimes(filename, now, now)
+	return filename, true
+}
+
+// Moves a freshly built binary into the cache and returns its new location. The binary is left where it is if
+// it can't be cached.
+func storeCachedBinary(binFilename string, key string) string {
+	if check(os.MkdirAll(buildCacheDir(), 0755), 0, "Unable to create the build cache.") {
+		return binFilename
+	}
+	filename := buildCacheDir() + "/" + key
+	if check(os.Rename(binFilename, filename), 0, "Unable to cache the binary.") {
+		return binFilename
+	}
+	pruneBuildCache(key)
+	return filename
+}
+
+// Removes cached binaries that have not been run for buildCacheMaxAge (or cache_max_age in the project defaults),
+// and then the least recently run ones until the cache is within cache_max_size, if it is set. The binary under
+// the key is kept, since it is about to run.
+func pruneBuildCache(key string) {
+	entries, err := os.ReadDir(buildCacheDir())
+	if err != nil {
+		return
+	}
+	maxAge, maxSize := buildCacheLimits()
+	kept := []os.FileInfo{}
+	var size int64
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if time.Since(info.ModTime()) > maxAge {
+			os.Remove(buildCacheDir() + "/" + entry.Name())
+			continue
+		}
+		kept = append(kept, info)
+		size += info.Size()
+	}
+	if maxSize == 0 {
+		return
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].ModTime().Before(kept[j].ModTime()) })
+	for _, info := range kept {
+		if size <= maxSize {
+			break
+		}
+		if info.Name() != key && os.Remove(buildCacheDir()+"/"+info.Name()) == nil {
+			size -= info.Size()
+		}
+	}
+}
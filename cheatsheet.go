@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/fkmiec/goscript/engine"
+)
+
+type cheatsheetEntry struct {
+	Name        string
+	Description string
+	Flags       []FlagSpec
+}
+
+const textCheatsheet = `{{range .}}{{.Name}}{{if .Description}} - {{.Description}}{{end}}
+{{range .Flags}}    -{{.Name}} {{.Type}}{{if .Default}} (default {{.Default}}){{end}}{{if .Required}} (required){{end}}{{if .Usage}}  {{.Usage}}{{end}}
+{{end}}
+{{end}}`
+
+const markdownCheatsheet = `# Commands
+{{range .}}
+## {{.Name}}
+{{if .Description}}
+{{.Description}}
+{{end}}{{if .Flags}}
+| Flag | Type | Default | Required | Usage |
+| --- | --- | --- | --- | --- |
+{{range .Flags}}| -{{.Name}} | {{.Type}} | {{.Default}} | {{if .Required}}yes{{end}} | {{.Usage}} |
+{{end}}{{end}}{{end}}`
+
+const htmlCheatsheet = `<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Commands</title></head>
+<body>
+<h1>Commands</h1>
+{{range .}}<h2>{{.Name}}</h2>
+{{if .Description}}<p>{{.Description}}</p>
+{{end}}{{if .Flags}}<table>
+<tr><th>Flag</th><th>Type</th><th>Default</th><th>Required</th><th>Usage</th></tr>
+{{range .Flags}}<tr><td>-{{.Name}}</td><td>{{.Type}}</td><td>{{.Default}}</td><td>{{if .Required}}yes{{end}}</td><td>{{.Usage}}</td></tr>
+{{end}}</table>
+{{end}}{{end}}</body>
+</html>
+`
+
+// Collects the name, description and declared flags of every active command in the project.
+func cheatsheetEntries() []cheatsheetEntry {
+	cmds := []string{}
+	filenames := []string{}
+	for _, cmd := range getSourceList() {
+		if strings.HasSuffix(cmd, ".go") {
+			cmds = append(cmds, cmd)
+			filenames = append(filenames, sourcePath(cmd))
+		}
+	}
+	descriptions := describeScripts(filenames)
+
+	entries := []cheatsheetEntry{}
+	for i, cmd := range cmds {
+		entries = append(entries, cheatsheetEntry{
+			Name:        cmd[:len(cmd)-3],
+			Description: descriptions[filenames[i]],
+			Flags:       engine.ReadMetadata(filenames[i]).Flags,
+		})
+	}
+	return entries
+}
+
+// Renders all commands, their descriptions and flags into a cheat sheet in the project directory.
+// The format is text, md (Markdown) or html.
+func writeCheatsheet(format string) {
+	entries := cheatsheetEntries()
+	var out bytes.Buffer
+	var err error
+	var ext string
+	switch format {
+	case "text", "txt":
+		ext = "txt"
+		err = template.Must(template.New("cheatsheet").Parse(textCheatsheet)).Execute(&out, entries)
+	case "md", "markdown":
+		ext = "md"
+		err = template.Must(template.New("cheatsheet").Parse(markdownCheatsheet)).Execute(&out, entries)
+	case "html":
+		ext = "html"
+		err = htmltemplate.Must(htmltemplate.New("cheatsheet").Parse(htmlCheatsheet)).Execute(&out, entries)
+	default:
+		err = fmt.Errorf("unknown cheat sheet format %q (expected text, md or html)", format)
+	}
+	check(err, 2, "")
+
+	filename := projectDir + "/cheatsheet." + ext
+	err = os.WriteFile(filename, out.Bytes(), 0644)
+	check(err, 2, "Unable to write "+filename)
+	fmt.Printf("Cheat sheet for %d commands written to: %s\n", len(entries), filename)
+}
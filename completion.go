@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// --completion prints a completion script for bash, zsh or fish. Options are completed from the declared options,
+// and the names of commands in the project are completed at completion time with the hidden --complete-names
+// option, so the script doesn't go stale as commands are added and deleted.
+
+// What the value of an option is completed with: "active" or "deleted" command names, "file" names, or a list
+// of words. Options not listed here take free-form values.
+var completionValues = map[string]string{
+	"edit":           "active",
+	"cat":            "active",
+	"delete":         "active",
+	"export":         "active",
+	"rename":         "active",
+	"package":        "active",
+	"export-bin":     "active",
+	"export-selfrun": "active",
+	"path":           "active",
+	"name":           "active",
+	"run":            "active",
+	"try":            "active",
+	"test":           "active",
+	"runs":           "active",
+	"versions":       "active",
+	"watch":          "active",
+	"describe":       "active",
+	"size-history":   "active",
+	"licenses":       "active",
+	"vet":            "active",
+	"restore":        "deleted",
+	"file":           "file",
+	"code-file":      "file",
+	"fix-shebang":    "file",
+	"template-add":   "file",
+	"ingest":         "file",
+	"export-toolbox": "file",
+	"format":         strings.Join(slices.Concat(outputFormats, packageFormats), " "),
+	"completion":     "bash zsh fish",
+	"cheatsheet":     "text md html",
+	"secret":         "set get list delete",
+	"preset":         "export import",
+	"on-conflict":    "keep take rename",
+	"encoding":       "utf-8 latin-1 windows-1252 utf-16 utf-16le utf-16be locale",
+}
+
+// Prints the names of the project's commands, one per line: the active ones, or the soft-deleted ones.
+func printCommandNames(which string) {
+	for _, filename := range getSourceList() {
+		cmd, active := strings.CutSuffix(filename, ".go")
+		if active == (which == "active") {
+			fmt.Println(cmd)
+		}
+	}
+}
+
+// Returns the first sentence of an option's usage, for shells that show a description beside each option.
+func shortUsage(usage string) string {
+	if i := strings.Index(usage, ". "); i >= 0 {
+		usage = usage[:i]
+	}
+	return strings.TrimSuffix(usage, ".")
+}
+
+// Returns the names (e.g. "--edit", "-e") of the visible options whose value is completed with the given kind.
+func optionNames(kind string) []string {
+	names := []string{}
+	for _, o := range options.options {
+		if o.hidden || completionValues[o.long] != kind {
+			continue
+		}
+		names = append(names, "--"+o.long)
+		if o.short != "" {
+			names = append(names, "-"+o.short)
+		}
+	}
+	return names
+}
+
+// Returns the option kinds that complete from a list of words, sorted for stable output.
+func wordLists() []string {
+	lists := []string{}
+	for _, kind := range completionValues {
+		if kind != "active" && kind != "deleted" && kind != "file" && !slices.Contains(lists, kind) {
+			lists = append(lists, kind)
+		}
+	}
+	sort.Strings(lists)
+	return lists
+}
+
+func printCompletion(shell string) {
+	prog := filepath.Base(os.Args[0])
+	fn := "_" + strings.NewReplacer("-", "_", ".", "_").Replace(prog)
+	all := []string{}
+	for _, o := range options.options {
+		if !o.hidden {
+			all = append(all, "--"+o.long)
+		}
+	}
+
+	switch shell {
+	case "bash":
+		fmt.Printf("# %s completion for bash. Add to ~/.bashrc: source <(%s --completion bash)\n", prog, prog)
+		fmt.Printf("%s() {\n", fn)
+		fmt.Printf("    local cur=\"${COMP_WORDS[COMP_CWORD]}\" prev=\"${COMP_WORDS[COMP_CWORD-1]}\"\n")
+		fmt.Printf("    case \"$prev\" in\n")
+		for _, kind := range []string{"active", "deleted"} {
+			fmt.Printf("    %s)\n", strings.Join(optionNames(kind), "|"))
+			fmt.Printf("        COMPREPLY=($(compgen -W \"$(%s --complete-names %s 2>/dev/null)\" -- \"$cur\"))\n        return ;;\n", prog, kind)
+		}
+		fmt.Printf("    %s)\n        COMPREPLY=($(compgen -f -- \"$cur\"))\n        return ;;\n", strings.Join(optionNames("file"), "|"))
+		for _, words := range wordLists() {
+			fmt.Printf("    %s)\n        COMPREPLY=($(compgen -W %s -- \"$cur\"))\n        return ;;\n", strings.Join(optionNames(words), "|"), shellQuote(words))
+		}
+		fmt.Printf("    esac\n")
+		fmt.Printf("    if [[ \"$cur\" == -* ]]; then\n")
+		fmt.Printf("        COMPREPLY=($(compgen -W %s -- \"$cur\"))\n", shellQuote(strings.Join(all, " ")))
+		fmt.Printf("    fi\n")
+		fmt.Printf("}\n")
+		fmt.Printf("complete -o default -F %s %s\n", fn, prog)
+	case "zsh":
+		fmt.Printf("#compdef %s\n", prog)
+		fmt.Printf("# %s completion for zsh. Add to ~/.zshrc: source <(%s --completion zsh)\n", prog, prog)
+		fmt.Printf("%s() {\n", fn)
+		fmt.Printf("    case \"${words[CURRENT-1]}\" in\n")
+		for _, kind := range []string{"active", "deleted"} {
+			fmt.Printf("    %s)\n", strings.Join(optionNames(kind), "|"))
+			fmt.Printf("        compadd -- ${(f)\"$(%s --complete-names %s 2>/dev/null)\"}\n        return ;;\n", prog, kind)
+		}
+		fmt.Printf("    %s)\n        _files\n        return ;;\n", strings.Join(optionNames("file"), "|"))
+		for _, words := range wordLists() {
+			fmt.Printf("    %s)\n        compadd -- %s\n        return ;;\n", strings.Join(optionNames(words), "|"), words)
+		}
+		fmt.Printf("    esac\n")
+		fmt.Printf("    local -a opts\n")
+		fmt.Printf("    opts=(\n")
+		for _, o := range options.options {
+			if !o.hidden {
+				fmt.Printf("        %s\n", shellQuote("--"+o.long+":"+strings.ReplaceAll(shortUsage(o.usage), ":", `\:`)))
+			}
+		}
+		fmt.Printf("    )\n")
+		fmt.Printf("    _describe 'option' opts\n")
+		fmt.Printf("    _files\n")
+		fmt.Printf("}\n")
+		fmt.Printf("compdef %s %s\n", fn, prog)
+	case "fish":
+		fmt.Printf("# %s completion for fish. Add to ~/.config/fish/config.fish: %s --completion fish | source\n", prog, prog)
+		for _, o := range options.options {
+			if o.hidden {
+				continue
+			}
+			line := fmt.Sprintf("complete -c %s -l %s", prog, o.long)
+			if o.short != "" {
+				line += " -s " + o.short
+			}
+			if o.argName != "" {
+				line += " -r"
+			}
+			switch kind := completionValues[o.long]; kind {
+			case "":
+			case "active", "deleted":
+				line += fmt.Sprintf(" -f -a '(%s --complete-names %s 2>/dev/null)'", prog, kind)
+			case "file":
+				line += " -F"
+			default:
+				line += " -f -a " + shellQuote(kind)
+			}
+			fmt.Printf("%s -d %s\n", line, shellQuote(shortUsage(o.usage)))
+		}
+	default:
+		check(fmt.Errorf("unsupported shell %q", shell), 2, "Supported shells are bash, zsh and fish.")
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+// Settings that belong with the project rather than the shell environment are kept in <project>/config.json.
+// Every setting is optional, and a missing file is the same as an empty one. For example:
+//
+//	{
+//	    "notify": {"webhook": "https://hooks.slack.com/services/..."},
+//	    "schedule": {"backup-db": "0 3 * * *"}
+//	}
+type projectConfig struct {
+	Notify struct {
+		Webhook string `json:"webhook"` //Slack-compatible incoming webhook URL for --notify
+	} `json:"notify"`
+	Schedule map[string]string `json:"schedule"` //cron-style schedules run by --serve, keyed by command
+	Serve    serveConfig       `json:"serve"`    //clients allowed to call --serve, and its TLS setup (see auth.go)
+	Defaults defaultsConfig    `json:"defaults"` //defaults for options and environment variables (see settings.go)
+	Hosts    map[string]string `json:"hosts"`    //the platforms of the hosts given to --target ssh:<host> (see cross.go)
+}
+
+func projectConfigFile() string {
+	return projectDir + "/config.json"
+}
+
+// Reads the project configuration. An unreadable file is reported and treated as empty.
+func readProjectConfig() projectConfig {
+	var config projectConfig
+	data, err := os.ReadFile(projectConfigFile())
+	if err != nil {
+		return config
+	}
+	check(json.Unmarshal(data, &config), 1, "Ignoring invalid "+projectConfigFile())
+	return config
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	from := time.Date(2026, time.October, 16, 12, 0, 0, 0, time.UTC) //a Friday
+	tests := []struct {
+		spec, want string
+	}{
+		{"30 * * * *", "2026-10-16 12:30"},
+		{"0 3 * * *", "2026-10-17 03:00"},
+		{"0 0 1 * *", "2026-11-01 00:00"},
+		{"0 0 * * mon", "2026-10-19 00:00"},
+		{"0 0 * * 7", "2026-10-18 00:00"},
+		//Both days restricted: either matches
+		{"0 0 1 * mon", "2026-10-19 00:00"},
+		{"0 0 17 * mon", "2026-10-17 00:00"},
+		//A day field that matches every day is taken as "*", so only the other one counts
+		{"0 0 1 * */1", "2026-11-01 00:00"},
+		{"0 0 1 * 0-6", "2026-11-01 00:00"},
+		{"0 0 1 * sun-sat", "2026-11-01 00:00"},
+		{"0 0 1-31 * mon", "2026-10-19 00:00"},
+		{"0 0 */1 * mon", "2026-10-19 00:00"},
+		{"0 0 1-15,16-31 * mon", "2026-10-19 00:00"},
+		//But not one that leaves a day out
+		{"0 0 2-31 * mon", "2026-10-17 00:00"},
+		{"0 0 1 * 1-6", "2026-10-17 00:00"},
+		{"0 0 30 2 *", ""},
+		{"@weekly", "2026-10-18 00:00"},
+	}
+	for _, test := range tests {
+		s, err := parseCron(test.spec)
+		if err != nil {
+			t.Errorf("parseCron(%q): %v", test.spec, err)
+			continue
+		}
+		got := ""
+		if next := s.next(from); !next.IsZero() {
+			got = next.Format("2006-01-02 15:04")
+		}
+		if got != test.want {
+			t.Errorf("%q: next run %q, want %q", test.spec, got, test.want)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, spec := range []string{"* * * *", "60 * * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "* * * * fun"} {
+		if _, err := parseCron(spec); err == nil {
+			t.Errorf("parseCron(%q) succeeded", spec)
+		}
+	}
+}
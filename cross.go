@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Set by --os, --arch or --target to build for another platform. Binaries built for a platform other than the
+// host go to bin/<os>_<arch>/, so they don't replace the commands on the PATH.
+var targetOS, targetArch string
+
+// Set by --target ssh:<host> to build for the platform of a host reached with ssh. The platform is found by
+// running uname on the host, and kept in the "hosts" section of <project>/config.json, so each host is only
+// asked once:
+//
+//	"hosts": {
+//	    "pi": "linux/arm64",
+//	    "deploy@build-01": "linux/amd64"
+//	}
+//
+// Remove a host from the section, or correct its platform there, when the machine behind the name changes.
+var targetHost string
+
+// Parses a --target value such as linux/amd64 into targetOS and targetArch, or ssh:<host> into targetHost.
+func parseTarget(target string) {
+	if host, ok := strings.CutPrefix(target, "ssh:"); ok {
+		//A host starting with - would be read by ssh as an option
+		if host == "" || strings.HasPrefix(host, "-") {
+			check(fmt.Errorf("invalid target %q", target), 2, "Give the host as for ssh, e.g. ssh:pi or ssh:deploy@build-01.")
+		}
+		targetHost = host
+		return
+	}
+	goos, goarch, ok := strings.Cut(target, "/")
+	if !ok || goos == "" || goarch == "" {
+		check(fmt.Errorf("invalid target %q", target), 2, "Use the form <os>/<arch>, e.g. linux/arm64, or ssh:<host> for the platform of a remote host. 'go tool dist list' lists the platforms.")
+	}
+	targetOS, targetArch = goos, goarch
+}
+
+// Sets targetOS and targetArch to the platform of targetHost: the one recorded in the project config, or if there
+// is none, the one its uname reports, which is then recorded. Called once the project is known.
+func resolveTargetHost() {
+	platform := readProjectConfig().Hosts[targetHost]
+	if platform == "" {
+		fmt.Fprintf(os.Stderr, "Finding the platform of %s ...\n", targetHost)
+		var err error
+		platform, err = probeHost(targetHost)
+		check(err, 2, "Give the platform with --target <os>/<arch> instead, or add it to the \"hosts\" section of "+projectConfigFile()+".")
+		if !check(saveHostPlatform(targetHost, platform), 1, "The platform was not recorded, so it will be looked up again next time.") {
+			fmt.Fprintf(os.Stderr, "%s is %s. Recorded in %s.\n", targetHost, platform, projectConfigFile())
+		}
+	}
+	goos, goarch, ok := strings.Cut(platform, "/")
+	if !ok || goos == "" || goarch == "" {
+		check(fmt.Errorf("invalid platform %q for %s in %s", platform, targetHost, projectConfigFile()), 2, "Use the form <os>/<arch>, e.g. linux/arm64, or remove the host to have it looked up again.")
+	}
+	targetOS, targetArch = goos, goarch
+}
+
+// Returns the platform of a host as <os>/<arch>, by running uname on it with ssh. Windows hosts, which have no
+// uname unless a Unix-like shell is installed, are recognised by their environment instead.
+func probeHost(host string) (string, error) {
+	run := func(command string) (string, error) {
+		var stderr bytes.Buffer
+		cmd := exec.Command("ssh", "-o", "BatchMode=yes", "-o", "ConnectTimeout=10", "--", host, command)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil && stderr.Len() > 0 {
+			err = fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return strings.TrimSpace(string(out)), err
+	}
+	out, err := run("uname -sm")
+	if err != nil {
+		var exit *exec.ExitError
+		if !errors.As(err, &exit) || exit.ExitCode() == 255 {
+			//ssh itself failed, so there's no use trying another command
+			return "", fmt.Errorf("unable to reach %s with ssh: %w", host, err)
+		}
+		if winOut, winErr := run("echo %OS% %PROCESSOR_ARCHITECTURE%"); winErr == nil && strings.HasPrefix(winOut, "Windows_NT") {
+			out = winOut
+		} else {
+			return "", fmt.Errorf("unable to run uname on %s: %w", host, err)
+		}
+	}
+	fields := strings.Fields(out)
+	if len(fields) != 2 {
+		return "", fmt.Errorf("unexpected output from uname on %s: %q", host, out)
+	}
+	goos, goarch := unamePlatform(fields[0], fields[1])
+	if goos == "" || goarch == "" {
+		return "", fmt.Errorf("%s reports %q, which goscript doesn't recognise as a Go platform", host, out)
+	}
+	return goos + "/" + goarch, nil
+}
+
+// Translates the system and machine names that uname reports (or that Windows reports in %OS% and
+// %PROCESSOR_ARCHITECTURE%) into GOOS and GOARCH. Returns "" for a name it doesn't know.
+func unamePlatform(system, machine string) (string, string) {
+	goos := ""
+	switch system = strings.ToLower(system); {
+	case system == "windows_nt" || strings.HasPrefix(system, "mingw") || strings.HasPrefix(system, "msys") || strings.HasPrefix(system, "cygwin"):
+		goos = "windows"
+	case system == "sunos":
+		goos = "solaris"
+	case system == "linux" || system == "darwin" || system == "freebsd" || system == "openbsd" || system == "netbsd" ||
+		system == "dragonfly" || system == "aix" || system == "illumos":
+		goos = system
+	}
+	goarch := ""
+	switch machine = strings.ToLower(machine); {
+	case machine == "x86_64" || machine == "amd64" || machine == "x64":
+		goarch = "amd64"
+	case machine == "aarch64" || machine == "arm64" || machine == "aarch64_be":
+		goarch = "arm64"
+	case strings.HasPrefix(machine, "arm"):
+		goarch = "arm"
+	case machine == "i386" || machine == "i486" || machine == "i586" || machine == "i686" || machine == "i86pc" || machine == "x86":
+		goarch = "386"
+	case machine == "loongarch64":
+		goarch = "loong64"
+	case machine == "ppc64" || machine == "ppc64le" || machine == "riscv64" || machine == "s390x" || machine == "mips" ||
+		machine == "mipsle" || machine == "mips64" || machine == "mips64le":
+		goarch = machine
+	}
+	return goos, goarch
+}
+
+// Records the platform of a host in the "hosts" section of the project config, keeping the rest of the file.
+func saveHostPlatform(host, platform string) error {
+	config := map[string]json.RawMessage{}
+	data, err := os.ReadFile(projectConfigFile())
+	if err == nil {
+		if err := json.Unmarshal(data, &config); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	hosts := map[string]string{}
+	if raw, ok := config["hosts"]; ok {
+		if err := json.Unmarshal(raw, &hosts); err != nil {
+			return err
+		}
+	}
+	hosts[host] = platform
+	config["hosts"], _ = json.Marshal(hosts)
+	data, err = json.MarshalIndent(config, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(projectConfigFile(), append(data, '\n'), 0644)
+}
+
+// Returns the platform being built for: the target if one was given, otherwise the host.
+func buildPlatform() (string, string) {
+	goos, goarch := runtime.GOOS, runtime.GOARCH
+	if targetOS != "" {
+		goos = targetOS
+	}
+	if targetArch != "" {
+		goarch = targetArch
+	}
+	return goos, goarch
+}
+
+// Reports whether the build is for a platform other than the host.
+func crossCompiling() bool {
+	goos, goarch := buildPlatform()
+	return goos != runtime.GOOS || goarch != runtime.GOARCH
+}
+
+// Returns the path of the named command's binary for the platform being built for.
+func binaryPath(name string) string {
+	if !crossCompiling() {
+		return hostBinaryPath(name)
+	}
+	goos, goarch := buildPlatform()
+	return filepath.Join(projectDir, "bin", goos+"_"+goarch, exeName(name, goos))
+}
+
+// Returns the environment additions that make go build produce a binary for the target platform. Cgo is
+// disabled for other platforms unless CGO_ENABLED is set, since it needs a C cross-compiler.
+func crossEnv() []string {
+	if !crossCompiling() {
+		return nil
+	}
+	goos, goarch := buildPlatform()
+	env := []string{"GOOS=" + goos, "GOARCH=" + goarch}
+	if _, ok := os.LookupEnv("CGO_ENABLED"); !ok {
+		env = append(env, "CGO_ENABLED=0")
+	}
+	return env
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fkmiec/goscript/engine"
+)
+
+// --daemon keeps goscript warm for the project. It keeps a few worker processes waiting on a unix socket in
+// .goscript/daemon, each with the go executable found, imports.json read, the project's templates parsed and
+// goimports loaded, work a goscript process otherwise repeats on every run. A run of a script or
+// of --code checks for the socket and, if a worker answers, is a thin client: it passes the worker its standard
+// input, output and error, arguments, environment and working directory, forwards interrupts, and exits with the
+// status the worker sends back. The worker runs goscript as the client would have, from the build cache or with a
+// build, then exits; the daemon starts another in its place. With no daemon, or GOSCRIPT_NO_DAEMON set, runs are
+// local as before.
+//
+// The daemon also keeps the build cache current: each run of a cached script tells it about the script over a
+// second socket, and when the script is saved it is built into the cache in the background with the options it was
+// run with, so the next run doesn't wait for go build.
+
+// Workers kept waiting for a run.
+const spareWorkers = 2
+
+// The environment variable that starts goscript as a daemon worker.
+const daemonWorkerEnv = "GOSCRIPT_DAEMON_WORKER"
+
+// A run handed to a daemon worker. The client's standard files are passed with it.
+type runRequest struct {
+	Args  []string `json:"args"` //os.Args of the client
+	Env   []string `json:"env"`
+	Dir   string   `json:"dir"`
+	Umask int      `json:"umask"`
+}
+
+// A message on a run's connection: a signal for the worker to forward to the run, or the exit status of the run
+// for the client.
+type runMessage struct {
+	Signal int `json:"signal,omitempty"`
+	Exit   int `json:"exit"`
+}
+
+type daemonRequest struct {
+	Script string   `json:"script"` //absolute path of the script
+	Dir    string   `json:"dir"`    //working directory it was run in
+	Args   []string `json:"args"`   //goscript's arguments, to build it the same way
+}
+
+type watchedScript struct {
+	request daemonRequest
+	stamp   string
+}
+
+// The directory of the daemon's sockets. Only its owner can reach them, since whoever can connect to the run
+// socket runs code as the daemon's user.
+func daemonDir() string {
+	return stateDir() + "/daemon"
+}
+
+func daemonSocket() string {
+	return daemonDir() + "/daemon.sock"
+}
+
+// The socket daemon workers wait for runs on.
+func runSocket() string {
+	return daemonDir() + "/run.sock"
+}
+
+// Creates the directory of the daemon's sockets, or makes an existing one private again, before any socket is
+// created in it: a socket is created with the permissions the umask leaves, which may let others connect.
+func makeDaemonDir() error {
+	if err := os.MkdirAll(daemonDir(), 0700); err != nil {
+		return err
+	}
+	return os.Chmod(daemonDir(), 0700)
+}
+
+// What a daemon worker loaded before it was given a run, for wrapEngine, and the imports.json it was loaded with.
+var warmEngine *engine.Engine
+var warmImports string
+
+// Loads what runs need, for a daemon worker waiting to be given one.
+func warmUp() {
+	e := wrapEngine()
+	e.Warm()
+	warmEngine, warmImports = e, fileStamp(projectDir+"/imports.json")
+}
+
+// Returns a value that changes whenever the file is saved, or "" if it can't be read.
+func fileStamp(filename string) string {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", info.ModTime().UnixNano(), info.Size())
+}
+
+// Tells the daemon, if it is running, that a script was run, so it is rebuilt when it changes. Errors are ignored:
+// the script runs the same without the daemon.
+func notifyDaemon(script string) {
+	if !checkFileExists(daemonSocket()) {
+		return
+	}
+	conn, err := net.DialTimeout("unix", daemonSocket(), 50*time.Millisecond)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	request := daemonRequest{Args: os.Args[1:]}
+	request.Script, _ = filepath.Abs(script)
+	request.Dir, _ = os.Getwd()
+	conn.SetWriteDeadline(time.Now().Add(50 * time.Millisecond))
+	json.NewEncoder(conn).Encode(request)
+}
+
+// Builds a script into the build cache without running it, as goscript would before running it with the same
+// arguments.
+func prebuildScript(request daemonRequest) {
+	self, err := os.Executable()
+	if check(err, 1, "") {
+		return
+	}
+	start := time.Now()
+	cmd := exec.Command(self, append([]string{"--prebuild"}, request.Args...)...)
+	cmd.Dir = request.Dir
+	cmd.Env = append(os.Environ(), "GOSCRIPT_PROJECT_DIR="+projectDir)
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "[%s] Build of %s failed:\n%s", time.Now().Format("15:04:05"), request.Script, out)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "[%s] Built %s in %v\n", time.Now().Format("15:04:05"), request.Script, time.Since(start).Round(time.Millisecond))
+}
+
+// Runs the daemon until interrupted (see --daemon).
+func runDaemon() {
+	socket := daemonSocket()
+	if conn, err := net.Dial("unix", socket); err == nil {
+		conn.Close()
+		check(fmt.Errorf("a daemon is already running for %s", projectDir), 2, "")
+	}
+	check(makeDaemonDir(), 2, "")
+	os.Remove(socket) //left by a daemon that didn't exit cleanly
+	listener, err := net.Listen("unix", socket)
+	check(err, 2, "Unable to listen on "+socket)
+	stopWorkers, err := startDaemonWorkers()
+	check(err, 1, "Runs are not handed to the daemon, which only rebuilds scripts.")
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		listener.Close()
+		os.Remove(socket)
+		stopWorkers()
+		exitProgram(0)
+	}()
+
+	var mutex sync.Mutex
+	scripts := map[string]*watchedScript{}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			var request daemonRequest
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			err = json.NewDecoder(conn).Decode(&request)
+			conn.Close()
+			if err != nil || request.Script == "" {
+				continue
+			}
+			//The script was just built or found in the cache, so it is current
+			mutex.Lock()
+			if _, ok := scripts[request.Script]; !ok {
+				fmt.Fprintf(os.Stderr, "[%s] Watching %s\n", time.Now().Format("15:04:05"), request.Script)
+			}
+			scripts[request.Script] = &watchedScript{request: request, stamp: fileStamp(request.Script)}
+			mutex.Unlock()
+		}
+	}()
+
+	fmt.Fprintf(os.Stderr, "Listening in %s. Scripts and --code run in this project are run by warm workers, and shebang scripts are rebuilt when they change. Press Ctrl-C to stop.\n", daemonDir())
+	for {
+		time.Sleep(watchInterval)
+		mutex.Lock()
+		changed := []daemonRequest{}
+		for path, script := range scripts {
+			switch current := fileStamp(path); {
+			case current == "":
+				delete(scripts, path)
+			case current != script.stamp:
+				script.stamp = current
+				changed = append(changed, script.request)
+			}
+		}
+		mutex.Unlock()
+		for _, request := range changed {
+			prebuildScript(request)
+		}
+	}
+}
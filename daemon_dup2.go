@@ -0,0 +1,13 @@
+//go:build unix && !linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// Makes fd refer to the file.
+func dupFile(file *os.File, fd int) error {
+	return syscall.Dup2(int(file.Fd()), fd)
+}
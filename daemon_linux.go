@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// Makes fd refer to the file (dup2), which some linux ports only have as dup3.
+func dupFile(file *os.File, fd int) error {
+	return syscall.Dup3(int(file.Fd()), fd, 0)
+}
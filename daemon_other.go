@@ -0,0 +1,24 @@
+//go:build !unix
+
+package main
+
+import "errors"
+
+// Without unix sockets that pass open files, runs are not handed to the daemon (see daemon.go), which only
+// rebuilds scripts.
+
+func isDaemonWorker() bool {
+	return false
+}
+
+func startDaemonWorkers() (func(), error) {
+	return func() {}, errors.New("runs can't be handed to a daemon on this platform")
+}
+
+func serveDaemonClient() {}
+
+func answerDaemonClient(code int) {}
+
+func runInDaemon() (int, bool) {
+	return 0, false
+}
@@ -0,0 +1,275 @@
+//go:build unix
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// The connection to the client a daemon worker runs for, once it has one.
+var daemonClient *net.UnixConn
+
+func isDaemonWorker() bool {
+	return daemonClient != nil
+}
+
+// Sends open files over a unix socket, for receiveFiles at the other end.
+func sendFiles(conn *net.UnixConn, files ...*os.File) error {
+	fds := make([]int, len(files))
+	for i, file := range files {
+		fds[i] = int(file.Fd())
+	}
+	_, _, err := conn.WriteMsgUnix([]byte{0}, syscall.UnixRights(fds...), nil)
+	return err
+}
+
+// Receives the given number of files sent with sendFiles.
+func receiveFiles(conn *net.UnixConn, n int) ([]*os.File, error) {
+	oob := make([]byte, syscall.CmsgSpace(n*4))
+	_, oobn, _, _, err := conn.ReadMsgUnix(make([]byte, 1), oob)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil {
+		return nil, err
+	}
+	files := []*os.File{}
+	for _, message := range messages {
+		fds, err := syscall.ParseUnixRights(&message)
+		if err != nil {
+			return nil, err
+		}
+		for _, fd := range fds {
+			files = append(files, os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd)))
+		}
+	}
+	if len(files) != n {
+		for _, file := range files {
+			file.Close()
+		}
+		return nil, fmt.Errorf("received %d files, want %d", len(files), n)
+	}
+	return files, nil
+}
+
+// Starts the daemon's workers (see daemon.go) and keeps spareWorkers of them waiting on the run socket, starting
+// another each time one takes a run. Returns a function that removes the socket.
+func startDaemonWorkers() (func(), error) {
+	self, err := os.Executable()
+	if err != nil {
+		return func() {}, err
+	}
+	//The socket is created in the daemon's directory (see makeDaemonDir), which only the daemon's user can open
+	socket := runSocket()
+	if err := makeDaemonDir(); err != nil {
+		return func() {}, err
+	}
+	os.Remove(socket) //left by a daemon that didn't exit cleanly
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return func() {}, err
+	}
+	file, err := listener.(*net.UnixListener).File()
+	if err != nil {
+		listener.Close()
+		return func() {}, err
+	}
+	for i := 0; i < spareWorkers; i++ {
+		go keepWorker(self, file)
+	}
+	return func() { listener.Close() }, nil
+}
+
+// Starts a worker, and another each time it takes a run or exits.
+func keepWorker(self string, listener *os.File) {
+	for {
+		busy, busyWriter, err := os.Pipe()
+		if check(err, 1, "") {
+			return
+		}
+		cmd := exec.Command(self)
+		cmd.Env = append(os.Environ(), daemonWorkerEnv+"=1", "GOSCRIPT_PROJECT_DIR="+projectDir)
+		cmd.Stdout = os.Stderr
+		cmd.Stderr = os.Stderr
+		cmd.ExtraFiles = []*os.File{listener, busyWriter} //fds 3 and 4
+		//In a session of its own, interrupts of the daemon don't reach the worker nor what it runs
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+		err = cmd.Start()
+		busyWriter.Close()
+		took := 0
+		if !check(err, 1, "Unable to start a worker.") {
+			took, _ = busy.Read(make([]byte, 1))
+			go cmd.Wait()
+		}
+		busy.Close()
+		//A worker that failed to start, or exited without a run, is likely to again
+		if took == 0 {
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+// Makes goscript a daemon worker, if it was started as one (see keepWorker): loads what runs need, waits for a
+// client, and takes on its standard files, arguments, environment and working directory, so that run runs as the
+// client's goscript would. Returns at once if goscript isn't a worker.
+func serveDaemonClient() {
+	if os.Getenv(daemonWorkerEnv) == "" || isDaemonWorker() {
+		return
+	}
+	projectDir = os.Getenv("GOSCRIPT_PROJECT_DIR")
+	warmUp()
+	file := os.NewFile(3, "run.sock")
+	listener, err := net.FileListener(file)
+	file.Close()
+	check(err, 2, "")
+	//A worker left waiting by a daemon that has exited has nothing to wait for
+	daemon := os.Getppid()
+	go func() {
+		for os.Getppid() == daemon {
+			time.Sleep(time.Second)
+		}
+		listener.Close()
+	}()
+	conn, err := listener.Accept()
+	listener.Close()
+	if err != nil {
+		os.Exit(0)
+	}
+	busy := os.NewFile(4, "busy")
+	busy.Write([]byte{1})
+	busy.Close()
+
+	client := conn.(*net.UnixConn)
+	files, request, messages, err := readRunRequest(client)
+	check(err, 2, "")
+	for fd, file := range files {
+		check(dupFile(file, fd), 2, "")
+		file.Close()
+	}
+	os.Clearenv()
+	for _, variable := range request.Env {
+		name, value, _ := strings.Cut(variable, "=")
+		os.Setenv(name, value)
+	}
+	check(os.Chdir(request.Dir), 2, "")
+	syscall.Umask(request.Umask)
+	os.Args = request.Args
+	daemonClient = client
+
+	//Interrupts of the client go to the worker and what it runs, as they would to a local run in a terminal
+	go func() {
+		for {
+			var message runMessage
+			if messages.Decode(&message) != nil {
+				//The client is gone, as if its terminal had been closed
+				signalRun(syscall.SIGHUP)
+				return
+			}
+			signalRun(syscall.Signal(message.Signal))
+		}
+	}()
+}
+
+// Reads a run handed to a worker by handRun: the client's standard files, then the request. Returns the decoder
+// that reads the messages that follow.
+func readRunRequest(client *net.UnixConn) ([]*os.File, runRequest, *json.Decoder, error) {
+	var request runRequest
+	decoder := json.NewDecoder(client)
+	files, err := receiveFiles(client, 3)
+	if err != nil {
+		return nil, request, nil, err
+	}
+	if err := decoder.Decode(&request); err != nil {
+		for _, file := range files {
+			file.Close()
+		}
+		return nil, request, nil, err
+	}
+	return files, request, decoder, nil
+}
+
+// Sends a signal to the worker's process group: the worker and the commands it runs, since keepWorker starts each
+// worker in a session of its own. A worker that doesn't lead its group signals only itself.
+func signalRun(sig syscall.Signal) {
+	if group := syscall.Getpgrp(); group == os.Getpid() {
+		syscall.Kill(-group, sig)
+	} else {
+		syscall.Kill(os.Getpid(), sig)
+	}
+}
+
+// Sends the exit status of the run to the client, if goscript is a daemon worker.
+func answerDaemonClient(code int) {
+	if daemonClient != nil {
+		sendExitStatus(daemonClient, code)
+	}
+}
+
+// Sends the exit status of a run to the client that handed it over, for handRun to return.
+func sendExitStatus(client *net.UnixConn, code int) error {
+	return json.NewEncoder(client).Encode(runMessage{Exit: code})
+}
+
+// Hands the run to a worker of the daemon, if one is running for the project, and returns the run's exit status.
+// Returns false, for goscript to run it itself, if no worker takes it.
+func runInDaemon() (int, bool) {
+	if os.Getenv("GOSCRIPT_NO_DAEMON") != "" || isDaemonWorker() || !checkFileExists(runSocket()) {
+		return 0, false
+	}
+	dialed, err := net.DialTimeout("unix", runSocket(), 50*time.Millisecond)
+	if err != nil {
+		return 0, false
+	}
+	conn := dialed.(*net.UnixConn)
+	defer conn.Close()
+	request := runRequest{Args: os.Args, Env: os.Environ(), Umask: syscall.Umask(0)}
+	syscall.Umask(request.Umask)
+	request.Dir, _ = os.Getwd()
+	return handRun(conn, request, os.Stdin, os.Stdout, os.Stderr)
+}
+
+// Hands a run to the worker at the other end of conn, with the files to use as its standard input, output and
+// error, and returns the exit status the worker sends back. Interrupts are forwarded to the worker meanwhile.
+// Returns false if the worker didn't take the run.
+func handRun(conn *net.UnixConn, request runRequest, stdin, stdout, stderr *os.File) (int, bool) {
+	//The worker runs nothing until it has the whole request, so until then the run can still be local
+	encoder := json.NewEncoder(conn)
+	if sendFiles(conn, stdin, stdout, stderr) != nil || encoder.Encode(request) != nil {
+		return 0, false
+	}
+
+	var forwarded atomic.Int32
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	go func() {
+		for sig := range signals {
+			forwarded.Store(int32(sig.(syscall.Signal)))
+			encoder.Encode(runMessage{Signal: int(sig.(syscall.Signal))})
+		}
+	}()
+	var answer runMessage
+	if err := json.NewDecoder(conn).Decode(&answer); err != nil {
+		//The worker was ended by the signal, as goscript would have been
+		if sig := syscall.Signal(forwarded.Load()); sig != 0 {
+			signal.Reset(sig)
+			syscall.Kill(os.Getpid(), sig)
+			time.Sleep(time.Second)
+		}
+		//Otherwise it panicked, as goscript does on a bug, and the panic has been printed
+		check(errors.New("the daemon's worker exited without an exit status"), 1, "")
+		return 2, true
+	}
+	return answer.Exit, true
+}
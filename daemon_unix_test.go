@@ -0,0 +1,132 @@
+//go:build unix
+
+package main
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A client's standard files reach the worker as files it can use in their place.
+func TestSendFiles(t *testing.T) {
+	listener, err := net.Listen("unix", filepath.Join(t.TempDir(), "run.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	client, err := net.Dial("unix", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	worker, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer worker.Close()
+
+	pipes := make([][2]*os.File, 3)
+	for i := range pipes {
+		r, w, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		defer w.Close()
+		pipes[i] = [2]*os.File{r, w}
+	}
+	if err := sendFiles(client.(*net.UnixConn), pipes[0][1], pipes[1][1], pipes[2][1]); err != nil {
+		t.Fatal(err)
+	}
+	files, err := receiveFiles(worker.(*net.UnixConn), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, file := range files {
+		want := []string{"in", "out", "err"}[i]
+		if _, err := io.WriteString(file, want); err != nil {
+			t.Fatal(err)
+		}
+		file.Close()
+		pipes[i][1].Close()
+		if got, _ := io.ReadAll(pipes[i][0]); string(got) != want {
+			t.Errorf("file %d received %q, want %q", i, got, want)
+		}
+	}
+
+	if err := sendFiles(client.(*net.UnixConn), pipes[0][0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := receiveFiles(worker.(*net.UnixConn), 3); err == nil {
+		t.Error("receiveFiles succeeded with 1 file of 3")
+	}
+}
+
+// A run handed to a worker writes to the client's files and ends with the exit status the worker sends back.
+func TestHandRun(t *testing.T) {
+	listener, err := net.Listen("unix", filepath.Join(t.TempDir(), "run.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	worker := func(status int, answer bool) {
+		conn, err := listener.Accept()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		files, request, _, err := readRunRequest(conn.(*net.UnixConn))
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		for _, file := range files {
+			defer file.Close()
+		}
+		io.WriteString(files[1], strings.Join(request.Args, " ")+" in "+request.Dir)
+		if answer {
+			sendExitStatus(conn.(*net.UnixConn), status)
+		}
+	}
+	run := func(request runRequest) (int, bool, string) {
+		conn, err := net.Dial("unix", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		stdout, stdoutWriter, err := os.Pipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer stdout.Close()
+		status, ok := handRun(conn.(*net.UnixConn), request, os.Stdin, stdoutWriter, os.Stderr)
+		stdoutWriter.Close()
+		out, _ := io.ReadAll(stdout)
+		return status, ok, string(out)
+	}
+
+	go worker(7, true)
+	status, ok, out := run(runRequest{Args: []string{"goscript", "-x", "hello.go"}, Dir: "/tmp"})
+	if status != 7 || !ok {
+		t.Errorf("handRun = %d, %v, want 7, true", status, ok)
+	}
+	if out != "goscript -x hello.go in /tmp" {
+		t.Errorf("worker wrote %q", out)
+	}
+
+	go worker(0, true)
+	if status, ok, _ := run(runRequest{Args: []string{"goscript"}}); status != 0 || !ok {
+		t.Errorf("handRun = %d, %v, want 0, true", status, ok)
+	}
+
+	//A worker that exits without an answer has failed, as a goscript that panics does
+	go worker(0, false)
+	if status, ok, _ := run(runRequest{Args: []string{"goscript"}}); status != 2 || !ok {
+		t.Errorf("handRun = %d, %v, want 2, true", status, ok)
+	}
+}
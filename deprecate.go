@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fkmiec/goscript/engine"
+)
+
+// --deprecate <old>:<new> marks a command as replaced by another, in its manifest.json entry, so the mark is
+// shared with everyone using the project:
+//
+//	{
+//	    "gofind": {"replaced_by": "findcfg", "forward": true}
+//	}
+//
+// Running a deprecated command prints a warning naming the replacement. With --forward, it runs the replacement
+// instead: its binary is a small redirect that passes its arguments, input and exit status through. The old
+// name needn't have a source any more, so a command can be renamed and its old name kept working for a while.
+// --deprecate <old>: removes the mark.
+
+// Set by --forward.
+var forwardDeprecated bool
+
+// Returns the deprecation mark of a command, if it has one.
+func deprecation(name string) (manifestEntry, bool) {
+	entry, ok := readManifest()[name]
+	return entry, ok && entry.ReplacedBy != ""
+}
+
+// Returns the deprecated names that have no source of their own, which only redirect to their replacements.
+func redirectNames() []string {
+	names := []string{}
+	for name, entry := range readManifest() {
+		if entry.ReplacedBy != "" && !checkFileExists(sourceFile(name)) && !checkFileExists(strings.TrimSuffix(sourceFile(name), ".go")) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Returns the commands from getSourceList with the redirect-only names added, sorted by name.
+func withRedirects(cmds []string) []string {
+	all := append(append([]string{}, cmds...), redirectNames()...)
+	sort.SliceStable(all, func(i, j int) bool {
+		return strings.TrimSuffix(all[i], ".go") < strings.TrimSuffix(all[j], ".go")
+	})
+	return all
+}
+
+// Returns how --list describes a deprecated command.
+func deprecationNote(entry manifestEntry) string {
+	if entry.Forward {
+		return "deprecated: runs " + entry.ReplacedBy
+	}
+	return "deprecated: use " + entry.ReplacedBy
+}
+
+// Parses the argument of --deprecate. An empty new name removes the mark.
+func parseDeprecate(arg string) (string, string, error) {
+	oldName, newName, ok := strings.Cut(arg, ":")
+	if !ok || !validCommandName(oldName) || (newName != "" && !validCommandName(newName)) {
+		return "", "", fmt.Errorf("%q is not of the form <old>:<new>, or <old>: to remove the mark", arg)
+	}
+	if oldName == newName {
+		return "", "", fmt.Errorf("%s can't replace itself", oldName)
+	}
+	return oldName, newName, nil
+}
+
+// Changes the manifest.json entry of a command with update, keeping its other settings and the other entries.
+// An entry left empty is removed.
+func updateManifestEntry(name string, update func(entry map[string]json.RawMessage)) {
+	manifest := map[string]json.RawMessage{}
+	data, err := os.ReadFile(manifestFile())
+	if !errors.Is(err, os.ErrNotExist) {
+		check(err, 2, "")
+		check(json.Unmarshal(data, &manifest), 2, "Invalid "+manifestFile())
+	}
+	entry := map[string]json.RawMessage{}
+	if raw, ok := manifest[name]; ok {
+		check(json.Unmarshal(raw, &entry), 2, "Invalid "+manifestFile())
+	}
+	update(entry)
+	if len(entry) == 0 {
+		delete(manifest, name)
+	} else {
+		manifest[name], err = json.Marshal(entry)
+		check(err, 2, "")
+	}
+	data, err = json.MarshalIndent(manifest, "", "    ")
+	check(err, 2, "")
+	check(writeFileAtomic(manifestFile(), append(data, '\n'), 0644), 2, "Unable to update "+manifestFile())
+}
+
+// Marks a command as replaced by another, or removes the mark when newName is empty (see --deprecate).
+func deprecateCommand(oldName, newName string, forward bool) {
+	hasSource := checkFileExists(sourceFile(oldName))
+	if newName == "" {
+		if _, ok := deprecation(oldName); !ok {
+			check(fmt.Errorf("%s is not deprecated", oldName), 2, "")
+		}
+		updateManifestEntry(oldName, func(entry map[string]json.RawMessage) {
+			delete(entry, "replaced_by")
+			delete(entry, "forward")
+		})
+		if hasSource {
+			fmt.Printf("%s is no longer deprecated.\n", oldName)
+			if !compileBinary(sourceFile(oldName), binaryPath(oldName)) {
+				exitProgram(1)
+			}
+			return
+		}
+		check(os.Remove(hostBinaryPath(oldName)), 1, "")
+		fmt.Printf("Removed the redirect from %s to its replacement.\n", oldName)
+		return
+	}
+
+	if !checkFileExists(sourceFile(newName)) {
+		check(fmt.Errorf("there is no command named %s", newName), 2, "")
+	}
+	if entry, ok := deprecation(newName); ok && entry.Forward {
+		check(fmt.Errorf("%s is deprecated itself and runs %s", newName, entry.ReplacedBy), 2, "Deprecate "+oldName+" in favour of "+entry.ReplacedBy+" instead.")
+	}
+	if !hasSource && checkFileExists(strings.TrimSuffix(sourceFile(oldName), ".go")) {
+		check(fmt.Errorf("%s is deleted", oldName), 2, "Restore it with --restore first.")
+	}
+	updateManifestEntry(oldName, func(entry map[string]json.RawMessage) {
+		entry["replaced_by"], _ = json.Marshal(newName)
+		if forward {
+			entry["forward"] = json.RawMessage("true")
+		} else {
+			delete(entry, "forward")
+		}
+	})
+
+	if hasSource && !forward {
+		if !compileBinary(sourceFile(oldName), binaryPath(oldName)) {
+			exitProgram(1)
+		}
+	} else if !buildRedirect(oldName, manifestEntry{ReplacedBy: newName, Forward: forward}, binaryPath(oldName)) {
+		exitProgram(1)
+	}
+	if forward {
+		fmt.Printf("Deprecated %s: it now warns and runs %s.\n", oldName, newName)
+	} else if hasSource {
+		fmt.Printf("Deprecated %s: it now warns that %s replaces it.\n", oldName, newName)
+	} else {
+		fmt.Printf("Deprecated %s: it now says that %s replaces it. Give --forward to have it run %s.\n", oldName, newName, newName)
+	}
+}
+
+// Builds the binary of a deprecated name that has no source of its own, or whose runs are forwarded: a program
+// that warns and runs the replacement, or without forwarding, only says what replaced it.
+func buildRedirect(name string, entry manifestEntry, binFilename string) bool {
+	return !check(redirectBinary(goEngine(), name, entry, binFilename), 1, "Unable to build the redirect for "+name+".")
+}
+
+// Like buildRedirect, but returns an error instead of printing it.
+func redirectBinary(e *engine.Engine, name string, entry manifestEntry, binFilename string) error {
+	var body string
+	if entry.Forward {
+		body = fmt.Sprintf(redirectForward, strconv.Quote(fmt.Sprintf("warning: %s is deprecated and runs %s; use %s instead", name, entry.ReplacedBy, entry.ReplacedBy)), strconv.Quote(entry.ReplacedBy))
+	} else {
+		body = fmt.Sprintf(redirectRemoved, strconv.Quote(fmt.Sprintf("%s has been replaced by %s; use %s instead", name, entry.ReplacedBy, entry.ReplacedBy)))
+	}
+	os.MkdirAll(stateDir(), 0755)
+	dir, err := os.MkdirTemp(stateDir(), "redirect-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(dir+"/main.go", []byte(body), 0644); err != nil {
+		return err
+	}
+	absBinFilename, err := filepath.Abs(binFilename)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(absBinFilename), 0755); err != nil {
+		return err
+	}
+
+	cmd := e.GoCommand(dir, "build", "-o", absBinFilename, "main.go")
+	if env := crossEnv(); env != nil {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(cmd.Env, env...)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, out)
+	}
+	return nil
+}
+
+// Adds a warning to the build of a deprecated command that isn't forwarded: an init function printing it is
+// given to go build in an overlay, leaving the source as it is. Returns a function that removes the overlay.
+func addDeprecationWarning(srcFilename, name string, entry manifestEntry, buildFlags *[]string) func() {
+	os.MkdirAll(stateDir(), 0755)
+	dir, err := os.MkdirTemp(stateDir(), "deprecated-*")
+	if check(err, 1, "") {
+		return func() {}
+	}
+	warning := fmt.Sprintf("\nfunc init() { println(%s) } //added by goscript --deprecate\n", strconv.Quote(fmt.Sprintf("warning: %s is deprecated; use %s instead", name, entry.ReplacedBy)))
+	absSrcFilename, _ := filepath.Abs(srcFilename)
+	replace := map[string]string{}
+	if sourceDir(srcFilename) != "" {
+		//A directory command is built as a package, so the warning can be a file of its own
+		check(os.WriteFile(dir+"/warning.go", []byte("package main\n"+warning), 0644), 1, "")
+		replace[filepath.Join(filepath.Dir(absSrcFilename), "goscript_deprecated.go")] = dir + "/warning.go"
+	} else {
+		data, err := os.ReadFile(srcFilename)
+		if check(err, 1, "") {
+			return func() { os.RemoveAll(dir) }
+		}
+		check(os.WriteFile(dir+"/main.go", append(data, warning...), 0644), 1, "")
+		replace[absSrcFilename] = dir + "/main.go"
+	}
+	overlay, _ := json.Marshal(map[string]any{"Replace": replace})
+	check(os.WriteFile(dir+"/overlay.json", overlay, 0644), 1, "")
+	*buildFlags = append(*buildFlags, "-overlay="+dir+"/overlay.json")
+	return func() { os.RemoveAll(dir) }
+}
+
+// Builds the binaries of the redirect-only names that don't have one, or all of them with force.
+func buildRedirects(force bool) {
+	manifest := readManifest()
+	for _, name := range redirectNames() {
+		if force || !checkFileExists(binaryPath(name)) {
+			buildRedirect(name, manifest[name], binaryPath(name))
+		}
+	}
+}
+
+// The redirect of a deprecated name whose runs are forwarded to its replacement, in the same directory.
+const redirectForward = `package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+func main() {
+	fmt.Fprintln(os.Stderr, %s)
+	exe, err := os.Executable()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	replacement := %s
+	cmd := exec.Command(filepath.Join(filepath.Dir(exe), replacement+filepath.Ext(exe)), os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err = cmd.Run()
+	var exit *exec.ExitError
+	if errors.As(err, &exit) && exit.ExitCode() > 0 {
+		os.Exit(exit.ExitCode())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "unable to run %%s: %%v\n", replacement, err)
+		os.Exit(1)
+	}
+}
+`
+
+// The redirect of a deprecated name without a source that isn't forwarded.
+const redirectRemoved = `package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func main() {
+	fmt.Fprintln(os.Stderr, %s)
+	os.Exit(1)
+}
+`
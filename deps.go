@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// --update-deps upgrades the modules the project requires to their latest minor or patch releases with go get -u,
+// prints what changed, module by module, and records the changes in the operations journal (see journal.go) for
+// review. Each change has a link to review it: the compare view between the two versions for modules on GitHub,
+// or the module's page on pkg.go.dev. The links are built from the module paths and versions alone, so nothing
+// but go get itself contacts the network.
+
+// A module that was added, removed, upgraded or downgraded in the build list.
+type moduleChange struct {
+	Change string `json:"change"`
+	Path   string `json:"path"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+	Link   string `json:"link,omitempty"`
+}
+
+// Returns the version of each module in the project's build list, keyed by module path.
+func moduleVersions() map[string]string {
+	versions := map[string]string{}
+	out, err := goCommand("list", "-m", "-f", "{{if not .Main}}{{.Path}}\t{{.Version}}{{end}}", "all").Output()
+	if err != nil {
+		check(err, 0, "Unable to list the project modules.")
+		return versions
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if path, version, ok := strings.Cut(line, "\t"); ok {
+			versions[path] = version
+		}
+	}
+	return versions
+}
+
+// Returns the modules that were added, removed, upgraded or downgraded between two build lists, sorted by path.
+func diffModules(before, after map[string]string) []moduleChange {
+	changes := []moduleChange{}
+	for path, version := range after {
+		if old, ok := before[path]; !ok {
+			changes = append(changes, moduleChange{Change: "added", Path: path, To: version})
+		} else if old != version {
+			change := "upgraded"
+			if compareVersions(version, old) < 0 {
+				change = "downgraded"
+			}
+			changes = append(changes, moduleChange{Change: change, Path: path, From: old, To: version})
+		}
+	}
+	for path, version := range before {
+		if _, ok := after[path]; !ok {
+			changes = append(changes, moduleChange{Change: "removed", Path: path, From: version})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	for i := range changes {
+		changes[i].Link = reviewLink(changes[i])
+	}
+	return changes
+}
+
+var pseudoVersionMatcher = regexp.MustCompile(`\d{14}-([0-9a-f]{12})$`)
+var majorSuffixMatcher = regexp.MustCompile(`/v\d+$`)
+
+// Returns the git ref of a module version: the commit of a pseudo-version, otherwise the tag, which is prefixed
+// with the module's directory in its repository.
+func versionRef(version, subdir string) string {
+	version = strings.TrimSuffix(version, "+incompatible")
+	if m := pseudoVersionMatcher.FindStringSubmatch(version); m != nil {
+		return m[1]
+	}
+	if subdir != "" {
+		return subdir + "/" + version
+	}
+	return version
+}
+
+// Returns a link for reviewing a module change: the compare view of the two versions for a module on GitHub,
+// otherwise the module's page on pkg.go.dev at the version it changed to (or from, if it was removed).
+func reviewLink(change moduleChange) string {
+	path := majorSuffixMatcher.ReplaceAllString(change.Path, "")
+	parts := strings.Split(path, "/")
+	if parts[0] == "github.com" && len(parts) >= 3 {
+		repo := "https://github.com/" + parts[1] + "/" + parts[2]
+		subdir := strings.Join(parts[3:], "/")
+		switch {
+		case change.From != "" && change.To != "":
+			return repo + "/compare/" + versionRef(change.From, subdir) + "..." + versionRef(change.To, subdir)
+		case change.To != "":
+			return repo + "/tree/" + versionRef(change.To, subdir)
+		}
+		return repo
+	}
+	version := change.To
+	if version == "" {
+		version = change.From
+	}
+	return "https://pkg.go.dev/" + change.Path + "@" + version
+}
+
+// Returns the version of a change for display, e.g. "v1.2.0" or "-" when there isn't one.
+func changeVersion(version string) string {
+	if version == "" {
+		return "-"
+	}
+	return version
+}
+
+// Prints a report of module changes.
+func printModuleChanges(changes []moduleChange, notes ...string) {
+	r := &report{title: "Module changes", columns: []string{"Change", "Module", "From", "To", "Review"}}
+	for _, change := range changes {
+		r.add(change.Change, change.Path, changeVersion(change.From), changeVersion(change.To), change.Link)
+	}
+	r.notes = append(r.notes, notes...)
+	r.print()
+}
+
+// Recompiles only the commands that depend on a module that was added, upgraded or downgraded. Removed modules
+// don't count, since no command that still builds can depend on them.
+func rebuildAffected(changes []moduleChange) {
+	changed := map[string]bool{}
+	for _, change := range changes {
+		if change.To != "" {
+			changed[change.Path] = true
+		}
+	}
+	if len(changed) == 0 {
+		return
+	}
+	affected := []string{}
+	for filename, entry := range importIndex() {
+		//Isolated commands don't use the project go.mod
+		if !strings.HasSuffix(filename, ".go") || isIsolated(strings.TrimSuffix(filename, ".go")) {
+			continue
+		}
+		for _, mod := range entry.Modules {
+			if changed[mod] {
+				affected = append(affected, filename)
+				break
+			}
+		}
+	}
+	if len(affected) == 0 {
+		fmt.Println("No commands depend on the changed modules.")
+		return
+	}
+	sort.Strings(affected)
+	fmt.Printf("Recompiling %d affected command(s) ...\n", len(affected))
+	recompileCommands(affected, false, true)
+}
+
+// Makes a change to the project's modules, such as a go get, then prints the modules it changed and recompiles
+// the commands that depend on them.
+func rebuildAfter(change func()) {
+	before := moduleVersions()
+	change()
+	if changes := diffModules(before, moduleVersions()); len(changes) > 0 {
+		printModuleChanges(changes)
+		rebuildAffected(changes)
+	}
+}
+
+// Upgrades the modules in the project's go.mod with go get -u, records the module changes in the journal and
+// returns them, for the commands they affect to be recompiled (see --update-deps).
+func updateDeps() []moduleChange {
+	//The modules go.mod requires, as goscript adds them with go get before the commands that use them exist, so
+	//most are marked indirect. Modules replaced by a local directory have no releases to upgrade to.
+	mod := goModJSON(projectDir)
+	local := map[string]bool{}
+	for _, replace := range mod.Replace {
+		if replace.New.Version == "" {
+			local[replace.Old.Path] = true
+		}
+	}
+	required := []string{}
+	for _, req := range mod.Require {
+		if !local[req.Path] {
+			required = append(required, req.Path)
+		}
+	}
+	if len(required) == 0 {
+		fmt.Println("The project has no dependencies to update.")
+		return nil
+	}
+	before := moduleVersions()
+	out, err := goModify(projectDir, append([]string{"get", "-u"}, required...)...)
+	if err != nil {
+		check(fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out))), 2, "Unable to update the dependencies.")
+	}
+	changes := diffModules(before, moduleVersions())
+	if len(changes) == 0 {
+		fmt.Println("All dependencies are up to date.")
+		return nil
+	}
+	entry := newJournalEntry("update-deps", moduleName())
+	entry.Changes = changes
+	recordOperation(entry)
+	printModuleChanges(changes, fmt.Sprintf("Recorded in %s. Run --rollback-config to go back to the previous versions.", journalFile()))
+	return changes
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/fkmiec/goscript/engine"
+)
+
+// --describe renders a help page for a command from its frontmatter and directives, laid out like a man page, so
+// what a script does, what it needs and how to run it can be looked up instead of asked about.
+
+type helpPage struct {
+	Name        string
+	Description string
+	Synopsis    string
+	Flags       []FlagSpec
+	Env         []string
+	Bin         []string
+	OS          []string
+	Exclusive   string
+	Routes      []RouteSpec
+	Deps        []string
+	Examples    []string
+	Source      string
+}
+
+const plainHelpPage = `NAME
+    {{.Name}}{{if .Description}} - {{.Description}}{{end}}
+
+SYNOPSIS
+    {{.Synopsis}}
+{{if .Flags}}
+FLAGS
+{{range .Flags}}    -{{.Name}} {{.Type}}{{if or .Default .Required}} ({{if .Default}}default {{.Default}}{{end}}{{if and .Default .Required}}, {{end}}{{if .Required}}required{{end}}){{end}}
+{{if .Usage}}        {{.Usage}}
+{{end}}{{end}}{{end}}{{if .Env}}
+ENVIRONMENT
+{{range .Env}}    {{.}}
+{{end}}{{end}}{{if or .Bin .OS .Exclusive .Deps}}
+REQUIREMENTS
+{{if .Bin}}    Programs on the PATH: {{join .Bin}}
+{{end}}{{if .OS}}    Runs only on: {{join .OS}}
+{{end}}{{if .Exclusive}}    Runs exclusively{{if eq .Exclusive "no-wait"}}; a second run exits instead of waiting{{end}}
+{{end}}{{if .Deps}}    Modules: {{join .Deps}}
+{{end}}{{end}}{{if .Routes}}
+ROUTES
+{{range .Routes}}    {{.Method}} {{.Path}}{{if .Open}} (no token){{else}} (token in ${{.TokenEnv}}){{end}}
+{{end}}{{end}}{{if .Examples}}
+EXAMPLES
+{{range .Examples}}    {{.}}
+{{end}}{{end}}
+SOURCE
+    {{.Source}}
+`
+
+const markdownHelpPage = `## {{.Name}}
+{{if .Description}}
+{{.Description}}
+{{end}}
+` + "```" + `
+{{.Synopsis}}
+` + "```" + `
+{{if .Flags}}
+| Flag | Type | Default | Required | Usage |
+| --- | --- | --- | --- | --- |
+{{range .Flags}}| -{{.Name}} | {{.Type}} | {{.Default}} | {{if .Required}}yes{{end}} | {{.Usage}} |
+{{end}}{{end}}{{if .Env}}
+**Environment:** {{join .Env}}
+{{end}}{{if .Bin}}
+**Programs on the PATH:** {{join .Bin}}
+{{end}}{{if .OS}}
+**Runs only on:** {{join .OS}}
+{{end}}{{if .Exclusive}}
+**Runs exclusively**{{if eq .Exclusive "no-wait"}}; a second run exits instead of waiting{{end}}
+{{end}}{{if .Deps}}
+**Modules:** {{join .Deps}}
+{{end}}{{if .Routes}}
+**Routes:**{{range .Routes}} ` + "`{{.Method}} {{.Path}}`" + `{{end}}
+{{end}}{{if .Examples}}
+**Examples:**
+` + "```" + `
+{{range .Examples}}{{.}}
+{{end}}` + "```" + `
+{{end}}`
+
+// The help page of --plain: one labelled item per line, without indentation.
+const itemsHelpPage = `Name: {{.Name}}
+{{if .Description}}Description: {{.Description}}
+{{end}}Synopsis: {{.Synopsis}}
+{{range .Flags}}Flag: -{{.Name}}, {{.Type}}{{if .Default}}, default {{.Default}}{{end}}{{if .Required}}, required{{end}}{{if .Usage}}. {{.Usage}}{{end}}
+{{end}}{{range .Env}}Environment variable: {{.}}
+{{end}}{{if .Bin}}Programs on the PATH: {{join .Bin}}
+{{end}}{{if .OS}}Runs only on: {{join .OS}}
+{{end}}{{if .Exclusive}}Runs exclusively{{if eq .Exclusive "no-wait"}}; a second run exits instead of waiting{{end}}
+{{end}}{{if .Deps}}Modules: {{join .Deps}}
+{{end}}{{range .Routes}}Route: {{.Method}} {{.Path}}{{if .Open}}, no token{{else}}, token in {{.TokenEnv}}{{end}}
+{{end}}{{range .Examples}}Example: {{.}}
+{{end}}Source: {{.Source}}
+`
+
+// Returns the synopsis line for a command: required flags first, then the optional ones in brackets.
+func synopsis(name string, flags []FlagSpec) string {
+	parts := []string{name}
+	optional := []string{}
+	for _, flag := range flags {
+		usage := "-" + flag.Name
+		if flag.Type != "bool" {
+			usage += " <" + flag.Type + ">"
+		}
+		if flag.Required {
+			parts = append(parts, usage)
+		} else {
+			optional = append(optional, "["+usage+"]")
+		}
+	}
+	parts = append(parts, optional...)
+	return strings.Join(append(parts, "[args...]"), " ")
+}
+
+// Builds the help page of a command in the project.
+func commandHelpPage(cmd string) helpPage {
+	srcFilename := sourceFile(cmd)
+	meta := engine.ReadMetadata(srcFilename)
+	description := describeScripts([]string{srcFilename})[srcFilename]
+	return helpPage{
+		Name:        cmd,
+		Description: description,
+		Synopsis:    synopsis(cmd, meta.Flags),
+		Flags:       meta.Flags,
+		Env:         meta.RequiresEnv,
+		Bin:         meta.RequiresBin,
+		OS:          meta.OS,
+		Exclusive:   meta.Exclusive,
+		Routes:      meta.Routes,
+		Deps:        meta.Deps,
+		Examples:    meta.Examples,
+		Source:      srcFilename,
+	}
+}
+
+// Prints help pages in the output format (see --format).
+func printHelpPages(pages []helpPage) {
+	layout := plainHelpPage
+	switch {
+	case plainOutput:
+		layout = itemsHelpPage
+	case outputFormat == "markdown":
+		layout = markdownHelpPage
+	case outputFormat == "slack":
+		layout = "```\n" + plainHelpPage + "```\n" //mrkdwn has no tables, so the page is kept as it is
+	}
+	tmpl := template.Must(template.New("help").Funcs(template.FuncMap{
+		"join": func(items []string) string { return strings.Join(items, ", ") },
+	}).Parse(layout))
+	for i, page := range pages {
+		if i > 0 {
+			fmt.Println()
+		}
+		check(tmpl.Execute(os.Stdout, page), 2, "")
+	}
+}
+
+// Prints the help page of the named command.
+func describeCommand(cmd string) {
+	if !checkFileExists(sourceFile(cmd)) {
+		check(fmt.Errorf("no command named %s", cmd), 2, "")
+	}
+	printHelpPages([]helpPage{commandHelpPage(cmd)})
+}
+
+// Prints the help page of every command in the project.
+func describeAll() {
+	pages := []helpPage{}
+	for _, filename := range getSourceList() {
+		if cmd, ok := strings.CutSuffix(filename, ".go"); ok {
+			pages = append(pages, commandHelpPage(cmd))
+		}
+	}
+	if len(pages) == 0 {
+		fmt.Println("No commands in the project.")
+		return
+	}
+	printHelpPages(pages)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/scanner"
+	"io/fs"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Errors saved with check(err, 0, ...) are not fatal. They are collected here and printed as a summary
+// before goscript exits. The collector is safe for concurrent use, so builds can run in parallel.
+
+type diagnostic struct {
+	category string
+	msg      string
+}
+
+type diagnostics struct {
+	mu      sync.Mutex
+	entries []diagnostic
+}
+
+var savedErrors = &diagnostics{}
+
+func (d *diagnostics) add(category, msg string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.entries = append(d.entries, diagnostic{category: category, msg: msg})
+}
+
+// Prints the saved errors with a count per category, then clears them.
+func (d *diagnostics) flush() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.entries) == 0 {
+		return
+	}
+	counts := map[string]int{}
+	for _, entry := range d.entries {
+		counts[entry.category]++
+	}
+	categories := []string{}
+	for category, n := range counts {
+		categories = append(categories, fmt.Sprintf("%s: %d", category, n))
+	}
+	sort.Strings(categories)
+	fmt.Fprintf(os.Stderr, "\n%d problem(s) (%s):\n", len(d.entries), strings.Join(categories, ", "))
+	for _, entry := range d.entries {
+		msg := strings.ReplaceAll(strings.TrimSpace(entry.msg), "\n", "\n    ")
+		fmt.Fprintf(os.Stderr, "  [%s] %s\n", entry.category, msg)
+	}
+	d.entries = nil
+}
+
+// Classifies an error for the summary.
+func errorCategory(e error) string {
+	var exitErr *exec.ExitError
+	var pathErr *fs.PathError
+	var syntaxErr *json.SyntaxError
+	var scanErrs scanner.ErrorList
+	switch {
+	case errors.As(e, &exitErr):
+		return "command"
+	case errors.As(e, &pathErr):
+		return "file"
+	case errors.As(e, &syntaxErr):
+		return "json"
+	case errors.As(e, &scanErrs):
+		return "syntax"
+	}
+	return "other"
+}
+
+// Prints any saved errors and exits with the given status code. Locks are released first, since os.Exit
+// doesn't run the deferred functions that would release them. A daemon worker sends the status to its client.
+func exitProgram(code int) {
+	savedErrors.flush()
+	releaseLocks()
+	answerDaemonClient(code)
+	os.Exit(code)
+}
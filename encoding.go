@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Go strings are UTF-8, so a script given latin-1 or UTF-16 text, such as an old log file or a Windows export,
+// mangles any character outside ASCII. --encoding <name> transcodes the script's standard input to UTF-8 as it
+// is read, a buffer at a time, so input of any size streams through. --encoding locale uses the character set of
+// the locale (LC_ALL, LC_CTYPE or LANG, e.g. de_DE.ISO-8859-1) if it isn't UTF-8; input is never transcoded unless
+// asked, since a locale is often set for other reasons than the files at hand. With utf-8, input is checked
+// instead: invalid bytes are replaced with U+FFFD and counted in a warning, rather than passed on silently.
+
+// Set by --encoding.
+var inputEncoding string
+
+// The names --encoding accepts, and the encodings they stand for.
+var encodingNames = map[string]string{
+	"utf-8":        "utf-8",
+	"utf8":         "utf-8",
+	"latin-1":      "latin-1",
+	"latin1":       "latin-1",
+	"iso-8859-1":   "latin-1",
+	"iso8859-1":    "latin-1",
+	"windows-1252": "windows-1252",
+	"cp1252":       "windows-1252",
+	"utf-16":       "utf-16",
+	"utf16":        "utf-16",
+	"utf-16le":     "utf-16le",
+	"utf-16be":     "utf-16be",
+}
+
+// The characters windows-1252 has in place of the C1 control codes 0x80-0x9F of latin-1. Unassigned codes are 0.
+var windows1252 = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+// Returns the encoding of an --encoding name, or locale, or an error listing the ones there are.
+func parseEncoding(name string) (string, error) {
+	if encoding, ok := encodingNames[strings.ToLower(name)]; ok {
+		return encoding, nil
+	}
+	if strings.ToLower(name) == "locale" {
+		return "locale", nil
+	}
+	return "", fmt.Errorf("unknown encoding %q (available: utf-8, latin-1, windows-1252, utf-16, utf-16le, utf-16be, locale)", name)
+}
+
+// Returns the encoding of the locale's character set, or "" if it is UTF-8, unset or not one --encoding knows.
+func localeEncoding() string {
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		_, charset, _ := strings.Cut(value, ".")
+		charset, _, _ = strings.Cut(charset, "@")
+		if encoding, ok := encodingNames[strings.ToLower(charset)]; ok && encoding != "utf-8" {
+			return encoding
+		}
+		return ""
+	}
+	return ""
+}
+
+// Copies src to dst, decoding it from the encoding to UTF-8. Returns the number of invalid sequences replaced
+// with U+FFFD.
+func transcode(dst io.Writer, src io.Reader, encoding string) (int, error) {
+	in := bufio.NewReaderSize(src, 64*1024)
+	out := bufio.NewWriterSize(dst, 64*1024)
+	invalid := 0
+	bigEndian := encoding == "utf-16be" || encoding == "utf-16" //UTF-16 without a byte order mark is big-endian
+	if encoding == "utf-16" {
+		if bom, err := in.Peek(2); err == nil && (bom[0] == 0xFF && bom[1] == 0xFE || bom[0] == 0xFE && bom[1] == 0xFF) {
+			bigEndian = bom[0] == 0xFE
+			in.Discard(2)
+		}
+	}
+	readUnit := func() (rune, error) {
+		var b [2]byte
+		if _, err := io.ReadFull(in, b[:]); err != nil {
+			return 0, err
+		}
+		if bigEndian {
+			return rune(b[0])<<8 | rune(b[1]), nil
+		}
+		return rune(b[1])<<8 | rune(b[0]), nil
+	}
+
+	var err error
+	for err == nil {
+		//What has been decoded is passed on before waiting for more input, so a stream (e.g. tail -f) isn't held up
+		if in.Buffered() == 0 {
+			err = out.Flush()
+		}
+		var r rune
+		switch encoding {
+		case "latin-1", "windows-1252":
+			var b byte
+			if b, err = in.ReadByte(); err != nil {
+				break
+			}
+			r = rune(b)
+			if encoding == "windows-1252" && b >= 0x80 && b < 0xA0 {
+				if r = windows1252[b-0x80]; r == 0 {
+					r, invalid = utf8.RuneError, invalid+1
+				}
+			}
+		case "utf-16", "utf-16le", "utf-16be":
+			if r, err = readUnit(); err != nil {
+				break
+			}
+			if utf16.IsSurrogate(r) {
+				var low rune
+				if low, err = readUnit(); err != nil {
+					r, err = utf8.RuneError, nil
+				} else {
+					r = utf16.DecodeRune(r, low)
+				}
+			}
+			if r == utf8.RuneError {
+				invalid++
+			}
+		default: //utf-8
+			var size int
+			if r, size, err = in.ReadRune(); err == nil && r == utf8.RuneError && size == 1 {
+				invalid++
+			}
+		}
+		if err == nil {
+			_, err = out.WriteRune(r)
+		}
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		if errors.Is(err, io.ErrUnexpectedEOF) { //an odd byte at the end of UTF-16
+			out.WriteRune(utf8.RuneError)
+			invalid++
+		}
+		err = nil
+	}
+	if flushErr := out.Flush(); err == nil {
+		err = flushErr
+	}
+	return invalid, err
+}
+
+// Returns the encoding the script's standard input is in: the one given with --encoding, or with locale, the
+// locale's. Returns "" if the input needs no transcoding.
+func stdinEncoding() string {
+	if inputEncoding == "locale" {
+		return localeEncoding()
+	}
+	return inputEncoding
+}
+
+// Returns a pipe a script reads its standard input from, fed with goscript's standard input transcoded to UTF-8.
+// The read end is the script's to close.
+func transcodedStdin(encoding string) (*os.File, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer w.Close()
+		invalid, err := transcode(w, os.Stdin, encoding)
+		if invalid > 0 {
+			fmt.Fprintf(os.Stderr, "warning: %d invalid %s sequence(s) in the input were replaced with U+FFFD\n", invalid, encoding)
+		}
+		if err != nil && !errors.Is(err, syscall.EPIPE) {
+			fmt.Fprintf(os.Stderr, "warning: reading input: %v\n", err)
+		}
+	}()
+	return r, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestTranscode(t *testing.T) {
+	tests := []struct {
+		encoding, in, want string
+		invalid            int
+	}{
+		{"latin-1", "caf\xe9 cr\xe8me", "café crème", 0},
+		{"windows-1252", "\x93quoted\x94 \x80 \x81", "“quoted” € �", 1},
+		{"utf-16", "\xff\xfec\x00a\x00f\x00\xe9\x00", "café", 0},
+		{"utf-16", "\x00c\x00a\x00f\x00\xe9", "café", 0},
+		{"utf-16le", "=\xd8\x0d\xdc!\x00", "\U0001f40d!", 0},
+		{"utf-16be", "\x00a\x00", "a�", 1},
+		{"utf-8", "café \xff", "café �", 1},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		invalid, err := transcode(&out, strings.NewReader(tt.in), tt.encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != tt.want || invalid != tt.invalid {
+			t.Errorf("transcode(%q, %s) = %q with %d invalid, want %q with %d", tt.in, tt.encoding, out.String(), invalid, tt.want, tt.invalid)
+		}
+	}
+}
+
+// The locale's character set is only used when asked for with --encoding locale.
+func TestStdinEncoding(t *testing.T) {
+	t.Setenv("LC_ALL", "")
+	t.Setenv("LC_CTYPE", "")
+	t.Setenv("LANG", "de_DE.ISO-8859-1")
+	defer func(encoding string) { inputEncoding = encoding }(inputEncoding)
+	tests := []struct {
+		option, want string
+	}{
+		{"", ""},
+		{"locale", "latin-1"},
+		{"utf-16le", "utf-16le"},
+	}
+	for _, tt := range tests {
+		inputEncoding = ""
+		if tt.option != "" {
+			encoding, err := parseEncoding(tt.option)
+			if err != nil {
+				t.Fatal(err)
+			}
+			inputEncoding = encoding
+		}
+		if got := stdinEncoding(); got != tt.want {
+			t.Errorf("stdinEncoding() with --encoding %q = %q, want %q", tt.option, got, tt.want)
+		}
+	}
+	t.Setenv("LANG", "de_DE.UTF-8")
+	inputEncoding = "locale"
+	if got := stdinEncoding(); got != "" {
+		t.Errorf("stdinEncoding() with --encoding locale in a UTF-8 locale = %q, want none", got)
+	}
+}
@@ -0,0 +1,225 @@
+package engine
+
+// Templates available in every project, selected with --template <name>. A project overrides one with a template
+// of the same name in its templates directory.
+var BuiltinTemplates = map[string]string{
+	"cli":         cliTemplate,
+	"http-server": httpServerTemplate,
+	"json-filter": jsonFilterTemplate,
+	"lines":       linesTemplate,
+	"csv":         csvTemplate,
+	"cron":        cronTemplate,
+}
+
+const cliTemplate = `{{/* A command-line tool with usage help. Code that declares flags calls flag.Parse itself; otherwise it is called for the code. */ -}}
+package main
+
+import ( {{range .Imports}}
+	{{.}}{{ end }}
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [args]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	{{- if not .Uses.Flags}}
+	flag.Parse()
+	{{- end}}
+	{{.Code}}
+}
+`
+
+const httpServerTemplate = `{{/* An HTTP server on $PORT (8080 by default). The code adds handlers to mux. */ -}}
+package main
+
+import ( {{range .Imports}}
+	{{.}}{{ end }}
+	"log"
+	"net/http"
+	"os"
+)
+
+func main() {
+	addr := ":8080"
+	if port := os.Getenv("PORT"); port != "" {
+		addr = ":" + port
+	}
+	mux := http.NewServeMux()
+	{{.Code}}
+	log.Printf("listening on %s", addr)
+	log.Fatal(http.ListenAndServe(addr, mux))
+}
+`
+
+const jsonFilterTemplate = `{{/* Reads JSON values from stdin and writes them to stdout. The code changes v, or sets it to nil to drop it. */ -}}
+package main
+
+import ( {{range .Imports}}
+	{{.}}{{ end }}
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+func main() {
+	dec := json.NewDecoder(os.Stdin)
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	for {
+		var v any
+		if err := dec.Decode(&v); err == io.EOF {
+			break
+		} else if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		func() {
+			{{.Code}}
+		}()
+		if v != nil {
+			enc.Encode(v)
+		}
+	}
+}
+`
+
+const linesTemplate = `{{/* Runs the code for each line of stdin: line, its number n and, if the code uses them, its fields. The code changes line, or sets drop to leave it out. */ -}}
+package main
+
+import ( {{range .Imports}}
+	{{.}}{{ end }}
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+func main() {
+	//Lines are read and written through buffers of GOSCRIPT_BUFFER_SIZE bytes, which is also the longest line
+	size := 64 * 1024
+	if s, err := strconv.Atoi(os.Getenv("GOSCRIPT_BUFFER_SIZE")); err == nil && s > 0 {
+		size = s
+	}
+	in := bufio.NewReaderSize(os.Stdin, size)
+	out := bufio.NewWriterSize(os.Stdout, size)
+	defer out.Flush()
+	for n := 1; ; n++ {
+		//Output is passed on before waiting for more input, so a slow stream isn't held up
+		if in.Buffered() == 0 {
+			out.Flush()
+		}
+		data, err := in.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			out.Flush()
+			fmt.Fprintf(os.Stderr, "line %d is longer than %d bytes; set GOSCRIPT_BUFFER_SIZE to allow longer lines\n", n, size)
+			os.Exit(1)
+		} else if err != nil && err != io.EOF {
+			out.Flush()
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		} else if len(data) == 0 {
+			break
+		}
+		line := strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r")
+		{{- if contains "fields" .Code}}
+		//Fields are separated by spaces and tabs, as in awk, so a no-break space (a thousands separator in some
+		//locales) doesn't split one
+		fields := strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == '\t' })
+		_ = fields
+		{{- end}}
+		drop := false
+		{{- if .Uses.Stdout}}
+		out.Flush() //the code writes to stdout itself
+		{{- end}}
+		func() {
+			{{.Code}}
+		}()
+		if !drop {
+			out.WriteString(line)
+			out.WriteByte('\n')
+		}
+	}
+}
+`
+
+const csvTemplate = `{{/* Runs the code for each record of CSV on stdin, in record, with its number in n. The code changes record, or sets it to nil to drop it. */ -}}
+package main
+
+import ( {{range .Imports}}
+	{{.}}{{ end }}
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+func main() {
+	//Records are read and written through buffers of GOSCRIPT_BUFFER_SIZE bytes
+	size := 64 * 1024
+	if s, err := strconv.Atoi(os.Getenv("GOSCRIPT_BUFFER_SIZE")); err == nil && s > 0 {
+		size = s
+	}
+	in := bufio.NewReaderSize(os.Stdin, size)
+	out := bufio.NewWriterSize(os.Stdout, size)
+	r := csv.NewReader(in)
+	r.FieldsPerRecord = -1
+	w := csv.NewWriter(out)
+	defer out.Flush()
+	defer w.Flush()
+	for n := 1; ; n++ {
+		//Output is passed on before waiting for more input, so a slow stream isn't held up
+		if in.Buffered() == 0 {
+			w.Flush()
+			out.Flush()
+		}
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			w.Flush()
+			out.Flush()
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		{{- if .Uses.Stdout}}
+		w.Flush()
+		out.Flush() //the code writes to stdout itself
+		{{- end}}
+		func() {
+			{{.Code}}
+		}()
+		if record != nil {
+			w.Write(record)
+		}
+	}
+}
+`
+
+const cronTemplate = `{{/* A scheduled job that logs when it starts and how long it took, e.g. for the schedules of --serve. */ -}}
+package main
+
+import ( {{range .Imports}}
+	{{.}}{{ end }}
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+func main() {
+	log.SetPrefix(filepath.Base(os.Args[0]) + ": ")
+	start := time.Now()
+	log.Print("started")
+	defer func() { log.Printf("finished in %v", time.Since(start).Round(time.Millisecond)) }()
+	{{.Code}}
+}
+`
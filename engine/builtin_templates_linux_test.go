@@ -0,0 +1,154 @@
+package engine
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// Reads at most 64 KiB at a time, after a pause, like a consumer downstream that is slower than the script.
+type slowReader struct {
+	r     io.Reader
+	delay time.Duration
+}
+
+func (s slowReader) Read(p []byte) (int, error) {
+	time.Sleep(s.delay)
+	return s.r.Read(p[:min(len(p), 64*1024)])
+}
+
+// Streams input much larger than the template's buffers through the lines and csv templates to a slow reader,
+// and checks that every line or record, and every character of it, comes out as the code left it, in order,
+// while the script's memory stays bounded. Maximum resident set sizes are only reported in KiB on Linux.
+func TestStreamingTemplates(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds scripts and streams 128 MiB through each")
+	}
+	const inputSize = 128 << 20
+	const maxRSS = 32 << 20
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module scripts\n\ngo 1.22\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	e, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, template, code string
+		env                  []string
+		input                func(n int) string
+		output               func(n int) (string, bool) //the line or record the input n becomes, or false if dropped
+	}{
+		{
+			"lines", "lines",
+			"if n%3 == 0 {\n\tdrop = true\n} else {\n\tline = strings.ToUpper(line)\n}",
+			nil,
+			func(n int) string { return fmt.Sprintf("line %d of the input\n", n) },
+			func(n int) (string, bool) { return fmt.Sprintf("LINE %d OF THE INPUT\n", n), n%3 != 0 },
+		},
+		{
+			"fields", "lines",
+			"line = strings.Join(fields, \"|\")",
+			nil,
+			func(n int) string { return fmt.Sprintf("%d café\u00a0crème\t  naïve 👍🏽\n", n) },
+			func(n int) (string, bool) { return fmt.Sprintf("%d|café\u00a0crème|naïve|👍🏽\n", n), true },
+		},
+		{
+			"csv", "csv",
+			"if n%3 == 0 {\n\trecord = nil\n} else {\n\trecord[1] = strings.ToUpper(record[1])\n}",
+			[]string{"GOSCRIPT_BUFFER_SIZE=4096"},
+			func(n int) string { return fmt.Sprintf("%d,\"a field, with a comma\",\"and \"\"quotes\"\"\"\n", n) },
+			func(n int) (string, bool) {
+				return fmt.Sprintf("%d,\"A FIELD, WITH A COMMA\",\"and \"\"quotes\"\"\"\n", n), n%3 != 0
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := e.Wrap("//---\n//template: " + tt.template + "\n//---\n" + tt.code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			srcFilename := e.Project.SourceFile(tt.name)
+			if err := os.WriteFile(srcFilename, src, 0644); err != nil {
+				t.Fatal(err)
+			}
+			binFilename := filepath.Join(dir, tt.name)
+			if out, err := e.BuildFile(srcFilename, binFilename); err != nil {
+				t.Fatalf("%v: %s", err, out)
+			}
+
+			cmd := exec.Command(binFilename)
+			cmd.Env = append(os.Environ(), tt.env...)
+			cmd.Stderr = os.Stderr
+			stdin, err := cmd.StdinPipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			stdout, err := cmd.StdoutPipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+			written := make(chan int, 1)
+			go func() {
+				w := bufio.NewWriter(stdin)
+				n, size := 0, 0
+				for size < inputSize {
+					n++
+					text, _ := w.WriteString(tt.input(n))
+					size += text
+				}
+				w.Flush()
+				stdin.Close()
+				written <- n
+			}()
+
+			out := bufio.NewReaderSize(slowReader{stdout, 500 * time.Microsecond}, 64*1024)
+			next := 1
+			for {
+				line, err := out.ReadString('\n')
+				if err == io.EOF && line == "" {
+					break
+				} else if err != nil && err != io.EOF {
+					t.Fatal(err)
+				}
+				want, kept := tt.output(next)
+				for !kept {
+					next++
+					want, kept = tt.output(next)
+				}
+				if line != want {
+					t.Fatalf("output for input %d = %q, want %q", next, line, want)
+				}
+				next++
+			}
+			if err := cmd.Wait(); err != nil {
+				t.Fatal(err)
+			}
+			//The output may only end early by inputs that were dropped
+			for n := <-written; next <= n; next++ {
+				if _, kept := tt.output(next); kept {
+					t.Fatalf("output ended at input %d of %d", next, n)
+				}
+			}
+			if rss := cmd.ProcessState.SysUsage().(*syscall.Rusage).Maxrss * 1024; rss > maxRSS {
+				t.Errorf("the script used %d MiB of memory for %d MiB of input, want at most %d MiB", rss>>20, inputSize>>20, maxRSS>>20)
+			}
+		})
+	}
+}
@@ -0,0 +1,337 @@
+// Package engine is the core of goscript: turning a main function body into a Go program, and building and
+// running the commands of a goscript project. It lets other tools compile and run goscripts the way the
+// goscript command does:
+//
+//	e, err := engine.New(os.Getenv("GOSCRIPT_PROJECT_DIR"))
+//	if err != nil {
+//		return err
+//	}
+//	if err := e.Save("hello", `fmt.Println(strings.ToUpper("hello"))`); err != nil {
+//		return err
+//	}
+//	if out, err := e.Build("hello"); err != nil {
+//		return fmt.Errorf("%v: %s", err, out)
+//	}
+//	return e.Command(ctx, "hello").Run()
+//
+// The goscript command adds its own steps to Wrap with WrapHooks, such as --with preludes, --must, the recovery
+// of panics, printing a bare expression and imports resolved by subpackage expansions, and its own bookkeeping of
+// versions and the import index around the others.
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/fkmiec/goscript/util"
+)
+
+// Builds and runs the commands of a project.
+type Engine struct {
+	Project Project
+	Go      string            //The go executable. Blank for the go on the PATH.
+	Env     []string          //The environment of go commands. Nil for the environment of the process.
+	Imports map[string]string //Package names and the import paths they are inferred as (e.g. "re": "regexp")
+	// Build flags for every build, merged with the flags in a script's frontmatter (see MergeBuildFlags).
+	BuildFlags []string
+	Trace      io.Writer //If set, each go command is written to it as it is created.
+	Hooks      WrapHooks //Steps added to Wrap
+}
+
+var goGetMatcher = regexp.MustCompile(`go get (.+)`)
+
+// Returns an engine for the project in dir, which must have a go.mod and a src directory. The project's
+// imports.json mappings are added to the built-in ones.
+func New(dir string) (*Engine, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, required := range []string{"go.mod", "src"} {
+		if !fileExists(filepath.Join(dir, required)) {
+			return nil, fmt.Errorf("%s is not a goscript project: %s not found", dir, required)
+		}
+	}
+	e := &Engine{Project: Project{Dir: dir}, Imports: maps.Clone(util.ImportsMap)}
+	if data, err := os.ReadFile(dir + "/imports.json"); err == nil {
+		userImports := map[string]string{}
+		if err := json.Unmarshal(data, &userImports); err != nil {
+			return nil, fmt.Errorf("invalid %s/imports.json: %v", dir, err)
+		}
+		maps.Copy(e.Imports, userImports)
+	}
+	return e, nil
+}
+
+// Does the slow parts of a first Wrap ahead of time: fixes the imports of a small program, for goimports to load
+// what it needs, and parses the project's templates. For a process started before it has code to wrap, such as a
+// goscript daemon worker.
+func (e *Engine) Warm() {
+	e.FixImports([]byte("package main\n\nfunc main() {\n\tfmt.Println(strings.ToUpper(\"\"))\n}\n"))
+	e.Project.ParseTemplates()
+}
+
+// Creates an exec.Cmd for the go tool that runs in the given directory.
+func (e *Engine) GoCommand(dir string, args ...string) *exec.Cmd {
+	goBin := e.Go
+	if goBin == "" {
+		goBin = "go"
+	}
+	cmd := exec.Command(goBin, args...)
+	cmd.Dir = dir
+	cmd.Env = e.Env
+	if e.Trace != nil {
+		fmt.Fprintf(e.Trace, "+ (in %s) go %s\n", dir, strings.Join(args, " "))
+	}
+	return cmd
+}
+
+// Steps a caller adds to Wrap, each optional, in the order Wrap runs them. The goscript command adds its --with
+// preludes, --must, the recovery of panics, printing a bare expression and its template fallback with them.
+type WrapHooks struct {
+	// Rewrites the main function body before the packages it uses are found, e.g. to add code in front of it.
+	Rewrite func(code string) string
+	// Returns the import paths, keyed by name, of packages the code uses that Imports has no path for.
+	Resolve func(names []string) map[string]string
+	// Returns source to add after the template's, such as helper functions the code calls, and the packages it
+	// uses, keyed by name.
+	Helpers func(code string) (string, map[string]string)
+	// Rewrites the body once its imports are known, formatted as for the template, and returns the packages the
+	// new code uses, keyed by name.
+	Finish func(code string, imports []string) (string, map[string]string)
+	// Executes the template named in the frontmatter (blank for script.tmpl) with the script, in place of
+	// Project.RenderTemplate.
+	Render func(name string, script Script) ([]byte, error)
+}
+
+// Returned by Wrap for a program it generated that may not build cleanly: one with imports dropped because they
+// clash with others, or one that couldn't be formatted, usually for a syntax error in the code. Source is the
+// program as generated, which can still be built to have go build report the errors in detail.
+type WrapError struct {
+	Source  []byte
+	Dropped []string //The imports dropped, each with the one it clashes with
+	Format  error    //Why the source couldn't be formatted, if it couldn't
+}
+
+func (e *WrapError) Error() string {
+	msgs := slices.Clone(e.Dropped)
+	if e.Format != nil {
+		msgs = append(msgs, e.Format.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// Turns a main function body into the source of a program with the project template. Imports written at the top
+// of the code are kept, the packages the code refers to by a name in Imports are imported, and the imports are
+// then fixed as goimports would (see FixImports). Frontmatter is kept at the top of the program, followed by the
+// comment at the top of the code (see SplitLeadingComment), and a template the frontmatter names is used in place
+// of script.tmpl. The steps in Hooks are run along the way. A *WrapError is returned for a
+// program that may not build.
+func (e *Engine) Wrap(code string) ([]byte, error) {
+	front, code := SplitFrontmatter(code)
+	comment, code := SplitLeadingComment(code)
+	explicit, code := SplitImports(code)
+	imports := []string{}
+	paths := map[string]bool{}
+	names := map[string]bool{}
+	for _, spec := range explicit {
+		imports = append(imports, spec.String())
+		paths[spec.Path] = true
+		names[spec.LocalName()] = true
+	}
+	//A package imported by the code keeps its name. One inferred for two names (e.g. bar and v1 for .../bar/v1)
+	//is imported as both.
+	addImports := func(byName map[string]string) {
+		for _, name := range sortedKeys(byName) {
+			if path := byName[name]; !paths[path] && !names[name] {
+				imports = append(imports, NamedImport(name, path).String())
+				names[name] = true
+			}
+		}
+	}
+	if e.Hooks.Rewrite != nil {
+		code = e.Hooks.Rewrite(code)
+	}
+
+	unresolved := []string{}
+	for _, name := range PackageSelectors(code) {
+		if path := e.Imports[name]; path != "" && !util.IsExpansion(path) {
+			addImports(map[string]string{name: path})
+		} else {
+			unresolved = append(unresolved, name)
+		}
+	}
+	if e.Hooks.Resolve != nil && len(unresolved) > 0 {
+		addImports(e.Hooks.Resolve(unresolved))
+	}
+	helpers := ""
+	if e.Hooks.Helpers != nil {
+		var helperImports map[string]string
+		helpers, helperImports = e.Hooks.Helpers(code)
+		addImports(helperImports)
+	}
+	if e.Hooks.Finish != nil {
+		var finishImports map[string]string
+		code, finishImports = e.Hooks.Finish(code, imports)
+		addImports(finishImports)
+	}
+
+	script := Script{Imports: imports, Code: code, Uses: DetectFeatures(code)}
+	render := e.Project.RenderTemplate
+	if e.Hooks.Render != nil {
+		render = e.Hooks.Render
+	}
+	src, err := render(ParseMetadata(front).Template, script)
+	if err != nil {
+		return nil, err
+	}
+	src = append(src, helpers...)
+	//The template may import packages the code also imports
+	src, dropped := MergeImports(e.FixImports(src))
+	src = append([]byte(comment), src...)
+	if front != "" {
+		src = append([]byte(front+"\n"), src...)
+	}
+	formatted, err := format.Source(src)
+	if err != nil || len(dropped) > 0 {
+		if err == nil {
+			src = formatted
+		}
+		return nil, &WrapError{Source: src, Dropped: dropped, Format: err}
+	}
+	return formatted, nil
+}
+
+// Wraps the code (see Wrap) and saves it as the source of the named command, src/<name>.go, or main.go of a
+// directory command.
+func (e *Engine) Save(name, code string) error {
+	src, err := e.Wrap(code)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(e.Project.SourceFile(name), src, 0644)
+}
+
+// Builds a source file of the project into a binary, in the module it belongs to, with the build flags in its
+// frontmatter. The environment of go build is extended with env. Returns the output of go build.
+func (e *Engine) BuildFile(srcFilename, binFilename string, env ...string) ([]byte, error) {
+	meta := ReadMetadata(srcFilename)
+	//An isolated command is built in its own module, which resolves relative paths from its directory.
+	//A directory command is built as a package, so its helper files are included.
+	absBinFilename, err := filepath.Abs(binFilename)
+	if err != nil {
+		return nil, err
+	}
+	absSrcFilename, err := filepath.Abs(srcFilename)
+	if err != nil {
+		return nil, err
+	}
+	args := append([]string{"build"}, MergeBuildFlags(e.BuildFlags, meta.BuildFlags)...)
+	args = append(args, "-o", absBinFilename, e.Project.BuildTarget(absSrcFilename))
+	cmd := e.GoCommand(e.Project.ModuleDir(srcFilename), args...)
+	if len(env) > 0 {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(cmd.Env, env...)
+	}
+	return cmd.CombinedOutput()
+}
+
+// Combines lists of go build flags, given as -name or -name=value, into one. go build uses only the last -ldflags
+// and -tags, so those of every list are joined into one of each: the linker flags in order, so a later -X wins,
+// and the tags without repeats. The other flags are kept in order, without repeats.
+func MergeBuildFlags(lists ...[]string) []string {
+	merged, ldflags, tags := []string{}, []string{}, []string{}
+	seen := map[string]bool{}
+	for _, list := range lists {
+		for _, flag := range list {
+			if value, ok := strings.CutPrefix(flag, "-ldflags="); ok {
+				if value = strings.Trim(value, `"'`); value != "" {
+					ldflags = append(ldflags, value)
+				}
+			} else if value, ok := strings.CutPrefix(flag, "-tags="); ok {
+				for _, tag := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' }) {
+					if !slices.Contains(tags, tag) {
+						tags = append(tags, tag)
+					}
+				}
+			} else if !seen[flag] {
+				seen[flag] = true
+				merged = append(merged, flag)
+			}
+		}
+	}
+	if len(ldflags) > 0 {
+		merged = append(merged, "-ldflags="+strings.Join(ldflags, " "))
+	}
+	if len(tags) > 0 {
+		merged = append(merged, "-tags="+strings.Join(tags, ","))
+	}
+	return merged
+}
+
+// Runs go vet on a script, with the build tags in its frontmatter, and returns its findings. The error is
+// non-nil if there were findings or go vet couldn't run.
+func (e *Engine) VetFile(srcFilename string, env ...string) ([]byte, error) {
+	absSrcFilename, err := filepath.Abs(srcFilename)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"vet"}
+	for _, flag := range MergeBuildFlags(e.BuildFlags, ReadMetadata(srcFilename).BuildFlags) {
+		if strings.HasPrefix(flag, "-tags=") {
+			args = append(args, flag) //go vet takes only the build flags that choose the files of a package
+		}
+	}
+	args = append(args, e.Project.BuildTarget(absSrcFilename))
+	cmd := e.GoCommand(e.Project.ModuleDir(srcFilename), args...)
+	if len(env) > 0 {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(cmd.Env, env...)
+	}
+	return cmd.CombinedOutput()
+}
+
+// Builds the named command into the project's bin directory. Packages that go build reports missing are added
+// with go get, as are the dependencies in the command's frontmatter. Returns the output of go build.
+func (e *Engine) Build(name string) ([]byte, error) {
+	srcFilename := e.Project.SourceFile(name)
+	dir := e.Project.ModuleDir(srcFilename)
+	for _, dep := range ReadMetadata(srcFilename).Deps {
+		if out, err := e.GoCommand(dir, "get", dep).CombinedOutput(); err != nil {
+			return out, err
+		}
+	}
+	out, err := e.BuildFile(srcFilename, e.Project.BinaryFile(name))
+	if err == nil {
+		return out, nil
+	}
+	matches := goGetMatcher.FindAllSubmatch(out, -1)
+	if len(matches) == 0 {
+		return out, err
+	}
+	for _, m := range matches {
+		if out, err := e.GoCommand(dir, "get", strings.TrimSpace(string(m[1]))).CombinedOutput(); err != nil {
+			return out, err
+		}
+	}
+	return e.BuildFile(srcFilename, e.Project.BinaryFile(name))
+}
+
+// Creates an exec.Cmd that runs the named command's binary with the arguments.
+func (e *Engine) Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, e.Project.BinaryFile(name), args...)
+}
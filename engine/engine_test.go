@@ -0,0 +1,166 @@
+package engine
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Returns an engine for a new project in a temporary directory, with the default template.
+func testEngine(t *testing.T) *Engine {
+	t.Helper()
+	dir := t.TempDir()
+	for filename, text := range map[string]string{"go.mod": "module scripts\n\ngo 1.22\n", "script.tmpl": DefaultTemplate} {
+		if err := os.WriteFile(filepath.Join(dir, filename), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "src"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	e, err := New(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		name, code string
+		hooks      WrapHooks
+		want       string
+	}{
+		{
+			"infers imports",
+			`fmt.Println(strings.ToUpper("a"))`,
+			WrapHooks{},
+			"package main\n\nimport (\n\t\"fmt\"\n\t\"strings\"\n)\n\nfunc main() {\n\tfmt.Println(strings.ToUpper(\"a\"))\n}\n",
+		},
+		{
+			"names an import by its mapping",
+			`println(re.MustCompile("a+").String())`,
+			WrapHooks{},
+			"package main\n\nimport (\n\tre \"regexp\"\n)\n\nfunc main() {\n\tprintln(re.MustCompile(\"a+\").String())\n}\n",
+		},
+		{
+			"keeps imports written in the code",
+			"import r \"regexp\"\n\nprintln(r.MustCompile(\"a\").String())",
+			WrapHooks{},
+			"package main\n\nimport (\n\tr \"regexp\"\n)\n\nfunc main() {\n\n\tprintln(r.MustCompile(\"a\").String())\n}\n",
+		},
+		{
+			"keeps frontmatter at the top",
+			"//---\n//desc: says hi\n//---\nprintln(\"hi\")",
+			WrapHooks{},
+			"//---\n//desc: says hi\n//---\n\npackage main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n",
+		},
+		{
+			"moves the leading comment above the package clause",
+			"//---\n//desc: says hi\n//---\n// Says hi\n// to everyone\n//goscript:requires env HOME\nprintln(\"hi\")",
+			WrapHooks{},
+			"//---\n//desc: says hi\n//---\n\n// Says hi\n// to everyone\npackage main\n\nfunc main() {\n\t//goscript:requires env HOME\n\tprintln(\"hi\")\n}\n",
+		},
+		{
+			"runs the hooks",
+			"fmt.Println(bar.Hello())",
+			WrapHooks{
+				Rewrite: func(code string) string { return "defer done()\n" + code },
+				Resolve: func(names []string) map[string]string {
+					if slices.Equal(names, []string{"bar"}) {
+						return map[string]string{"bar": "example.com/api/bar/v1"}
+					}
+					return nil
+				},
+				Helpers: func(code string) (string, map[string]string) {
+					return "\nfunc done() { os.Stdout.Sync() }\n", map[string]string{"os": "os"}
+				},
+				Finish: func(code string, imports []string) (string, map[string]string) {
+					return code + "\n//imports: " + strings.Join(imports, ", "), nil
+				},
+			},
+			"package main\n\nimport (\n\t\"fmt\"\n\t\"os\"\n\n\tbar \"example.com/api/bar/v1\"\n)\n\nfunc main() {\n\tdefer done()\n\tfmt.Println(bar.Hello())\n\t// imports: \"fmt\", bar \"example.com/api/bar/v1\", \"os\"\n}\n\nfunc done() { os.Stdout.Sync() }\n",
+		},
+		{
+			"renders with the Render hook",
+			"println(1)",
+			WrapHooks{
+				Render: func(name string, script Script) ([]byte, error) {
+					return RenderText("test", "package main\n\nfunc main() {\n\t// {{.Code}}\n}\n", script)
+				},
+			},
+			"package main\n\nfunc main() {\n\t// println(1)\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := testEngine(t)
+			e.Hooks = tt.hooks
+			got, err := e.Wrap(tt.code)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Wrap(%q) =\n%s\nwant\n%s", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+// A command saved from --code is described by the comment at the top of the code.
+func TestWrapDescription(t *testing.T) {
+	e := testEngine(t)
+	src, err := e.Wrap("\n// Counts the lines of its input\n\nfmt.Println(1)\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := FirstComment(string(src)), "Counts the lines of its input"; got != want {
+		t.Errorf("FirstComment of the wrapped code = %q, want %q\n%s", got, want, src)
+	}
+}
+
+// Code that doesn't parse is still wrapped, for go build to report its errors.
+func TestWrapSyntaxError(t *testing.T) {
+	e := testEngine(t)
+	src, err := e.Wrap("fmt.Println(")
+	var wrapErr *WrapError
+	if src != nil || !errors.As(err, &wrapErr) || wrapErr.Format == nil {
+		t.Fatalf("Wrap returned %q, %v; want a *WrapError for a formatting error", src, err)
+	}
+	if !strings.Contains(string(wrapErr.Source), "fmt.Println(\n}") {
+		t.Errorf("WrapError.Source = %q, want the generated program", wrapErr.Source)
+	}
+}
+
+func TestMergeBuildFlags(t *testing.T) {
+	tests := []struct {
+		name  string
+		lists [][]string
+		want  []string
+	}{
+		{"none", nil, []string{}},
+		{"one list", [][]string{{"-trimpath", "-race"}}, []string{"-trimpath", "-race"}},
+		{"repeated flags", [][]string{{"-trimpath"}, {"-trimpath", "-race"}}, []string{"-trimpath", "-race"}},
+		{
+			"linker flags joined in order",
+			[][]string{{"-ldflags=-s -w"}, {`-ldflags="-X main.version=1"`}, {"-ldflags="}},
+			[]string{"-ldflags=-s -w -X main.version=1"},
+		},
+		{"tags joined without repeats", [][]string{{"-tags=a,b"}, {"-tags=b c"}}, []string{"-tags=a,b,c"}},
+		{
+			"flags before linker flags and tags",
+			[][]string{{"-tags=netgo", "-ldflags=-s"}, {"-trimpath"}},
+			[]string{"-trimpath", "-ldflags=-s", "-tags=netgo"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MergeBuildFlags(tt.lists...); !slices.Equal(got, tt.want) {
+				t.Errorf("MergeBuildFlags(%q) = %q, want %q", tt.lists, got, tt.want)
+			}
+		})
+	}
+}
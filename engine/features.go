@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strings"
+)
+
+// What a main function body does, found by parsing it, so a template can add scaffolding only where it is
+// needed (e.g. {{if .Uses.Context}} around a signal-aware context).
+type Features struct {
+	Goroutines bool //Starts goroutines
+	Stdin      bool //Reads standard input (os.Stdin or script.Stdin)
+	Stdout     bool //Writes to standard output itself (fmt.Print*, os.Stdout or a script pipe's Stdout)
+	Flags      bool //Declares flags with the flag package
+	Context    bool //Refers to ctx without declaring it, for the template to declare
+}
+
+// Returns the features of a main function body. Code that doesn't parse has none.
+func DetectFeatures(code string) Features {
+	var features Features
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", "package main\n\nfunc main() {\n"+code+"\n}\n", parser.SkipObjectResolution)
+	if err != nil {
+		return features
+	}
+	info := resolveNames(fset, f)
+	selected := map[*ast.Ident]bool{} //the Sel of X.Sel, which isn't resolved without the package
+	ast.Inspect(f, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.GoStmt:
+			features.Goroutines = true
+		case *ast.SelectorExpr:
+			selected[n.Sel] = true
+			if n.Sel.Name == "Stdout" {
+				features.Stdout = true
+			}
+			pkg, ok := n.X.(*ast.Ident)
+			if !ok || !refersToPackage(info, pkg) {
+				break
+			}
+			switch {
+			case pkg.Name == "flag" && declaresFlag(n.Sel.Name):
+				features.Flags = true
+			case pkg.Name == "os" && n.Sel.Name == "Stdin", pkg.Name == "script" && n.Sel.Name == "Stdin":
+				features.Stdin = true
+			case pkg.Name == "fmt" && strings.HasPrefix(n.Sel.Name, "Print"):
+				features.Stdout = true
+			}
+		case *ast.Ident:
+			if n.Name == "ctx" && unresolved(info, n) && !selected[n] {
+				features.Context = true
+			}
+		}
+		return true
+	})
+	return features
+}
+
+// Reports whether the function of the flag package declares a flag (e.g. flag.String or flag.DurationVar).
+func declaresFlag(name string) bool {
+	switch strings.TrimSuffix(name, "Var") {
+	case "", "Bool", "Duration", "Float64", "Func", "BoolFunc", "Int", "Int64", "String", "Text", "Uint", "Uint64":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+package engine
+
+import (
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/imports"
+)
+
+// FixImports runs goimports (golang.org/x/tools/imports) on a generated program, after the names in Imports have
+// been resolved: it imports the packages the program uses but doesn't import, choosing them by the names used
+// (rand.Intn is math/rand, rand.Read crypto/rand), and removes the imports it doesn't use. goimports leaves the
+// imports that are there alone, so first an inferred standard library import that lacks the names used from it
+// (crypto/rand for rand.Intn) is dropped for goimports to replace, and of imports with the same name only the first
+// that has them is kept (goimports keeps the first of them if none has). The program is fixed as if it were a file in the project's directory, so the project's
+// dependencies can be found. The source is returned unchanged if it can't be parsed.
+func (e *Engine) FixImports(src []byte) []byte {
+	fixed, err := imports.Process(filepath.Join(e.Project.Dir, "main.go"), e.dropMismatchedImports(src), nil)
+	if err != nil {
+		return src
+	}
+	return fixed
+}
+
+// Removes the imports that goimports would keep but the program can't use: an inferred standard library import
+// that doesn't declare the names the program uses from it, and imports with the name of another that does.
+func (e *Engine) dropMismatchedImports(src []byte) []byte {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments|parser.SkipObjectResolution)
+	if err != nil {
+		return src
+	}
+
+	//A selector on an import, or a name that isn't declared, is a use of a package (or a mistake the build will
+	//report)
+	info := resolveNames(fset, f)
+	used := map[string][]string{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		if sel, ok := n.(*ast.SelectorExpr); ok {
+			if x, ok := sel.X.(*ast.Ident); ok && refersToPackage(info, x) && !slices.Contains(used[x.Name], sel.Sel.Name) {
+				used[x.Name] = append(used[x.Name], sel.Sel.Name)
+			}
+		}
+		return true
+	})
+
+	imported := map[string][]*ast.ImportSpec{}
+	for _, imp := range f.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		name := ImportAlias(path)
+		if imp.Name != nil {
+			name = imp.Name.Name
+		}
+		if name != "_" && name != "." && path != "C" {
+			imported[name] = append(imported[name], imp)
+		}
+	}
+
+	removed := map[*ast.ImportSpec]bool{}
+	for _, name := range sortedKeys(imported) {
+		specs := imported[name]
+		if len(used[name]) == 0 {
+			continue //goimports removes it
+		}
+		//An inferred import may be the wrong package of its name, e.g. crypto/rand for rand.Intn
+		if path, _ := strconv.Unquote(specs[0].Path.Value); len(specs) == 1 && standardPath(path) {
+			if exports := e.packageExports(path); len(exports) > 0 && !exportsAll(exports, used[name]) {
+				removed[specs[0]] = true
+			}
+			continue
+		}
+		if len(specs) > 1 {
+			//The first import that has what the program uses is kept, as written
+			for i, imp := range specs {
+				path, _ := strconv.Unquote(imp.Path.Value)
+				if exportsAll(e.packageExports(path), used[name]) {
+					for _, other := range slices.Delete(slices.Clone(specs), i, i+1) {
+						removed[other] = true
+					}
+					break
+				}
+			}
+		}
+	}
+	if len(removed) == 0 {
+		return src
+	}
+	return removeImports(fset, f, src, removed)
+}
+
+// Reports whether an import path is in the standard library, whose paths have no dot in their first element.
+func standardPath(path string) bool {
+	first, _, _ := strings.Cut(path, "/")
+	return !strings.Contains(first, ".")
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	names := []string{}
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// A part of the source to remove: src[start:end].
+type sourceCut struct {
+	start, end int
+}
+
+// Removes import specs from the source, and the declarations left without any. The source is edited as text, so
+// comments stay where they are.
+func removeImports(fset *token.FileSet, f *ast.File, src []byte, removed map[*ast.ImportSpec]bool) []byte {
+	cuts := []sourceCut{}
+	offset := func(pos token.Pos) int { return fset.Position(pos).Offset }
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			continue
+		}
+		kept := 0
+		for _, spec := range gen.Specs {
+			if !removed[spec.(*ast.ImportSpec)] {
+				kept++
+			}
+		}
+		if kept == 0 {
+			cuts = append(cuts, lineCut(src, offset(gen.Pos()), offset(gen.End())))
+			continue
+		}
+		for _, spec := range gen.Specs {
+			if removed[spec.(*ast.ImportSpec)] {
+				cuts = append(cuts, lineCut(src, offset(spec.Pos()), offset(spec.End())))
+			}
+		}
+	}
+	sort.Slice(cuts, func(i, j int) bool { return cuts[i].start > cuts[j].start })
+	out := slices.Clone(src)
+	for _, cut := range cuts {
+		out = slices.Delete(out, cut.start, cut.end)
+	}
+	return out
+}
+
+// Returns src[start:end], along with the rest of its line if nothing else is on it.
+func lineCut(src []byte, start, end int) sourceCut {
+	lineStart := start
+	for lineStart > 0 && (src[lineStart-1] == ' ' || src[lineStart-1] == '\t') {
+		lineStart--
+	}
+	lineEnd := end
+	for lineEnd < len(src) && (src[lineEnd] == ' ' || src[lineEnd] == '\t' || src[lineEnd] == '\r') {
+		lineEnd++
+	}
+	if (lineStart == 0 || src[lineStart-1] == '\n') && lineEnd < len(src) && src[lineEnd] == '\n' {
+		start, end = lineStart, lineEnd+1
+	}
+	return sourceCut{start, end}
+}
+
+func exportsAll(exports map[string]bool, names []string) bool {
+	for _, name := range names {
+		if !exports[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the exported names declared by the package at the import path, from the source files go/build would
+// build it from, or none if the package can't be found.
+func (e *Engine) packageExports(path string) map[string]bool {
+	exports := map[string]bool{}
+	pkg, err := build.Import(path, e.Project.Dir, 0)
+	if err != nil {
+		return exports
+	}
+	fset := token.NewFileSet()
+	for _, name := range slices.Concat(pkg.GoFiles, pkg.CgoFiles) {
+		f, err := parser.ParseFile(fset, filepath.Join(pkg.Dir, name), nil, parser.SkipObjectResolution)
+		if err != nil {
+			continue
+		}
+		for _, decl := range f.Decls {
+			switch decl := decl.(type) {
+			case *ast.FuncDecl:
+				if decl.Recv == nil && decl.Name.IsExported() {
+					exports[decl.Name.Name] = true
+				}
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					switch spec := spec.(type) {
+					case *ast.TypeSpec:
+						if spec.Name.IsExported() {
+							exports[spec.Name.Name] = true
+						}
+					case *ast.ValueSpec:
+						for _, name := range spec.Names {
+							if name.IsExported() {
+								exports[name.Name] = true
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return exports
+}
@@ -0,0 +1,103 @@
+package engine
+
+import (
+	"go/format"
+	"testing"
+)
+
+func TestFixImports(t *testing.T) {
+	e := &Engine{Project: Project{Dir: t.TempDir()}}
+	tests := []struct {
+		name, src, want string
+	}{
+		{
+			"adds a standard package",
+			"package main\n\nfunc main() {\n\tfmt.Println(strings.ToUpper(\"a\"))\n}\n",
+			"package main\n\nimport (\n\t\"fmt\"\n\t\"strings\"\n)\n\nfunc main() {\n\tfmt.Println(strings.ToUpper(\"a\"))\n}\n",
+		},
+		{
+			"drops an unused import",
+			"package main\n\nimport (\n\t\"fmt\"\n\t\"os\"\n)\n\nfunc main() {\n\tfmt.Println(1)\n}\n",
+			"package main\n\nimport (\n\t\"fmt\"\n)\n\nfunc main() {\n\tfmt.Println(1)\n}\n",
+		},
+		{
+			"drops an unused import outside the standard library",
+			"package main\n\nimport \"github.com/bitfield/script\"\n\nfunc main() {}\n",
+			"package main\n\nfunc main() {}\n",
+		},
+		{
+			"chooses math/rand for rand.Intn",
+			"package main\n\nfunc main() {\n\tprintln(rand.Intn(6))\n}\n",
+			"package main\n\nimport \"math/rand\"\n\nfunc main() {\n\tprintln(rand.Intn(6))\n}\n",
+		},
+		{
+			"chooses crypto/rand for rand.Read",
+			"package main\n\nfunc main() {\n\tb := make([]byte, 8)\n\trand.Read(b)\n}\n",
+			"package main\n\nimport \"crypto/rand\"\n\nfunc main() {\n\tb := make([]byte, 8)\n\trand.Read(b)\n}\n",
+		},
+		{
+			"replaces an inferred import of the wrong package",
+			"package main\n\nimport \"crypto/rand\"\n\nfunc main() {\n\tprintln(rand.Intn(6))\n}\n",
+			"package main\n\nimport \"math/rand\"\n\nfunc main() {\n\tprintln(rand.Intn(6))\n}\n",
+		},
+		{
+			"keeps the import of a clashing name that is used",
+			"package main\n\nimport (\n\t\"html/template\"\n\t\"text/template\"\n)\n\nfunc main() {\n\ttemplate.HTMLEscapeString(\"\")\n}\n",
+			"package main\n\nimport (\n\t\"html/template\"\n)\n\nfunc main() {\n\ttemplate.HTMLEscapeString(\"\")\n}\n",
+		},
+		{
+			"keeps the first of clashing imports that both fit",
+			"package main\n\nimport (\n\t\"text/template\"\n\t\"html/template\"\n)\n\nfunc main() {\n\ttemplate.New(\"\")\n}\n",
+			"package main\n\nimport (\n\t\"text/template\"\n)\n\nfunc main() {\n\ttemplate.New(\"\")\n}\n",
+		},
+		{
+			"keeps the used one of clashing renamed imports",
+			"package main\n\nimport (\n\tt \"text/template\"\n\tt \"html/template\"\n)\n\nfunc main() {\n\tprintln(t.HTML(\"\"))\n}\n",
+			"package main\n\nimport (\n\tt \"html/template\"\n)\n\nfunc main() {\n\tprintln(t.HTML(\"\"))\n}\n",
+		},
+		{
+			"keeps the first of clashing imports if neither fits, for the build to report",
+			"package main\n\nimport (\n\t\"html/template\"\n\t\"text/template\"\n)\n\nfunc main() {\n\ttemplate.Nothing()\n}\n",
+			"package main\n\nimport (\n\t\"html/template\"\n)\n\nfunc main() {\n\ttemplate.Nothing()\n}\n",
+		},
+		{
+			"keeps an import of the standard library that fits over one that can't be found",
+			"package main\n\nimport (\n\t\"example.com/missing/template\"\n\t\"text/template\"\n)\n\nfunc main() {\n\ttemplate.New(\"\")\n}\n",
+			"package main\n\nimport (\n\t\"text/template\"\n)\n\nfunc main() {\n\ttemplate.New(\"\")\n}\n",
+		},
+		{
+			"keeps an import outside the standard library that lacks the names used",
+			"package main\n\nimport \"example.com/missing/rand\"\n\nfunc main() {\n\tprintln(rand.Intn(6))\n}\n",
+			"package main\n\nimport \"example.com/missing/rand\"\n\nfunc main() {\n\tprintln(rand.Intn(6))\n}\n",
+		},
+		{
+			"drops an unused renamed import outside the standard library",
+			"package main\n\nimport sh \"github.com/bitfield/script\"\n\nfunc main() {}\n",
+			"package main\n\nfunc main() {}\n",
+		},
+		{
+			"keeps a renamed import that is used",
+			"package main\n\nimport re \"regexp\"\n\nfunc main() {\n\tre.MustCompile(\"a\")\n}\n",
+			"package main\n\nimport re \"regexp\"\n\nfunc main() {\n\tre.MustCompile(\"a\")\n}\n",
+		},
+		{
+			"ignores a local name like a package",
+			"package main\n\nfunc main() {\n\tstrings := []string{}\n\tprintln(len(strings))\n}\n",
+			"package main\n\nfunc main() {\n\tstrings := []string{}\n\tprintln(len(strings))\n}\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			//Imports are merged as Wrap does
+			merged, _ := MergeImports(e.FixImports([]byte(tt.src)))
+			got, err := format.Source(merged)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, _ := format.Source([]byte(tt.want))
+			if string(got) != string(want) {
+				t.Errorf("FixImports:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
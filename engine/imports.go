@@ -0,0 +1,236 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// An import of a script, as written at the top of its code or inferred from the packages it uses.
+type ImportSpec struct {
+	Name string //Blank unless the import is renamed
+	Path string
+}
+
+// Returns the name the package is referred to by in code.
+func (s ImportSpec) LocalName() string {
+	if s.Name != "" {
+		return s.Name
+	}
+	return ImportAlias(s.Path)
+}
+
+// Formats the import for the template (e.g. re "regexp").
+func (s ImportSpec) String() string {
+	if s.Name != "" {
+		return fmt.Sprintf("%s %q", s.Name, s.Path)
+	}
+	return strconv.Quote(s.Path)
+}
+
+// Splits import declarations at the top of a main function body (e.g. in a file passed to --code) from the rest
+// of the body. Comments and blank lines before the imports stay in the body. If the imports can't be parsed,
+// the code is returned unchanged.
+func SplitImports(code string) ([]ImportSpec, string) {
+	lines := strings.SplitAfter(code, "\n")
+	i := 0
+	for i < len(lines) && (strings.TrimSpace(lines[i]) == "" || strings.HasPrefix(strings.TrimSpace(lines[i]), "//")) {
+		i++
+	}
+	start := i
+	for i < len(lines) && isImportLine(lines[i]) {
+		if strings.HasSuffix(strings.TrimSpace(lines[i]), "(") {
+			for i < len(lines) && strings.TrimSpace(lines[i]) != ")" {
+				i++
+			}
+		}
+		i++
+		for i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+			i++
+		}
+	}
+	i = min(i, len(lines))
+	if i == start {
+		return nil, code
+	}
+
+	decls := strings.Join(lines[start:i], "")
+	f, err := parser.ParseFile(token.NewFileSet(), "", "package p\n"+decls, parser.ImportsOnly)
+	if err != nil {
+		return nil, code
+	}
+	if len(f.Imports) == 0 {
+		return nil, code
+	}
+	specs := []ImportSpec{}
+	for _, imp := range f.Imports {
+		spec := ImportSpec{}
+		spec.Path, _ = strconv.Unquote(imp.Path.Value)
+		if imp.Name != nil {
+			spec.Name = imp.Name.Name
+		}
+		specs = append(specs, spec)
+	}
+	//Keep the line count so compile errors still point at the right lines
+	body := strings.Join(lines[:start], "") + strings.Repeat("\n", strings.Count(decls, "\n")) + strings.Join(lines[i:], "")
+	return specs, body
+}
+
+// Reports whether a line starts with the import keyword, rather than a name such as imported.
+func isImportLine(line string) bool {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(line), "import")
+	return ok && (rest == "" || strings.ContainsAny(rest[:1], " \t(\"`"))
+}
+
+// Merges the import declarations of a generated file into one. Duplicate imports are removed, and an import whose name
+// collides with an earlier import of a different package is dropped, since the earlier one was either
+// written by the user or by the template. Returns the source unchanged if there is nothing to merge, and a
+// description of each dropped import.
+func MergeImports(src []byte) ([]byte, []string) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return src, nil
+	}
+	dropped := []string{}
+	seen := map[ImportSpec]bool{}
+	names := map[string]string{}
+	changed := false
+	decls := []ast.Decl{}
+	var merged *ast.GenDecl
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.IMPORT {
+			decls = append(decls, decl)
+			continue
+		}
+		kept := []ast.Spec{}
+		for _, s := range gen.Specs {
+			imp := s.(*ast.ImportSpec)
+			spec := ImportSpec{}
+			spec.Path, _ = strconv.Unquote(imp.Path.Value)
+			if imp.Name != nil {
+				spec.Name = imp.Name.Name
+			}
+			if seen[spec] {
+				changed = true
+				continue
+			}
+			name := spec.LocalName()
+			if path, ok := names[name]; ok && path != spec.Path && name != "_" && name != "." {
+				dropped = append(dropped, fmt.Sprintf("import %s dropped: %s already refers to %q", spec, name, path))
+				changed = true
+				continue
+			}
+			seen[spec] = true
+			names[name] = spec.Path
+			kept = append(kept, s)
+		}
+		if merged != nil {
+			merged.Specs = append(merged.Specs, kept...)
+			changed = true
+			continue
+		}
+		merged = gen
+		merged.Specs = kept
+		decls = append(decls, merged)
+	}
+	if merged != nil && len(merged.Specs) > 1 && !merged.Lparen.IsValid() {
+		merged.Lparen = merged.Pos() + token.Pos(len("import "))
+	}
+	if !changed {
+		return src, dropped
+	}
+	f.Decls = decls
+	var out bytes.Buffer
+	if err := format.Node(&out, fset, f); err != nil {
+		return src, dropped
+	}
+	return out.Bytes(), dropped
+}
+
+// Returns the names that a main function body uses as packages, in the order they first appear: the X of each
+// selector expression X.Sel that doesn't resolve to a name declared in the code (see resolve.go). A local
+// variable, parameter or type that shadows a package is skipped where it is in scope, and selectors in strings and
+// comments, or on the result of a call, index or another selector, are never mistaken for packages.
+func PackageSelectors(code string) []string {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", "package main\n\nfunc main() {\n"+code+"\n}\n", parser.SkipObjectResolution)
+	if err != nil {
+		return scanSelectors(code)
+	}
+	info := resolveNames(fset, f)
+	names := []string{}
+	seen := map[string]bool{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		sel, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		if id, ok := sel.X.(*ast.Ident); ok && refersToPackage(info, id) && !seen[id.Name] {
+			seen[id.Name] = true
+			names = append(names, id.Name)
+		}
+		return true
+	})
+	return names
+}
+
+// Finds the package names in code that doesn't parse, from its tokens: each identifier followed by a dot,
+// unless it is itself preceded by one. Declarations can't be tracked, but strings and comments are skipped.
+func scanSelectors(code string) []string {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	src := []byte(code)
+	s.Init(fset.AddFile("", fset.Base(), len(src)), src, nil, 0)
+	names := []string{}
+	seen := map[string]bool{}
+	prev, ident := token.ILLEGAL, ""
+	for {
+		_, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.PERIOD && ident != "" && !seen[ident] {
+			seen[ident] = true
+			names = append(names, ident)
+		}
+		ident = ""
+		if tok == token.IDENT && prev != token.PERIOD {
+			ident = lit
+		}
+		prev = tok
+	}
+	return names
+}
+
+// Returns the import of the package at path as name. The name is left out only where it is the last element of
+// the path, the package's own name by convention. Elsewhere it is written, which is right whether the package has
+// that name or not: for "bar" and .../bar/v1, the package may be named bar or v1.
+func NamedImport(name, path string) ImportSpec {
+	if filepath.Base(path) == name {
+		return ImportSpec{Path: path}
+	}
+	return ImportSpec{Name: name, Path: path}
+}
+
+// Returns the alias for an import path, skipping a major version suffix (e.g. "bar" for github.com/foo/bar/v3)
+// and the version in gopkg.in paths (e.g. "yaml" for gopkg.in/yaml.v3).
+func ImportAlias(path string) string {
+	base := filepath.Base(path)
+	if regexp.MustCompile(`^v[0-9]+$`).MatchString(base) {
+		base = filepath.Base(filepath.Dir(path))
+	}
+	if strings.HasPrefix(path, "gopkg.in/") {
+		base, _, _ = strings.Cut(base, ".")
+	}
+	return strings.ReplaceAll(base, "-", "")
+}
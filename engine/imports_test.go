@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestPackageSelectors(t *testing.T) {
+	tests := []struct {
+		name, code string
+		want       []string
+	}{
+		{"packages in order", `fmt.Println(strings.ToUpper("a"), filepath.Base("b"))`, []string{"fmt", "strings", "filepath"}},
+		{"repeated", "fmt.Println(1)\nfmt.Println(2)", []string{"fmt"}},
+		{"local variable", "u := url.URL{}\nfmt.Println(u.Host)", []string{"url", "fmt"}},
+		{"shadowing a package", "strings := []string{\"a\"}\nfmt.Println(strings.Len)", []string{"fmt"}},
+		{"shadowed only in scope", "if true {\n\tstrings := 1\n\t_ = strings\n}\nfmt.Println(strings.ToUpper(\"a\"))", []string{"fmt", "strings"}},
+		{"parameter", "f := func(os string) int { return len(os) }\nfmt.Println(f(\"a\"), os.Args)", []string{"fmt", "os"}},
+		{"local type", "type point struct{ X int }\np := point{}\nfmt.Println(p.X)", []string{"fmt"}},
+		{"method value", "var b strings.Builder\nw := b.WriteString\nw(\"a\")", []string{"strings"}},
+		{"call result", "time.Now().Unix()", []string{"time"}},
+		{"strings and comments", "// os.Exit\nfmt.Println(\"json.Marshal\")", []string{"fmt"}},
+		{"code that doesn't parse", "fmt.Println(strings.ToUpper(", []string{"fmt", "strings"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PackageSelectors(tt.code); !slices.Equal(got, tt.want) {
+				t.Errorf("PackageSelectors(%q) = %q, want %q", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectFeatures(t *testing.T) {
+	tests := []struct {
+		name, code string
+		want       Features
+	}{
+		{"stdout", `fmt.Println("a")`, Features{Stdout: true}},
+		{"stdin", "b, _ := io.ReadAll(os.Stdin)\n_ = b", Features{Stdin: true}},
+		{"flags", `n := flag.Int("n", 1, "")` + "\n_ = n", Features{Flags: true}},
+		{"goroutines", "go func() {}()", Features{Goroutines: true}},
+		{"undeclared ctx", "<-ctx.Done()", Features{Context: true}},
+		{"declared ctx", "ctx := context.Background()\n<-ctx.Done()", Features{}},
+		{"shadowed fmt", "var fmt printer\nfmt.Println()", Features{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectFeatures(tt.code); got != tt.want {
+				t.Errorf("DetectFeatures(%q) = %+v, want %+v", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitImports(t *testing.T) {
+	tests := []struct {
+		name, code string
+		want       []ImportSpec
+		body       string
+	}{
+		{"no imports", "fmt.Println(1)", nil, "fmt.Println(1)"},
+		{
+			"one import",
+			"import \"regexp\"\nfmt.Println(regexp.QuoteMeta(\".\"))",
+			[]ImportSpec{{Path: "regexp"}},
+			"\nfmt.Println(regexp.QuoteMeta(\".\"))",
+		},
+		{
+			"a block, after a comment",
+			"// Finds things\nimport (\n\tre \"regexp\"\n\t\"strings\"\n)\n\nprintln(1)",
+			[]ImportSpec{{Name: "re", Path: "regexp"}, {Path: "strings"}},
+			"// Finds things\n\n\n\n\n\nprintln(1)",
+		},
+		{
+			"several declarations",
+			"import \"os\"\nimport _ \"embed\"\nprintln(os.Args)",
+			[]ImportSpec{{Path: "os"}, {Name: "_", Path: "embed"}},
+			"\n\nprintln(os.Args)",
+		},
+		{"imports that don't parse", "import (\n\t\"os\n)\nprintln(1)", nil, "import (\n\t\"os\n)\nprintln(1)"},
+		{"an identifier starting with import", "imported := 1\nprintln(imported)", nil, "imported := 1\nprintln(imported)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, body := SplitImports(tt.code)
+			if !slices.Equal(got, tt.want) || body != tt.body {
+				t.Errorf("SplitImports(%q) = %q, %q, want %q, %q", tt.code, got, body, tt.want, tt.body)
+			}
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package engine
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// Metadata describes a script: what it does, the flags it accepts and what it needs to build.
+// It is declared in an optional frontmatter block of comments at the top of the source file:
+//
+//	//---
+//	// description: Find config files matching a pattern
+//	// version: 1.4.0
+//	// flag: pattern string default=vlc Pattern to match
+//	// deps: github.com/bitfield/script
+//	// template: cli.tmpl
+//	// build: -trimpath -ldflags=-s
+//	// route: POST /hooks/deploy token=env:DEPLOY_TOKEN timeout=5m
+//	//---
+//
+// Because the block is made of comments, the file remains a valid Go source file.
+//
+// Requirements are declared with directives, which may appear anywhere in the file:
+//
+//	//goscript:requires env AWS_PROFILE,KUBECONFIG
+//	//goscript:requires bin kubectl,jq
+//	//goscript:os linux,darwin
+//	//goscript:exclusive [no-wait]
+//	//goscript:example deploy -env staging --dry-run
+//	//goscript:desc Deploy the app (an alternative to the frontmatter description)
+type Metadata struct {
+	Description string
+	Version     string //The version of the command, used when it is packaged
+	Flags       []FlagSpec
+	Deps        []string
+	Template    string
+	BuildFlags  []string
+	Routes      []RouteSpec
+	RequiresEnv []string //From //goscript:requires env NAME,... directives
+	RequiresBin []string //From //goscript:requires bin NAME,... directives
+	OS          []string //From //goscript:os GOOS,... directives. Empty means any.
+	Exclusive   string   //From a //goscript:exclusive directive: "wait" or "no-wait". Empty if runs may overlap.
+	Examples    []string //From //goscript:example directives: invocations of the command, starting with its name
+}
+
+// FlagSpec declares a command-line flag accepted by a script.
+// Syntax: flag: <name> <type> [default=<value>] [required] <usage>
+type FlagSpec struct {
+	Name     string
+	Type     string
+	Default  string
+	Required bool
+	Usage    string
+}
+
+// RouteSpec declares an HTTP route that triggers the script in --serve mode.
+// Syntax: route: <method> <path> [token=env:<VAR>|token=none] [timeout=<duration>]
+type RouteSpec struct {
+	Method   string
+	Path     string
+	TokenEnv string        //Environment variable holding the token callers must present. Blank for token=none.
+	Open     bool          //token=none: no token required
+	Timeout  time.Duration //Zero means the server default
+}
+
+const frontmatterDelimiter = "//---"
+
+// Splits the frontmatter block (if any) from the rest of the source.
+// A shebang and blank lines are allowed before the opening delimiter.
+func SplitFrontmatter(src string) (front string, body string) {
+	lines := strings.SplitAfter(src, "\n")
+	start := 0
+	for start < len(lines) && (strings.TrimSpace(lines[start]) == "" || (start == 0 && strings.HasPrefix(lines[start], "#!"))) {
+		start++
+	}
+	if start >= len(lines) || strings.TrimSpace(lines[start]) != frontmatterDelimiter {
+		return "", src
+	}
+	for end := start + 1; end < len(lines); end++ {
+		if strings.TrimSpace(lines[end]) == frontmatterDelimiter {
+			return strings.Join(lines[:end+1], ""), strings.Join(lines[end+1:], "")
+		}
+	}
+	return "", src
+}
+
+// Returns the description in a "//goscript:desc <text>" directive, which may also be written with a space after
+// the slashes, like an ordinary comment.
+func cutDescDirective(line string) (string, bool) {
+	comment, ok := strings.CutPrefix(strings.TrimSpace(line), "//")
+	if !ok {
+		return "", false
+	}
+	value, ok := strings.CutPrefix(strings.TrimSpace(comment), "goscript:desc ")
+	return strings.TrimSpace(value), ok
+}
+
+// Parses the metadata declared in the source file's frontmatter.
+func ParseMetadata(src string) Metadata {
+	var meta Metadata
+	front, _ := SplitFrontmatter(src)
+	for _, line := range strings.Split(front, "\n") {
+		line = strings.TrimSpace(line)
+		if line == frontmatterDelimiter || !strings.HasPrefix(line, "//") {
+			continue
+		}
+		key, value, found := strings.Cut(strings.TrimSpace(strings.TrimPrefix(line, "//")), ":")
+		if !found {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "description", "desc":
+			meta.Description = value
+		case "version":
+			meta.Version = value
+		case "flag", "flags":
+			if spec, ok := parseFlagSpec(value); ok {
+				meta.Flags = append(meta.Flags, spec)
+			}
+		case "deps", "dep":
+			meta.Deps = append(meta.Deps, SplitList(value)...)
+		case "template":
+			meta.Template = value
+		case "build":
+			meta.BuildFlags = append(meta.BuildFlags, strings.Fields(value)...)
+		case "route":
+			if spec, ok := parseRouteSpec(value); ok {
+				meta.Routes = append(meta.Routes, spec)
+			}
+		}
+	}
+	for _, line := range strings.Split(src, "\n") {
+		if value, ok := cutDescDirective(line); ok {
+			if meta.Description == "" { //the frontmatter description wins
+				meta.Description = value
+			}
+			continue
+		}
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line)+" ", "//goscript:exclusive "); ok {
+			meta.Exclusive = "wait"
+			if strings.TrimSpace(value) == "no-wait" {
+				meta.Exclusive = "no-wait"
+			}
+			continue
+		}
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), "//goscript:example "); ok {
+			if value = strings.TrimSpace(value); value != "" {
+				meta.Examples = append(meta.Examples, value)
+			}
+			continue
+		}
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), "//goscript:os "); ok {
+			meta.OS = append(meta.OS, SplitList(value)...)
+			continue
+		}
+		value, ok := strings.CutPrefix(strings.TrimSpace(line), "//goscript:requires ")
+		if !ok {
+			continue
+		}
+		kind, list, _ := strings.Cut(strings.TrimSpace(value), " ")
+		switch kind {
+		case "env":
+			meta.RequiresEnv = append(meta.RequiresEnv, SplitList(list)...)
+		case "bin":
+			meta.RequiresBin = append(meta.RequiresBin, SplitList(list)...)
+		}
+	}
+	return meta
+}
+
+// Reads and parses the metadata from a source file. Returns empty metadata if the file can't be read.
+func ReadMetadata(filename string) Metadata {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return Metadata{}
+	}
+	return ParseMetadata(string(data))
+}
+
+func parseFlagSpec(value string) (FlagSpec, bool) {
+	fields := strings.Fields(value)
+	if len(fields) < 2 {
+		return FlagSpec{}, false
+	}
+	spec := FlagSpec{Name: strings.TrimLeft(fields[0], "-"), Type: fields[1]}
+	rest := fields[2:]
+	for len(rest) > 0 {
+		if strings.HasPrefix(rest[0], "default=") {
+			spec.Default = strings.TrimPrefix(rest[0], "default=")
+		} else if rest[0] == "required" {
+			spec.Required = true
+		} else {
+			break
+		}
+		rest = rest[1:]
+	}
+	spec.Usage = strings.Join(rest, " ")
+	return spec, true
+}
+
+func parseRouteSpec(value string) (RouteSpec, bool) {
+	fields := strings.Fields(value)
+	if len(fields) < 2 || !strings.HasPrefix(fields[1], "/") {
+		return RouteSpec{}, false
+	}
+	spec := RouteSpec{Method: strings.ToUpper(fields[0]), Path: fields[1]}
+	for _, field := range fields[2:] {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "token":
+			if value == "none" {
+				spec.Open = true
+			} else if name, ok := strings.CutPrefix(value, "env:"); ok {
+				spec.TokenEnv = name
+			} else {
+				return RouteSpec{}, false //a token must not be written into the source
+			}
+		case "timeout":
+			timeout, err := time.ParseDuration(value)
+			if err != nil {
+				return RouteSpec{}, false
+			}
+			spec.Timeout = timeout
+		default:
+			return RouteSpec{}, false
+		}
+	}
+	return spec, true
+}
+
+// Splits a comma or space separated list.
+func SplitList(value string) []string {
+	return strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t'
+	})
+}
+
+// Splits the comment lines at the top of a main function body (e.g. --code) from the rest of the body, for Wrap
+// to put above the package clause, where FirstComment finds the description of a command saved from the code.
+// The comment ends at a blank line, code or a directive, which stays in the body.
+func SplitLeadingComment(code string) (comment, body string) {
+	lines := strings.SplitAfter(code, "\n")
+	start := 0
+	for start < len(lines) && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+	end := start
+	for end < len(lines) {
+		text, ok := strings.CutPrefix(strings.TrimSpace(lines[end]), "//")
+		if !ok || strings.HasPrefix(text, "go:") || strings.HasPrefix(strings.TrimSpace(text), "goscript:") {
+			break
+		}
+		end++
+	}
+	if end == start {
+		return "", code
+	}
+	return strings.Join(lines[start:end], ""), strings.Join(lines[end:], "")
+}
+
+// Returns the first comment line at the top of the file (after any shebang and frontmatter), skipping
+// compiler and goscript directives. This is the description used when none is declared in frontmatter.
+func FirstComment(src string) string {
+	_, body := SplitFrontmatter(src)
+	for _, line := range strings.Split(body, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "", strings.HasPrefix(line, "#!"):
+			continue
+		case strings.HasPrefix(line, "//go:"), strings.HasPrefix(line, "//goscript:"):
+			continue
+		case strings.HasPrefix(strings.TrimSpace(strings.TrimPrefix(line, "//")), "goscript:"):
+			continue //a directive written like a comment, e.g. "// goscript:desc"
+		case strings.HasPrefix(line, "//"):
+			return strings.TrimSpace(strings.TrimPrefix(line, "//"))
+		case strings.HasPrefix(line, "/*"):
+			text := strings.TrimSpace(strings.TrimPrefix(line, "/*"))
+			text, _, _ = strings.Cut(text, "*/")
+			return strings.TrimSpace(text)
+		default:
+			return ""
+		}
+	}
+	return ""
+}
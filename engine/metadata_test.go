@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseMetadata(t *testing.T) {
+	tests := []struct {
+		name, src string
+		want      Metadata
+	}{
+		{"no frontmatter", "package main\n", Metadata{}},
+		{
+			"frontmatter",
+			"#!/usr/bin/env goscript\n//---\n// desc: Deploys the app\n// version: 1.2.0\n// deps: github.com/a/b, github.com/c/d@v1\n// template: cli\n// build: -trimpath -tags=netgo\n//---\npackage main\n",
+			Metadata{
+				Description: "Deploys the app",
+				Version:     "1.2.0",
+				Deps:        []string{"github.com/a/b", "github.com/c/d@v1"},
+				Template:    "cli",
+				BuildFlags:  []string{"-trimpath", "-tags=netgo"},
+			},
+		},
+		{
+			"flags",
+			"//---\n// flag: -env string default=staging required Where to deploy\n// flag: n int\n// flag: broken\n//---\n",
+			Metadata{Flags: []FlagSpec{
+				{Name: "env", Type: "string", Default: "staging", Required: true, Usage: "Where to deploy"},
+				{Name: "n", Type: "int"},
+			}},
+		},
+		{
+			"routes",
+			"//---\n// route: post /deploy token=env:DEPLOY_TOKEN timeout=30s\n// route: get /health token=none\n// route: get /secret token=abc\n// route: get health\n//---\n",
+			Metadata{Routes: []RouteSpec{
+				{Method: "POST", Path: "/deploy", TokenEnv: "DEPLOY_TOKEN", Timeout: 30 * time.Second},
+				{Method: "GET", Path: "/health", Open: true},
+			}},
+		},
+		{
+			"directives",
+			"package main\n\n//goscript:desc Cleans up\n//goscript:requires env HOME,USER\n//goscript:requires bin git\n//goscript:os linux darwin\n//goscript:exclusive no-wait\n//goscript:example clean -n\n",
+			Metadata{
+				Description: "Cleans up",
+				RequiresEnv: []string{"HOME", "USER"},
+				RequiresBin: []string{"git"},
+				OS:          []string{"linux", "darwin"},
+				Exclusive:   "no-wait",
+				Examples:    []string{"clean -n"},
+			},
+		},
+		{
+			"frontmatter description wins over a directive",
+			"//---\n// description: From the frontmatter\n//---\n// goscript:desc From a directive\n//goscript:exclusive\n",
+			Metadata{Description: "From the frontmatter", Exclusive: "wait"},
+		},
+		{"unterminated frontmatter", "//---\n// desc: never closed\n", Metadata{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseMetadata(tt.src); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseMetadata(%q) =\n%+v\nwant\n%+v", tt.src, got, tt.want)
+			}
+		})
+	}
+}
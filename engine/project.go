@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// A goscript project: a Go module whose src directory holds the sources of its commands and whose bin directory
+// holds their binaries, made with 'goscript --setup'.
+//
+// A command's source is either a single file, src/<name>.go, or a directory, src/<name>/, holding main.go and
+// any number of helper files in package main. A directory with its own go.mod is an isolated command: its
+// dependencies are kept in its own module rather than the project's. A soft-deleted directory command keeps
+// its directory, with main.go renamed to main, just as a soft-deleted single-file command loses its .go
+// extension.
+type Project struct {
+	Dir string
+}
+
+func (p Project) CommandDir(cmd string) string {
+	return p.Dir + "/src/" + cmd
+}
+
+// Returns true if the command (deleted or not) is a directory with main.go, or main if deleted. A directory with
+// just a go.mod is a new isolated command whose main.go is yet to be written.
+func (p Project) IsDirCommand(cmd string) bool {
+	if cmd == "" {
+		return false
+	}
+	for _, main := range []string{"main.go", "main", "go.mod"} {
+		if info, err := os.Stat(p.CommandDir(cmd) + "/" + main); err == nil && !info.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the path of a command's source file: main.go for a directory command.
+func (p Project) SourceFile(cmd string) string {
+	if p.IsDirCommand(cmd) {
+		return p.CommandDir(cmd) + "/main.go"
+	}
+	return p.Dir + "/src/" + cmd + ".go"
+}
+
+// Returns the path of a source listed by Commands (e.g. "hello.go", or "hello" if soft-deleted).
+func (p Project) SourcePath(filename string) string {
+	cmd, ok := strings.CutSuffix(filename, ".go")
+	if !p.IsDirCommand(cmd) {
+		return p.Dir + "/src/" + filename
+	}
+	if ok {
+		return p.CommandDir(cmd) + "/main.go"
+	}
+	return p.CommandDir(cmd) + "/main"
+}
+
+// Returns the directory of a directory command that the source file belongs to, or "" for a single-file command.
+func (p Project) SourceDir(srcFilename string) string {
+	dir := filepath.Dir(srcFilename)
+	if filepath.Dir(dir) == filepath.Clean(p.Dir+"/src") && p.IsDirCommand(filepath.Base(dir)) {
+		return dir
+	}
+	return ""
+}
+
+// The reverse of SourcePath: returns the name Commands uses for a source file in the project.
+func (p Project) SourceListName(srcFilename string) string {
+	if dir := p.SourceDir(srcFilename); dir != "" {
+		name := filepath.Base(dir)
+		if filepath.Base(srcFilename) == "main.go" {
+			name += ".go"
+		}
+		return name
+	}
+	if rel, err := filepath.Rel(p.Dir+"/src", srcFilename); err == nil && !strings.HasPrefix(rel, "..") {
+		return filepath.ToSlash(rel)
+	}
+	return srcFilename
+}
+
+// Returns the Go files of the command a source file belongs to: the file itself, or main.go and its helpers,
+// sorted, for a directory command. Test files are left out.
+func (p Project) CommandFiles(srcFilename string) []string {
+	dir := p.SourceDir(srcFilename)
+	if dir == "" {
+		return []string{srcFilename}
+	}
+	files := []string{srcFilename}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") || name == "main.go" {
+			continue
+		}
+		files = append(files, dir+"/"+name)
+	}
+	sort.Strings(files[1:])
+	return files
+}
+
+// Returns what go build and go list are given for a source file: the file itself, or the directory of a
+// directory command, so its helper files are included.
+func (p Project) BuildTarget(srcFilename string) string {
+	if dir := p.SourceDir(srcFilename); dir != "" {
+		return dir
+	}
+	return srcFilename
+}
+
+// Returns the sources of the project's commands, sorted: "<name>.go" for a command, or "<name>" for one that
+// is soft-deleted. Tests of a command are not commands.
+func (p Project) Commands() ([]string, error) {
+	cmds := []string{}
+	list, err := os.ReadDir(p.Dir + "/src")
+	for _, entry := range list {
+		if !entry.IsDir() {
+			if !strings.HasSuffix(entry.Name(), "_test.go") {
+				cmds = append(cmds, entry.Name())
+			}
+		} else if p.IsDirCommand(entry.Name()) {
+			//A directory command is listed like the others; deleted if it has no main.go
+			if fileExists(p.CommandDir(entry.Name()) + "/main.go") {
+				cmds = append(cmds, entry.Name()+".go")
+			} else if fileExists(p.CommandDir(entry.Name()) + "/main") {
+				cmds = append(cmds, entry.Name())
+			}
+		}
+	}
+	sort.Strings(cmds)
+	return cmds, err
+}
+
+// Returns true if the command (deleted or not) has a module of its own.
+func (p Project) IsIsolated(cmd string) bool {
+	info, err := os.Stat(p.CommandDir(cmd) + "/go.mod")
+	return p.IsDirCommand(cmd) && err == nil && !info.IsDir()
+}
+
+// Returns the directory of the module a source file belongs to: its own for an isolated command, otherwise the project.
+func (p Project) ModuleDir(srcFilename string) string {
+	if dir := p.SourceDir(srcFilename); dir != "" && fileExists(dir+"/go.mod") {
+		return dir
+	}
+	return p.Dir
+}
+
+// Returns the path of the named command's binary for the host platform.
+func (p Project) BinaryFile(name string) string {
+	return p.Dir + "/bin/" + name
+}
+
+func fileExists(filename string) bool {
+	_, err := os.Stat(filename)
+	return !errors.Is(err, os.ErrNotExist)
+}
@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestProjectCommands(t *testing.T) {
+	p := Project{Dir: t.TempDir()}
+	for _, filename := range []string{
+		"src/hello.go",
+		"src/hello_test.go",
+		"src/old",          //a soft-deleted command
+		"src/tool/main.go", //a directory command
+		"src/tool/helpers.go",
+		"src/gone/main",        //a soft-deleted directory command
+		"src/fresh/go.mod",     //an isolated command with no main.go yet
+		"src/data/input.txt",   //not a command
+		"src/isolated/main.go", //an isolated command
+		"src/isolated/go.mod",
+	} {
+		filename = filepath.Join(p.Dir, filename)
+		if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	got, err := p.Commands()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"gone", "hello.go", "isolated.go", "old", "tool.go"}; !slices.Equal(got, want) {
+		t.Errorf("Commands() = %q, want %q", got, want)
+	}
+	for cmd, want := range map[string]bool{"tool": false, "isolated": true, "fresh": true, "hello": false} {
+		if got := p.IsIsolated(cmd); got != want {
+			t.Errorf("IsIsolated(%q) = %v, want %v", cmd, got, want)
+		}
+	}
+
+	if _, err := (Project{Dir: t.TempDir()}).Commands(); err == nil {
+		t.Error("Commands() of a project without a src directory succeeded, want an error")
+	}
+}
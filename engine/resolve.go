@@ -0,0 +1,47 @@
+package engine
+
+import (
+	"errors"
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// Which names in a script are packages is decided by resolving its identifiers with go/types, rather than with the
+// parser's object resolution (ast.Ident.Obj), which is deprecated because it can't be done correctly from syntax
+// alone. The code is checked without loading its imports, which go/types then records as fake packages, so only
+// the code's own declarations are resolved: all that is needed to tell them from packages, and quick.
+
+var errImportsNotLoaded = errors.New("imports are not loaded")
+
+type importerFunc func(path string) (*types.Package, error)
+
+func (f importerFunc) Import(path string) (*types.Package, error) {
+	return f(path)
+}
+
+// Resolves the identifiers of a file to the objects they declare and use, as far as that can be done without its
+// imports. Type errors, such as the use of a package that isn't imported, are ignored.
+func resolveNames(fset *token.FileSet, f *ast.File) *types.Info {
+	info := &types.Info{Defs: map[*ast.Ident]types.Object{}, Uses: map[*ast.Ident]types.Object{}}
+	conf := types.Config{
+		Importer: importerFunc(func(string) (*types.Package, error) { return nil, errImportsNotLoaded }),
+		Error:    func(error) {},
+	}
+	conf.Check("main", fset, []*ast.File{f}, info)
+	return info
+}
+
+// Reports whether an identifier refers to a package: an imported one, or a name the code doesn't declare.
+func refersToPackage(info *types.Info, id *ast.Ident) bool {
+	switch info.Uses[id].(type) {
+	case nil, *types.PkgName:
+		return info.Defs[id] == nil
+	}
+	return false
+}
+
+// Reports whether an identifier is neither declared by the code nor a use of something it declares.
+func unresolved(info *types.Info, id *ast.Ident) bool {
+	return info.Uses[id] == nil && info.Defs[id] == nil
+}
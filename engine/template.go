@@ -0,0 +1,198 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// The template written to script.tmpl by 'goscript --setup'.
+const DefaultTemplate = "package main\n\nimport ( {{range .Imports}}\n\t{{.}}{{ end }}\n)\n\nfunc main() {\n\t{{.Code}}\n}\n"
+
+// What a template is executed with: the imports of a script, formatted for an import declaration (e.g.
+// re "regexp"), its main function body and what the body does.
+type Script struct {
+	Imports []string
+	Code    string
+	Uses    Features
+}
+
+// Functions available to templates in addition to the text/template builtins. They follow the Sprig library,
+// taking the value being worked on last, so they can be used in pipelines (e.g. {{env "USER" | default "nobody"}}).
+var TemplateFuncs = template.FuncMap{
+	"upper":     strings.ToUpper,
+	"lower":     strings.ToLower,
+	"trim":      strings.TrimSpace,
+	"replace":   func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"contains":  func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix": func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix": func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"split":     func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":      func(sep string, items []string) string { return strings.Join(items, sep) },
+	"quote":     func(s string) string { return fmt.Sprintf("%q", s) },
+	"indent": func(spaces int, s string) string {
+		pad := strings.Repeat(" ", spaces)
+		return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+	},
+	"default": func(def any, given ...any) any {
+		if len(given) == 0 || empty(given[0]) {
+			return def
+		}
+		return given[0]
+	},
+	"empty": empty,
+	"env":   os.Getenv,
+	"now":   time.Now,
+	"date":  func(layout string, t time.Time) string { return t.Format(layout) },
+}
+
+// Reports whether a value is the zero value of its type, or an empty slice or map.
+func empty(v any) bool {
+	if v == nil {
+		return true
+	}
+	value := reflect.ValueOf(v)
+	switch value.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		return value.Len() == 0
+	}
+	return value.IsZero()
+}
+
+// Templates are looked up by name: script.tmpl in the project directory is the default, "script", and other
+// templates are kept in the templates directory of the project (e.g. templates/http-server.tmpl). A template
+// in the project directory itself, as named in the frontmatter of older scripts (template: cli.tmpl), is still
+// found there first. The built-in templates (see BuiltinTemplates) are used unless the project has a template
+// of the same name. A template may describe itself with a comment at its start: {{/* A description */ -}}.
+
+// A template available to a project.
+type TemplateInfo struct {
+	Name        string
+	File        string //Blank for a built-in template
+	Description string
+}
+
+func (p Project) TemplatesDir() string {
+	return p.Dir + "/templates"
+}
+
+// Returns the path of the named template in the project, whether it exists or not. The .tmpl extension is optional.
+func (p Project) TemplateFile(name string) string {
+	name = strings.TrimSuffix(name, ".tmpl")
+	if name == "" || name == "script" {
+		return p.Dir + "/script.tmpl"
+	}
+	if fileExists(p.Dir + "/" + name + ".tmpl") {
+		return p.Dir + "/" + name + ".tmpl"
+	}
+	return p.TemplatesDir() + "/" + name + ".tmpl"
+}
+
+// Returns the text of the named template: the project's, or the built-in template of that name.
+func (p Project) ReadTemplate(name string) (string, error) {
+	data, err := os.ReadFile(p.TemplateFile(name))
+	if errors.Is(err, os.ErrNotExist) {
+		if text, ok := BuiltinTemplates[strings.TrimSuffix(name, ".tmpl")]; ok {
+			return text, nil
+		}
+		return "", fmt.Errorf("no template named %s: %s not found", name, p.TemplateFile(name))
+	}
+	return string(data), err
+}
+
+// Templates parsed by ParseTemplate, by name and text, so a process that wraps code more than once (such as a
+// daemon worker, see Engine.Warm) parses each template only once.
+var parsedTemplates sync.Map
+
+// Parses a template with the template functions, to execute it or check it.
+func ParseTemplate(name, text string) (*template.Template, error) {
+	key := name + "\x00" + text
+	if tmpl, ok := parsedTemplates.Load(key); ok {
+		return tmpl.(*template.Template), nil
+	}
+	tmpl, err := template.New(name).Funcs(TemplateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	parsedTemplates.Store(key, tmpl)
+	return tmpl, nil
+}
+
+// Parses the project's templates ahead of their first use (see ParseTemplate).
+func (p Project) ParseTemplates() {
+	for _, t := range p.Templates() {
+		if text, err := p.ReadTemplate(t.Name); err == nil {
+			ParseTemplate(filepath.Base(p.TemplateFile(t.Name)), text)
+		}
+	}
+}
+
+// Executes the named template (see ReadTemplate) with the script.
+func (p Project) RenderTemplate(name string, script Script) ([]byte, error) {
+	text, err := p.ReadTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+	return RenderText(filepath.Base(p.TemplateFile(name)), text, script)
+}
+
+// Parses the text of a template and executes it with the script.
+func RenderText(name, text string, script Script) ([]byte, error) {
+	tmpl, err := ParseTemplate(name, text)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, script); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Returns the templates available to the project, sorted by name: script.tmpl, the templates in the templates
+// directory and the built-in templates the project doesn't override.
+func (p Project) Templates() []TemplateInfo {
+	templates := []TemplateInfo{}
+	seen := map[string]bool{}
+	add := func(name, filename, text string) {
+		if !seen[name] {
+			seen[name] = true
+			templates = append(templates, TemplateInfo{Name: name, File: filename, Description: templateDescription(text)})
+		}
+	}
+	if data, err := os.ReadFile(p.TemplateFile("script")); err == nil {
+		add("script", p.TemplateFile("script"), string(data))
+	}
+	entries, _ := os.ReadDir(p.TemplatesDir())
+	for _, entry := range entries {
+		if name, ok := strings.CutSuffix(entry.Name(), ".tmpl"); ok && !entry.IsDir() {
+			data, _ := os.ReadFile(p.TemplatesDir() + "/" + entry.Name())
+			add(name, p.TemplatesDir()+"/"+entry.Name(), string(data))
+		}
+	}
+	for name, text := range BuiltinTemplates {
+		add(name, "", text)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates
+}
+
+// Returns the description in the comment at the start of a template, if any.
+func templateDescription(text string) string {
+	comment, ok := strings.CutPrefix(strings.TrimSpace(text), "{{/*")
+	if !ok {
+		comment, ok = strings.CutPrefix(strings.TrimSpace(text), "{{- /*")
+	}
+	if end := strings.Index(comment, "*/"); ok && end >= 0 {
+		return strings.Join(strings.Fields(comment[:end]), " ")
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/fkmiec/goscript/engine"
+)
+
+// A script can show how it is meant to be run with //goscript:example directives:
+//
+//	//goscript:example backup-db --dry-run
+//	//goscript:example backup-db -target 's3://backups/nightly'
+//
+// The examples are shown by --describe and --list --long, and --try runs the first one after asking, so an
+// unfamiliar script can be tried the way its author intended.
+
+// Splits an example into arguments as a POSIX shell would, honouring single and double quotes and backslashes.
+// Variables, globs and other expansions are not supported.
+func splitArgs(line string) ([]string, error) {
+	args := []string{}
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			arg.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inArg = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 || escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args, nil
+}
+
+// Returns the arguments of an example of the command, without the command name it starts with.
+func exampleArgs(cmd string, example string) ([]string, error) {
+	args, err := splitArgs(example)
+	if err != nil {
+		return nil, fmt.Errorf("invalid example %q: %v", example, err)
+	}
+	if len(args) > 0 && args[0] == cmd {
+		args = args[1:]
+	}
+	return args, nil
+}
+
+// Runs the first example of the named command, after showing it and asking for confirmation. Exits with the
+// command's exit status.
+func tryExample(cmd string) {
+	srcFilename := sourceFile(cmd)
+	if !checkFileExists(srcFilename) {
+		check(fmt.Errorf("no command named %s", cmd), 2, "")
+	}
+	meta := engine.ReadMetadata(srcFilename)
+	if len(meta.Examples) == 0 {
+		check(fmt.Errorf("%s has no examples", cmd), 2, "Add one to the script with a '//goscript:example "+cmd+" <args>' directive.")
+	}
+	args, err := exampleArgs(cmd, meta.Examples[0])
+	check(err, 2, "")
+	if missing := missingRequirements(meta); len(missing) > 0 {
+		reportMissingRequirements(missing)
+		exitProgram(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Example: %s\n", meta.Examples[0])
+	if !offer("Run it?") {
+		cancelled()
+	}
+	if binFilename := hostBinaryPath(cmd); !binaryUpToDate(srcFilename, binFilename) {
+		unlock := lockProject()
+		ok := compileBinary(srcFilename, binFilename)
+		unlock()
+		if !ok {
+			exitProgram(1)
+		}
+	}
+	run := exec.Command(hostBinaryPath(cmd), args...)
+	run.Stdin = os.Stdin
+	run.Stdout = os.Stdout
+	run.Stderr = os.Stderr
+	if err := run.Run(); run.ProcessState == nil {
+		check(err, 2, "")
+	}
+	exitProgram(run.ProcessState.ExitCode())
+}
@@ -2,9 +2,13 @@ module github.com/fkmiec/goscript
 
 go 1.22.1
 
+require golang.org/x/tools v0.30.0
+
 require (
 	github.com/bitfield/script v0.24.1 // indirect
 	github.com/itchyny/gojq v0.12.13 // indirect
 	github.com/itchyny/timefmt-go v0.1.5 // indirect
+	golang.org/x/mod v0.23.0 // indirect
+	golang.org/x/sync v0.11.0 // indirect
 	mvdan.cc/sh/v3 v3.7.0 // indirect
 )
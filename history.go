@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Every successful build of a command saves a copy of its source in .goscript/history/<name>, unless the source
+// is unchanged since the last copy. --versions lists the copies and --exec-rev builds and runs one of them in a
+// scratch command, without touching the current source, for when the latest edit broke a script that is
+// needed now. The newest maxVersions copies of each command are kept.
+
+const maxVersions = 50
+
+type sourceVersion struct {
+	Number int //1 for the oldest copy kept
+	Time   time.Time
+	Hash   string
+	Path   string //a file, or a directory for a directory command
+}
+
+func historyDir(cmd string) string {
+	return stateDir() + "/history/" + cmd
+}
+
+// Returns the saved versions of a command, oldest first.
+func commandVersions(cmd string) []sourceVersion {
+	entries, err := os.ReadDir(historyDir(cmd))
+	if err != nil {
+		return nil
+	}
+	versions := []sourceVersion{}
+	for _, entry := range entries {
+		stamp, hash, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".go"), "-")
+		nanos, err := strconv.ParseInt(stamp, 10, 64)
+		if !ok || err != nil {
+			continue
+		}
+		versions = append(versions, sourceVersion{Time: time.Unix(0, nanos), Hash: hash, Path: historyDir(cmd) + "/" + entry.Name()})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Time.Before(versions[j].Time) })
+	for i := range versions {
+		versions[i].Number = i + 1
+	}
+	return versions
+}
+
+// Saves a copy of a command's source after it is built, if it differs from the newest copy.
+func recordVersion(srcFilename string) {
+	filename := sourceListName(srcFilename)
+	cmd, ok := strings.CutSuffix(filename, ".go")
+	if filename == srcFilename || !ok || strings.HasPrefix(filename, "gocmd-") {
+		return //not a project command
+	}
+	hash := sourcesHash(srcFilename)
+	versions := commandVersions(cmd)
+	if hash == "" || (len(versions) > 0 && strings.HasPrefix(hash, versions[len(versions)-1].Hash)) {
+		return
+	}
+
+	name := fmt.Sprintf("%d-%s", time.Now().UnixNano(), hash[:12])
+	if check(os.MkdirAll(historyDir(cmd), 0755), 0, "Unable to save the version of "+cmd+".") {
+		return
+	}
+	files := commandFiles(srcFilename)
+	dest := historyDir(cmd) + "/" + name + ".go"
+	if dir := sourceDir(srcFilename); dir != "" {
+		//A directory command is saved with its helper files, and its go.mod and go.sum if it is isolated
+		dest = historyDir(cmd) + "/" + name
+		for _, extra := range []string{dir + "/go.mod", dir + "/go.sum"} {
+			if checkFileExists(extra) {
+				files = append(files, extra)
+			}
+		}
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if check(err, 0, "Unable to save the version of "+cmd+".") {
+			return
+		}
+		target := dest
+		if sourceDir(srcFilename) != "" {
+			check(os.MkdirAll(dest, 0755), 0, "")
+			target = dest + "/" + filepath.Base(file)
+		}
+		if check(os.WriteFile(target, data, 0644), 0, "Unable to save the version of "+cmd+".") {
+			return
+		}
+	}
+
+	//Drop the oldest copies
+	versions = commandVersions(cmd)
+	for len(versions) > maxVersions {
+		os.RemoveAll(versions[0].Path)
+		versions = versions[1:]
+	}
+}
+
+// Finds a version of a command by number (as listed by --versions, or negative to count back from the newest,
+// -1 being the version before it), by hash prefix, or by time (the newest version saved at or before it).
+func findVersion(cmd string, rev string) (sourceVersion, error) {
+	versions := commandVersions(cmd)
+	if len(versions) == 0 {
+		return sourceVersion{}, fmt.Errorf("no saved versions of %s", cmd)
+	}
+	if n, err := strconv.Atoi(rev); err == nil {
+		if n < 0 {
+			n = len(versions) + n
+		}
+		if n < 1 || n > len(versions) {
+			return sourceVersion{}, fmt.Errorf("%s has versions 1 to %d", cmd, len(versions))
+		}
+		return versions[n-1], nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02 15:04", "2006-01-02"} {
+		t, err := time.ParseInLocation(layout, rev, time.Local)
+		if err != nil {
+			continue
+		}
+		if layout == "2006-01-02" {
+			t = t.Add(24*time.Hour - 1) //the end of the day
+		}
+		for i := len(versions) - 1; i >= 0; i-- {
+			if !versions[i].Time.After(t) {
+				return versions[i], nil
+			}
+		}
+		return sourceVersion{}, fmt.Errorf("no version of %s was saved by %s", cmd, rev)
+	}
+	matches := []sourceVersion{}
+	for _, version := range versions {
+		if strings.HasPrefix(version.Hash, rev) {
+			matches = append(matches, version)
+		}
+	}
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+	if len(matches) > 1 {
+		return sourceVersion{}, fmt.Errorf("%s matches %d versions of %s", rev, len(matches), cmd)
+	}
+	return sourceVersion{}, fmt.Errorf("no version of %s matches %s", cmd, rev)
+}
+
+// Prints the saved versions of a command.
+func listVersions(cmd string) {
+	versions := commandVersions(cmd)
+	if len(versions) == 0 {
+		fmt.Printf("No saved versions of %s. A version is saved each time the command is built.\n", cmd)
+		return
+	}
+	r := &report{title: "Versions of " + cmd, columns: []string{"Version", "Saved", "Hash"}}
+	for _, version := range versions {
+		r.add(strconv.Itoa(version.Number), version.Time.Format("2006-01-02 15:04:05"), version.Hash)
+	}
+	r.notes = append(r.notes, fmt.Sprintf("Run one with 'goscript --exec-rev %s@<version>'.", cmd))
+	r.print()
+}
+
+// Builds a saved version of a command (given as name@rev) in a scratch command and runs it with args. The
+// current source and binary are left alone. Exits with the version's exit status.
+func execRevision(spec string, args []string) {
+	cmd, rev, ok := strings.Cut(spec, "@")
+	if !ok || cmd == "" || rev == "" {
+		check(fmt.Errorf("invalid --exec-rev %q", spec), 2, "Use <name>@<version>, where version is a number from --versions, a hash prefix or a time (e.g. 2024-05-01 or 2024-05-01T09:30).")
+	}
+	version, err := findVersion(cmd, rev)
+	check(err, 2, "")
+
+	scratch := fmt.Sprintf("gocmd-rev-%d", time.Now().UnixNano())
+	srcFilename := projectDir + "/src/" + scratch + ".go"
+	unlock := lockProject()
+	if info, err := os.Stat(version.Path); err == nil && info.IsDir() {
+		entries, err := os.ReadDir(version.Path)
+		check(err, 2, "")
+		check(os.Mkdir(commandDir(scratch), 0755), 2, "")
+		for _, entry := range entries {
+			copyFile(version.Path+"/"+entry.Name(), commandDir(scratch)+"/"+entry.Name())
+		}
+		srcFilename = commandDir(scratch) + "/main.go"
+	} else {
+		copyFile(version.Path, srcFilename)
+	}
+	fmt.Fprintf(os.Stderr, "Running version %d of %s, saved %s\n", version.Number, cmd, version.Time.Format("2006-01-02 15:04:05"))
+	ok = compileBinary(srcFilename, hostBinaryPath(scratch))
+	unlock()
+	savedErrors.flush()
+	if !ok {
+		cleanTemporaryFiles(scratch)
+		exitProgram(1)
+	}
+
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		cleanTemporaryFiles(scratch)
+		exitProgram(1)
+	}()
+	run := exec.Command(hostBinaryPath(scratch), args...)
+	run.Stdin = os.Stdin
+	run.Stdout = os.Stdout
+	run.Stderr = os.Stderr
+	err = run.Run()
+	cleanTemporaryFiles(scratch)
+	if run.ProcessState == nil {
+		check(err, 2, "")
+	}
+	exitProgram(run.ProcessState.ExitCode())
+}
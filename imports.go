@@ -0,0 +1,65 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/fkmiec/goscript/util"
+)
+
+// Resolves selectors that have no exact mapping in the import mappings against their expansion mappings (see
+// util/resolve.go).
+// The most specific expansion, the one with the longest path, wins. Only expansions covering a module required in
+// go.mod are tried, and all candidate packages are checked with a single go list call.
+func resolveExpansions(mappings map[string]string, selectors []string) map[string]string {
+	resolved := map[string]string{}
+	if len(selectors) == 0 {
+		return resolved
+	}
+
+	expansions := []string{}
+	mods := requiredModules()
+	for _, v := range mappings {
+		if !util.IsExpansion(v) {
+			continue
+		}
+		prefix := util.ExpansionPrefix(v)
+		for _, mod := range mods {
+			if prefix == mod || strings.HasPrefix(prefix, mod+"/") || strings.HasPrefix(mod, prefix+"/") {
+				expansions = append(expansions, v)
+				break
+			}
+		}
+	}
+	if len(expansions) == 0 {
+		return resolved
+	}
+	sort.Slice(expansions, func(i, j int) bool {
+		return len(util.ExpansionPrefix(expansions[i])) > len(util.ExpansionPrefix(expansions[j]))
+	})
+
+	candidates := []string{}
+	for _, selector := range selectors {
+		for _, v := range expansions {
+			if path := util.Expand(v, selector); path != "" {
+				candidates = append(candidates, path)
+			}
+		}
+	}
+	args := append([]string{"list", "-e", "-f", "{{if not .Error}}{{.ImportPath}}{{end}}"}, candidates...)
+	out, _ := goCommand(args...).Output()
+	exists := map[string]bool{}
+	for _, path := range strings.Fields(string(out)) {
+		exists[path] = true
+	}
+
+	for _, selector := range selectors {
+		for _, v := range expansions {
+			if path := util.Expand(v, selector); exists[path] {
+				resolved[selector] = path
+				break
+			}
+		}
+	}
+	return resolved
+}
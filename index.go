@@ -0,0 +1,228 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"go/parser"
+	"go/token"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// The import index records the packages each source in the project imports and the modules it depends on.
+// It is kept in .goscript/index.json and refreshed incrementally: an entry is recomputed only when its source
+// has changed, or a module it depends on has changed version, since it was indexed. A change to go.mod that
+// leaves those modules alone (a --goget for another command, say) keeps the entry. Selective recompiles,
+// --unused and the decision to run go mod tidy after a delete all read it instead of parsing every source and
+// running go list each time.
+
+type indexEntry struct {
+	Hash       string            `json:"hash"`                 //of the source file(s)
+	GoMod      string            `json:"gomod"`                //hash of go.mod when the versions were last checked
+	Imports    []string          `json:"imports"`              //import paths, as written in the source
+	Modules    []string          `json:"modules"`              //modules the command depends on, directly or indirectly
+	Versions   map[string]string `json:"versions"`             //the version of each of the modules (and its replacement)
+	Incomplete bool              `json:"incomplete,omitempty"` //some packages couldn't be resolved, e.g. a module is missing
+}
+
+func importIndexFile() string {
+	return stateDir() + "/index.json"
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func fileHash(filename string) string {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return ""
+	}
+	return hashBytes(data)
+}
+
+func readImportIndex() map[string]indexEntry {
+	index := map[string]indexEntry{}
+	if data, err := os.ReadFile(importIndexFile()); err == nil {
+		json.Unmarshal(data, &index)
+	}
+	return index
+}
+
+func writeImportIndex(index map[string]indexEntry) {
+	data, err := json.MarshalIndent(index, "", "    ")
+	if check(err, 0, "") || check(os.MkdirAll(stateDir(), 0755), 0, "") {
+		return
+	}
+	//A reader never sees a partly written index, and two writers don't share a temporary file
+	check(writeFileAtomic(importIndexFile(), data, 0644), 0, "Unable to save the import index.")
+}
+
+// Indexes a source file in the project src directory. Soft-deleted sources (no .go extension) are parsed for
+// their imports, but go list can't resolve their modules. Returns false if the source couldn't be indexed.
+func indexSource(filename string, hash string, goMod string) (indexEntry, bool) {
+	entry := indexEntry{Hash: hash, GoMod: goMod, Imports: []string{}, Modules: []string{}, Versions: map[string]string{}}
+	srcFilename := sourcePath(filename)
+	seenImports := map[string]bool{}
+	for _, file := range commandFiles(srcFilename) {
+		f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.ImportsOnly)
+		if check(err, 0, "Unable to index "+filename+".") {
+			return entry, false
+		}
+		for _, spec := range f.Imports {
+			if path, err := strconv.Unquote(spec.Path.Value); err == nil && !seenImports[path] {
+				entry.Imports = append(entry.Imports, path)
+				seenImports[path] = true
+			}
+		}
+	}
+	if !strings.HasSuffix(filename, ".go") {
+		return entry, true
+	}
+	out, err := goCommandIn(moduleDir(srcFilename), "list", "-e", "-deps", "-f", "{{if .Error}}!{{else}}{{with .Module}}{{if not .Main}}"+moduleVersionFormat+"{{end}}{{end}}{{end}}", buildTarget(srcFilename)).Output()
+	if check(err, 0, "Unable to list the dependencies of "+filename+".") {
+		return entry, false
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if line == "!" {
+			entry.Incomplete = true
+		} else if mod, version, ok := strings.Cut(line, "\t"); ok {
+			if _, seen := entry.Versions[mod]; !seen {
+				entry.Modules = append(entry.Modules, mod)
+				entry.Versions[mod] = version
+			}
+		}
+	}
+	return entry, true
+}
+
+// A go list template printing a module's path, then a tab and its version, with its replacement in parentheses.
+const moduleVersionFormat = "{{.Path}}\t{{.Version}}{{with .Replace}} ({{.Path}}{{with .Version}}@{{.}}{{end}}){{end}}"
+
+// Returns the version of each module in the build list of the module in dir, as printed by moduleVersionFormat.
+func buildList(dir string) map[string]string {
+	versions := map[string]string{}
+	out, err := goCommandIn(dir, "list", "-m", "-e", "-f", "{{if not .Main}}"+moduleVersionFormat+"{{end}}", "all").Output()
+	if check(err, 0, "Unable to list the modules of "+dir+".") {
+		return versions
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if mod, version, ok := strings.Cut(line, "\t"); ok {
+			versions[mod] = version
+		}
+	}
+	return versions
+}
+
+// Reports whether an entry's modules are still at the versions it was indexed with. The build list is only
+// consulted when go.mod has changed since the entry was last checked.
+func (entry indexEntry) current(goMod string, buildList func() map[string]string) bool {
+	if entry.GoMod == goMod {
+		return true
+	}
+	//Whatever was missing may have been added since
+	if entry.Incomplete || len(entry.Versions) != len(entry.Modules) {
+		return false
+	}
+	versions := buildList()
+	for mod, version := range entry.Versions {
+		if versions[mod] != version {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the import index for every source in the project, keyed by source file name (e.g. "hello.go", or "hello"
+// if soft-deleted). Stale entries are refreshed and entries for removed sources are dropped.
+func importIndex() map[string]indexEntry {
+	index := readImportIndex()
+	projectGoMod := fileHash(projectDir + "/go.mod")
+	byHash := map[string]indexEntry{}
+	for _, entry := range index {
+		byHash[entry.Hash] = entry
+	}
+
+	//Listed once for each module (the project's, or an isolated command's), if any entry needs it
+	buildLists := map[string]map[string]string{}
+	changed := false
+	current := map[string]indexEntry{}
+	for _, filename := range getSourceList() {
+		srcFilename := sourcePath(filename)
+		hash := sourcesHash(srcFilename)
+		dir := moduleDir(srcFilename)
+		goMod := projectGoMod
+		if dir != projectDir {
+			goMod = fileHash(dir + "/go.mod") //an isolated command has its own
+		}
+		modules := func() map[string]string {
+			if buildLists[dir] == nil {
+				buildLists[dir] = buildList(dir)
+			}
+			return buildLists[dir]
+		}
+		if entry, ok := index[filename]; ok && entry.Hash == hash && entry.current(goMod, modules) {
+			changed = changed || entry.GoMod != goMod
+			entry.GoMod = goMod
+			current[filename] = entry
+			continue
+		}
+		changed = true
+		//A renamed source (e.g. soft delete or restore) keeps its imports; only its modules may need listing
+		if entry, ok := byHash[hash]; ok && entry.current(goMod, modules) && (len(entry.Modules) > 0 || !strings.HasSuffix(filename, ".go")) {
+			entry.GoMod = goMod
+			current[filename] = entry
+			continue
+		}
+		if entry, ok := indexSource(filename, hash, goMod); ok {
+			current[filename] = entry
+		}
+	}
+	if changed || len(current) != len(index) {
+		writeImportIndex(current)
+	}
+	return current
+}
+
+// Updates the index entry for one source file, e.g. after it is saved and built.
+func updateImportIndex(srcFilename string) {
+	filename := sourceListName(srcFilename)
+	if filename == srcFilename || strings.HasPrefix(filename, "gocmd-") {
+		return //not a project command
+	}
+	index := readImportIndex()
+	entry, ok := indexSource(filename, sourcesHash(srcFilename), fileHash(moduleDir(srcFilename)+"/go.mod"))
+	if !ok {
+		return
+	}
+	index[filename] = entry
+	writeImportIndex(index)
+}
+
+// Returns the modules that the given command depends on and no other command using the project go.mod (not
+// soft-deleted or isolated) does. The second result is false if the command isn't in the index.
+func exclusiveModules(index map[string]indexEntry, cmd string) ([]string, bool) {
+	entry, ok := index[cmd+".go"]
+	if !ok {
+		return nil, false
+	}
+	shared := map[string]bool{}
+	for filename, other := range index {
+		if filename == cmd+".go" || !strings.HasSuffix(filename, ".go") || isIsolated(strings.TrimSuffix(filename, ".go")) {
+			continue
+		}
+		for _, mod := range other.Modules {
+			shared[mod] = true
+		}
+	}
+	exclusive := []string{}
+	for _, mod := range entry.Modules {
+		if !shared[mod] {
+			exclusive = append(exclusive, mod)
+		}
+	}
+	return exclusive, true
+}
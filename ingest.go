@@ -0,0 +1,385 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// --ingest <dir> brings a directory of loose Go scripts into the project. Each .go file with a main function at
+// the top of the directory becomes a single-file command, and each subdirectory holding a main package becomes a
+// directory command, named after the file or subdirectory. Scripts are normalized on the way in: shebang lines
+// and "//go:build ignore" constraints (which keep go run scripts out of normal builds) are removed, statements
+// without a package clause (goscript shebang scripts) are wrapped like --code, and the result is gofmt'ed.
+//
+// The modules required by a script's go.mod (its own, or the one at the top of the directory) are added to the
+// project go.mod. A script that needs a newer version of a module than the project has gets a copy of the go.mod
+// and becomes an isolated command instead, so the other commands are unaffected. A script with the name of a command
+// in the project is resolved as a conflict (see merge.go): the command is kept, replaced (its source stays in its
+// --versions) or the script is added under another name. Everything ingested is compiled and the results reported.
+
+type ingestedScript struct {
+	name   string
+	origin string   //the file or directory the script came from
+	files  []string //its Go files, the one with the main function first
+	gomod  string   //the go.mod that applies to it, its own or the one at the top of the directory, if any
+	taken  bool     //its name is that of a command in the project
+}
+
+var buildIgnoreMatcher = regexp.MustCompile(`(?m)^//( \+build|go:build) ignore\s*\n`)
+
+// Returns true if the Go source declares package main with a main function. Source without a package clause is
+// a goscript script, which is wrapped in a main function.
+func hasMainFunc(src []byte) bool {
+	if needsWrapping(string(src)) {
+		return true
+	}
+	f, err := parser.ParseFile(token.NewFileSet(), "", src, parser.SkipObjectResolution)
+	if err != nil || f.Name.Name != "main" {
+		return false
+	}
+	for _, decl := range f.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == "main" {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the Go files (not tests) in a directory, sorted.
+func goFilesIn(dir string) []string {
+	files := []string{}
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		if name := entry.Name(); !entry.IsDir() && strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	return files
+}
+
+// Finds the scripts in a directory. Returns them sorted by name, and what was left out and why.
+func scanScripts(dir string) ([]ingestedScript, map[string]string) {
+	scripts := []ingestedScript{}
+	skipped := map[string]string{}
+	rootMod := ""
+	if checkFileExists(filepath.Join(dir, "go.mod")) {
+		rootMod = filepath.Join(dir, "go.mod")
+	}
+	for _, filename := range goFilesIn(dir) {
+		data, err := os.ReadFile(filename)
+		if err != nil || !hasMainFunc(data) {
+			skipped[filename] = "no main function"
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(filename), ".go")
+		scripts = append(scripts, ingestedScript{name: name, origin: filename, files: []string{filename}, gomod: rootMod})
+	}
+
+	entries, err := os.ReadDir(dir)
+	check(err, 2, "")
+	for _, entry := range entries {
+		sub := filepath.Join(dir, entry.Name())
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || entry.Name() == "vendor" || entry.Name() == "testdata" {
+			continue
+		}
+		files := goFilesIn(sub)
+		if len(files) == 0 {
+			continue
+		}
+		script := ingestedScript{name: entry.Name(), origin: sub, gomod: rootMod}
+		if checkFileExists(filepath.Join(sub, "go.mod")) {
+			script.gomod = filepath.Join(sub, "go.mod")
+		}
+		for _, filename := range files {
+			data, _ := os.ReadFile(filename)
+			if hasMainFunc(data) {
+				script.files = append([]string{filename}, script.files...)
+			} else {
+				script.files = append(script.files, filename)
+			}
+		}
+		first, _ := os.ReadFile(script.files[0])
+		switch {
+		case !hasMainFunc(first):
+			skipped[sub] = "no main function"
+			continue
+		case len(script.files) > 1 && filepath.Base(script.files[0]) != "main.go" && checkFileExists(filepath.Join(sub, "main.go")):
+			skipped[sub] = "main.go has no main function"
+			continue
+		}
+		scripts = append(scripts, script)
+	}
+
+	//A name used by another script or a deleted command is left out. One used by a command is a conflict to resolve.
+	sort.SliceStable(scripts, func(i, j int) bool { return scripts[i].name < scripts[j].name })
+	kept := []ingestedScript{}
+	for i, script := range scripts {
+		switch {
+		case i > 0 && scripts[i-1].name == script.name:
+			skipped[script.origin] = fmt.Sprintf("%s is also the name of %s", script.name, scripts[i-1].origin)
+		case checkFileExists(sourceFile(script.name)):
+			script.taken = true
+			kept = append(kept, script)
+		case checkFileExists(strings.TrimSuffix(sourceFile(script.name), ".go")):
+			skipped[script.origin] = fmt.Sprintf("the project has a deleted command named %s (see --restore)", script.name)
+		default:
+			kept = append(kept, script)
+		}
+	}
+	return kept, skipped
+}
+
+// Returns a script's source in the form the project keeps it in.
+func normalizeScript(data []byte) []byte {
+	data = readSourceData(data).Bytes()
+	if needsWrapping(string(data)) {
+		data = wrapCode(string(data)).Bytes()
+	}
+	data = buildIgnoreMatcher.ReplaceAll(data, nil)
+	if formatted, err := format.Source(data); err == nil {
+		data = formatted
+	}
+	return data
+}
+
+// Returns the modules required directly by a go.mod file, with their versions.
+func goModRequirements(gomod string) (map[string]string, error) {
+	out, err := goCommandIn(filepath.Dir(gomod), "mod", "edit", "-json").Output()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %v", gomod, err)
+	}
+	var mod struct {
+		Require []struct {
+			Path     string
+			Version  string
+			Indirect bool
+		}
+	}
+	if err := json.Unmarshal(out, &mod); err != nil {
+		return nil, err
+	}
+	reqs := map[string]string{}
+	for _, req := range mod.Require {
+		if !req.Indirect {
+			reqs[req.Path] = req.Version
+		}
+	}
+	return reqs, nil
+}
+
+// Compares two module versions (e.g. v1.2.3, v1.2.3-pre, or a pseudo-version), returning -1, 0 or 1.
+func compareVersions(a, b string) int {
+	relA, preA, _ := strings.Cut(strings.TrimPrefix(a, "v"), "-")
+	relB, preB, _ := strings.Cut(strings.TrimPrefix(b, "v"), "-")
+	partsA, partsB := strings.Split(relA, "."), strings.Split(relB, ".")
+	for i := 0; i < max(len(partsA), len(partsB)); i++ {
+		var x, y int
+		if i < len(partsA) {
+			x, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			y, _ = strconv.Atoi(partsB[i])
+		}
+		if x < y {
+			return -1
+		} else if x > y {
+			return 1
+		}
+	}
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "": //a release is newer than its pre-releases
+		return 1
+	case preB == "":
+		return -1
+	}
+	return strings.Compare(preA, preB)
+}
+
+// Copies a script into the project, giving it its own module if it needs newer modules than the project has.
+// Returns a note for the report, or an error if the script couldn't be added.
+func ingestScript(script ingestedScript, projectVersions map[string]string) (string, error) {
+	missing := map[string]string{}
+	newer := []string{}
+	if script.gomod != "" {
+		reqs, err := goModRequirements(script.gomod)
+		if err != nil {
+			return "", err
+		}
+		for path, version := range reqs {
+			if have, ok := projectVersions[path]; !ok {
+				missing[path] = version
+			} else if compareVersions(version, have) > 0 {
+				newer = append(newer, fmt.Sprintf("%s %s (project has %s)", path, version, have))
+			}
+		}
+	}
+	isolated := len(newer) > 0
+
+	srcFilename := projectDir + "/src/" + script.name + ".go"
+	if len(script.files) > 1 || isolated {
+		srcFilename = commandDir(script.name) + "/main.go"
+	}
+	if err := os.MkdirAll(filepath.Dir(srcFilename), 0755); err != nil {
+		return "", err
+	}
+	for i, filename := range script.files {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return "", err
+		}
+		dest := srcFilename
+		if i > 0 {
+			dest = filepath.Join(filepath.Dir(srcFilename), filepath.Base(filename))
+		}
+		if err := os.WriteFile(dest, normalizeScript(data), 0644); err != nil {
+			return "", err
+		}
+	}
+
+	if isolated {
+		sort.Strings(newer)
+		for _, file := range []string{"go.mod", "go.sum"} {
+			if checkFileExists(filepath.Join(filepath.Dir(script.gomod), file)) {
+				copyFile(filepath.Join(filepath.Dir(script.gomod), file), filepath.Join(commandDir(script.name), file))
+			}
+		}
+		return "isolated, it needs " + strings.Join(newer, ", "), nil
+	}
+	paths := []string{}
+	for path := range missing {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if out, err := goModify(projectDir, "get", path+"@"+missing[path]); err != nil {
+			return "", fmt.Errorf("go get %s@%s: %s", path, missing[path], strings.TrimSpace(string(out)))
+		}
+		projectVersions[path] = missing[path]
+	}
+	if len(paths) > 0 {
+		return "added " + strings.Join(paths, ", "), nil
+	}
+	return "", nil
+}
+
+// Resolves the conflicts of scripts with the names of commands in the project. Returns the scripts to add, with
+// the scripts renamed or marked taken to replace the commands; those left out are added to skipped.
+func resolveIngestConflicts(scripts []ingestedScript, skipped map[string]string) []ingestedScript {
+	names := map[string]bool{}
+	for _, script := range scripts {
+		names[script.name] = true
+	}
+	taken := func(name string) bool {
+		return names[name] || checkFileExists(sourceFile(name)) || checkFileExists(strings.TrimSuffix(sourceFile(name), ".go"))
+	}
+	resolved := []ingestedScript{}
+	for _, script := range scripts {
+		if !script.taken {
+			resolved = append(resolved, script)
+			continue
+		}
+		local, _ := os.ReadFile(sourceFile(script.name))
+		incoming, _ := os.ReadFile(script.files[0])
+		if string(local) == string(normalizeScript(incoming)) && len(script.files) == 1 {
+			skipped[script.origin] = fmt.Sprintf("the same as the project's command %s", script.name)
+			continue
+		}
+		switch choice, name := resolveConflict(conflict{kind: "command", name: script.name, local: string(local), incoming: string(normalizeScript(incoming)), taken: taken, valid: validCommandName}); choice {
+		case "take":
+			resolved = append(resolved, script)
+		case "rename":
+			script.name, script.taken = name, false
+			names[name] = true
+			resolved = append(resolved, script)
+		default:
+			skipped[script.origin] = fmt.Sprintf("kept the project's command %s", script.name)
+		}
+	}
+	return resolved
+}
+
+// Removes the source of a command that an ingested script replaces, after saving it in the command's versions.
+func replaceCommandSource(cmd string) {
+	srcFilename := sourceFile(cmd)
+	recordVersion(srcFilename)
+	if isDirCommand(cmd) {
+		check(os.RemoveAll(commandDir(cmd)), 2, "")
+	} else {
+		check(os.Remove(srcFilename), 2, "")
+	}
+}
+
+// Brings the scripts in a directory into the project and compiles them (see --ingest).
+func ingestScripts(dir string) {
+	info, err := os.Stat(dir)
+	if err == nil && !info.IsDir() {
+		err = fmt.Errorf("%s is not a directory", dir)
+	}
+	check(err, 2, "")
+	scripts, skipped := scanScripts(dir)
+	if len(scripts) == 0 && len(skipped) == 0 {
+		fmt.Printf("No Go scripts found in %s\n", dir)
+		return
+	}
+
+	scripts = resolveIngestConflicts(scripts, skipped)
+	r := &report{title: "Ingest", columns: []string{"Result", "Command", "From", "Note"}, indent: "  "}
+	if len(scripts) > 0 {
+		summary := fmt.Sprintf("Add %d command(s) from %s to the project:", len(scripts), dir)
+		for _, script := range scripts {
+			summary += "\n  " + script.name
+			if script.taken {
+				summary += " (replacing the project's command)"
+			}
+		}
+		if !confirm(summary) {
+			cancelled()
+		}
+	}
+	passed, failed := 0, 0
+	projectVersions := moduleVersions()
+	for _, script := range scripts {
+		if script.taken {
+			replaceCommandSource(script.name)
+		}
+		note, err := ingestScript(script, projectVersions)
+		if err == nil && !compileBinary(sourceFile(script.name), binaryPath(script.name)) {
+			err = fmt.Errorf("failed to compile")
+		}
+		if err != nil {
+			r.add("FAIL", script.name, script.origin, err.Error())
+			failed++
+			continue
+		}
+		if script.taken {
+			note = strings.TrimSuffix("replaced the project's command (its old source is in --versions); "+note, "; ")
+		}
+		r.add("ok", script.name, script.origin, note)
+		passed++
+	}
+	origins := []string{}
+	for origin := range skipped {
+		origins = append(origins, origin)
+	}
+	sort.Strings(origins)
+	for _, origin := range origins {
+		r.add("skip", "", origin, skipped[origin])
+	}
+	r.notes = append(r.notes, fmt.Sprintf("Ingested %d script(s): %d ok, %d failed, %d skipped", passed+failed, passed, failed, len(skipped)))
+	r.print()
+	if failed > 0 {
+		exitProgram(1)
+	}
+}
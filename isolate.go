@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// An isolated command has a module of its own: it is a directory command (see sources.go) with a go.mod beside
+// its main.go. Its dependencies are fetched into its own go.mod, so they don't bloat the project go.mod, and
+// go mod tidy in the project can't remove a module it needs.
+
+func isIsolated(cmd string) bool {
+	return project().IsIsolated(cmd)
+}
+
+func moduleDir(srcFilename string) string {
+	return project().ModuleDir(srcFilename)
+}
+
+// Returns the module directory and the source file of the named command, for --goget and --gotidy with --name.
+// Without a name, the module is the project's. Exits if there is no such command.
+func commandModule(cmd string) (string, string) {
+	if cmd == "" {
+		return projectDir, ""
+	}
+	srcFilename := sourceFile(cmd)
+	if !checkFileExists(srcFilename) && !isIsolated(cmd) {
+		check(fmt.Errorf("no command named %s", cmd), 2, "")
+	}
+	return moduleDir(srcFilename), srcFilename
+}
+
+// Recompiles an isolated command after its module changed, unless its main.go is yet to be written.
+func recompileIsolated(srcFilename string) {
+	if checkFileExists(srcFilename) {
+		recompileCommands([]string{sourceListName(srcFilename)}, false, true)
+	}
+}
+
+// Creates an exec.Cmd for the go tool that runs in the given module directory.
+func goCommandIn(dir string, args ...string) *exec.Cmd {
+	cmd := goCommand(args...)
+	cmd.Dir = dir
+	return cmd
+}
+
+// Gives a command a module of its own. A single-file command is moved into a directory first. The command's
+// dependencies are added to the new go.mod; modules in the project go.mod that only this command used are left
+// for --gotidy to remove. For new code, only the directory and go.mod are created.
+func isolateCommand(cmd string) {
+	if isIsolated(cmd) {
+		return
+	}
+	dir := commandDir(cmd)
+	existing := isDirCommand(cmd)
+	if !existing {
+		if checkFileExists(dir) {
+			check(fmt.Errorf("%s already exists", dir), 2, "The command can't be given a module of its own.")
+		}
+		check(os.Mkdir(dir, 0755), 2, "")
+		srcFilename := projectDir + "/src/" + cmd + ".go"
+		if checkFileExists(srcFilename) {
+			check(os.Rename(srcFilename, dir+"/main.go"), 2, "")
+			existing = true
+		}
+	}
+
+	modulePath := sanitizeModuleName(cmd)
+	if project := moduleName(); project != "" {
+		modulePath = project + "/" + modulePath
+	}
+	out, err := goCommandIn(dir, "mod", "init", modulePath).CombinedOutput()
+	check(err, 2, fmt.Sprintf("%v: %s", err, out))
+	if existing {
+		goTidyIn(dir)
+	}
+	fmt.Printf("Command %s has its own module %s in %s\n", cmd, modulePath, dir)
+}
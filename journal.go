@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Destructive operations (delete, export, export-bin) are recorded in an operations journal so that
+// --undo-last can reverse them. Files removed from the project are moved to a trash area rather than
+// deleted, and each journal entry lists the moves it made. --update-deps records the module changes it
+// made, for review; those are undone with --rollback-config rather than --undo-last.
+
+type fileMove struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type journalEntry struct {
+	ID      int64          `json:"id"`
+	Time    time.Time      `json:"time"`
+	Op      string         `json:"op"`
+	Command string         `json:"command"`
+	Moves   []fileMove     `json:"moves"`
+	Changes []moduleChange `json:"changes,omitempty"`
+	Undone  bool           `json:"undone,omitempty"`
+}
+
+// Directory for state goscript keeps in the project (journal, trash, caches).
+// Go tooling ignores directories starting with a dot, so nothing here is mistaken for a package.
+func stateDir() string {
+	return projectDir + "/.goscript"
+}
+
+func journalFile() string {
+	return stateDir() + "/journal.jsonl"
+}
+
+// Returns the trash directory for the given journal entry.
+func trashDir(id int64) string {
+	return fmt.Sprintf("%s/trash/%d", stateDir(), id)
+}
+
+// Starts a new journal entry. Moves are added with entry.move and the entry is saved with recordOperation.
+func newJournalEntry(op, cmd string) *journalEntry {
+	return &journalEntry{ID: time.Now().UnixNano(), Time: time.Now(), Op: op, Command: cmd}
+}
+
+// Moves a file and remembers the move so it can be undone.
+func (entry *journalEntry) move(from, to string) error {
+	err := moveFile(from, to)
+	if err == nil {
+		entry.Moves = append(entry.Moves, fileMove{From: from, To: to})
+	}
+	return err
+}
+
+// Moves a file into the entry's trash directory.
+func (entry *journalEntry) trash(filename string) error {
+	return entry.move(filename, trashDir(entry.ID)+"/"+filepath.Base(filename))
+}
+
+// Moves a file, falling back to copy and remove when a rename isn't possible (e.g. across filesystems).
+func moveFile(from, to string) error {
+	err := os.MkdirAll(filepath.Dir(to), 0755)
+	if err != nil {
+		return err
+	}
+	if os.Rename(from, to) == nil {
+		return nil
+	}
+	info, err := os.Stat(from)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(to, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err = out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(from)
+}
+
+func readJournal() []journalEntry {
+	entries := []journalEntry{}
+	file, err := os.Open(journalFile())
+	if err != nil {
+		return entries
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry journalEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func writeJournal(entries []journalEntry) {
+	err := os.MkdirAll(stateDir(), 0755)
+	check(err, 2, "")
+	file, err := os.Create(journalFile())
+	check(err, 2, "Unable to write "+journalFile())
+	defer file.Close()
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		check(err, 2, "")
+		file.Write(append(line, '\n'))
+	}
+}
+
+// Appends an operation to the journal.
+func recordOperation(entry *journalEntry) {
+	if len(entry.Moves) == 0 && len(entry.Changes) == 0 {
+		return
+	}
+	err := os.MkdirAll(stateDir(), 0755)
+	check(err, 1, "")
+	file, err := os.OpenFile(journalFile(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if check(err, 1, "Unable to record operation in "+journalFile()) {
+		return
+	}
+	defer file.Close()
+	line, err := json.Marshal(entry)
+	check(err, 2, "")
+	file.Write(append(line, '\n'))
+}
+
+// Reverses the most recent destructive operation that hasn't already been undone.
+func undoLast() {
+	entries := readJournal()
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := &entries[i]
+		if entry.Undone || len(entry.Moves) == 0 {
+			continue
+		}
+		//Skip, rather than clobber, an operation whose files have been recreated since; the ones before it can
+		//still be undone
+		if m, ok := recreatedMove(entry); ok {
+			fmt.Fprintf(os.Stderr, "warning: skipping the %s of %s from %s: %s has been recreated since\n", entry.Op, entry.Command, entry.Time.Format(time.DateTime), m.From)
+			continue
+		}
+		if !confirm(fmt.Sprintf("This will undo the %s of %s from %s.", entry.Op, entry.Command, entry.Time.Format(time.DateTime))) {
+			cancelled()
+		}
+		for j := len(entry.Moves) - 1; j >= 0; j-- {
+			m := entry.Moves[j]
+			err := moveFile(m.To, m.From)
+			check(err, 2, fmt.Sprintf("Unable to restore %s.", m.From))
+		}
+		os.RemoveAll(trashDir(entry.ID))
+		entry.Undone = true
+		writeJournal(entries)
+		fmt.Printf("Undid %s of %s\n", entry.Op, entry.Command)
+		return
+	}
+	fmt.Println("Nothing to undo.")
+}
+
+// Returns the first move of an entry whose original path exists again.
+func recreatedMove(entry *journalEntry) (fileMove, bool) {
+	for _, m := range entry.Moves {
+		if checkFileExists(m.From) {
+			return m, true
+		}
+	}
+	return fileMove{}, false
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/fkmiec/goscript/engine"
+)
+
+// Licenses that are reported as disallowed unless GOSCRIPT_DISALLOWED_LICENSES says otherwise.
+// The variable takes a comma-separated list of license identifiers, or "none".
+const defaultDisallowedLicenses = "AGPL-3.0,GPL-2.0,GPL-3.0"
+
+type moduleLicense struct {
+	Path    string
+	Version string
+	License string
+}
+
+// Identifying phrases for common licenses, checked in order so that more specific licenses match first.
+var licensePatterns = []struct {
+	id      string
+	pattern *regexp.Regexp
+}{
+	{"AGPL-3.0", regexp.MustCompile(`(?i)GNU AFFERO GENERAL PUBLIC LICENSE`)},
+	{"LGPL-3.0", regexp.MustCompile(`(?is)GNU LESSER GENERAL PUBLIC LICENSE.*Version 3`)},
+	{"LGPL-2.1", regexp.MustCompile(`(?i)GNU LESSER GENERAL PUBLIC LICENSE|GNU LIBRARY GENERAL PUBLIC LICENSE`)},
+	{"GPL-3.0", regexp.MustCompile(`(?is)GNU GENERAL PUBLIC LICENSE.*Version 3`)},
+	{"GPL-2.0", regexp.MustCompile(`(?is)GNU GENERAL PUBLIC LICENSE.*Version 2`)},
+	{"MPL-2.0", regexp.MustCompile(`(?i)Mozilla Public License,? (Version|v\.) ?2\.0`)},
+	{"Apache-2.0", regexp.MustCompile(`(?is)Apache License.*Version 2\.0`)},
+	{"BSD-3-Clause", regexp.MustCompile(`(?is)Redistribution and use in source and binary forms.*Neither the name`)},
+	{"BSD-2-Clause", regexp.MustCompile(`(?i)Redistribution and use in source and binary forms`)},
+	{"MIT", regexp.MustCompile(`(?i)Permission is hereby granted, free of charge`)},
+	{"ISC", regexp.MustCompile(`(?i)Permission to use, copy, modify, and(/or)? distribute this software for any purpose`)},
+	{"Unlicense", regexp.MustCompile(`(?i)This is free and unencumbered software released into the public domain`)},
+	{"CC0-1.0", regexp.MustCompile(`(?i)CC0 1\.0 Universal`)},
+}
+
+// Identifies the license of a module from the license file in its root directory.
+func detectLicense(dir string) string {
+	if dir == "" {
+		return "unknown (not downloaded)"
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "unknown"
+	}
+	for _, entry := range entries {
+		name := strings.ToUpper(entry.Name())
+		if entry.IsDir() || !(strings.HasPrefix(name, "LICENSE") || strings.HasPrefix(name, "LICENCE") || strings.HasPrefix(name, "COPYING")) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		for _, p := range licensePatterns {
+			if p.pattern.Match(data) {
+				return p.id
+			}
+		}
+	}
+	return "unknown"
+}
+
+// Returns the dependency modules of a command, or of the whole project if name is blank.
+func dependencyModules(name string) []moduleLicense {
+	var args []string
+	dir := projectDir
+	if name == "" {
+		args = []string{"list", "-m", "-f", "{{if not .Main}}{{.Path}}\t{{.Version}}\t{{.Dir}}{{end}}", "all"}
+	} else {
+		srcFilename := sourceFile(name)
+		dir = moduleDir(srcFilename)
+		if !checkFileExists(srcFilename) {
+			check(fmt.Errorf("no command named %s", name), 2, "")
+		}
+		args = []string{"list", "-deps", "-f", "{{with .Module}}{{if not .Main}}{{.Path}}\t{{.Version}}\t{{.Dir}}{{end}}{{end}}", buildTarget(srcFilename)}
+	}
+	out, err := goCommandIn(dir, args...).Output()
+	check(err, 2, "Unable to resolve the module graph.")
+
+	mods := []moduleLicense{}
+	seen := map[string]bool{}
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 || seen[fields[0]] {
+			continue
+		}
+		seen[fields[0]] = true
+		mods = append(mods, moduleLicense{Path: fields[0], Version: fields[1], License: detectLicense(fields[2])})
+	}
+	sort.Slice(mods, func(i, j int) bool { return mods[i].Path < mods[j].Path })
+	return mods
+}
+
+// Returns the disallowed license identifiers from GOSCRIPT_DISALLOWED_LICENSES or the default list.
+func disallowedLicenses() []string {
+	value, ok := os.LookupEnv("GOSCRIPT_DISALLOWED_LICENSES")
+	if !ok {
+		value = defaultDisallowedLicenses
+	}
+	if strings.EqualFold(strings.TrimSpace(value), "none") {
+		return nil
+	}
+	return engine.SplitList(value)
+}
+
+// Prints the license of each dependency of a command (or of the project if name is "all") and exits with a
+// nonzero status if any of them is disallowed.
+func licenseReport(name string) {
+	if name == "all" {
+		name = ""
+	}
+	mods := dependencyModules(name)
+	if len(mods) == 0 {
+		fmt.Println("No third-party dependencies.")
+		return
+	}
+
+	disallowed := disallowedLicenses()
+	flagged := 0
+	unknown := 0
+	r := &report{title: "Dependency licenses", columns: []string{"Module", "Version", "License", "Note"}}
+	for _, mod := range mods {
+		note := ""
+		if slices.Contains(disallowed, mod.License) {
+			note = "DISALLOWED"
+			flagged++
+		} else if strings.HasPrefix(mod.License, "unknown") {
+			note = "check manually"
+			unknown++
+		}
+		r.add(mod.Path, mod.Version, mod.License, note)
+	}
+	r.print()
+
+	if unknown > 0 {
+		fmt.Fprintf(os.Stderr, "%d module(s) have a license that could not be identified.\n", unknown)
+	}
+	if flagged > 0 {
+		check(errors.New("disallowed licenses found"), 2, fmt.Sprintf("%d module(s) use a disallowed license (%s). Set GOSCRIPT_DISALLOWED_LICENSES to change the list.", flagged, strings.Join(disallowed, ", ")))
+	}
+}
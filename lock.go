@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Operations that change src, bin, go.mod or imports.json hold an exclusive lock on the project so that
+// concurrent goscript processes (e.g. --recompile and --goget) can't interleave and corrupt its state.
+// The lock is released when the process exits, even if it exits early on an error: through exitProgram, which
+// releases the locks still held, where the exit skips deferred releases.
+
+const defaultLockTimeout = 2 * time.Minute
+
+func projectLockFile() string {
+	return stateDir() + "/project.lock"
+}
+
+// How long to wait for another goscript to release the lock. Set GOSCRIPT_LOCK_TIMEOUT (e.g. "30s") to change it.
+func lockTimeout() time.Duration {
+	if value := os.Getenv("GOSCRIPT_LOCK_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if !check(err, 1, "Ignoring invalid GOSCRIPT_LOCK_TIMEOUT.") {
+			return timeout
+		}
+	}
+	return defaultLockTimeout
+}
+
+// Acquires an exclusive lock on the given lock file, waiting up to the timeout if another process holds it.
+// Returns a function that releases the lock. Exits if the lock can't be acquired.
+func acquireLock(filename string, timeout time.Duration, what string) func() {
+	release, err := tryAcquireLock(filename, timeout, what)
+	check(err, 2, "")
+	return release
+}
+
+// Like acquireLock, but returns an error instead of exiting. A zero timeout doesn't wait at all and a negative
+// one waits indefinitely.
+func tryAcquireLock(filename string, timeout time.Duration, what string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open lock file %s: %w", filename, err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	waiting := false
+	for !tryLock(file) {
+		holder := lockHolder(filename)
+		if timeout == 0 {
+			file.Close()
+			return nil, fmt.Errorf("%s is held by another goscript%s", what, holder)
+		}
+		if timeout > 0 && time.Now().After(deadline) {
+			file.Close()
+			return nil, fmt.Errorf("another goscript is running%s; timed out after %v waiting for %s", holder, timeout, what)
+		}
+		if !waiting {
+			fmt.Fprintf(os.Stderr, "Another goscript is running%s. Waiting for %s ...\n", holder, what)
+			waiting = true
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	//Record the holder so anyone waiting can tell who has the lock
+	file.Truncate(0)
+	file.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+
+	//The release may be called more than once, e.g. by a signal handler and by the code it interrupts
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			heldLocks.Delete(file)
+			file.Truncate(0)
+			unlockFile(file)
+			file.Close()
+		})
+	}
+	heldLocks.Store(file, release)
+	return release, nil
+}
+
+// The release functions of the locks the process holds, keyed by lock file.
+var heldLocks sync.Map
+
+// Releases every lock still held, before the process exits without running deferred functions.
+func releaseLocks() {
+	heldLocks.Range(func(_, release any) bool {
+		release.(func())()
+		return true
+	})
+}
+
+// Returns " (pid N)" for the process holding the lock, if known.
+func lockHolder(filename string) string {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return ""
+	}
+	pid := strings.TrimSpace(string(data))
+	if pid == "" {
+		return ""
+	}
+	return fmt.Sprintf(" (pid %s)", pid)
+}
+
+// Locks the project against concurrent mutation. Returns a function that releases the lock.
+func lockProject() func() {
+	return acquireLock(projectLockFile(), lockTimeout(), "the project lock")
+}
+
+// Scripts run with --exclusive (or a //goscript:exclusive directive) hold a run lock while they execute, so
+// two invocations of the same script, say from cron and from a terminal, never overlap. Unlike the project
+// lock, it is held for as long as the script runs.
+
+func runLockFile(key string) string {
+	return stateDir() + "/run/" + key + ".lock"
+}
+
+// Locks a command against concurrent runs. If wait is false and the command is already running, an error is
+// returned instead of waiting for it to finish. Returns a function that releases the lock.
+func lockRun(key string, wait bool) (func(), error) {
+	timeout := time.Duration(-1)
+	if !wait {
+		timeout = 0
+	}
+	return tryAcquireLock(runLockFile(key), timeout, "the run lock of "+key)
+}
@@ -0,0 +1,24 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+)
+
+// Without flock, a marker file created exclusively next to the lock file stands in for the lock. goscript removes
+// it on the way out, through exitProgram when it exits early, but unlike flock, a marker left behind by a crashed
+// or killed process must be removed by hand.
+
+func tryLock(file *os.File) bool {
+	marker, err := os.OpenFile(file.Name()+".held", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return false
+	}
+	marker.Close()
+	return true
+}
+
+func unlockFile(file *os.File) {
+	os.Remove(file.Name() + ".held")
+}
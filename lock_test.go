@@ -0,0 +1,39 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestReleaseTwice(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "run.lock")
+	release, err := tryAcquireLock(filename, 0, "the test lock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	release() //e.g. from a signal handler, then after the command exits
+
+	again, err := tryAcquireLock(filename, 0, "the test lock")
+	if err != nil {
+		t.Fatalf("lock not released: %v", err)
+	}
+	release() //must not release the new holder's lock
+	if _, err := tryAcquireLock(filename, 0, "the test lock"); err == nil {
+		t.Error("a stale release freed a lock held since")
+	}
+	again()
+}
+
+func TestReleaseLocks(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "project.lock")
+	if _, err := tryAcquireLock(filename, 0, "the test lock"); err != nil {
+		t.Fatal(err)
+	}
+	releaseLocks() //as exitProgram does, where deferred releases don't run
+	release, err := tryAcquireLock(filename, 0, "the test lock")
+	if err != nil {
+		t.Fatalf("lock still held after releaseLocks: %v", err)
+	}
+	release()
+}
@@ -5,96 +5,214 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
-	"flag"
 	"fmt"
-	"go/format"
+	"go/parser"
+	"go/token"
 	"io"
+	"maps"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"slices"
 	"sort"
 	"strings"
 	"syscall"
-	"text/template"
 	"time"
 
+	"github.com/fkmiec/goscript/engine"
 	"github.com/fkmiec/goscript/util"
 )
 
-type Repl struct {
-	Imports []string
-	Code    string
-}
+type Repl = engine.Script
 
 var version string = "goscript v1.2.3"
 var projectDir string
-var pkgMatcher *regexp.Regexp
 var buf *bytes.Buffer
-var savedErrors []string
+var assumeYes bool
 
-func assembleSourceFile(code string) *bytes.Buffer {
+// Assembles a source file from the --code fragments, which are joined with newlines. Repeating --code lets a long
+// one-liner be composed from several shell-quoted pieces.
+func assembleSourceFile(fragments []string) *bytes.Buffer {
 	//If user wants to put main function body in a file and read it in, rather than cumbersome command line, we can do that.
-	if checkFileExists(code) {
-		buf = readSourceFile(code)
-		code = buf.String()
+	parts := []string{}
+	readStdin := false
+	for _, fragment := range fragments {
+		//--code - (or --stdin) reads the code from stdin, e.g. generated by another program
+		if fragment == "-" {
+			if readStdin {
+				check(errors.New("--code - given more than once"), 2, "Standard input can only be read once.")
+			}
+			readStdin = true
+			data, err := io.ReadAll(os.Stdin)
+			check(err, 2, "Unable to read the code from standard input.")
+			parts = append(parts, readSourceData(data).String())
+			continue
+		}
+		if filename := codeFileName(fragment); filename != "" {
+			fragment = readSourceFile(filename).String()
+		}
+		parts = append(parts, fragment)
+	}
+	code := strings.Join(parts, "\n")
+	origin := "--code"
+	if len(fragments) == 1 && fragments[0] == "-" {
+		origin = "stdin"
+	} else if len(fragments) == 1 && codeFileName(fragments[0]) != "" {
+		origin = codeFileName(fragments[0])
+	}
+	inputOrigin = &sourceOrigin{name: origin, text: code}
+	//A complete program (e.g. pasted into --code) is used as is, the same as with --file
+	if !needsWrapping(code) {
+		buf = bytes.NewBufferString(code)
+		return buf
 	}
-	//Automate imports when writing a one-liner goscript with the --code option.
+	return wrapCode(code)
+}
 
-	//Lookup any references to packages listed in the util/imports.go file and
-	// add to the imports if not already there explicitly. Enable use of shorter aliases.
-	var formattedImports []string
+// Returns the file named by a --code value, or blank if the value is code. "@path" always names a file.
+// For compatibility, a bare value naming an existing file is also taken as a file, with a warning, unless it
+// looks like code (contains spaces, quotes, parentheses, braces or semicolons).
+func codeFileName(code string) string {
+	if filename, ok := strings.CutPrefix(code, "@"); ok {
+		if !checkFileExists(filename) {
+			check(fmt.Errorf("no such file: %s", filename), 2, "The --code value @path must name an existing file.")
+		}
+		return filename
+	}
+	if strings.ContainsAny(code, " \t\n\"'`(){};") || !checkFileExists(code) {
+		return ""
+	}
+	fmt.Fprintf(os.Stderr, "warning: treating --code %s as a file name. Use '--code @%s' or '--code-file %s' instead; bare file names will be treated as code in a future release.\n", code, code, code)
+	return code
+}
 
-	//Read in any additional import mappings from imports.json file in project directory
-	userImports := readUserImports()
-	if userImports != nil {
-		for key, value := range userImports {
-			util.ImportsMap[key] = value
-		}
-	}
-
-	pkgMatcher = regexp.MustCompile(`(\w+)\.`) //match a type, field or function accessor (e.g. pkg.Type or struct.Field or struct.Function)
-	matches := pkgMatcher.FindAllStringSubmatch(code, -1)
-	for _, m := range matches {
-		if len(m) > 0 {
-			k := m[1]
-			v := util.ImportsMap[k]
-
-			if v != "" {
-				//Check if the key matches the basename for the import. If so, use the import as is.
-				//Otherwise, prepend the key as an alias for the package (e.g. "re" instead of "regexp")
-				if filepath.Base(v) != k {
-					v = fmt.Sprintf("%s \"%s\"", k, v) //e.g. re "regexp"
-				} else {
-					v = fmt.Sprintf("\"%s\"", v) //e.g. "regexp"
-				}
-				//Ensure we don't duplicate any imports
-				if !slices.Contains(formattedImports, v) {
-					formattedImports = append(formattedImports, v)
-				}
-			}
+// Returns true if the source is a bare main function body rather than a complete Go program.
+// A //goscript:wrap directive forces wrapping. Otherwise, source without a package clause is wrapped.
+func needsWrapping(src string) bool {
+	if hasDirective(src, "wrap") {
+		return true
+	}
+	_, err := parser.ParseFile(token.NewFileSet(), "", src, parser.PackageClauseOnly)
+	return err != nil
+}
+
+// Reports whether the source contains the //goscript:<name> directive on a line of its own.
+func hasDirective(src string, name string) bool {
+	for _, line := range strings.Split(src, "\n") {
+		if strings.TrimSpace(line) == "//goscript:"+name {
+			return true
 		}
 	}
+	return false
+}
 
-	repl := Repl{
-		Imports: formattedImports,
-		Code:    code,
+// Wraps a main function body with the project template, adding any imports it requires.
+func wrapCode(code string) *bytes.Buffer {
+	e := wrapEngine()
+	usesRecover, usesSecret := false, false
+	helpers := ""
+	e.Hooks = engine.WrapHooks{
+		Rewrite: func(code string) string {
+			//--with: Add scaffolding such as a signal-aware context in front of the code
+			code = addPreludes(code)
+			//--args: Add the parsing of typed arguments into an args struct
+			code = addArgs(code)
+			//A panic is reported as a short error rather than a goroutine dump, unless --no-recover or //goscript:norecover
+			if usesRecover = !noRecover && !hasDirective(code, "norecover"); usesRecover {
+				code = "defer goscriptRecover()\n" + code
+			}
+			//--must: Replace unhandled errors with the injected must() and check() helpers
+			if mustMode || hasDirective(code, "must") {
+				code, helpers = rewriteMust(code)
+			}
+			//goscript.Secret reads the project's secret store, with the secret package imported as goscript
+			usesSecret = usesSecrets(code)
+			return code
+		},
+		//Exact mappings take precedence. Selectors without one are tried against the subpackage expansions.
+		Resolve: func(names []string) map[string]string {
+			resolved := map[string]string{}
+			if usesSecret {
+				names = slices.DeleteFunc(names, func(name string) bool { return name == "goscript" })
+				resolved["goscript"] = secretPackage
+			}
+			maps.Copy(resolved, resolveExpansions(e.Imports, names))
+			return resolved
+		},
+		Helpers: func(code string) (string, map[string]string) {
+			imports := map[string]string{}
+			//exit() and fail() run deferred cleanup before exiting, which os.Exit does not
+			usesMust := helpers != ""
+			usesExit := usesMust || usesExitHelpers(code)
+			if usesRecover && osExitSkipsDefers(code) {
+				fmt.Fprintln(os.Stderr, "warning: os.Exit skips deferred functions in the code; use exit(code) to run them first.")
+			}
+			if usesMust || usesRecover || usesExit {
+				imports["fmt"], imports["os"] = "fmt", "os"
+			}
+			text := helpers
+			if usesRecover {
+				imports["debug"] = "runtime/debug"
+				text += recoverHelper
+			}
+			if usesExit && usesRecover {
+				text += exitHelper
+			} else if usesExit {
+				text += plainExitHelper
+			}
+			return text, imports
+		},
+		//A bare expression at the end of the code is printed (e.g. 'strings.ToUpper("hi")' prints HI)
+		Finish: func(code string, imports []string) (string, map[string]string) {
+			var printed string
+			if printed, autoPrinted = autoPrint(code, imports); autoPrinted {
+				return printed, map[string]string{"fmt": "fmt"}
+			}
+			return code, nil
+		},
+		Render: func(name string, script engine.Script) ([]byte, error) {
+			return processTemplate(script, selectedTemplate(Metadata{Template: name})).Bytes(), nil
+		},
 	}
 
-	buf = processTemplate(repl)
-	formatCode(buf)
+	src, err := e.Wrap(code)
+	var wrapErr *engine.WrapError
+	if errors.As(err, &wrapErr) {
+		//The program is built anyway, so the errors of go build are reported at the end of the run
+		for _, msg := range wrapErr.Dropped {
+			savedErrors.add("imports", msg)
+		}
+		check(wrapErr.Format, 0, "Code formatting failed")
+		src = wrapErr.Source
+	} else {
+		check(err, 2, "")
+	}
+	buf = bytes.NewBuffer(src)
 	return buf
 }
 
-func formatCode(buf *bytes.Buffer) {
-	formatted, err := format.Source(buf.Bytes())
-	//If format succeeded, overwrite buffer with formatted code. If not, error will be printed at end of run.
-	if !check(err, 1, "Code formatting failed") {
-		buf.Reset()
-		buf.Write(formatted)
+// Returns the engine that wraps code: with the go command, if there is one, for FixImports to find the standard
+// library with, and the import mappings of util.ImportsMap and the project's imports.json.
+func wrapEngine() *engine.Engine {
+	//A daemon worker loaded one before it had a run, which is current unless imports.json changed since
+	if warmEngine != nil && warmEngine.Project.Dir == projectDir && fileStamp(projectDir+"/imports.json") == warmImports {
+		e := *warmEngine
+		if e.Go != "" {
+			e.Env = toolchainEnv(e.Go) //the client's environment
+		}
+		e.Imports = maps.Clone(e.Imports)
+		return configureEngine(&e)
+	}
+	e, err := tryGoEngine()
+	if err != nil {
+		e = &engine.Engine{Project: project()}
 	}
+	e.Imports = maps.Clone(util.ImportsMap)
+	maps.Copy(e.Imports, readUserImports())
+	return e
 }
 
 func readUserImports() map[string]string {
@@ -106,7 +224,10 @@ func readUserImports() map[string]string {
 		defer file.Close()
 
 		byteValue, _ := io.ReadAll(file)
-		json.Unmarshal([]byte(byteValue), &userImports)
+		//A damaged file must not be taken for an empty one, or the next alias added would replace it
+		if err := json.Unmarshal([]byte(byteValue), &userImports); err != nil && len(bytes.TrimSpace(byteValue)) > 0 {
+			check(fmt.Errorf("invalid %s: %v", filename, err), 2, "Fix it, or run --rollback-config to restore the previous version.")
+		}
 	}
 	return userImports
 }
@@ -115,57 +236,213 @@ func writeUserImports(userImports map[string]string) {
 	filename := projectDir + "/imports.json"
 	jsonData, err := json.MarshalIndent(userImports, "", "    ") // Use MarshalIndent for pretty printing
 	check(err, 2, "Unable to marshal content for imports.json file.")
-	err = os.WriteFile(filename, jsonData, 0644)
+	err = writeConfig(filename, jsonData)
 	check(err, 2, "")
 }
 
+// Makes sure the project directory is the root of its own module before go.mod is changed.
+// An uninitialized project (no go.mod, or a go.mod belonging to a module in a parent directory)
+// can be initialized on the spot.
+func checkProjectModule() {
+	out, err := goCommand("env", "GOMOD").Output()
+	check(err, 2, "Unable to determine the module for "+projectDir)
+	goMod := strings.TrimSpace(string(out))
+	projectGoMod := filepath.Join(projectDir, "go.mod")
+	if goMod == projectGoMod {
+		return
+	}
+
+	var problem string
+	if goMod == "" || goMod == os.DevNull {
+		problem = fmt.Sprintf("The project at %s has no go.mod file.", projectDir)
+	} else {
+		problem = fmt.Sprintf("The project at %s has no go.mod file of its own. It is inside the module defined by %s, which goscript would change instead.", projectDir, goMod)
+	}
+	if !offer(problem + "\nRun 'go mod init' to initialize the project module now?") {
+		check(errors.New(problem), 2, fmt.Sprintf("Run '%s --setup %s' to set up the project, or 'go mod init' in the project directory.", os.Args[0], projectDir))
+	}
+	projectName := sanitizeModuleName(filepath.Base(projectDir))
+	out, err = goCommand("mod", "init", projectName).CombinedOutput()
+	check(err, 2, fmt.Sprintf("%v: %s", err, out))
+	fmt.Printf("Initialized module %s in %s\n", projectName, projectDir)
+}
+
 func goGet(pkgName string) {
+	goGetIn(projectDir, pkgName)
+}
+
+// Runs go get in the given module directory: the project, or an isolated command's module.
+func goGetIn(dir string, pkgName string) {
+	if dir == projectDir {
+		checkProjectModule()
+	}
 
 	//If no changes to go.mod in a week, run go mod tidy
 	//Intent is to NOT run go mod tidy every time goGet is required.
 	//	For unnamed code (e.g. shebang script), could result in go get for every invocation.
-	fileInfo, err := os.Stat(projectDir + "/go.mod")
+	fileInfo, err := os.Stat(dir + "/go.mod")
 	check(err, 2, "Could not stat go.mod file.")
 	if fileInfo.ModTime().Before(time.Now().Add(-7 * 24 * time.Hour)) {
-		goTidy()
+		goTidyIn(dir)
 	}
 
-	cmd := exec.Command("go", "get", pkgName)
-	cmd.Dir = projectDir
-
-	out, err := cmd.CombinedOutput()
+	out, err := goModify(dir, "get", pkgName)
 	check(err, 2, fmt.Sprintf("%v: %s", err, out))
 
-	//Add pkgName to imports.json file
-	pkgAlias := filepath.Base(pkgName)
+	addUserImport(pkgName)
+}
+
+// Adds aliases to the imports.json file for each importable package provided by the module or package that was
+// fetched with go get. Each package is registered under its declared package name, so a major-version path like
+// github.com/foo/bar/v3 is registered as "bar", not "v3". Aliases already defined by the user are kept.
+func addUserImport(pkgName string) {
+	pkgName, _, _ = strings.Cut(pkgName, "@") //drop any version query (e.g. pkg@v1.2.3)
+	packages := listPackages(pkgName)
+	if len(packages) == 0 {
+		packages = map[string]string{engine.ImportAlias(pkgName): pkgName}
+	}
+
 	userImports := readUserImports()
 	if userImports == nil {
 		userImports = make(map[string]string)
 	}
-	userImports[pkgAlias] = pkgName
+	aliases := []string{}
+	for alias, path := range packages {
+		if existing, ok := userImports[alias]; ok && existing != path {
+			fmt.Fprintf(os.Stderr, "warning: alias %s already maps to %s; not registering %s\n", alias, existing, path)
+			continue
+		}
+		userImports[alias] = path
+		aliases = append(aliases, alias)
+	}
+	if len(aliases) == 0 {
+		return
+	}
 	writeUserImports(userImports)
+	sort.Strings(aliases)
+	fmt.Printf("Registered import aliases: %s\n", strings.Join(aliases, ", "))
+}
+
+// Returns the importable packages under a module or package path, keyed by package name. Commands, internal
+// packages and packages whose names collide within the module are skipped.
+func listPackages(path string) map[string]string {
+	out, err := goCommand("list", "-e", "-f", "{{.ImportPath}} {{.Name}}", path+"/...").Output()
+	if err != nil {
+		return nil
+	}
+	packages := map[string]string{}
+	collisions := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		importPath, name, found := strings.Cut(line, " ")
+		if !found || name == "" || name == "main" || strings.HasSuffix(name, "_test") {
+			continue
+		}
+		if strings.Contains(importPath+"/", "/internal/") || strings.Contains(importPath+"/", "/testdata/") {
+			continue
+		}
+		if existing, ok := packages[name]; ok && existing != importPath {
+			collisions[name] = true
+			if importPath != path {
+				continue
+			}
+		}
+		packages[name] = importPath
+	}
+	//Ambiguous names are only registered for the package that was asked for
+	for name := range collisions {
+		if packages[name] != path {
+			delete(packages, name)
+		}
+	}
+	return packages
 }
 
 func goTidy() {
-	cmd := exec.Command("go", "mod", "tidy")
-	cmd.Dir = projectDir
+	goTidyIn(projectDir)
+}
 
-	out, err := cmd.CombinedOutput()
+func goTidyIn(dir string) {
+	if dir == projectDir {
+		checkProjectModule()
+	}
+	out, err := goModify(dir, "mod", "tidy")
 	check(err, 2, fmt.Sprintf("%v: %s\n", err, out))
 }
 
+// Runs go mod verify to check that the module content in the cache matches go.sum. Prints any modules whose
+// content has been modified and returns false if verification failed.
+func verifyModules() bool {
+	out, err := goCommand("mod", "verify").CombinedOutput()
+	if err == nil {
+		fmt.Fprintf(os.Stderr, "Module verification: %s", out)
+		return true
+	}
+	mismatches := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line != "" && !strings.HasPrefix(line, "go: ") {
+			mismatches = append(mismatches, line)
+		}
+	}
+	if len(mismatches) == 0 {
+		fmt.Fprintf(os.Stderr, "Module verification failed: %s\n", strings.TrimSpace(string(out)))
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "Module verification failed for %d module(s):\n", len(mismatches))
+	for _, line := range mismatches {
+		fmt.Fprintf(os.Stderr, "  %s\n", line)
+	}
+	fmt.Fprintf(os.Stderr, "Run 'go clean -modcache' and rebuild to fetch clean copies.\n")
+	return false
+}
+
+// Precompile the standard library and all packages listed in imports.json so the first build of a
+// script on a fresh machine (or after a Go upgrade) does not pay the full compile cost.
+func warmBuildCache() {
+	fmt.Printf("Warming build cache for the standard library ...\n")
+	cmd := goCommand("build", "std")
+	out, err := cmd.CombinedOutput()
+	check(err, 1, fmt.Sprintf("%v: %s", err, out))
+
+	userImports := readUserImports()
+	if len(userImports) == 0 {
+		return
+	}
+
+	//Build a throw-away program that blank-imports every package in imports.json
+	pkgs := []string{}
+	for _, pkg := range userImports {
+		if !slices.Contains(pkgs, pkg) {
+			pkgs = append(pkgs, pkg)
+		}
+	}
+	sort.Strings(pkgs)
+	var src bytes.Buffer
+	src.WriteString("package main\n\nimport (\n")
+	for _, pkg := range pkgs {
+		src.WriteString(fmt.Sprintf("\t_ \"%s\"\n", pkg))
+	}
+	src.WriteString(")\n\nfunc main() {}\n")
+
+	name := fmt.Sprintf("gocmd-warm-%d", time.Now().UnixNano())
+	srcFilename := projectDir + "/src/" + name + ".go"
+	writeSourceFile(srcFilename, &src)
+	defer cleanTemporaryFiles(name)
+
+	fmt.Printf("Warming build cache for %d packages in imports.json ...\n", len(pkgs))
+	cmd = goCommand("build", "-o", os.DevNull, srcFilename)
+	out, err = cmd.CombinedOutput()
+	check(err, 1, fmt.Sprintf("Some packages in imports.json could not be built: %s", out))
+}
+
 func editCommand(cmd string) {
-	srcFilename := projectDir + "/src/" + cmd + ".go"
+	srcFilename := sourceFile(cmd)
 	if checkFileExists(srcFilename) {
-		editor := os.Getenv("GOSCRIPT_EDITOR")
-		if editor == "" {
-			editor = os.Getenv("EDITOR")
-			if editor == "" {
-				fmt.Printf("The --edit option requires environment variable GOSCRIPT_EDITOR or EDITOR to be defined.")
-				return
-			}
+		editor := defaultEditor()
+		if len(editor) == 0 {
+			fmt.Printf("The --edit option requires environment variable GOSCRIPT_EDITOR or EDITOR, or \"editor\" in the defaults of %s, to be defined.\n", projectConfigFile())
+			return
 		}
-		cmd := exec.Command(editor, srcFilename)
+		cmd := exec.Command(editor[0], append(editor[1:], commandFiles(srcFilename)...)...) //a directory command opens with its helper files
 		cmd.Stdin = os.Stdin
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
@@ -178,45 +455,50 @@ func editCommand(cmd string) {
 	}
 }
 
+// Reads a source file byte-for-byte, except for a shebang on the first line, which is replaced by a blank line
+// (keeping its LF or CRLF line ending) so compile errors report the line numbers of the original file.
+// The whole file is read at once, so there is no limit on line length.
 func readSourceFile(filename string) *bytes.Buffer {
-	// Using bufio.Scanner to read line by line
-	file, err := os.Open(filename)
+	data, err := os.ReadFile(filename)
 	check(err, 2, "")
+	return readSourceData(data)
+}
 
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	var line string
-	buf = bytes.NewBuffer([]byte{})
-	for scanner.Scan() {
-		line = scanner.Text()
-		//strip out the shebang if present
-		if strings.HasPrefix(line, "#!") {
-			continue
+// Reads source given as data (e.g. on stdin) the same as a source file.
+func readSourceData(data []byte) *bytes.Buffer {
+	//blank out the shebang if present
+	if bytes.HasPrefix(data, []byte("#!")) {
+		if i := bytes.IndexByte(data, '\n'); i < 0 {
+			data = nil
+		} else if i > 0 && data[i-1] == '\r' {
+			data = data[i-1:]
+		} else {
+			data = data[i:]
 		}
-		buf.WriteString(line + "\n")
 	}
-
-	err = scanner.Err() //; err != nil {
-	check(err, 2, "")   //Panic
-
+	buf = bytes.NewBuffer(data)
 	return buf
 }
 
-func processTemplate(repl Repl) *bytes.Buffer {
+// Executes the project template (script.tmpl, unless --template or the script's frontmatter names another template).
+func processTemplate(repl Repl, tmplName string) *bytes.Buffer {
 
 	//go(:)embed script.tmpl
 	//var vfs embed.FS
 	//tmpl, err := template.New("script.tmpl").ParseFS(vfs, "script.tmpl") //Embedding the template would be more efficient, but not embedding lets user change it w/o recompile.
 
-	var tmplFile = projectDir + "/script.tmpl"
-	tmpl, err := template.New("script.tmpl").ParseFiles(tmplFile)
-	check(err, 2, "")
-
-	buf = bytes.NewBuffer([]byte{})
-	err = tmpl.Execute(buf, repl)
-	check(err, 2, "")
-
+	_, err := project().ReadTemplate(tmplName)
+	check(err, 2, "See --template-list for the templates there are.")
+	src, err := project().RenderTemplate(tmplName, repl)
+	if err != nil {
+		//A template broken by a customization shouldn't stop the code from being tried
+		filename := filepath.Base(project().TemplateFile(tmplName))
+		fmt.Fprintf(os.Stderr, "warning: the template %s can't be used: %v\n", filename, err)
+		fmt.Fprintf(os.Stderr, "warning: the code is wrapped with the default template instead. Run 'goscript --check-template %s' while fixing it.\n", strings.TrimSuffix(filename, ".tmpl"))
+		src, err = engine.RenderText("default", engine.DefaultTemplate, repl)
+		check(err, 2, "")
+	}
+	buf = bytes.NewBuffer(src)
 	return buf
 }
 
@@ -236,20 +518,25 @@ func writeSourceFile(filename string, buf *bytes.Buffer) bool {
 	return true
 }
 
+// Copies a file, keeping its permissions (e.g. a binary stays executable). Windows has no permission bits to keep.
 func copyFile(orig string, dest string) {
 	origFile, err := os.Open(orig)
 	check(err, 2, "")
 	defer origFile.Close()
+	info, err := origFile.Stat()
+	check(err, 2, "")
 
-	destFile, err := os.Create(dest)
+	destFile, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
 	check(err, 2, "")
 	defer destFile.Close()
 
 	_, err = io.Copy(destFile, origFile)
 	check(err, 2, "Failed to copy "+orig+" to "+dest)
 
-	err = os.Chmod(dest, 0766)
-	check(err, 2, "Failed to set permissions on "+dest)
+	if runtime.GOOS != "windows" {
+		err = os.Chmod(dest, info.Mode().Perm()) //an existing file keeps its permissions when opened
+		check(err, 2, "Failed to set permissions on "+dest)
+	}
 }
 
 func getProjectPath() string {
@@ -273,95 +560,252 @@ func getProjectPath() string {
 		executablePath, err := os.Executable()
 		check(err, 2, "Unable to get project path relative to executable")
 		executableDir = filepath.Dir(executablePath)
+		//An executable installed with go install isn't in a project, so the default project is tried next
+		if def := defaultProjectDir(); !checkFileExists(executableDir+"/go.mod") && def != "" && checkFileExists(def+"/go.mod") {
+			executableDir = def
+		}
 	}
 	return executableDir
 }
 
-func getSourceList() []string {
-	cmds := []string{}
-	srcDir := projectDir + "/src"
-	list, err := os.ReadDir(srcDir)
-	check(err, 1, "")
-	for _, entry := range list {
-		if !entry.IsDir() {
-			cmds = append(cmds, entry.Name())
+// Prints the commands with when their source was last changed, the size of their binary and their
+// descriptions (see --list --long).
+func listCommandsLong(cmds []string) {
+	infos := commandInfos(cmds)
+	//The first example of each command is shown too, if any command has one
+	examples := false
+	for _, info := range infos {
+		examples = examples || len(info.Examples) > 0
+	}
+	r := &report{title: "Commands", columns: []string{"Command", "Modified", "Size", "Description"}}
+	if examples {
+		r.columns = append(r.columns, "Example")
+	}
+	for _, info := range infos {
+		desc := info.Description
+		if info.Deleted {
+			desc = "(requires --restore) " + desc
 		}
+		if info.ReplacedBy != "" {
+			desc = strings.TrimSpace("(" + deprecationNote(manifestEntry{ReplacedBy: info.ReplacedBy, Forward: info.Forwards}) + ") " + desc)
+		}
+		size := "-" //not built
+		if info.Binary != "" {
+			size = formatSize(info.BinarySize)
+		}
+		modified := "-" //a redirect that hasn't been built
+		if !info.Modified.IsZero() {
+			modified = info.Modified.Format("2006-01-02 15:04")
+		}
+		row := []string{info.Name, modified, size, desc}
+		if examples {
+			example := ""
+			if len(info.Examples) > 0 {
+				example = info.Examples[0]
+			}
+			row = append(row, example)
+		}
+		r.add(row...)
 	}
-	sort.Strings(cmds)
+	r.print()
+}
+
+func getSourceList() []string {
+	cmds, err := project().Commands()
+	check(err, 1, "")
 	return cmds
 }
 
 // Soft delete. Renames source file without .go extension so it will be ignored. Removes binary.
-func deleteCommand(cmd string) {
-	sansGoExt := projectDir + "/src/" + cmd
-	srcFilename := sansGoExt + ".go"
-	binFilename := projectDir + "/bin/" + cmd
-	err := os.Rename(srcFilename, sansGoExt)
+// The binary is moved to the trash and the operation is journaled so --undo-last can reverse it.
+func deleteCommand(cmd string, op string) {
+	srcFilename := sourceFile(cmd)
+	sansGoExt := strings.TrimSuffix(srcFilename, ".go")
+	binFilename := hostBinaryPath(cmd)
+	exclusive, indexed := exclusiveModules(importIndex(), cmd)
+	entry := newJournalEntry(op, cmd)
+	err := entry.move(srcFilename, sansGoExt)
 	check(err, 1, "")
-	err = os.Remove(binFilename)
+	err = entry.trash(binFilename)
 	check(err, 1, "")
-	goTidy() //run go mod tidy to keep go.mod file current when you remove sources
+	recordOperation(entry)
+	//Run go mod tidy to keep go.mod file current when you remove sources, unless other commands still use every module this one did.
+	//An isolated command's modules were never in the project go.mod.
+	if !isIsolated(cmd) && (!indexed || len(exclusive) > 0) {
+		goTidy()
+	}
 }
 
 // Soft delete. Renames source file without .go extension so it will be ignored. Removes binary.
 func restoreCommand(cmd string) {
-	sansGoExt := projectDir + "/src/" + cmd
-	srcFilename := sansGoExt + ".go"
-	binFilename := projectDir + "/bin/" + cmd
+	srcFilename := sourceFile(cmd)
+	sansGoExt := strings.TrimSuffix(srcFilename, ".go")
+	binFilename := hostBinaryPath(cmd)
 	err := os.Rename(sansGoExt, srcFilename)
 	check(err, 2, "")
 	compileBinary(srcFilename, binFilename)
 }
 
-func recompileCommands() {
-	commands := getSourceList()
+// Recompiles the given source files from the project src directory. A failing command doesn't stop the others; a pass/fail summary is
+// printed at the end and goscript exits nonzero if anything failed. With failFast, the first failure stops the run. Binaries that are
+// up to date are left alone unless force is set.
+func recompileCommands(commands []string, failFast bool, force bool) {
 	var srcFilename, binFilename string
+	passed, failed, skipped, current := []string{}, []string{}, []string{}, []string{}
+	states := readBuildStates()
 	for _, name := range commands {
 		if !strings.HasSuffix(name, ".go") {
 			continue
 		}
-		srcFilename = projectDir + "/src/" + name
-		binFilename = projectDir + "/bin/" + name[:len(name)-3] //removes .go from binary filename
+		cmd := name[:len(name)-3]
+		srcFilename = sourcePath(name)
+		binFilename = binaryPath(cmd) //removes .go from binary filename
+		if meta := engine.ReadMetadata(srcFilename); !supportsTarget(meta) {
+			skipped = append(skipped, fmt.Sprintf("%s\t(runs only on %s)", cmd, strings.Join(meta.OS, ", ")))
+			continue
+		}
+		if !force && binaryCurrent(states, srcFilename, binFilename) {
+			current = append(current, cmd)
+			continue
+		}
 		if !compileBinary(srcFilename, binFilename) {
-			os.Exit(1)
+			if failFast {
+				exitProgram(1)
+			}
+			failed = append(failed, cmd)
+			continue
 		}
+		passed = append(passed, cmd)
+	}
+
+	r := &report{title: "Recompile", columns: []string{"Result", "Command", "Note"}, indent: "  "}
+	for _, cmd := range passed {
+		r.add("ok", cmd)
+	}
+	for _, cmd := range current {
+		r.add("ok", cmd, "up to date")
+	}
+	for _, cmd := range skipped {
+		name, note, _ := strings.Cut(cmd, "\t")
+		r.add("skip", name, note)
+	}
+	for _, cmd := range failed {
+		r.add("FAIL", cmd)
+	}
+	summary := fmt.Sprintf("Recompiled %d command(s): %d ok, %d failed, %d skipped", len(passed)+len(failed), len(passed), len(failed), len(skipped))
+	if len(current) > 0 {
+		summary += fmt.Sprintf("; %d already up to date (use --force to rebuild them)", len(current))
+	}
+	r.notes = append(r.notes, summary)
+	r.print()
+	if len(failed) > 0 {
+		exitProgram(1)
 	}
 }
 
 func compileBinary(srcFilename, binFilename string) bool {
-	cmd := exec.Command("go", "build", "-o", binFilename, srcFilename)
-	cmd.Dir = projectDir
+	return !check(buildBinary(goEngine(), srcFilename, binFilename, goGetIn), 1, "")
+}
 
-	out, err := cmd.CombinedOutput()
+// Builds the binary of a source file, returning an error rather than printing it or exiting. Dependencies
+// declared in the script's frontmatter, or that go build asks for, are added with fetch; without it, they are an
+// error too.
+func buildBinary(e *engine.Engine, srcFilename, binFilename string, fetch func(dir, pkg string)) error {
+	//Flags may be added for this build only
+	build := *e
+	e = &build
+	e.BuildFlags = slices.Clone(e.BuildFlags)
+
+	//A deprecated command warns when it runs, or is built as a redirect to its replacement
+	name := strings.TrimSuffix(sourceListName(srcFilename), ".go")
+	if entry, ok := deprecation(name); ok {
+		if entry.Forward {
+			return redirectBinary(e, name, entry, binFilename)
+		}
+		defer addDeprecationWarning(srcFilename, name, entry, &e.BuildFlags)()
+	}
+
+	//Dependencies and build flags may be declared in the script's frontmatter
+	meta := engine.ReadMetadata(srcFilename)
+	dir := moduleDir(srcFilename)
+	if missing := missingDeps(dir, meta.Deps); len(missing) > 0 {
+		if fetch == nil {
+			return fmt.Errorf("missing dependencies: %s (add them with --goget)", strings.Join(missing, ", "))
+		}
+		for _, dep := range missing {
+			fetch(dir, dep)
+		}
+	}
+	env := crossEnv()
+	if env != nil {
+		os.MkdirAll(filepath.Dir(binFilename), 0755)
+	}
+
+	out, err := e.BuildFile(srcFilename, binFilename, env...)
 	if err != nil {
 		re := regexp.MustCompile(`go get (.+)`)
 		matches := re.FindAllSubmatch(out, -1)
-		if len(matches) > 0 {
+		if len(matches) > 0 && fetch != nil {
 			for _, m := range matches {
 				pkg := strings.TrimSpace(string(m[1]))
-				goGet(pkg)
-			}
-			compileBinary(srcFilename, binFilename)
-		} else {
-			if check(err, 1, string(out)) { //fmt.Sprintf("%v: %s\n", err, out)
-				return false
+				fetch(dir, pkg)
 			}
+			return buildBinary(e, srcFilename, binFilename, fetch)
 		}
+		return fmt.Errorf("%s\n%w", strings.TrimSpace(string(inputOrigin.mapDiagnostics(srcFilename, out))), err)
 	}
-	return true
+	if !crossCompiling() {
+		recordBinarySize(binFilename)
+	}
+	updateImportIndex(srcFilename)
+	recordVersion(srcFilename)
+	recordBuildState(srcFilename, binFilename)
+	if vetEnabled() {
+		warnVet(srcFilename, env)
+	}
+	return nil
+}
+
+// Derives a valid module path from a directory name. go mod init rejects spaces and most punctuation,
+// and names like "std" or "cmd" collide with the standard library.
+func sanitizeModuleName(name string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_', r == '.', r == '~':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('-')
+		}
+	}
+	module := strings.Trim(b.String(), "-.")
+	for strings.Contains(module, "--") {
+		module = strings.ReplaceAll(module, "--", "-")
+	}
+	switch module {
+	case "", "std", "cmd", "main", "all", "test", "tool", "local":
+		module = "goscript-" + module
+	}
+	return strings.TrimSuffix(module, "-")
 }
 
-func createNewProject(dir string) {
+// Dependencies added to every new project unless --no-default-deps is given.
+var defaultDeps = []string{"github.com/bitfield/script"}
+
+func createNewProject(dir string, modulePath string, noDefaultDeps bool, starters []string) {
 	if dir == "help" {
 		fmt.Printf("To use the --setup option to create a goscript project:\n")
-		fmt.Printf("Run '%s --setup <project name>'\n", os.Args[0])
+		fmt.Printf("Run '%s --setup <project name>' (optionally with '--module <module path>')\n", os.Args[0])
 		fmt.Printf("Goscript will:\n")
 		fmt.Printf("  a. Create the project directory\n")
-		fmt.Printf("  b. Run go mod init <project>\n")
-		fmt.Printf("  c. Run 'go get github.com/bitfield/script'\n")
+		fmt.Printf("  b. Run go mod init <module>, where module is the --module path or derived from the project name\n")
+		fmt.Printf("  c. Run 'go get github.com/bitfield/script' and record it in imports.json (skipped with --no-default-deps)\n")
+		fmt.Printf("     With --starter <packs>, also add the dependencies and imports.json aliases of each starter pack:\n")
+		printStarterPacks("       ")
 		fmt.Printf("  d. Create 'src' and 'bin' subdirectories in the project\n")
 		fmt.Printf("  e. Add the required Go template file 'script.tmpl'\n")
 		fmt.Printf("  f. Print out instructions to set GOSCRIPT_PROJECT_DIR and add GOSCRIPT_PROJECT_DIR/bin to the PATH\n")
+		fmt.Printf("Setup can be re-run on an existing project to repair it. Only missing pieces are created.\n")
 		return
 	}
 	projectDir = dir
@@ -369,61 +813,217 @@ func createNewProject(dir string) {
 	if !isAbsolute {
 		pwd, err := os.Getwd()
 		check(err, 2, "Unable to create project at "+dir)
-		projectDir = pwd + "/" + dir
+		projectDir = filepath.Join(pwd, dir)
+	}
+
+	//Setup is safe to re-run on an existing project. Only what is missing is created and user files are never overwritten.
+	done := []string{}
+	report := func(msg string, args ...any) {
+		done = append(done, fmt.Sprintf(msg, args...))
 	}
 
-	//Create project directory if not exist
+	//Create project directory if not exist. An existing directory, even one with files in it, is fine.
 	if !checkFileExists(projectDir) {
-		os.Mkdir(projectDir, 0766)
+		err := os.Mkdir(projectDir, 0766)
+		check(err, 2, "Unable to create project at "+projectDir)
+		report("created directory %s", projectDir)
+	} else if entries, _ := os.ReadDir(projectDir); len(entries) > 0 {
+		fmt.Printf("Setting up project in existing directory %s\n", projectDir)
 	}
 
-	//Run go mod init <basename>
-	projectName := filepath.Base(projectDir)
-	cmd := exec.Command("go", "mod", "init", projectName)
-	cmd.Dir = projectDir
-	out, err := cmd.CombinedOutput()
-	check(err, 2, fmt.Sprintf("%v: %s\n", err, out))
+	//Run go mod init <module>, where module is given by --module or derived from the directory name
+	projectName := modulePath
+	if checkFileExists(projectDir + "/go.mod") {
+		existing := moduleName()
+		if modulePath != "" && modulePath != existing {
+			fmt.Fprintf(os.Stderr, "warning: go.mod already declares module %s; --module %s ignored\n", existing, modulePath)
+		}
+		projectName = existing
+	} else {
+		if projectName == "" {
+			projectName = sanitizeModuleName(filepath.Base(projectDir))
+			if projectName != filepath.Base(projectDir) {
+				fmt.Printf("Using module path %s (use --module to choose a different one)\n", projectName)
+			}
+		}
+		cmd := goCommand("mod", "init", projectName)
+		out, err := cmd.CombinedOutput()
+		check(err, 2, fmt.Sprintf("%v: %s\nUse --module <path> to choose a different module path.", err, out))
+		report("initialized module %s", projectName)
+	}
 
-	//Run go get github.com/bitfield/script
-	cmd = exec.Command("go", "get", "github.com/bitfield/script")
-	cmd.Dir = projectDir
-	out, err = cmd.CombinedOutput()
-	check(err, 2, fmt.Sprintf("%v: %s\n", err, out))
+	//Run go get for the default dependencies (github.com/bitfield/script) and record their aliases in imports.json
+	if !noDefaultDeps {
+		for _, dep := range defaultDeps {
+			if slices.Contains(requiredModules(), dep) {
+				continue
+			}
+			out, err := goModify(projectDir, "get", dep)
+			check(err, 2, fmt.Sprintf("%v: %s\n", err, out))
+			addUserImport(dep)
+			report("added dependency %s", dep)
+		}
+	}
+
+	for _, name := range starters {
+		done = append(done, installStarterPack(name)...)
+	}
 
 	//Create 'src' and 'bin' subdirectories
 	srcDir := projectDir + "/src"
-	os.Mkdir(srcDir, 0766)
 	binDir := projectDir + "/bin"
-	os.Mkdir(binDir, 0766)
+	for _, dir := range []string{srcDir, binDir} {
+		if !checkFileExists(dir) {
+			err := os.Mkdir(dir, 0766)
+			check(err, 2, "Unable to create "+dir)
+			report("created %s", dir)
+		}
+	}
 
-	//Write script.tmpl file
-	// Open the file for writing, creates it if it doesn't exist, or truncates if it exists.
+	//Write script.tmpl file, unless the user already has one
 	filename := projectDir + "/script.tmpl"
-	file, err := os.Create(filename)
-	check(err, 2, "")
-	defer file.Close()
-	file.WriteString("package main\n\nimport ( {{range .Imports}}\n\t{{.}}{{ end }}\n)\n\nfunc main() {\n\t{{.Code}}\n}\n")
+	if !checkFileExists(filename) {
+		err := os.WriteFile(filename, []byte(engine.DefaultTemplate), 0644)
+		check(err, 2, "Unable to write "+filename)
+		report("created %s", filename)
+	}
+
+	if len(done) == 0 {
+		fmt.Printf("Project %s at %s is already set up. Nothing to do.\n", projectName, projectDir)
+	} else {
+		fmt.Printf("Set up project %s at %s:\n", projectName, projectDir)
+		for _, msg := range done {
+			fmt.Printf("  - %s\n", msg)
+		}
+	}
+
+	//Registering the project, so --project can select it by name, is left to the user, who chooses the name
+	if name := registeredName(projectDir); name != "" {
+		fmt.Printf("The project is registered as %s: 'goscript --project %s ...' uses it without GOSCRIPT_PROJECT_DIR.\n", name, name)
+	} else {
+		fmt.Printf("To use the project from anywhere with 'goscript --project <name> ...', register it with 'goscript --project %s --register <name>'.\n", projectDir)
+	}
 
 	//Print instructions to set environment variable GOSCRIPT_PROJECT_DIR and add GOSCRIPT_PROJECT_DIR/bin to PATH
-	fmt.Printf("Created project %s at %s\n", projectName, projectDir)
 	fmt.Printf("To complete setup:\n")
-	fmt.Printf("\t1. Set environment variable GOSCRIPT_PROJECT_DIR=%s\n", projectDir)
-	fmt.Printf("\t2. Add %s to your PATH environment variable.\n", binDir)
+	if runtime.GOOS == "windows" {
+		fmt.Printf("\t1. Run: setx GOSCRIPT_PROJECT_DIR \"%s\"\n", projectDir)
+		fmt.Printf("\t2. Add %s to your Path environment variable (Settings > System > About > Advanced system settings > Environment Variables).\n", filepath.Clean(binDir))
+		fmt.Printf("\tThen open a new terminal for the changes to take effect.\n")
+	} else {
+		fmt.Printf("\t1. Set environment variable GOSCRIPT_PROJECT_DIR=%s\n", projectDir)
+		fmt.Printf("\t2. Add %s to your PATH environment variable.\n", binDir)
+	}
+}
+
+// Returns the module path declared in the project's go.mod file.
+var moduleMatcher = regexp.MustCompile(`(?m)^\s*module\s+(\S+)`)
+
+func moduleName() string {
+	data, err := os.ReadFile(projectDir + "/go.mod")
+	if err != nil {
+		return ""
+	}
+	m := moduleMatcher.FindStringSubmatch(string(data))
+	if m == nil {
+		return ""
+	}
+	return strings.Trim(m[1], `"`)
 }
 
 func cleanTemporaryFiles(name string) {
 	srcFilename := projectDir + "/src/" + name + ".go"
-	binFilename := projectDir + "/bin/" + name
+	binFilename := hostBinaryPath(name)
 	if checkFileExists(srcFilename) {
 		err := os.Remove(srcFilename)
 		check(err, 1, "")
 	}
+	if isDirCommand(name) {
+		err := os.RemoveAll(commandDir(name))
+		check(err, 1, "")
+	}
 	if checkFileExists(binFilename) {
 		err := os.Remove(binFilename)
 		check(err, 1, "")
 	}
 }
 
+// Removes the temporary sources and binaries that runs which were interrupted before cleaning up left behind, once
+// they are older than temp_max_age (see settings.go).
+func sweepTemporaryFiles() {
+	maxAge := tempMaxAge()
+	for _, dir := range []string{projectDir + "/src", projectDir + "/bin"} {
+		entries, _ := os.ReadDir(dir)
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err == nil && strings.HasPrefix(entry.Name(), "gocmd-") && time.Since(info.ModTime()) > maxAge {
+				os.RemoveAll(dir + "/" + entry.Name())
+			}
+		}
+	}
+}
+
+// Returns true if the file (typically stdin) is an interactive terminal.
+// /dev/null is also a character device, so it is ruled out explicitly.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	null, err := os.Stat(os.DevNull)
+	return err != nil || !os.SameFile(info, null)
+}
+
+// Asks the user to confirm a destructive operation after printing a summary of what will change.
+// Returns true without asking if --yes was given or stdin is not a terminal (e.g. cron jobs and pipelines).
+func confirm(summary string) bool {
+	if assumeYes || !isTerminal(os.Stdin) {
+		return true
+	}
+	return prompt(summary + "\nProceed?")
+}
+
+// Offers to take an optional action on the user's behalf. Unlike confirm, the answer is no when stdin
+// is not a terminal, so nothing unexpected happens in cron jobs and pipelines unless --yes was given.
+func offer(question string) bool {
+	if assumeYes {
+		return true
+	}
+	if !isTerminal(os.Stdin) {
+		return false
+	}
+	return prompt(question)
+}
+
+func prompt(question string) bool {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// Confirms replacing an existing file. There is nothing to confirm if the file doesn't exist or the content is unchanged.
+func confirmOverwrite(filename string, content []byte) bool {
+	existing, err := os.ReadFile(filename)
+	if err != nil || bytes.Equal(existing, content) {
+		return true
+	}
+	return confirm(fmt.Sprintf("This will overwrite %s.", filename))
+}
+
+// Describes what deleting a command will do, for confirmation prompts.
+func deleteSummary(cmd string) string {
+	srcFilename := sourceFile(cmd)
+	return fmt.Sprintf("This will remove %s and rename %s to %s (recoverable with --restore).",
+		hostBinaryPath(cmd), srcFilename, strings.TrimSuffix(srcFilename, ".go"))
+}
+
+// Exits after the user declines a confirmation prompt.
+func cancelled() {
+	fmt.Fprintln(os.Stderr, "Cancelled.")
+	exitProgram(1)
+}
+
 func checkFileExists(filePath string) bool {
 	_, error := os.Stat(filePath)
 	//return !os.IsNotExist(err)
@@ -439,7 +1039,7 @@ func check(e error, errLevel int, customMsg string) bool {
 			} else {
 				msg = e.Error()
 			}
-			savedErrors = append(savedErrors, msg)
+			savedErrors.add(errorCategory(e), msg)
 		} else if errLevel == 1 { //errLevel == 1: Print msg and return
 			if customMsg != "" {
 				fmt.Fprintf(os.Stderr, "%s\n%s\n", strings.TrimSpace(customMsg), e.Error())
@@ -452,7 +1052,7 @@ func check(e error, errLevel int, customMsg string) bool {
 			} else {
 				fmt.Fprintf(os.Stderr, fmt.Sprintf("%s\n", e.Error()))
 			}
-			os.Exit(1)
+			exitProgram(1)
 		} else if errLevel == 3 { //errLevel == 3: Panic (quit the program and print stack trace)
 			panic(e)
 		} //errLevel -1 or really any other: Just return true indicating there was an error and let caller handle it.
@@ -463,6 +1063,15 @@ func check(e error, errLevel int, customMsg string) bool {
 }
 
 func main() {
+	//A daemon worker waits for a client, then runs as the client's goscript would and sends it the exit status
+	serveDaemonClient()
+	exitProgram(run(os.Args))
+}
+
+// Runs goscript with the command line args (args[0] is the program name) and returns the exit status.
+func run(args []string) int {
+	//Saved errors are reported when run returns. Paths that exit early do so through exitProgram, which also reports them.
+	defer savedErrors.flush()
 
 	var name string
 	var toEdit string
@@ -471,329 +1080,1006 @@ func main() {
 	var binToExport string
 	var toDelete string
 	var toRestore string
-	var code string
+	var code []string
 	var inputFile string
 	var listCommands bool
 	var recompile bool
+	var forceRebuild bool
+	var daemon bool
+	var prebuild bool
+	var toTest string
 	var setupProject string
 	var toGoGet string
 	var doTidy bool
+	var updateDepsFlag bool
+	var secretAction string
+	var presetAction string
 	var path string
 	var printDir bool
-	var printTemplate bool
+	var projectArg string
+	var printProjects bool
+	var registerName string
+	var listTemplatesFlag bool
+	var templateToAdd string
+	var templateToCheck string
+	var ingestDir string
+	var toolboxDest string
+	var selfrunToExport string
+	var toRename string
+	var toDeprecate string
+	var toPackage string
 	var execCode bool
 	var printShebang bool
 	var printVersion bool
-
-	flag.StringVar(&name, "name", "", "A name for your command.")
-	flag.StringVar(&name, "n", "", "A name for your command.")
-	flag.StringVar(&toCat, "cat", "", "Prints the script, or copies it to --name if provided. The original source and binary remain in the project.")
-	flag.StringVar(&toExport, "export", "", "Exports the named script to stdout with shebang added and removes source and binary from project.")
-	flag.StringVar(&binToExport, "export-bin", "", "Exports the named binary to local directory and removes source and binary from project.")
-	flag.StringVar(&toEdit, "edit", "", "Edit the named command in the editor specified by environment variable GOSCRIPT_EDITOR or EDITOR.")
-	flag.StringVar(&toEdit, "e", "", "Edit the named command in the editor specified by environment variable GOSCRIPT_EDITOR or EDITOR.")
-	flag.StringVar(&code, "code", "", "The code of your command. Defaults to empty string.")
-	flag.StringVar(&code, "c", "", "The code of your command. Defaults to empty string.")
-
-	flag.StringVar(&inputFile, "file", "", "A go src file, complete with main function and imports. Alternative to --code and --imports options.")
-	flag.StringVar(&inputFile, "f", "", "A go src file, complete with main function and imports. Alternative to --code and --imports options.")
-	flag.StringVar(&toDelete, "delete", "", "Delete the specified compiled command. Removes .go extension from source file so it can be restored.")
-	flag.StringVar(&toRestore, "restore", "", "Restore a command after delete or export operation. Restores .go extension to the source file and recompiles.")
-
-	flag.StringVar(&path, "path", "", "Print the path to the source file specified, if exists in the project. Blank if not found.")
-	flag.StringVar(&path, "p", "", "Print the path to the source file specified, if exists in the project. Blank if not found.")
-	flag.BoolVar(&printDir, "dir", false, "Print the directory path to the project.")
-	flag.BoolVar(&printDir, "d", false, "Print the directory path to the project.")
-	flag.BoolVar(&printTemplate, "template", false, "Print a template go source file to stdout. After edits, use --file to compile with goscript.")
-	flag.BoolVar(&printTemplate, "t", false, "Print a template go source file to stdout. After edits, use --file to compile with goscript.")
-
-	flag.BoolVar(&printShebang, "bang", false, "Print the expected shebang line.")
-	flag.BoolVar(&printShebang, "b", false, "Print the expected shebang line.")
-
-	flag.BoolVar(&listCommands, "list", false, "Print the list of existing commands.")
-	flag.BoolVar(&listCommands, "l", false, "Print the list of existing commands.")
-
-	flag.StringVar(&setupProject, "setup", "", "A name or absolute path. Creates a module project to be used by goscript. If no name is given, prints setup instructions.")
-	flag.BoolVar(&recompile, "recompile", false, "Recompile all existing source files in the project src directory.")
-	flag.StringVar(&toGoGet, "goget", "", "Go get an external package (not part of stdlib) to pull into the project.")
-	flag.StringVar(&toGoGet, "g", "", "Go get an external package (not part of stdlib) to pull into the project.")
-	flag.BoolVar(&doTidy, "gotidy", false, "Run go mod tidy (remove modules from go.mod file that are no longer required.)")
-
-	flag.BoolVar(&execCode, "exec", false, "Execute the resulting binary.")
-	flag.BoolVar(&execCode, "x", false, "Execute the resulting binary.")
-
-	flag.BoolVar(&printVersion, "version", false, "Print the goscript version.")
-	flag.BoolVar(&printVersion, "v", false, "Print the goscript version.")
+	var doUpdate bool
+	var warm bool
+	var runDoctor bool
+	var doInstallGo bool
+	var pinGo string
+	var toFixShebang string
+	var printHelp bool
+	var doUndo bool
+	var doRollback bool
+	var toVet string
+	var longList bool
+	var jsonList bool
+	var cheatsheetFormat string
+	var toDescribe string
+	var describeEvery bool
+	var modulePath string
+	var verifyMods bool
+	var licenses string
+	var findUnused bool
+	var sizeHistory string
+	var noDefaultDeps bool
+	var starters string
+	var codeFile string
+	var codeStdin bool
+	var failFast bool
+	var exclusive bool
+	var wait bool
+	var noWait bool
+	var runCommand string
+	var shellFunctions string
+	var startRepl bool
+	var notifyDone bool
+	var toWatch string
+	var serveAddr string
+	var showStatus bool
+	var showRuns string
+	var showHistory string
+	var runStatistics bool
+	var target string
+	var isolate bool
+	var completionShell string
+	var completeNames string
+	var toTry string
+	var scriptURL string
+	var trustURL bool
+	var execRev string
+	var toListVersions string
+
+	const (
+		runGroup     = "Run and build"
+		manageGroup  = "Manage commands"
+		projectGroup = "Project and modules"
+		infoGroup    = "Information"
+	)
+	options.Strings(&code, "code", "c", runGroup, "The code of your command, @path to read the body of the main function from a file, or - to read it from standard input. May be repeated; the fragments are joined with newlines.")
+	options.String(&codeFile, "code-file", "", runGroup, "A file containing the body of the main function. Same as --code @path.")
+	options.Bool(&codeStdin, "stdin", "", runGroup, "Read the body of the main function from standard input. Same as --code -.")
+	options.Strings(&argSpecs, "args", "", runGroup, "Declare typed arguments for --code as <name>:<type>[=<default>], comma-separated (e.g. \"in:string,verbose:bool,n:int=3\"). They are parsed as flags into args (args.In, args.Verbose, args.N), with the other arguments in args.Rest. Types are string, bool, int, int64, uint, uint64, float and duration.")
+	options.Strings(&withPreludes, "with", "", runGroup, "Add scaffolding to --code. 'context' declares ctx, a context.Context cancelled on SIGINT or SIGTERM. 'log' declares log, a log/slog logger configured by GOSCRIPT_LOG and GOSCRIPT_LOG_FORMAT. 'text' declares chars, truncate, reverse and length, which work on characters as a reader sees them rather than bytes. May be repeated or comma-separated.")
+	options.Bool(&noVet, "no-vet", "", runGroup, "Don't check scripts with go vet when they are built. Also set by GOSCRIPT_NO_VET=1.")
+	options.Bool(&verbose, "verbose", "", runGroup, "Print each go command goscript runs, such as go build and go get, to stderr.")
+	options.String(&ldflagsOption, "ldflags", "", runGroup, "Linker flags for the builds of this run (e.g. '-s -w' to strip symbols, or '-X main.version=1.2.0'), added to those of the project and a script's frontmatter.")
+	options.String(&tagsOption, "tags", "", runGroup, "Comma-separated build tags for the builds of this run, added to those of the project and a script's frontmatter.")
+	options.Bool(&raceOption, "race", "", runGroup, "Build with the race detector.")
+	options.Bool(&trimpathOption, "trimpath", "", runGroup, "Build without the file system paths of this machine in the binary.")
+	options.Bool(&noRecover, "no-recover", "", runGroup, "Don't turn panics in --code into a short error message. The full goroutine trace is printed instead.")
+	options.Bool(&mustMode, "must", "", runGroup, "Handle errors in --code for you: 'v, err := f()' becomes 'v := must(f())', which exits with the error if there is one.")
+	options.String(&inputFile, "file", "f", runGroup, "A go src file, complete with main function and imports, or a directory with main.go and helper files. Alternative to --code.")
+	options.String(&scriptURL, "url", "", runGroup, "Fetch a Go source file over https (e.g. a raw GitHub file or gist) and run it like --file --exec. With --name, it is saved as a command instead. Fetched sources are cached and revalidated with their ETag.")
+	options.Bool(&trustURL, "trust", "", runGroup, "With --url, run the fetched source without asking, even if it is new or has changed since it was last run.")
+	options.Bool(&execCode, "exec", "x", runGroup, "Execute the resulting binary.")
+	options.Bool(&notifyDone, "notify", "", runGroup, "With --exec, send a notification with the command name, duration and exit status when it finishes. Uses the webhook in <project>/config.json if set, or a desktop notification.")
+	options.Bool(&exclusive, "exclusive", "", runGroup, "With --exec, don't let two runs of the same command overlap. A run waits for the one in progress to finish.")
+	options.Bool(&wait, "wait", "", runGroup, "With --exclusive, wait for a run in progress to finish (the default). Overrides '//goscript:exclusive no-wait'.")
+	options.Bool(&noWait, "no-wait", "", runGroup, "With --exclusive, exit with an error if the command is already running instead of waiting.")
+	options.String(&inputEncoding, "encoding", "", runGroup, "With --exec, the encoding of standard input, which is transcoded to UTF-8 for the script as it is read: utf-8, latin-1, windows-1252, utf-16 (with a byte order mark, else big-endian), utf-16le or utf-16be. Invalid input is replaced with U+FFFD and reported. locale uses the character set of the locale if it isn't UTF-8. Input isn't transcoded without --encoding.")
+	options.Bool(&startRepl, "repl", "", runGroup, "Start an interactive session. Each statement is compiled and run as it is entered, and kept if it succeeds. Type :help in the session for its commands.")
+	options.String(&runCommand, "run", "", runGroup, "Run the named command, compiling it first only if its binary is missing or out of date. Arguments after -- are passed to the command.")
+	options.String(&execRev, "exec-rev", "", runGroup, "Run an earlier version of a command, given as <name>@<version>: a number from --versions (or -1 for the one before the latest), a hash prefix or a time such as 2024-05-01T09:30. The current source is not changed.")
+	options.String(&toTry, "try", "", runGroup, "Show the first example of the named command ('//goscript:example' in its source) and run it if you confirm.")
+	options.String(&toWatch, "watch", "", runGroup, "Recompile the named command each time its source is saved. With --exec, also run it after each successful build.")
+	options.String(&serveAddr, "serve", "", runGroup, "Serve the HTTP routes declared by commands ('route:' in frontmatter) on the given address (e.g. :8080), so CI or chat-ops can trigger them. Also runs the commands scheduled in <project>/config.json.")
+	options.String(&targetOS, "os", "", runGroup, "Build for another operating system (GOOS, e.g. linux or windows). The binary goes to bin/<os>_<arch>/ unless exported with --export-bin.")
+	options.String(&targetArch, "arch", "", runGroup, "Build for another architecture (GOARCH, e.g. arm64).")
+	options.String(&target, "target", "", runGroup, "Build for another platform given as <os>/<arch>, e.g. linux/arm64 (the same as --os and --arch), or as ssh:<host> for the platform of a host reached with ssh, which is found with uname and recorded in the project config.")
+	options.String(&name, "name", "n", runGroup, "A name for your command. The code will be saved to the project src directory with that name.")
+	options.Bool(&isolate, "isolate", "", runGroup, "Give the --name command a module of its own (src/<name>/main.go with its own go.mod), so its dependencies stay out of the project go.mod. An existing command is moved into it.")
+	options.OptionalString(&templateKind, "template", "t", runGroup, "script", "Print a template go source file to stdout, or to the project src directory if --name provided. Give a kind (e.g. http-server) to use a template from the project's templates directory or a built-in one instead of script.tmpl. With --exec, wraps --code with it and runs it.")
+
+	options.String(&ingestDir, "ingest", "", manageGroup, "Add the Go scripts in a directory to the project: each .go file with a main function, and each subdirectory with a main package. Their go.mod requirements are added to the project (or kept in a module of their own if they need newer versions), and they are compiled. Names already in the project are reported and skipped.")
+	options.OptionalString(&templateToCheck, "check-template", "", manageGroup, "script", "Check that the named template, or script.tmpl if no name is given, parses and wraps code into a Go program. Code is wrapped with the default template while the template it names can't be used.")
+	options.String(&templateToAdd, "template-add", "", manageGroup, "Add a template file to the project's templates directory, named after the file or --name, for use with --template. Give the name of a built-in template to add a copy of it to customize.")
+	options.String(&toEdit, "edit", "e", manageGroup, "Edit the named command in the editor named by GOSCRIPT_EDITOR, the project defaults or EDITOR.")
+	options.Bool(&listCommands, "list", "l", manageGroup, "Print the list of existing commands.")
+	options.Bool(&longList, "long", "", manageGroup, "With --list, also print when each command's source was last modified, the size of its binary and its description.")
+	options.Bool(&jsonList, "json", "", manageGroup, "With --list, print the commands as JSON, with their descriptions, source and binary paths, modification times, binary sizes and examples.")
+	options.String(&toDescribe, "describe", "", manageGroup, "Print a help page for the named command, generated from its frontmatter and directives: synopsis, flags, environment and requirements.")
+	options.Bool(&describeEvery, "describe-all", "", manageGroup, "Print the help page of every command in the project.")
+	options.String(&cheatsheetFormat, "cheatsheet", "", manageGroup, "Write a cheat sheet of all commands, descriptions and flags to the project. Format is text, md or html.")
+	options.String(&path, "path", "p", manageGroup, "Print the path to the source file specified, if exists in the project. Blank if not found.")
+	options.String(&secretAction, "secret", "", manageGroup, "Manage the project's encrypted secrets, which scripts read with goscript.Secret(\"NAME\"): 'set <name>' stores a value read from stdin, 'get <name>' prints it, 'list' prints the names and 'delete <name>' removes one.")
+	options.String(&toRename, "rename", "", manageGroup, "Rename a command, given as <old>:<new>. Its source, binaries and saved versions are renamed, its entries in manifest.json and config.json are updated, and it is recompiled.")
+	options.String(&toDeprecate, "deprecate", "", manageGroup, "Mark a command as replaced by another, given as <old>:<new>, in manifest.json. Running the old name warns and, with --forward, runs the new command instead; the old name needn't have a source any more. <old>: removes the mark.")
+	options.Bool(&forwardDeprecated, "forward", "", manageGroup, "With --deprecate, have the old name run the new command.")
+	options.String(&toPackage, "package", "", manageGroup, "Package the named command for people who don't use goscript, in the format given with --format: nix or brew (a package definition that builds its source), or deb or rpm (the binary with an nfpm.yaml, and the package itself if nfpm is installed).")
+	options.String(&toCat, "cat", "", manageGroup, "Prints the script, or copies it to --name if provided. The original source and binary remain in the project.")
+	options.String(&toExport, "export", "", manageGroup, "Exports the named script to stdout with shebang added and removes source and binary from project. For Windows, a .cmd wrapper that runs the script is written to the current directory instead of the shebang.")
+	options.String(&toolboxDest, "export-toolbox", "", manageGroup, "Export every command for machines without Go to a directory, or to a .tar, .tar.gz or .tgz file: the binaries (built for --os/--arch if given), bash and fish completions of their flags, a manifest.json and an install.sh. The commands stay in the project.")
+	options.String(&selfrunToExport, "export-selfrun", "", manageGroup, "Export the named command to the current directory as one executable carrying its source, go.mod and build metadata, which checks its own checksum when it starts. Run it with --source to extract the source, or --metadata to print the metadata. The command stays in the project.")
+	options.String(&binToExport, "export-bin", "", manageGroup, "Exports the named binary to the local directory and removes source and binary from project.")
+	options.String(&toDelete, "delete", "", manageGroup, "Delete the specified compiled command. Removes .go extension from source file so it remains recoverable.")
+	options.String(&toRestore, "restore", "", manageGroup, "Restore a command after delete or export operation. Restores .go extension to the source file and recompiles.")
+	options.String(&toListVersions, "versions", "", manageGroup, "List the saved versions of the named command. A version is saved each time the command is built with changed source.")
+	options.Bool(&doUndo, "undo-last", "", manageGroup, "Undo the most recent delete, export or export-bin operation.")
+	options.Bool(&recompile, "recompile", "", manageGroup, "Recompile the commands in the project src directory whose source or dependencies changed since their binaries were built. Failures are summarized at the end.")
+	options.OptionalString(&toTest, "test", "", manageGroup, "all", "Run the tests of the named command (src/<name>_test.go, or _test.go files in its directory), or of every command with tests if no name is given. Arguments after -- are passed to go test.")
+	options.Bool(&forceRebuild, "force", "", manageGroup, "With --recompile, rebuild every command, including those whose binaries are up to date.")
+	options.Bool(&failFast, "fail-fast", "", manageGroup, "With --recompile, stop at the first command that fails to compile.")
+	options.Bool(&assumeYes, "yes", "y", manageGroup, "Don't ask for confirmation before deleting or overwriting commands.")
+	options.String(&onConflict, "on-conflict", "", manageGroup, "With --preset import or --ingest, what to do with an import alias, template or command the project already has in a different form, instead of asking: keep (the project's), take (the incoming one) or rename (add the incoming one under a free name).")
+
+	options.String(&projectArg, "project", "", projectGroup, "Use the project registered under this name, or the one at this path, instead of GOSCRIPT_PROJECT_DIR. See --register and --projects.")
+	options.String(&registerName, "register", "", projectGroup, "Register the project in use (e.g. the one given to --project) under this name, for --project to select it by. The name must not be taken by another project.")
+	options.String(&setupProject, "setup", "", projectGroup, "A name, absolute path or 'help'. Creates a module project to be used by goscript. If 'help', prints setup instructions.")
+	options.String(&modulePath, "module", "", projectGroup, "With --setup, the module path for the new project. Defaults to a valid path derived from the project name.")
+	options.Bool(&noDefaultDeps, "no-default-deps", "", projectGroup, "With --setup, don't add the default dependency github.com/bitfield/script to the new project.")
+	options.String(&starters, "starter", "", projectGroup, "With --setup, a comma-separated list of starter packs (text, http, aws, kubernetes, data) whose dependencies and import aliases are added to the project.")
+	options.String(&toGoGet, "goget", "g", projectGroup, "Go get an external package (not part of stdlib) to pull into the project. With --name, into the module of that command if it is isolated.")
+	options.Bool(&doTidy, "gotidy", "", projectGroup, "Run go mod tidy (remove modules from go.mod file that are no longer required). With --name, in the module of that command if it is isolated.")
+	options.Bool(&updateDepsFlag, "update-deps", "", projectGroup, "Upgrade the modules in the project's go.mod to their latest minor or patch releases, print the modules that changed with links to review them, record the changes in the operations journal and recompile the commands they affect.")
+	options.String(&presetAction, "preset", "", projectGroup, "Share the project's environment without its scripts: 'export <name>' writes its import aliases, modules and templates to <name>.goscript-preset.json, and 'import <file|url>' adds those of a preset to the project.")
+	options.Bool(&doRollback, "rollback-config", "", projectGroup, "Restore go.mod, go.sum and imports.json to the versions they had before goscript last changed them, kept as .bak files beside them. Run it again to undo.")
+	options.Bool(&daemon, "daemon", "", projectGroup, "Run until interrupted, keeping warm workers that scripts and --code run in the project are handed to (set GOSCRIPT_NO_DAEMON to run without them), and rebuilding the shebang scripts run into the build cache as soon as they are saved, so their next run doesn't wait for go build.")
+	options.Bool(&prebuild, "prebuild", "", runGroup, "Build a script into the build cache without running it (used by --daemon).").Hide()
+	options.Bool(&warm, "warm", "", projectGroup, "Precompile the standard library and packages in imports.json to prime the build cache.")
+	options.Bool(&verifyMods, "verify-mods", "", projectGroup, "Verify that the project's dependencies in the module cache match go.sum. Runs automatically before --export-bin.")
+	options.OptionalString(&licenses, "licenses", "", projectGroup, "all", "Report the license of each dependency of the named command, or of the whole project if no name is given. Disallowed licenses (GOSCRIPT_DISALLOWED_LICENSES) are flagged.")
+	options.OptionalString(&toVet, "vet", "", projectGroup, "all", "Check the named command, or every command if no name is given, with go vet, and staticcheck if it is installed. Exits nonzero if there are findings.")
+	options.Bool(&findUnused, "unused", "", projectGroup, "Report aliases in imports.json and modules in go.mod that no command uses.")
+	options.String(&sizeHistory, "size-history", "", projectGroup, "Show how the named command's binary size has changed over time. Sizes are recorded on each build when GOSCRIPT_SIZE_HISTORY is set.")
+	options.Bool(&showStatus, "status", "", projectGroup, "Show the commands scheduled in <project>/config.json, with the last and next run of each, and whether --serve is running them.")
+	options.OptionalString(&showRuns, "runs", "", projectGroup, "all", "List the recent runs of the routes and schedules of --serve, of the named command or of all commands, with their exit status, duration, CPU time and peak memory.")
+	options.OptionalString(&showHistory, "history", "", projectGroup, "all", "List the recent runs with --exec (including --run and shebang scripts) of the named command, or of all commands, with their arguments, exit status, duration, CPU time and peak memory. Runs are recorded in <project>/history.jsonl unless GOSCRIPT_NO_RUN_LOG=1.")
+	options.Bool(&runStatistics, "stats", "", projectGroup, "With --runs or --history, show the totals for each command instead: number of runs and failures, average and maximum time and CPU, and peak memory.")
+	options.Bool(&runDoctor, "doctor", "", projectGroup, "Check the Go toolchain and project setup and report any problems.")
+	options.Bool(&doInstallGo, "install-go", "", projectGroup, "Download the pinned (or latest) Go toolchain into the project and use it for all builds.")
+	options.String(&pinGo, "toolchain", "", projectGroup, "Pin the project to a Go version (e.g. 1.22.1 or 'latest') and install it under <project>/toolchain.")
+
+	options.Bool(&printDir, "dir", "d", infoGroup, "Print the directory path to the project.")
+	options.Bool(&printProjects, "projects", "", infoGroup, "List the projects registered with --register, marking the one in use.")
+	options.OptionalString(&shellFunctions, "shell-functions", "", infoGroup, "sh", "Print a shell function for each command that runs it with --run, to source from a shell startup file. The shell is sh (the default, also for bash and zsh) or fish.")
+	options.Bool(&plainOutput, "plain", "", infoGroup, "Screen-reader friendly output: informational output is written one item per line as labelled fields, without alignment padding, colors or other terminal effects. Takes precedence over --format. Also set by GOSCRIPT_PLAIN=1.")
+	options.String(&outputFormat, "format", "", infoGroup, "Format of informational output such as --list, --recompile summaries and --licenses: plain (the default), markdown or slack. With --package, the package format: nix, brew, deb or rpm.")
+	options.String(&completionShell, "completion", "", infoGroup, "Print a completion script for bash, zsh or fish. Command names are completed from the project for --edit, --cat, --delete, --restore, --export and --path.")
+	options.String(&completeNames, "complete-names", "", infoGroup, "Print the names of the active or deleted commands, for completion scripts.").Hide()
+	options.Bool(&listTemplatesFlag, "template-list", "", infoGroup, "Print the templates available to --template: script.tmpl, those in the project's templates directory and the built-in ones.")
+	options.Bool(&printShebang, "bang", "b", infoGroup, "Print the expected shebang line. For Windows, which has no shebang lines, prints the .cmd wrapper that takes its place.")
+	options.String(&toFixShebang, "fix-shebang", "", infoGroup, "Rewrite the shebang line of the given script file in a portable form.")
+	options.Bool(&printVersion, "version", "v", infoGroup, "Print the goscript version.")
+	options.Bool(&doUpdate, "update", "", infoGroup, "Replace goscript with its latest release on GitHub, after verifying the download against the release's checksums.")
+	options.Bool(&updateCheckOnly, "check", "", infoGroup, "With --update, only report whether a newer release exists.")
+	options.Bool(&printHelp, "help", "h", infoGroup, "Print this help.")
 
 	// Custom usage function
-	flag.Usage = func() {
+	usage := func() {
 		fmt.Fprintf(os.Stderr, "%s (see https://github.com/fkmiec/goscript)\n\n", version)
-		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n", os.Args[0])
-		fmt.Fprintln(os.Stderr, "Options:")
-		fmt.Fprintln(os.Stderr, "  --code|-c string\n\tThe code of your command or the name of a file containing the body of the main function.")
-		fmt.Fprintln(os.Stderr, "  --file|-f string\n\tA go src file, complete with main function and imports. Alternative to --code.")
-		fmt.Fprintln(os.Stderr, "  --exec|-x\n\tExecute the resulting binary.")
-		fmt.Fprintln(os.Stderr, "  --name|-n string\n\tA name for your command. The code will be saved to the project src directory with that name.")
-		fmt.Fprintln(os.Stderr, "  --edit|-e string\n\tEdit the named command in the editor specified by environment variable GOSCRIPT_EDITOR or EDITOR.")
-		fmt.Fprintln(os.Stderr, "  --template|-t\n\tPrint a template go source file to stdout, or to the project src directory if --name provided.")
-		fmt.Fprintln(os.Stderr, "  --list|-l\n\tPrint the list of existing commands.")
-		fmt.Fprintln(os.Stderr, "  --path|-p string\n\tPrint the path to the source file specified, if exists in the project. Blank if not found.")
-		fmt.Fprintln(os.Stderr, "  --cat string\n\tPrints the script, or copies it to --name if provided. The original source and binary remain in the project.")
-		fmt.Fprintln(os.Stderr, "  --export string\n\tExports the named script to stdout with shebang added and removes source and binary from project.")
-		fmt.Fprintln(os.Stderr, "  --export-bin string\n\tExports the named binary to the local directory and removes source and binary from project.")
-		fmt.Fprintln(os.Stderr, "  --delete string\n\tDelete the specified compiled command. Removes .go extension from source file so it remains recoverable.")
-		fmt.Fprintln(os.Stderr, "  --restore string\n\tRestore a command after delete or export operation. Restores .go extension to the source file and recompiles.")
-		fmt.Fprintln(os.Stderr, "  --goget|-g string\n\tGo get an external package (not part of stdlib) to pull into the project.")
-		fmt.Fprintln(os.Stderr, "  --gotidy\n\tRun go mod tidy (remove modules from go.mod file that are no longer required.")
-		fmt.Fprintln(os.Stderr, "  --recompile\n\tRecompile existing source files in the project src directory.")
-		fmt.Fprintln(os.Stderr, "  --setup\n\tA name, absolute path or 'help'. Creates a module project to be used by goscript. If 'help', prints setup instructions.")
-		fmt.Fprintln(os.Stderr, "  --dir|-d\n\tPrint the directory path to the project.")
-		fmt.Fprintln(os.Stderr, "  --bang|-b\n\tPrint the expected shebang line.")
-		fmt.Fprintln(os.Stderr, "  --version|-v\n\tPrint the goscript version.")
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] [script file] [script args]\n", args[0])
+		options.PrintUsage(os.Stderr)
 		fmt.Fprintln(os.Stderr, "\nExample (Compile as 'hello'. Execute hello.):")
-		fmt.Fprintf(os.Stderr, "  %s --code 'script.Echo(\"Hello World!\\n\").Stdout()' --name hello; hello\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --code 'script.Echo(\"Hello World!\\n\").Stdout()' --name hello; hello\n", args[0])
 		fmt.Fprintln(os.Stderr, "\nExample (Execute immediately.):")
-		fmt.Fprintf(os.Stderr, "  %s --exec --code 'script.Echo(\"Hello World!\\n\").Stdout()'\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "  %s --exec --code 'script.Echo(\"Hello World!\\n\").Stdout()'\n", args[0])
 		fmt.Fprintln(os.Stderr, "\nExample shebang in 'myscript.go' file:")
-		fmt.Fprintf(os.Stderr, "  (1) Add '#!/usr/bin/env -S %s' to the top of your go source file.\n", os.Args[0])
-		fmt.Fprintln(os.Stderr, "  (2) Set execute permission and type \"./myscript.go\" as you would with a shell script.\n")
+		fmt.Fprintf(os.Stderr, "  (1) Add '#!/usr/bin/env -S %s' to the top of your go source file.\n", args[0])
+		fmt.Fprintln(os.Stderr, "  (2) Set execute permission and type \"./myscript.go\" as you would with a shell script.")
+		fmt.Fprintln(os.Stderr)
 	}
 
 	//Shebang scenarios (Note any of these could also be straight commandline and not shebang):
 	// (1) #!/usr/bin/env -S goscript -x -f <filename> <optionally more args> (handled as normal)
-	// (2) #!/usr/bin/env -S goscript -x <filename> <optionally more args> (need to determine if first non-flag arg is a filename, and if so, set inputFile=arg[0])
-	// (3) #!/usr/bin/env -S goscript <filename> <optionally more args> (need to determine if first non-flag arg is a filename, and if so, set inputFile=arg[0] and execCode=true)
+	// (2) #!/usr/bin/env -S goscript -x <filename> <optionally more args> (first non-option arg is a filename, so set inputFile=arg[0])
+	// (3) #!/usr/bin/env -S goscript <filename> <optionally more args> (first non-option arg is a filename, so set inputFile=arg[0] and execCode=true)
 
-	//The flag pkg expects non-flags to follow AFTER any flags given. However, shebang will make the filename the first arg.
-	// So, before parsing the flags, check if first arg is a non-flag and an existing file.
-	// If so, make it the inputFile and remove it from the os.Args array.
-	// Beyond this one use case, we expect the user to follow convention and pass flags before non-flags.
-	var nonFlagFirstArg bool
-	if len(os.Args) > 1 {
-		nonFlagFirstArg = checkFileExists(os.Args[1])
+	//A script's own flags may collide with goscript's. So the arguments are split in two phases: goscript options
+	// up to the first non-option argument (or "--"), then everything after it goes to the script verbatim.
+	// If that first non-option is an existing file, it's the script.
+	scriptFile, subprocessArgs, err := options.Parse(args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		fmt.Fprintf(os.Stderr, "Run '%s --help' for usage.\n", args[0])
+		exitProgram(2)
 	}
-	if nonFlagFirstArg {
-		inputFile = os.Args[1]
-		os.Args = append(os.Args[:1], os.Args[2:]...)
+	if printHelp {
+		usage()
+		return 0
+	}
+	if scriptFile != "" {
+		inputFile = scriptFile
+	}
+	if codeFile != "" {
+		code = append(code, "@"+codeFile)
+	}
+	if codeStdin {
+		code = append(code, "-")
 	}
 
-	flag.Parse()
-
-	if nonFlagFirstArg && !execCode {
+	if scriptFile != "" && !execCode {
 		execCode = true //Account for scenario 3, above.
 	}
+	//--run: Execute a named command, as the functions printed by --shell-functions do
+	if runCommand != "" {
+		name = runCommand
+		execCode = true
+	}
 
-	var subprocessArgs []string
-	if len(flag.Args()) > 0 {
-		subprocessArgs = flag.Args()
+	if target != "" {
+		parseTarget(target)
+	}
+	if value := os.Getenv("GOSCRIPT_PLAIN"); value != "" && value != "0" {
+		plainOutput = true
+	}
+	if inputEncoding != "" {
+		encoding, err := parseEncoding(inputEncoding)
+		check(err, 2, "")
+		inputEncoding = encoding
+	}
+	if onConflict != "" && !slices.Contains(conflictChoices, onConflict) {
+		check(fmt.Errorf("unknown --on-conflict %q", onConflict), 2, "Use "+strings.Join(conflictChoices, ", ")+".")
+	}
+	if toPackage == "" && !slices.Contains(outputFormats, outputFormat) {
+		check(fmt.Errorf("unknown format %q", outputFormat), 2, "The formats are "+strings.Join(outputFormats, ", ")+".")
 	}
 
+	//--project: Use a registered project, or the one at a path, in place of GOSCRIPT_PROJECT_DIR
+	if projectArg != "" {
+		selectProject(projectArg)
+	}
 	//Get the project path (either the location of the executable or as specified by GOSCRIPT_PROJECT_DIR).
 	projectDir = getProjectPath()
+	//--target ssh:<host>: Build for the platform of a remote host, found with uname once and then remembered
+	if targetHost != "" {
+		resolveTargetHost()
+	}
+	//Defaults from the project config, where neither options nor environment variables set them
+	applyDefaults()
 
 	//--version: Print the version of goscript
 	if printVersion {
 		fmt.Println(version)
-		return //Exit the program after printing the version
+		return 0 //Exit the program after printing the version
+	}
+
+	//--projects: List the registered projects
+	if printProjects {
+		listProjects()
+		return 0 //Exit the program after printing the projects
+	}
+
+	//--register: Add the project in use to the registry under a name, for --project
+	if registerName != "" {
+		check(registerProject(registerName, projectDir), 2, "Choose another name, or see the registry with --projects.")
+		fmt.Printf("Registered project %s as %s: 'goscript --project %s ...' uses it without GOSCRIPT_PROJECT_DIR.\n", projectDir, registerName, registerName)
+		return 0 //Exit the program after registering the project
+	}
+
+	//--update: Replace goscript with its latest release
+	if doUpdate {
+		selfUpdate(updateCheckOnly)
+		return 0 //Exit the program after updating
 	}
 
 	//--dir: Print the location of the project folder
 	if printDir {
 		fmt.Println(projectDir)
-		return //Exit the program after printing the path
+		return 0 //Exit the program after printing the path
+	}
+
+	//--doctor: Report on the go toolchain and project setup
+	if runDoctor {
+		doctor()
+		return 0 //Exit the program after printing the report
+	}
+
+	//--install-go: Download a go toolchain into the project directory
+	if doInstallGo {
+		installGo("")
+		return 0 //Exit the program after installing the toolchain
+	}
+
+	//--toolchain: Pin the project to a go version and install it
+	if pinGo != "" {
+		pinToolchain(pinGo)
+		return 0 //Exit the program after pinning the toolchain
 	}
 
 	//--path: Print the location of the source file, if it exists, otherwise blank
 	if path != "" {
-		srcFile := projectDir + "/src/" + path + ".go"
+		srcFile := sourceFile(path)
 		isFileExists := checkFileExists(srcFile)
 		if isFileExists {
 			//print the source file path
 			fmt.Println(srcFile)
 		}
-		return //Exit the program after printing the path
+		return 0 //Exit the program after printing the path
 	}
 
 	//--setup: Create new goscript project. If no project name or path given, prints setup instructions.
 	if setupProject != "" {
-		createNewProject(setupProject)
-		return //Exit the program after setting up project or printing instructions.
+		createNewProject(setupProject, modulePath, noDefaultDeps, parseStarterPacks(starters))
+		return 0 //Exit the program after setting up project or printing instructions.
 	}
 
 	//--bang: Print the shebang line to help the user who can't quite remember how it should go
 	if printShebang {
-		fmt.Println("#!/usr/bin/env -S " + os.Args[0])
-		return //Exit the program after printing the shebang line
+		if windowsScripts() {
+			fmt.Println("Windows has no shebang lines. To run script.go by name, save this beside it as script.cmd:")
+			fmt.Print(strings.ReplaceAll(cmdWrapper("script"), "\r\n", "\n"))
+			return 0
+		}
+		fmt.Println(shebangLine())
+		return 0 //Exit the program after printing the shebang line
+	}
+
+	//--fix-shebang: Rewrite a non-portable shebang line
+	if toFixShebang != "" {
+		fixShebang(toFixShebang)
+		return 0 //Exit the program after rewriting the shebang line
 	}
 
 	//--list: List existing commands
 	if listCommands {
-		cmds := getSourceList() //Assumes binary list is same. Not true if template files that were never compiled, but should be rare.
+		cmds := withRedirects(getSourceList()) //Assumes binary list is same. Not true if template files that were never compiled, but should be rare.
+		if jsonList {
+			listCommandsJSON(cmds)
+			return 0 //Exit the program after printing the list of commands
+		}
+		if longList {
+			listCommandsLong(cmds)
+			return 0 //Exit the program after printing the list of commands
+		}
+		r := &report{title: "Commands", columns: []string{"Command"}}
+		manifest := readManifest()
 		for _, cmd := range cmds {
-			if !strings.HasSuffix(cmd, ".go") {
-				fmt.Printf("%s (requires --restore)\n", cmd)
-				continue
+			name, active := strings.CutSuffix(cmd, ".go") //Remove the .go extension.
+			switch entry := manifest[name]; {
+			case !active && checkFileExists(sourcePath(cmd)):
+				r.add(cmd + " (requires --restore)")
+			case entry.ReplacedBy != "":
+				r.add(name + " (" + deprecationNote(entry) + ")")
+			default:
+				r.add(name)
 			}
-			fmt.Printf("%s\n", cmd[:len(cmd)-3]) //Remove the .go extension.
 		}
-		return //Exit the program after printing the list of commands
+		r.print()
+		return 0 //Exit the program after printing the list of commands
+	}
+
+	//--watch: Recompile (and optionally run) a command on every save
+	if toWatch != "" {
+		watchCommand(toWatch, execCode, subprocessArgs)
+		return 0
+	}
+
+	//--serve: Trigger commands over HTTP through the routes they declare
+	if serveAddr != "" {
+		serve(serveAddr)
+		return 0
+	}
+
+	//--status: Show the scheduled commands and their last and next runs
+	if showStatus {
+		printStatus()
+		return 0
+	}
+
+	//--runs: List the recorded runs of --serve, or their totals with --stats
+	if showRuns != "" {
+		printRuns(showRuns, runStatistics)
+		return 0
+	}
+
+	//--history: List the recorded runs with --exec, or their totals with --stats
+	if showHistory != "" {
+		printHistory(showHistory, runStatistics)
+		return 0
+	}
+
+	//--repl: Read, compile and run statements interactively
+	if startRepl {
+		runRepl()
+		return 0 //Exit when the session ends
+	}
+
+	//--shell-functions: Print shell functions that run each command through --run
+	if shellFunctions != "" {
+		printShellFunctions(shellFunctions)
+		return 0 //Exit the program after printing the functions
+	}
+
+	//--completion: Print a shell completion script
+	if completionShell != "" {
+		printCompletion(completionShell)
+		return 0 //Exit the program after printing the completion script
+	}
+
+	//--complete-names: Print command names for a completion script
+	if completeNames != "" {
+		printCommandNames(completeNames)
+		return 0
+	}
+
+	//--describe: Print a command's help page
+	if toDescribe != "" {
+		describeCommand(toDescribe)
+		return 0 //Exit the program after printing the help page
+	}
+
+	//--describe-all: Print the help page of every command
+	if describeEvery {
+		describeAll()
+		return 0 //Exit the program after printing the help pages
+	}
+
+	//--versions: List the saved versions of a command
+	if toListVersions != "" {
+		listVersions(toListVersions)
+		return 0
+	}
+
+	//--exec-rev: Run an earlier version of a command
+	if execRev != "" {
+		execRevision(execRev, subprocessArgs)
+		return 0
+	}
+
+	//--try: Run a command's first example, after confirmation
+	if toTry != "" {
+		tryExample(toTry)
+		return 0
+	}
+
+	//--cheatsheet: Render all commands into a shareable document
+	if cheatsheetFormat != "" {
+		writeCheatsheet(cheatsheetFormat)
+		return 0 //Exit the program after writing the cheat sheet
 	}
 
 	//--goget: Execute a go get <pkg> to bring external package into project
+	//With --name, into the module of the named command, which is its own if it is isolated
 	if toGoGet != "" {
-		goGet(toGoGet)
-		return //Exit after go get package
+		defer lockProject()()
+		if dir, srcFilename := commandModule(name); dir != projectDir {
+			goGetIn(dir, toGoGet)
+			recompileIsolated(srcFilename)
+			return 0
+		}
+		checkProjectModule()
+		//Recompile only the commands that use a module go get changed
+		rebuildAfter(func() { goGet(toGoGet) })
+		return 0 //Exit after go get package
+	}
+
+	//--update-deps: Upgrade the project's modules and record what changed
+	if updateDepsFlag {
+		defer lockProject()()
+		checkProjectModule()
+		rebuildAffected(updateDeps())
+		return 0
 	}
 
 	//--gotidy: Execute a go mod tidy to cleanup modules no longer required.
+	//With --name, tidy the module of the named command instead, if it is isolated
 	if doTidy {
-		goTidy()
-		return //Exit after go mod tidy
+		defer lockProject()()
+		if dir, srcFilename := commandModule(name); dir != projectDir {
+			goTidyIn(dir)
+			recompileIsolated(srcFilename)
+			return 0
+		}
+		//Tidying can add, upgrade or remove modules too
+		rebuildAfter(goTidy)
+		return 0 //Exit after go mod tidy
+	}
+
+	//--secret: Store, read, list or delete an encrypted secret
+	if secretAction != "" {
+		secretCommand(secretAction, operands(scriptFile, subprocessArgs))
+		return 0
+	}
+
+	//--preset: Export or import the project's import aliases, modules and templates
+	if presetAction != "" {
+		presetCommand(presetAction, operands(scriptFile, subprocessArgs))
+		return 0
+	}
+
+	//--rollback-config: Restore go.mod, go.sum and imports.json from their backups
+	if doRollback {
+		defer lockProject()()
+		//The restored go.mod may have other versions of modules the commands use
+		rebuildAfter(rollbackConfig)
+		return 0 //Exit after rolling back
+	}
+
+	//--verify-mods: Check the module cache against go.sum
+	if verifyMods {
+		if !verifyModules() {
+			exitProgram(1)
+		}
+		return 0 //Exit after verifying modules
+	}
+
+	//--licenses: Report the licenses of a command's or the project's dependencies
+	if licenses != "" {
+		licenseReport(licenses)
+		return 0 //Exit after reporting licenses
+	}
+
+	//--vet: Check commands with go vet and staticcheck
+	if toVet != "" {
+		vetCommands(toVet)
+		return 0 //Exit after vetting
+	}
+
+	//--unused: Report imports.json aliases and go.mod modules no command uses
+	if findUnused {
+		reportUnused()
+		return 0 //Exit after reporting
+	}
+
+	//--size-history: Plot the recorded binary sizes of a command
+	if sizeHistory != "" {
+		printSizeHistory(sizeHistory)
+		return 0 //Exit after printing the size history
+	}
+
+	//--daemon: Keep warm workers for runs, and rebuild shebang scripts in the background when they change
+	if daemon {
+		runDaemon()
+		return 0
+	}
+
+	//--warm: Precompile the standard library and imports.json packages
+	if warm {
+		defer lockProject()()
+		warmBuildCache()
+		return 0 //Exit after warming the build cache
+	}
+
+	//--test: Run the tests of a command, or of all commands
+	if toTest != "" {
+		defer lockProject()()
+		runTests(toTest, subprocessArgs)
+		return 0 //Exit after running the tests
 	}
 
 	//--recompile: Recompile existing sources
 	if recompile {
-		recompileCommands()
-		return //Exit the program after recompiling existing commands
+		defer lockProject()()
+		buildRedirects(forceRebuild)
+		recompileCommands(getSourceList(), failFast, forceRebuild)
+		return 0 //Exit the program after recompiling existing commands
+	}
+
+	//--template-list: Print the templates available to --template
+	if listTemplatesFlag {
+		listTemplates()
+		return 0
+	}
+
+	//--ingest: Add a directory of loose scripts to the project
+	if ingestDir != "" {
+		defer lockProject()()
+		ingestScripts(ingestDir)
+		return 0
+	}
+
+	//--template-add: Add a template to the project
+	if templateToAdd != "" {
+		defer lockProject()()
+		addTemplate(templateToAdd, name)
+		return 0
+	}
+
+	//--check-template: Check that a template wraps code into a Go program
+	if templateToCheck != "" {
+		checkTemplate(templateToCheck)
+		return 0
 	}
 
 	//--template: Print an empty template to give a starting point when creating a new source code file
-	if printTemplate {
+	if templateKind != "" && !execCode {
 		buf = assembleSourceFile(code)
 		if name != "" {
-			srcFilename := projectDir + "/src/" + name + ".go"
+			defer lockProject()()
+			srcFilename := sourceFile(name)
+			if !confirmOverwrite(srcFilename, buf.Bytes()) {
+				cancelled()
+			}
 			writeSourceFile(srcFilename, buf)
 			fmt.Printf("Source file written to: %s\n", srcFilename)
-			return
+			return 0
 		} else {
-			fmt.Println("#!/usr/bin/env -S " + os.Args[0]) //Add the shebang line when printing a template
+			if !windowsScripts() {
+				fmt.Println(shebangLine()) //Add the shebang line when printing a template
+			}
 			_, err := buf.WriteTo(os.Stdout)
 			check(err, 2, "")
-			return //Exit the program after printing the template
+			return 0 //Exit the program after printing the template
 		}
 	}
 
 	//--edit: Edit the source code from the named command using GOSCRIPT_EDITOR or EDITOR. If neither defined, then print help message.
 	if toEdit != "" {
 		editCommand(toEdit)
-		return //Exit the program after exporting
+		return 0 //Exit the program after exporting
+	}
+
+	//--rename: Rename a command, keeping its history
+	if toRename != "" {
+		oldName, newName, err := parseRename(toRename)
+		check(err, 2, "")
+		defer lockProject()()
+		renameCommand(oldName, newName)
+		return 0
+	}
+
+	//--deprecate: Mark a command as replaced by another
+	if toDeprecate != "" {
+		oldName, newName, err := parseDeprecate(toDeprecate)
+		check(err, 2, "")
+		defer lockProject()()
+		deprecateCommand(oldName, newName, forwardDeprecated)
+		return 0
+	}
+
+	//--package: Package a command for distribution
+	if toPackage != "" {
+		packageCommand(toPackage, outputFormat)
+		return 0
 	}
 
 	//--cat: Print the source code from the named command to stdout.
 	if toCat != "" {
-		srcFilename := projectDir + "/src/" + toCat + ".go"
-		buf = readSourceFile(srcFilename)
+		srcFilename := sourceFile(toCat)
 		if name != "" {
-			copy := projectDir + "/src/" + name + ".go"
-			if writeSourceFile(copy, buf) {
-				fmt.Printf("A copy of %s was saved as %s\n", toCat, name)
-			}
+			defer lockProject()()
+			copySources(srcFilename, name)
+			fmt.Printf("A copy of %s was saved as %s\n", toCat, name)
 		} else {
-			fmt.Println("#!/usr/bin/env -S " + os.Args[0]) //Add the shebang line when printing to stdout (assumption is outside project it will be a shebang script)
-			_, err := buf.WriteTo(os.Stdout)
-			check(err, 2, "")
+			printSources(srcFilename, true)
 		}
-		return //Exit the program after printing
+		return 0 //Exit the program after printing
 	}
 
 	//--export: Print the source code from the named command to stdout.
 	// Executes --delete option as well (see below)
 	if toExport != "" {
-		srcFilename := projectDir + "/src/" + toExport + ".go"
-		buf = readSourceFile(srcFilename)
-		fmt.Println("#!/usr/bin/env -S " + os.Args[0]) //Add the shebang line when exporting a source file (assumption is outside project it will be a shebang script)
-		_, err := buf.WriteTo(os.Stdout)
-		check(err, 2, "Failed to export "+srcFilename)
-		deleteCommand(toExport)
-		return //Exit the program after exporting
+		summary := deleteSummary(toExport)
+		wrapper := toExport + ".cmd"
+		if windowsScripts() && checkFileExists(wrapper) {
+			summary += fmt.Sprintf("\nThe existing file ./%s will be overwritten.", wrapper)
+		}
+		if !confirm(summary) {
+			cancelled()
+		}
+		defer lockProject()()
+		printSources(sourceFile(toExport), true)
+		//Windows has no shebang, so a wrapper beside the script runs it
+		if windowsScripts() {
+			check(os.WriteFile(wrapper, []byte(cmdWrapper(toExport)), 0644), 2, "")
+			fmt.Fprintf(os.Stderr, "Wrote %s, which runs %s.go beside it with goscript. Save the source there.\n", wrapper, toExport)
+		}
+		deleteCommand(toExport, "export")
+		return 0 //Exit the program after exporting
+	}
+
+	//--export-toolbox: Export every binary with completions and a manifest
+	if toolboxDest != "" {
+		defer lockProject()()
+		exportToolbox(toolboxDest)
+		return 0
+	}
+
+	//--export-selfrun: Export a command as an executable that carries its source
+	if selfrunToExport != "" {
+		exportSelfrun(selfrunToExport)
+		return 0
 	}
 
 	//--export-bin: Copy the binary to the local directory.
 	// Executes --delete option as well (see below)
 	if binToExport != "" {
-		binFilename := projectDir + "/bin/" + binToExport
-		copyFile(binFilename, binToExport)
-		deleteCommand(binToExport)
-		return //Exit the program after exporting
+		summary := deleteSummary(binToExport)
+		if goos, _ := buildPlatform(); checkFileExists(exeName(binToExport, goos)) {
+			summary += fmt.Sprintf("\nThe existing file ./%s will be overwritten.", exeName(binToExport, goos))
+		}
+		if !confirm(summary) {
+			cancelled()
+		}
+		defer lockProject()()
+		//Exported binaries should be traceable to verified module content
+		if !verifyModules() {
+			check(errors.New("module verification failed"), 2, "The binary was not exported.")
+		}
+		binFilename := hostBinaryPath(binToExport)
+		exportName := filepath.Base(binFilename)
+		if crossCompiling() {
+			//The binary for another platform is built for the export, and not kept in the project
+			binFilename = binaryPath(binToExport)
+			exportName = filepath.Base(binFilename)
+			if !compileBinary(sourceFile(binToExport), binFilename) {
+				exitProgram(1)
+			}
+			defer os.Remove(binFilename)
+		}
+		copyFile(binFilename, exportName)
+		deleteCommand(binToExport, "export-bin")
+		return 0 //Exit the program after exporting
 	}
 
 	//--delete: Deletes the named binary. Renames the named source file without .go extension so it remains recoverable.
 	if toDelete != "" {
-		deleteCommand(toDelete)
-		return //Exit the program after deleting
+		if !confirm(deleteSummary(toDelete)) {
+			cancelled()
+		}
+		defer lockProject()()
+		deleteCommand(toDelete, "delete")
+		return 0 //Exit the program after deleting
+	}
+
+	//--undo-last: Reverses the most recent destructive operation recorded in the journal
+	if doUndo {
+		defer lockProject()()
+		undoLast()
+		return 0 //Exit the program after undoing
 	}
 
 	//--restore: Restores the named binary that was previously deleted or exported. Adds the .go extension back to the source file and recompiles.
 	if toRestore != "" {
+		defer lockProject()()
 		restoreCommand(toRestore)
-		return //Exit the program after restoring
+		return 0 //Exit the program after restoring
+	}
+
+	//--isolate: Give the named command a module of its own, before its source is written there
+	if isolate {
+		if name == "" {
+			check(errors.New("--isolate requires --name"), 2, "")
+		}
+		if inputFile == "" && len(code) == 0 && !checkFileExists(sourceFile(name)) {
+			check(fmt.Errorf("no command named %s", name), 2, "Give the code of a new command with --code or --file.")
+		}
+		unlock := lockProject()
+		isolateCommand(name)
+		if inputFile == "" && len(code) == 0 {
+			ok := compileBinary(sourceFile(name), binaryPath(name))
+			unlock()
+			if !ok {
+				exitProgram(1)
+			}
+			return 0 //Exit the program after isolating an existing command
+		}
+		unlock()
+	}
+
+	//--url: Fetch a script and handle it like --file. It is run unless it is being saved with --name.
+	if scriptURL != "" {
+		inputFile = trustedScript(scriptURL, trustURL)
+		if name == "" {
+			execCode = true
+		}
+	}
+
+	//Running a script or --code is handed to a warm worker if a daemon is running for the project (see --daemon)
+	if execCode && name == "" && (inputFile != "" || len(code) > 0) && scriptURL == "" && targetHost == "" && !prebuild {
+		if status, ok := runInDaemon(); ok {
+			exitProgram(status)
+		}
 	}
 
 	//--file: Handle a regular go source file (potentially with a shebang (#!) at the top)
+	var helpers []string //helper files of a directory given with --file
 	if inputFile != "" {
+		//A directory holds a multi-file command: main.go and its helper files
+		if info, err := os.Stat(inputFile); err == nil && info.IsDir() {
+			helpers = helperFiles(inputFile)
+			inputFile = filepath.Join(inputFile, "main.go")
+			if !checkFileExists(inputFile) {
+				check(fmt.Errorf("no main.go in %s", filepath.Dir(inputFile)), 2, "A directory given with --file must contain main.go.")
+			}
+		}
+		warnShebang(inputFile)
 		buf = readSourceFile(inputFile)
+		inputOrigin = &sourceOrigin{name: inputFile, text: buf.String()}
+		//Shebang scripts may contain only statements, in which case they are wrapped like --code
+		if needsWrapping(buf.String()) {
+			buf = wrapCode(buf.String())
+		}
 		//--code: Handle typical one-liner code specified on command line
-	} else if code != "" {
+	} else if len(code) > 0 {
 		buf = assembleSourceFile(code)
 		//--name: Handle compiling a pre-existing source file located in the project/src folder
 	} else if name != "" {
-		srcFilename := projectDir + "/src/" + name + ".go"
-		buf = readSourceFile(srcFilename)
+		buf = readSourceFile(sourceFile(name))
 		//(no options): Print usage and exit
 	} else {
-		flag.Usage()
-		os.Exit(1)
+		usage()
+		exitProgram(1)
 	}
 
+	//A script restricted to other platforms is refused before anything is built
+	meta := engine.ParseMetadata(buf.String())
+	if goos, _ := buildPlatform(); (execCode || crossCompiling()) && !supportsTarget(meta) {
+		check(fmt.Errorf("this is %s", goos), 2, fmt.Sprintf("The script runs only on %s.", strings.Join(meta.OS, ", ")))
+	}
+	//A binary for another platform can't be run here, and is only useful if it is kept
+	if crossCompiling() && (execCode || name == "") {
+		goos, goarch := buildPlatform()
+		check(fmt.Errorf("can't run or discard a binary built for %s/%s", goos, goarch), 2, "Use --name to build a command for another platform, or --export-bin to export one.")
+	}
+
+	//Fail early with install guidance if the go toolchain is missing, before any temporary files are written
+	_, err = goExecutable()
+	check(err, 2, goMissingMessage)
+
 	//Temporary name needed to save source and compile binary
 	var isTemporary bool
 	if name == "" {
 		name = fmt.Sprintf("gocmd-%d", time.Now().UnixNano()) //temporary name, not for user. Will be deleted after exec.
 		isTemporary = true
+		sweepTemporaryFiles()
+	}
+	srcFilename := sourceFile(name)
+	binFilename := binaryPath(name)
+	if len(helpers) > 0 {
+		if checkFileExists(projectDir + "/src/" + name + ".go") {
+			check(fmt.Errorf("%s already exists as a single-file command", name), 2, "Delete it first, or choose another name.")
+		}
+		srcFilename = commandDir(name) + "/main.go"
 	}
-	srcFilename := projectDir + "/src/" + name + ".go"
-	binFilename := projectDir + "/bin/" + name
 
-	writeSourceFile(srcFilename, buf)
-	if !compileBinary(srcFilename, binFilename) {
-		if isTemporary {
-			cleanTemporaryFiles(name)
+	//Replacing an existing command with different code needs confirmation
+	if !isTemporary && (inputFile != "" || len(code) > 0) && !confirmOverwrite(srcFilename, buf.Bytes()) {
+		cancelled()
+	}
+	sourceHash := hashBytes(buf.Bytes())
+
+	//Unnamed code that is only run is built once and its binary cached, so running it again skips the build
+	cacheKey := ""
+	if isTemporary && execCode && len(helpers) == 0 && os.Getenv("GOSCRIPT_NO_CACHE") == "" {
+		cacheKey = buildCacheKey(buf.Bytes())
+	}
+	if cached, ok := cachedBinary(cacheKey); ok {
+		binFilename = cached
+	} else if runCommand == "" || !binaryUpToDate(srcFilename, binFilename) { //--run builds only when stale
+		//Hold the project lock while writing and compiling, but not while the script runs
+		unlock := lockProject()
+		if len(helpers) > 0 {
+			writeHelperFiles(name, helpers)
+		}
+		writeSourceFile(srcFilename, buf)
+		if inputOrigin != nil && len(helpers) == 0 {
+			inputOrigin.generated = srcFilename //so errors are reported at the input's lines
+		}
+		if !compileBinary(srcFilename, binFilename) {
+			if isTemporary {
+				cleanTemporaryFiles(name)
+			}
+			exitProgram(1)
 		}
-		os.Exit(1)
+		if cacheKey != "" {
+			binFilename = storeCachedBinary(binFilename, cacheKey)
+		}
+		unlock()
 	}
+	savedErrors.flush() //Report build problems before the script's own output
+
+	if execCode && !prebuild {
+		//Missing requirements are reported up front, rather than deep in the script's execution
+		if missing := missingRequirements(meta); len(missing) > 0 {
+			reportMissingRequirements(missing)
+			if isTemporary {
+				cleanTemporaryFiles(name)
+			}
+			exitProgram(1)
+		}
 
-	if execCode {
+		//Missing required flags are asked for on a terminal
+		subprocessArgs = promptForFlags(meta.Flags, subprocessArgs)
+
+		//An exclusive command is locked by name. Unnamed code, such as a shebang script, is locked by its content.
+		releaseRun := func() {}
+		if exclusive || noWait || meta.Exclusive != "" {
+			key := name
+			if isTemporary {
+				key = "code-" + sourceHash[:16]
+			}
+			releaseRun, err = lockRun(key, wait || !(noWait || meta.Exclusive == "no-wait"))
+			if check(err, 1, "The command is already running.") {
+				if isTemporary {
+					cleanTemporaryFiles(name)
+				}
+				exitProgram(1)
+			}
+		}
 
 		c := make(chan os.Signal, 1)
 		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 		go func() {
 			<-c
+			releaseRun()
 			if isTemporary {
 				cleanTemporaryFiles(name)
 			}
-			os.Exit(1)
+			exitProgram(1)
 		}()
 
+		//A cached script is rebuilt by the daemon when it changes, if one is running
+		if cacheKey != "" && inputFile != "" {
+			notifyDaemon(inputFile)
+		}
+
 		//Pass in any args intended for the subprocess
 		cmd := exec.Command(binFilename, subprocessArgs...)
 		cmd.Stdin = os.Stdin
+		if encoding := stdinEncoding(); encoding != "" {
+			stdin, err := transcodedStdin(encoding)
+			check(err, 2, "")
+			cmd.Stdin = stdin
+		}
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
+		start := time.Now()
 		err := cmd.Start()
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
+			releaseRun()
 			if isTemporary {
 				cleanTemporaryFiles(name)
 			}
-			os.Exit(1)
+			exitProgram(1)
 		}
 		cmd.Wait()
+		duration := time.Since(start)
+		releaseRun()
+		label := name
+		if isTemporary && scriptURL != "" {
+			label = scriptURL
+		} else if isTemporary && inputFile != "" {
+			label = filepath.Base(inputFile)
+		} else if isTemporary {
+			label = "goscript --code"
+		}
+		if runLogEnabled() {
+			record := runRecord{Command: label, Trigger: "exec", Start: start, Duration: duration, Args: subprocessArgs}
+			record.measure(cmd.ProcessState)
+			recordHistory(record)
+		}
+		if notifyDone {
+			notify(label, duration, cmd.ProcessState.ExitCode())
+		}
 		if isTemporary {
 			cleanTemporaryFiles(name)
 		}
-		os.Exit(cmd.ProcessState.ExitCode())
+		exitProgram(cmd.ProcessState.ExitCode())
 	}
 	if isTemporary {
 		cleanTemporaryFiles(name)
 	}
+	return 0
 }
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Sharing brings things made elsewhere into the project: --preset import adds import aliases and templates, and
+// --ingest adds commands. When one has the name of something the project already has, with different content,
+// goscript shows the difference and asks what to do: keep the project's, take the incoming one in its place, or
+// add the incoming one under another name. Nothing is overwritten without that answer. --on-conflict keep, take
+// or rename gives the answer for every conflict, e.g. in scripts. Without it, the project's is kept when stdin is
+// not a terminal.
+
+// Set by --on-conflict.
+var onConflict string
+
+var conflictChoices = []string{"keep", "take", "rename"}
+
+// Something incoming with the name of something the project has.
+type conflict struct {
+	kind            string //e.g. "import alias"
+	name            string
+	local, incoming string //the content of each, to show the difference
+	taken           func(name string) bool
+	valid           func(name string) bool //whether a name typed for the incoming one can be used
+}
+
+// Returns a name for the incoming one that isn't taken: the name with the first free number from 2 appended.
+func (c conflict) freeName() string {
+	for i := 2; ; i++ {
+		name := fmt.Sprintf("%s-%d", c.name, i)
+		if c.kind == "import alias" {
+			name = fmt.Sprintf("%s%d", c.name, i) //aliases are Go identifiers
+		}
+		if !c.taken(name) {
+			return name
+		}
+	}
+}
+
+// Asks how to resolve a conflict, unless --on-conflict answers or stdin is not a terminal. Returns "keep",
+// "take" or "rename", and the name to add the incoming one under when renaming.
+func resolveConflict(c conflict) (string, string) {
+	choice := onConflict
+	if choice == "" && !isTerminal(os.Stdin) {
+		choice = "keep"
+	}
+	if choice != "" {
+		if choice == "rename" {
+			return choice, c.freeName()
+		}
+		return choice, ""
+	}
+
+	fmt.Fprintf(os.Stderr, "The project already has a different %s named %s:\n", c.kind, c.name)
+	for _, line := range lineDiff(c.local, c.incoming) {
+		fmt.Fprintf(os.Stderr, "  %s\n", line)
+	}
+	in := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Fprintf(os.Stderr, "[k]eep the project's, [t]ake the incoming one or [r]ename the incoming one? [k] ")
+		answer, err := in.ReadString('\n')
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "", "k", "keep":
+			return "keep", ""
+		case "t", "take":
+			return "take", ""
+		case "r", "rename":
+			suggestion := c.freeName()
+			for {
+				fmt.Fprintf(os.Stderr, "New name for the incoming %s [%s]: ", c.kind, suggestion)
+				name, err := in.ReadString('\n')
+				if name = strings.TrimSpace(name); name == "" {
+					name = suggestion
+				}
+				switch {
+				case !c.valid(name):
+					fmt.Fprintf(os.Stderr, "%s is not a valid name for a %s.\n", name, c.kind)
+				case c.taken(name):
+					fmt.Fprintf(os.Stderr, "%s is taken too.\n", name)
+				default:
+					return "rename", name
+				}
+				if err != nil {
+					return "keep", ""
+				}
+			}
+		}
+		if err != nil {
+			return "keep", "" //end of input
+		}
+	}
+}
+
+// Returns the lines of a diff from a to b: lines only in a start with "-", lines only in b with "+", and up to
+// two unchanged lines around each change start with " ". Inputs too large to compare line by line are
+// summarized.
+func lineDiff(a, b string) []string {
+	x, y := strings.Split(strings.TrimSuffix(a, "\n"), "\n"), strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+	if len(x)*len(y) > 4_000_000 {
+		return []string{fmt.Sprintf("- (%d lines in the project)", len(x)), fmt.Sprintf("+ (%d lines incoming)", len(y))}
+	}
+	//lcs[i][j] is the length of the longest common subsequence of x[i:] and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	all := []string{}
+	i, j := 0, 0
+	for i < len(x) || j < len(y) {
+		switch {
+		case i < len(x) && j < len(y) && x[i] == y[j]:
+			all = append(all, " "+x[i])
+			i++
+			j++
+		case i < len(x) && (j == len(y) || lcs[i+1][j] >= lcs[i][j+1]):
+			all = append(all, "-"+x[i])
+			i++
+		default:
+			all = append(all, "+"+y[j])
+			j++
+		}
+	}
+
+	//Each change is shown with up to two unchanged lines on either side
+	shown := make([]bool, len(all))
+	for k, line := range all {
+		if line[0] != ' ' {
+			for n := max(k-2, 0); n <= min(k+2, len(all)-1); n++ {
+				shown[n] = true
+			}
+		}
+	}
+	lines := []string{}
+	for k, line := range all {
+		if !shown[k] {
+			continue
+		}
+		if len(lines) > 0 && !shown[k-1] {
+			lines = append(lines, "...")
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
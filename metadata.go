@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/fkmiec/goscript/engine"
+)
+
+// The metadata of a script is parsed by the engine package (see engine/metadata.go).
+type Metadata = engine.Metadata
+type FlagSpec = engine.FlagSpec
+type RouteSpec = engine.RouteSpec
+
+// Returns the module paths required in the project's go.mod file.
+func requiredModules() []string {
+	return moduleRequirements(projectDir)
+}
+
+// Returns the modules required by the go.mod file in the given module directory.
+func moduleRequirements(dir string) []string {
+	data, err := os.ReadFile(dir + "/go.mod")
+	if err != nil {
+		return nil
+	}
+	re := regexp.MustCompile(`(?m)^\s*(?:require\s+)?([^\s()]+)\s+v\S+`)
+	mods := []string{}
+	for _, m := range re.FindAllStringSubmatch(string(data), -1) {
+		mods = append(mods, m[1])
+	}
+	return mods
+}
+
+// Runs go get for any declared dependency not already provided by a module in the go.mod of the given module directory.
+func ensureDeps(dir string, deps []string) {
+	for _, dep := range missingDeps(dir, deps) {
+		goGetIn(dir, dep)
+	}
+}
+
+// Returns the declared dependencies not provided by a module in the go.mod of the given module directory.
+func missingDeps(dir string, deps []string) []string {
+	if len(deps) == 0 {
+		return nil
+	}
+	mods := moduleRequirements(dir)
+	missing := []string{}
+	for _, dep := range deps {
+		path, _, _ := strings.Cut(dep, "@")
+		satisfied := false
+		for _, mod := range mods {
+			if path == mod || strings.HasPrefix(path, mod+"/") {
+				satisfied = true
+				break
+			}
+		}
+		if !satisfied {
+			missing = append(missing, dep)
+		}
+	}
+	return missing
+}
+
+type cachedDescription struct {
+	Hash        string `json:"hash"`
+	Description string `json:"description"`
+}
+
+func descriptionCacheFile() string {
+	return stateDir() + "/descriptions.json"
+}
+
+// Returns the descriptions of the given source files, from frontmatter or a goscript:desc directive, the
+// project's manifest.json, or the first comment. Results are cached by file hash so listing a large project
+// stays fast.
+func describeScripts(filenames []string) map[string]string {
+	cache := map[string]cachedDescription{}
+	if data, err := os.ReadFile(descriptionCacheFile()); err == nil {
+		json.Unmarshal(data, &cache)
+	}
+	manifest := readManifest()
+
+	descriptions := map[string]string{}
+	changed := false
+	for _, filename := range filenames {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			continue
+		}
+		manifestDesc := manifest[strings.TrimSuffix(sourceListName(filename), ".go")].Description
+		sum := sha256.Sum256(append(data, "\x00manifest:"+manifestDesc...))
+		hash := hex.EncodeToString(sum[:])
+		if cached, ok := cache[filename]; ok && cached.Hash == hash {
+			descriptions[filename] = cached.Description
+			continue
+		}
+		src := string(data)
+		desc := engine.ParseMetadata(src).Description
+		if desc == "" {
+			desc = manifestDesc
+		}
+		if desc == "" {
+			desc = engine.FirstComment(src)
+		}
+		descriptions[filename] = desc
+		cache[filename] = cachedDescription{Hash: hash, Description: desc}
+		changed = true
+	}
+
+	if changed && os.MkdirAll(stateDir(), 0755) == nil {
+		if data, err := json.MarshalIndent(cache, "", "    "); err == nil {
+			os.WriteFile(descriptionCacheFile(), data, 0644)
+		}
+	}
+	return descriptions
+}
+
+// Reports whether the script supports the platform being built for (the host, unless --os was given).
+func supportsTarget(meta Metadata) bool {
+	goos, _ := buildPlatform()
+	return len(meta.OS) == 0 || slices.Contains(meta.OS, goos)
+}
+
+// Returns the script's declared requirements that are not met.
+func missingRequirements(meta Metadata) []string {
+	missing := []string{}
+	for _, name := range meta.RequiresEnv {
+		if _, ok := os.LookupEnv(name); !ok {
+			missing = append(missing, "environment variable "+name)
+		}
+	}
+	for _, name := range meta.RequiresBin {
+		if _, err := exec.LookPath(name); err != nil {
+			missing = append(missing, name+" on the PATH")
+		}
+	}
+	return missing
+}
+
+// Prints the requirements that are not met, all at once.
+func reportMissingRequirements(missing []string) {
+	fmt.Fprintf(os.Stderr, "The script can't run. It requires:\n")
+	for _, m := range missing {
+		fmt.Fprintf(os.Stderr, "  - %s\n", m)
+	}
+}
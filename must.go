@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"slices"
+	"sort"
+)
+
+// Set by --must. The //goscript:must directive turns it on for a single script.
+var mustMode bool
+
+// Helpers appended to the generated file when --must rewrites error handling. They exit through fail() (see
+// recover.go). %[1]s and %[2]s are their names: must and check, unless the code has names of its own like those.
+const mustHelpers = `
+// %[1]s returns v, or exits with the error if it is not nil. Added by goscript --must.
+func %[1]s[T any](v T, err error) T {
+	%[2]s(err)
+	return v
+}
+
+// %[2]s exits with the error if it is not nil. Added by goscript --must.
+func %[2]s(err error) {
+	if err != nil {
+		fail(err)
+	}
+}
+`
+
+// Rewrites assignments that return an error the code doesn't handle, so one-liners don't need error boilerplate:
+//
+//	data, err := os.ReadFile(name)  becomes  data := must(os.ReadFile(name))
+//	err := os.Remove(name)          becomes  check(os.Remove(name))
+//
+// An error is handled if the code reads err after the assignment (before assigning it again), so only
+// assignments whose err is never looked at are rewritten. If the code has an identifier named must or check, the
+// helpers are named goscriptMust and goscriptCheck instead. Returns the code unchanged, and no helpers, if nothing
+// was rewritten.
+func rewriteMust(code string) (string, string) {
+	header := "package main\n\nfunc main() {\n"
+	src := header + code + "\n}\n"
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return code, ""
+	}
+	offset := func(pos token.Pos) int {
+		return fset.Position(pos).Offset - len(header)
+	}
+	text := func(node ast.Node) string {
+		return code[offset(node.Pos()):offset(node.End())]
+	}
+
+	mustName, checkName := "must", "check"
+	ast.Inspect(f, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && (id.Name == "must" || id.Name == "check") {
+			mustName, checkName = "goscriptMust", "goscriptCheck"
+		}
+		return true
+	})
+
+	errRead := readsErr(f, false)
+
+	type edit struct {
+		start, end int
+		text       string
+	}
+	edits := []edit{}
+	ast.Inspect(f, func(n ast.Node) bool {
+		block, ok := n.(*ast.BlockStmt)
+		if !ok {
+			return true
+		}
+		for i, stmt := range block.List {
+			assign, ok := stmt.(*ast.AssignStmt)
+			if !ok || len(assign.Rhs) != 1 || !isErrIdent(assign.Lhs[len(assign.Lhs)-1]) || len(assign.Lhs) > 2 {
+				continue
+			}
+			if _, ok := assign.Rhs[0].(*ast.CallExpr); !ok {
+				continue
+			}
+			//Leave error handling the user wrote alone. An err assigned with = may be declared, and read, outside
+			//the block, so it is only rewritten if err is never read at all. Those left alone keep err declared.
+			if assign.Tok != token.DEFINE && errRead || errReadAfter(block.List[i+1:], errRead) {
+				continue
+			}
+			call := text(assign.Rhs[0])
+			var replacement string
+			if len(assign.Lhs) == 1 {
+				replacement = checkName + "(" + call + ")"
+			} else if text(assign.Lhs[0]) == "_" {
+				replacement = "_ = " + mustName + "(" + call + ")"
+			} else {
+				replacement = text(assign.Lhs[0]) + " " + assign.Tok.String() + " " + mustName + "(" + call + ")"
+			}
+			edits = append(edits, edit{offset(assign.Pos()), offset(assign.End()), replacement})
+		}
+		return true
+	})
+	if len(edits) == 0 {
+		return code, ""
+	}
+
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	for _, e := range edits {
+		code = code[:e.start] + e.text + code[e.end:]
+	}
+	return code, fmt.Sprintf(mustHelpers, mustName, checkName)
+}
+
+func isErrIdent(e ast.Expr) bool {
+	id, ok := e.(*ast.Ident)
+	return ok && id.Name == "err"
+}
+
+// Reports whether the statements following an assignment to err read it before it is declared again with :=.
+// With keptAssigns, assigning it with = counts as a read too, since that needs the declaration to stay.
+func errReadAfter(stmts []ast.Stmt, keptAssigns bool) bool {
+	for _, stmt := range stmts {
+		if assign, ok := stmt.(*ast.AssignStmt); ok && assign.Tok == token.DEFINE && slices.ContainsFunc(assign.Lhs, isErrIdent) {
+			//Later reads are of the new err
+			return readsErr(assign, keptAssigns)
+		}
+		if readsErr(stmt, keptAssigns) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether a node reads err: uses the name other than by assigning it (or, with assigns, other than by
+// declaring it with :=).
+func readsErr(node ast.Node, assigns bool) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range n.Lhs {
+				if !isErrIdent(lhs) || (assigns && n.Tok != token.DEFINE) {
+					found = found || readsErr(lhs, assigns)
+				}
+			}
+			for _, rhs := range n.Rhs {
+				found = found || readsErr(rhs, assigns)
+			}
+			return false
+		case *ast.Ident:
+			found = found || n.Name == "err"
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRewriteMust(t *testing.T) {
+	tests := []struct {
+		name, code string
+		want       string //empty if the code is left as it is
+		helper     string //a helper the rewrite must declare
+	}{
+		{"unread err", "data, err := os.ReadFile(\"a\")\nfmt.Println(data)", "data := must(os.ReadFile(\"a\"))\nfmt.Println(data)", "must"},
+		{"error only", `err := os.Remove("a")`, `check(os.Remove("a"))`, "check"},
+		{"blank value", `_, err := f()`, `_ = must(f())`, "must"},
+		{"checked by if", "data, err := f()\nif err != nil {\n\treturn\n}\nuse(data)", "", ""},
+		{"printed later", "data, err := os.ReadFile(\"a\")\nfmt.Println(len(data), err)", "", ""},
+		{"read in a closure", "v, err := f()\ndefer func() { log(err) }()\nuse(v)", "", ""},
+		{"redeclared before read", "a, err := f()\nb, err := g()\nif err != nil {\n}\nuse(a, b)", "a := must(f())\nb, err := g()\nif err != nil {\n}\nuse(a, b)", "must"},
+		{"reassigned and read", "a, err := f()\nb, err = g()\nfmt.Println(a, b, err)", "", ""},
+		{"reassigned never read", "a, err := f()\nb, err = g()\nuse(a, b)", "a := must(f())\nb = must(g())\nuse(a, b)", "must"},
+		{"assigned in a loop, read after", "var err error\nfor range 3 {\n\terr = f()\n}\nfmt.Println(err)", "", ""},
+		{"user must", "must := 1\nv, err := f()\nuse(v, must)", "must := 1\nv := goscriptMust(f())\nuse(v, must)", "goscriptMust"},
+		{"user check", "err := check()", "goscriptCheck(check())", "goscriptCheck"},
+		{"not a call", "v, err := x, y", "", ""},
+		{"syntax error", "v, err := (", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, helpers := rewriteMust(tt.code)
+			if tt.want == "" {
+				if got != tt.code || helpers != "" {
+					t.Errorf("rewriteMust(%q) = %q, want it unchanged", tt.code, got)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("rewriteMust(%q) = %q, want %q", tt.code, got, tt.want)
+			}
+			if !strings.Contains(helpers, "func "+tt.helper+"(") && !strings.Contains(helpers, "func "+tt.helper+"[") {
+				t.Errorf("helpers don't declare %s:\n%s", tt.helper, helpers)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// With --notify, goscript reports when an executed script finishes: to the webhook in the project config if one
+// is set, and with a desktop notification otherwise. A long script left running in a background terminal
+// doesn't finish unnoticed.
+
+// Describes how a run ended, e.g. "backup finished in 1m3s".
+func notificationText(label string, elapsed time.Duration, exitCode int) string {
+	elapsed = elapsed.Round(time.Second)
+	if exitCode == 0 {
+		return fmt.Sprintf("%s finished in %v", label, elapsed)
+	}
+	return fmt.Sprintf("%s failed in %v (exit status %d)", label, elapsed, exitCode)
+}
+
+// Sends a notification that a run has ended. Failures to notify are reported but don't change the exit status.
+func notify(label string, elapsed time.Duration, exitCode int) {
+	text := notificationText(label, elapsed, exitCode)
+	if webhook := readProjectConfig().Notify.Webhook; webhook != "" {
+		check(postWebhook(webhook, text), 1, "Unable to send the notification to the webhook.")
+		return
+	}
+	check(desktopNotification("goscript", text), 1, "Unable to show a desktop notification. Set notify.webhook in "+projectConfigFile()+" to use a webhook instead.")
+}
+
+// Posts the text to a Slack-compatible incoming webhook.
+func postWebhook(url string, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Shows a desktop notification with notify-send (Linux and BSD) or osascript (macOS).
+func desktopNotification(title string, text string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		quote := func(s string) string { return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"` }
+		cmd = exec.Command("osascript", "-e", "display notification "+quote(text)+" with title "+quote(title))
+	case "windows":
+		return fmt.Errorf("desktop notifications are not supported on %s", runtime.GOOS)
+	default:
+		cmd = exec.Command("notify-send", title, text)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil && len(bytes.TrimSpace(out)) > 0 {
+		return fmt.Errorf("%v: %s", err, bytes.TrimSpace(out))
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Command-line options are declared once with a long name, an optional short name and a help group.
+// The parser accepts --long, -long and -s forms, with values given as "--long value" or "--long=value".
+// Parsing stops at the first non-option argument or at "--" so that everything after a script file is
+// left for the script itself.
+
+// optionValue holds the value of an option and knows how to set it from a command-line string.
+type optionValue interface {
+	Set(string) error
+	String() string
+}
+
+type stringValue struct{ p *string }
+
+func (v stringValue) Set(s string) error { *v.p = s; return nil }
+func (v stringValue) String() string     { return *v.p }
+
+// stringsValue collects the values of an option that may be repeated.
+type stringsValue struct{ p *[]string }
+
+func (v stringsValue) Set(s string) error { *v.p = append(*v.p, s); return nil }
+func (v stringsValue) String() string     { return strings.Join(*v.p, "\n") }
+
+type boolValue struct{ p *bool }
+
+func (v boolValue) Set(s string) error {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return fmt.Errorf("invalid boolean value %q", s)
+	}
+	*v.p = b
+	return nil
+}
+func (v boolValue) String() string { return strconv.FormatBool(*v.p) }
+
+type option struct {
+	long       string
+	short      string
+	group      string
+	argName    string //Blank for boolean options that take no value
+	implicit   string //Value used when an option with an optional value is given without one
+	optional   bool
+	usage      string
+	value      optionValue
+	hidden     bool
+	deprecated string
+}
+
+// Hides the option from the help output. It is still accepted on the command line.
+func (o *option) Hide() *option {
+	o.hidden = true
+	return o
+}
+
+// Marks the option deprecated. Using it prints the message as a warning.
+func (o *option) Deprecate(msg string) *option {
+	o.deprecated = msg
+	o.hidden = true
+	return o
+}
+
+type optionSet struct {
+	options []*option
+	byName  map[string]*option
+	groups  []string
+}
+
+var options = &optionSet{byName: map[string]*option{}}
+
+func (s *optionSet) add(o *option) *option {
+	s.options = append(s.options, o)
+	s.byName[o.long] = o
+	if o.short != "" {
+		s.byName[o.short] = o
+	}
+	if !slices.Contains(s.groups, o.group) {
+		s.groups = append(s.groups, o.group)
+	}
+	return o
+}
+
+// Declares an option that takes a string value.
+func (s *optionSet) String(p *string, long, short, group, usage string) *option {
+	return s.add(&option{long: long, short: short, group: group, argName: "string", usage: usage, value: stringValue{p}})
+}
+
+// Declares an option that may be repeated, collecting each value in order.
+func (s *optionSet) Strings(p *[]string, long, short, group, usage string) *option {
+	return s.add(&option{long: long, short: short, group: group, argName: "string", usage: usage, value: stringsValue{p}})
+}
+
+// Declares an option whose value is optional. Given without a value, the option is set to implicit.
+// A following argument is taken as the value unless it looks like an option or is "--".
+func (s *optionSet) OptionalString(p *string, long, short, group, implicit, usage string) *option {
+	return s.add(&option{long: long, short: short, group: group, argName: "[string]", usage: usage, value: stringValue{p}, implicit: implicit, optional: true})
+}
+
+// Declares a boolean option.
+func (s *optionSet) Bool(p *bool, long, short, group, usage string) *option {
+	return s.add(&option{long: long, short: short, group: group, usage: usage, value: boolValue{p}})
+}
+
+// Looks up an option by its long or short name.
+func (s *optionSet) Lookup(name string) *option {
+	return s.byName[name]
+}
+
+// Parses goscript's options from the arguments. Parsing stops at "--" or the first non-option argument.
+// If that argument is an existing file, it is returned as the script file. Everything after it is
+// returned verbatim as the script's arguments.
+func (s *optionSet) Parse(args []string) (scriptFile string, scriptArgs []string, err error) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return "", args[i+1:], nil
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			if checkFileExists(arg) {
+				return arg, args[i+1:], nil
+			}
+			return "", args[i:], nil
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		o := s.Lookup(name)
+		if o == nil {
+			return "", nil, fmt.Errorf("unknown option: %s", arg)
+		}
+		if o.deprecated != "" {
+			fmt.Fprintf(os.Stderr, "warning: --%s is deprecated. %s\n", o.long, o.deprecated)
+		}
+		if o.argName == "" {
+			if !hasValue {
+				value = "true"
+			}
+		} else if !hasValue && o.optional {
+			value = o.implicit
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				i++
+				value = args[i]
+			}
+		} else if !hasValue {
+			if i+1 >= len(args) {
+				return "", nil, fmt.Errorf("option %s requires a value", arg)
+			}
+			i++
+			value = args[i]
+		}
+		if err := o.value.Set(value); err != nil {
+			return "", nil, fmt.Errorf("%s: %v", arg, err)
+		}
+	}
+	return "", nil, nil
+}
+
+// Returns the arguments after the options for an option that takes operands (e.g. --preset import <file>),
+// where Parse has taken the first of them for a script file because a file by that name exists.
+func operands(scriptFile string, scriptArgs []string) []string {
+	if scriptFile == "" {
+		return scriptArgs
+	}
+	return append([]string{scriptFile}, scriptArgs...)
+}
+
+// Writes the help text for all visible options, grouped in the order the groups were declared.
+func (s *optionSet) PrintUsage(w io.Writer) {
+	for _, group := range s.groups {
+		fmt.Fprintf(w, "\n%s:\n", group)
+		for _, o := range s.options {
+			if o.group != group || o.hidden {
+				continue
+			}
+			names := "--" + o.long
+			if o.short != "" {
+				names += "|-" + o.short
+			}
+			if o.argName != "" {
+				names += " " + o.argName
+			}
+			fmt.Fprintf(w, "  %s\n\t%s\n", names, o.usage)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+)
+
+// goscript's informational output (--list, --recompile summaries, --licenses) is built as a report and rendered in
+// the format chosen with --format, so it can be piped straight into a chat integration:
+//
+//	plain     aligned columns for the terminal (the default)
+//	markdown  a Markdown table, for GitHub, Mattermost or Teams
+//	slack     Slack mrkdwn: a bold title and the table in a code block
+//
+// --plain (or GOSCRIPT_PLAIN=1) is for screen readers and dumb terminals, and takes precedence over --format:
+// each row of a report is one line of labelled fields ("Command: gofind; Size: 2.4 MB") with no alignment
+// padding, and no ANSI escapes, spinners or other terminal effects are written. Output that adds any of these
+// must leave them out when plainOutput is set.
+
+var outputFormat = "plain"
+
+var plainOutput bool
+
+var ansiMatcher = regexp.MustCompile(`\x1b\[[0-9;?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(\x07|\x1b\\)`)
+
+// Removes ANSI escape sequences, such as colors, from text that may come from scripts.
+func stripANSI(s string) string {
+	return ansiMatcher.ReplaceAllString(s, "")
+}
+
+var outputFormats = []string{"plain", "markdown", "slack"}
+
+type report struct {
+	title   string     //not printed in plain format
+	columns []string   //headings, not printed in plain format
+	indent  string     //prefix of each row in plain format
+	rows    [][]string //cells of each row
+	notes   []string   //lines printed after the table
+}
+
+func (r *report) add(cells ...string) {
+	r.rows = append(r.rows, cells)
+}
+
+// Writes the rows as aligned columns.
+func (r *report) writeAligned(out io.Writer, indent string, columns bool) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	if columns && len(r.columns) > 0 {
+		fmt.Fprintf(w, "%s%s\n", indent, strings.Join(r.columns, "\t"))
+	}
+	for _, row := range r.rows {
+		fmt.Fprintf(w, "%s%s\n", indent, strings.Join(row, "\t"))
+	}
+	w.Flush()
+}
+
+// Writes the rows one per line as labelled fields, without padding (see --plain).
+func (r *report) writeItems(out io.Writer) {
+	if r.title != "" {
+		fmt.Fprintf(out, "%s: %d item(s)\n", r.title, len(r.rows))
+	}
+	for _, row := range r.rows {
+		fields := []string{}
+		for i, cell := range row {
+			cell = strings.TrimSpace(stripANSI(cell))
+			if cell == "" {
+				continue
+			}
+			if i < len(r.columns) {
+				cell = r.columns[i] + ": " + cell
+			}
+			fields = append(fields, cell)
+		}
+		fmt.Fprintln(out, strings.Join(fields, "; "))
+	}
+	for _, note := range r.notes {
+		fmt.Fprintln(out, stripANSI(note))
+	}
+}
+
+// Prints the report to stdout in the output format.
+func (r *report) print() {
+	out := os.Stdout
+	if plainOutput {
+		r.writeItems(out)
+		return
+	}
+	switch outputFormat {
+	case "markdown":
+		if r.title != "" {
+			fmt.Fprintf(out, "**%s**\n\n", r.title)
+		}
+		if len(r.rows) > 0 {
+			columns := r.columns
+			if len(columns) == 0 {
+				columns = make([]string, len(r.rows[0]))
+			}
+			fmt.Fprintf(out, "| %s |\n", strings.Join(columns, " | "))
+			fmt.Fprintf(out, "|%s\n", strings.Repeat(" --- |", len(columns)))
+			for _, row := range r.rows {
+				cells := make([]string, max(len(columns), len(row)))
+				for i, cell := range row {
+					cells[i] = strings.ReplaceAll(cell, "|", `\|`)
+				}
+				fmt.Fprintf(out, "| %s |\n", strings.Join(cells, " | "))
+			}
+		}
+		if len(r.notes) > 0 {
+			fmt.Fprintf(out, "\n%s\n", strings.Join(r.notes, "\n\n"))
+		}
+	case "slack":
+		if r.title != "" {
+			fmt.Fprintf(out, "*%s*\n", r.title)
+		}
+		if len(r.rows) > 0 {
+			fmt.Fprintln(out, "```")
+			r.writeAligned(out, "", true)
+			fmt.Fprintln(out, "```")
+		}
+		for _, note := range r.notes {
+			fmt.Fprintln(out, note)
+		}
+	default:
+		r.writeAligned(out, r.indent, false)
+		for _, note := range r.notes {
+			fmt.Fprintln(out, note)
+		}
+	}
+}
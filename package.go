@@ -0,0 +1,311 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/fkmiec/goscript/engine"
+)
+
+// --package <name> --format nix|brew|deb|rpm packages a command for people who don't use goscript, in the current
+// directory:
+//
+//	nix   <name>-<version>/ with the source, its go.mod and vendored modules, and a default.nix for buildGoModule
+//	brew  <name>-<version>.tar.gz with the same, and a <name>.rb formula that builds it
+//	deb   <name>-<version>/ with the binary and an nfpm.yaml, and the .deb if nfpm is on the PATH
+//	rpm   the same, with the .rpm
+//
+// The version is the one in the command's frontmatter (version: 1.4.0), or 0.0.<time of the newest saved
+// version> if there is none. It is stamped into the binary with -X main.version, so a script that declares
+// "var version string" can report it.
+
+var packageFormats = []string{"nix", "brew", "deb", "rpm"}
+
+// Returns the version a command is packaged as.
+func packageVersion(cmd string, meta Metadata) string {
+	if meta.Version != "" {
+		return strings.TrimPrefix(meta.Version, "v")
+	}
+	modified := time.Now()
+	if versions := commandVersions(cmd); len(versions) > 0 {
+		modified = versions[len(versions)-1].Time
+	} else if info, err := os.Stat(sourceFile(cmd)); err == nil {
+		modified = info.ModTime()
+	}
+	return "0.0." + modified.UTC().Format("20060102150405")
+}
+
+// Splits the build flags of a command, including those in its frontmatter, into its -ldflags, with the version
+// stamp added, its -tags, and the rest.
+func stampedBuildFlags(meta Metadata, stamp string) (string, []string, []string) {
+	ldflags := "-X main.version=" + stamp
+	tags, other := []string{}, []string{}
+	for _, flag := range engine.MergeBuildFlags(buildFlags(), meta.BuildFlags) {
+		if value, ok := strings.CutPrefix(flag, "-ldflags="); ok {
+			ldflags = strings.Trim(value, `"'`) + " " + ldflags
+		} else if value, ok := strings.CutPrefix(flag, "-tags="); ok {
+			tags = append(tags, strings.Split(value, ",")...)
+		} else {
+			other = append(other, flag)
+		}
+	}
+	return ldflags, tags, other
+}
+
+// Quotes a string for Nix.
+func nixString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "${", `\${`, "\n", `\n`).Replace(s) + `"`
+}
+
+// Quotes a string for Ruby.
+func rubyString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "#", `\#`, "\n", `\n`).Replace(s) + `"`
+}
+
+// Returns the Ruby class name of a Homebrew formula (e.g. go-find becomes GoFind).
+func formulaClass(name string) string {
+	class := ""
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool { return r == '-' || r == '_' || r == '.' }) {
+		class += strings.ToUpper(word[:1]) + word[1:]
+	}
+	return class
+}
+
+// Copies a command's source into dir as a module of its own, with only the modules it needs, vendored.
+func writePackageSources(cmd, dir string) {
+	srcFilename := sourceFile(cmd)
+	for _, filename := range commandFiles(srcFilename) {
+		copyFile(filename, filepath.Join(dir, filepath.Base(filename)))
+	}
+	modDir := moduleDir(srcFilename)
+	for _, file := range []string{"go.mod", "go.sum"} {
+		if checkFileExists(filepath.Join(modDir, file)) {
+			copyFile(filepath.Join(modDir, file), filepath.Join(dir, file))
+		}
+	}
+	//Replacements with local directories are made absolute, since the package is somewhere else
+	for _, replace := range goModJSON(dir).Replace {
+		if path := replace.New.Path; replace.New.Version == "" && !filepath.IsAbs(path) {
+			runGoMod(dir, "edit", "-replace", replace.Old.Path+"="+filepath.Join(modDir, path))
+		}
+	}
+	runGoMod(dir, "tidy")
+	//and dropped if the command doesn't need the module
+	mod := goModJSON(dir)
+	required := map[string]bool{}
+	for _, req := range mod.Require {
+		required[req.Path] = true
+	}
+	for _, replace := range mod.Replace {
+		if !required[replace.Old.Path] {
+			runGoMod(dir, "edit", "-dropreplace", replace.Old.Path)
+		}
+	}
+	runGoMod(dir, "vendor")
+}
+
+type goMod struct {
+	Require []struct{ Path, Version string }
+	Replace []struct {
+		Old, New struct{ Path, Version string }
+	}
+}
+
+// Returns the requirements and replacements in the go.mod in dir.
+func goModJSON(dir string) goMod {
+	var mod goMod
+	out, err := goCommandIn(dir, "mod", "edit", "-json").Output()
+	check(err, 2, "Unable to read "+dir+"/go.mod")
+	check(json.Unmarshal(out, &mod), 2, "")
+	return mod
+}
+
+// Runs a go mod subcommand in dir.
+func runGoMod(dir string, args ...string) {
+	out, err := goCommandIn(dir, append([]string{"mod"}, args...)...).CombinedOutput()
+	check(err, 2, fmt.Sprintf("go mod %s: %s", strings.Join(args, " "), out))
+}
+
+// Writes a Nix derivation that builds the package source with buildGoModule.
+func writeNixPackage(cmd, version, dir string, meta Metadata, desc string) {
+	writePackageSources(cmd, dir)
+	ldflags, tags, _ := stampedBuildFlags(meta, "${version}")
+	var b strings.Builder
+	b.WriteString("# Generated by goscript. Build with: nix-build -E 'with import <nixpkgs> {}; callPackage ./default.nix {}'\n")
+	b.WriteString("{ lib, buildGoModule }:\n\n")
+	b.WriteString("buildGoModule rec {\n")
+	fmt.Fprintf(&b, "  pname = %s;\n", nixString(cmd))
+	fmt.Fprintf(&b, "  version = %s;\n", nixString(version))
+	b.WriteString("  src = ./.;\n")
+	b.WriteString("  vendorHash = null; # the modules are in vendor/\n")
+	fmt.Fprintf(&b, "  ldflags = [ %s ];\n", strings.ReplaceAll(nixString(ldflags), `\${version}`, "${version}"))
+	if len(tags) > 0 {
+		quoted := []string{}
+		for _, tag := range tags {
+			quoted = append(quoted, nixString(tag))
+		}
+		fmt.Fprintf(&b, "  tags = [ %s ];\n", strings.Join(quoted, " "))
+	}
+	b.WriteString("  meta = {\n")
+	if desc != "" {
+		fmt.Fprintf(&b, "    description = %s;\n", nixString(desc))
+	}
+	fmt.Fprintf(&b, "    mainProgram = %s;\n", nixString(cmd))
+	b.WriteString("  };\n}\n")
+	check(os.WriteFile(filepath.Join(dir, "default.nix"), []byte(b.String()), 0644), 2, "")
+	fmt.Printf("Wrote %s/default.nix\n", dir)
+}
+
+// Writes a Homebrew formula that builds a tarball of the package source.
+func writeBrewPackage(cmd, version, dir string, meta Metadata, desc string) {
+	writePackageSources(cmd, dir)
+	tarball := dir + ".tar.gz"
+	toolbox, err := openToolbox(tarball)
+	check(err, 2, "")
+	check(filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, path)
+		return toolbox.add(filepath.ToSlash(rel), data, 0644)
+	}), 2, "")
+	check(toolbox.close(), 2, "")
+	check(os.RemoveAll(dir), 1, "")
+	absTarball, err := filepath.Abs(tarball)
+	check(err, 2, "")
+
+	ldflags, tags, other := stampedBuildFlags(meta, "#{version}")
+	buildArgs := []string{`"go"`, `"build"`, fmt.Sprintf(`*std_go_args(ldflags: %s)`, strings.ReplaceAll(rubyString(ldflags), `\#{version}`, "#{version}"))}
+	if len(tags) > 0 {
+		buildArgs = append(buildArgs, rubyString("-tags="+strings.Join(tags, ",")))
+	}
+	for _, flag := range other {
+		if flag != "-trimpath" { //std_go_args has it
+			buildArgs = append(buildArgs, rubyString(flag))
+		}
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by goscript. Upload %s somewhere and change url to where it can be downloaded.\n", filepath.Base(tarball))
+	fmt.Fprintf(&b, "class %s < Formula\n", formulaClass(cmd))
+	if desc != "" {
+		fmt.Fprintf(&b, "  desc %s\n", rubyString(desc))
+	}
+	fmt.Fprintf(&b, "  url %s\n", rubyString("file://"+filepath.ToSlash(absTarball)))
+	fmt.Fprintf(&b, "  version %s\n", rubyString(version))
+	fmt.Fprintf(&b, "  sha256 %s\n", rubyString(fileHash(tarball)))
+	b.WriteString("\n  depends_on \"go\" => :build\n\n")
+	b.WriteString("  def install\n")
+	fmt.Fprintf(&b, "    system %s, \".\"\n", strings.Join(buildArgs, ", "))
+	b.WriteString("  end\n\n")
+	b.WriteString("  test do\n")
+	fmt.Fprintf(&b, "    assert_predicate bin/%s, :executable?\n", rubyString(cmd))
+	b.WriteString("  end\nend\n")
+	formula := cmd + ".rb"
+	check(os.WriteFile(formula, []byte(b.String()), 0644), 2, "")
+	fmt.Printf("Wrote %s and %s\n", tarball, formula)
+}
+
+// Builds the binary of a Linux package and writes the nfpm config for it, then runs nfpm if it is installed.
+func writeNfpmPackage(cmd, version, dir, format string, meta Metadata, desc string) {
+	goos, goarch := buildPlatform()
+	if goos != "linux" {
+		check(fmt.Errorf("%s packages are for Linux, not %s", format, goos), 2, "Add --os linux to build the package for Linux.")
+	}
+	srcFilename := sourceFile(cmd)
+	absSrcFilename, err := filepath.Abs(srcFilename)
+	check(err, 2, "")
+	absBinFilename, err := filepath.Abs(filepath.Join(dir, cmd))
+	check(err, 2, "")
+	ensureDeps(moduleDir(srcFilename), meta.Deps)
+	ldflags, tags, other := stampedBuildFlags(meta, version)
+	args := append([]string{"build", "-ldflags=" + ldflags}, other...)
+	if len(tags) > 0 {
+		args = append(args, "-tags="+strings.Join(tags, ","))
+	}
+	build := goCommandIn(moduleDir(srcFilename), append(args, "-o", absBinFilename, buildTarget(absSrcFilename))...)
+	if env := crossEnv(); env != nil {
+		build.Env = append(build.Environ(), env...)
+	}
+	out, err := build.CombinedOutput()
+	check(err, 2, string(out))
+
+	maintainer := os.Getenv("DEBEMAIL")
+	if u, err := user.Current(); maintainer == "" && err == nil {
+		maintainer = u.Username
+	}
+	if desc == "" {
+		desc = cmd
+	}
+	quote := func(s string) string {
+		data, _ := json.Marshal(s) //a JSON string is a valid YAML string
+		return string(data)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Generated by goscript. Build the package with: nfpm package --packager %s\n", format)
+	fmt.Fprintf(&b, "name: %s\n", quote(cmd))
+	fmt.Fprintf(&b, "arch: %s\n", goarch)
+	b.WriteString("platform: linux\n")
+	fmt.Fprintf(&b, "version: %s\n", quote(version))
+	fmt.Fprintf(&b, "maintainer: %s\n", quote(maintainer))
+	fmt.Fprintf(&b, "description: %s\n", quote(desc))
+	b.WriteString("contents:\n")
+	fmt.Fprintf(&b, "  - src: ./%s\n", cmd)
+	fmt.Fprintf(&b, "    dst: /usr/bin/%s\n", cmd)
+	b.WriteString("    file_info:\n      mode: 0755\n")
+	check(os.WriteFile(filepath.Join(dir, "nfpm.yaml"), []byte(b.String()), 0644), 2, "")
+
+	if _, err := exec.LookPath("nfpm"); err != nil {
+		fmt.Printf("Wrote %s/%s and %s/nfpm.yaml. nfpm is not on the PATH; install it (https://nfpm.goreleaser.com) and run: cd %s && nfpm package --packager %s\n", dir, cmd, dir, dir, format)
+		return
+	}
+	nfpm := exec.Command("nfpm", "package", "--packager", format, "--target", "..")
+	nfpm.Dir = dir
+	nfpm.Stdout, nfpm.Stderr = os.Stdout, os.Stderr
+	check(nfpm.Run(), 2, "nfpm failed. The binary and nfpm.yaml are in "+dir+".")
+}
+
+// Packages a command for distribution (see --package).
+func packageCommand(cmd, format string) {
+	if !slices.Contains(packageFormats, format) {
+		err := fmt.Errorf("unknown package format %q", format)
+		if format == "plain" { //the default of --format
+			err = fmt.Errorf("no package format given")
+		}
+		check(err, 2, "Give the package format with --format "+strings.Join(packageFormats, ", ")+".")
+	}
+	srcFilename := sourceFile(cmd)
+	if !checkFileExists(srcFilename) {
+		check(fmt.Errorf("there is no command named %s", cmd), 2, "")
+	}
+	meta := engine.ReadMetadata(srcFilename)
+	desc := describeScripts([]string{srcFilename})[srcFilename]
+	version := packageVersion(cmd, meta)
+	dir := cmd + "-" + version
+	if checkFileExists(dir) {
+		if !confirm(fmt.Sprintf("%s exists and will be replaced.", dir)) {
+			cancelled()
+		}
+		check(os.RemoveAll(dir), 2, "")
+	}
+	check(os.Mkdir(dir, 0755), 2, "")
+
+	switch format {
+	case "nix":
+		writeNixPackage(cmd, version, dir, meta, desc)
+	case "brew":
+		writeBrewPackage(cmd, version, dir, meta, desc)
+	default:
+		writeNfpmPackage(cmd, version, dir, format, meta, desc)
+	}
+}
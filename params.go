@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// When goscript runs a command on a terminal without a flag the command declares as required (a 'flag:' line with
+// 'required' in its frontmatter), it asks for the value instead of letting the command fail. Teammates don't have
+// to remember the flags, and scripts run from cron or pipelines are unaffected.
+
+// Returns the names of the flags given in args, in the syntax of the flag package: -name, --name, -name=value
+// or -name value. Flags end at the first argument that is not a flag, or at "--".
+func providedFlags(args []string, specs []FlagSpec) map[string]bool {
+	isBool := map[string]bool{}
+	for _, spec := range specs {
+		isBool[spec.Name] = spec.Type == "bool"
+	}
+	provided := map[string]bool{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") || arg == "-" {
+			break
+		}
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		provided[name] = true
+		if !hasValue && !isBool[name] {
+			i++ //the value is the next argument
+		}
+	}
+	return provided
+}
+
+// Checks that a value is valid for a flag of the given type.
+func validFlagValue(kind string, value string) error {
+	var err error
+	switch kind {
+	case "int", "int64":
+		_, err = strconv.ParseInt(value, 0, 64)
+	case "uint", "uint64":
+		_, err = strconv.ParseUint(value, 0, 64)
+	case "float", "float64":
+		_, err = strconv.ParseFloat(value, 64)
+	case "bool":
+		_, err = strconv.ParseBool(value)
+	case "duration":
+		_, err = time.ParseDuration(value)
+	}
+	if err != nil {
+		return fmt.Errorf("%q is not a valid %s", value, kind)
+	}
+	return nil
+}
+
+// Prompts for each required flag missing from args, if stdin is a terminal. Returns args with the answers added
+// in front of them.
+func promptForFlags(specs []FlagSpec, args []string) []string {
+	if !isTerminal(os.Stdin) {
+		return args
+	}
+	provided := providedFlags(args, specs)
+	in := bufio.NewReader(os.Stdin)
+	answers := []string{}
+	for _, spec := range specs {
+		if !spec.Required || provided[spec.Name] {
+			continue
+		}
+		for {
+			fmt.Fprintf(os.Stderr, "%s (%s", spec.Name, spec.Type)
+			if spec.Usage != "" {
+				fmt.Fprintf(os.Stderr, ", %s", spec.Usage)
+			}
+			fmt.Fprint(os.Stderr, ")")
+			if spec.Default != "" {
+				fmt.Fprintf(os.Stderr, " [%s]", spec.Default)
+			}
+			fmt.Fprint(os.Stderr, ": ")
+			line, err := in.ReadString('\n')
+			value := strings.TrimSpace(line)
+			if value == "" {
+				value = spec.Default
+			}
+			if value == "" && err != nil {
+				check(fmt.Errorf("no value for -%s", spec.Name), 2, "")
+			}
+			if value == "" {
+				fmt.Fprintf(os.Stderr, "-%s is required.\n", spec.Name)
+				continue
+			}
+			if err := validFlagValue(spec.Type, value); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				continue
+			}
+			answers = append(answers, "-"+spec.Name+"="+value)
+			break
+		}
+	}
+	return append(answers, args...)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// goscript runs on Windows as well as on Unix. There, binaries are built with an .exe suffix, the project defaults
+// to %USERPROFILE%\goscript, and since Windows has no shebangs, a script outside the project is run by a .cmd
+// wrapper beside it (see --export and --bang), which works from both cmd.exe and PowerShell.
+
+// Returns the file name of a binary for the operating system: name.exe on Windows.
+func exeName(name, goos string) string {
+	if goos == "windows" && !strings.HasSuffix(name, ".exe") {
+		return name + ".exe"
+	}
+	return name
+}
+
+// Returns the path of the named command's binary for this machine, whatever platform is being built for.
+func hostBinaryPath(name string) string {
+	return projectDir + "/bin/" + exeName(name, runtime.GOOS)
+}
+
+// Returns the project used when GOSCRIPT_PROJECT_DIR isn't set and the goscript executable isn't in a project:
+// goscript in the home directory (%USERPROFILE% on Windows), or "" if there is no home directory.
+func defaultProjectDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, "goscript")
+}
+
+// Reports whether two paths name the same directory. Paths on Windows are compared without regard to case.
+func samePath(a, b string) bool {
+	a, b = filepath.Clean(a), filepath.Clean(b)
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// Reports whether scripts run on Windows, where a wrapper takes the place of a shebang: when building for Windows,
+// on Windows or with --os windows.
+func windowsScripts() bool {
+	goos, _ := buildPlatform()
+	return goos == "windows"
+}
+
+// Returns a .cmd file that runs the script saved as name.go beside it with goscript, passing on its arguments and
+// exit status.
+func cmdWrapper(name string) string {
+	command := "goscript"
+	if runtime.GOOS == "windows" {
+		command = goscriptCommand()
+	}
+	if strings.ContainsAny(command, " &()") {
+		command = `"` + command + `"`
+	}
+	return "@echo off\r\n" + command + ` -x -f "%~dp0` + name + `.go" %*` + "\r\nexit /b %ERRORLEVEL%\r\n"
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/fkmiec/goscript/engine"
+)
+
+// Preludes are scaffolding added to the start of wrapped code, so they work with any template. They are selected
+// with --with (e.g. --with context) or a //goscript:with directive in a script. Packages they use are imported
+// by the usual import inference.
+var preludes = map[string]string{
+	//ctx is cancelled on SIGINT or SIGTERM, so long-running code can stop cleanly
+	"context": `ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+defer stop()
+_ = ctx
+`,
+	//log is a *slog.Logger (also the slog default). GOSCRIPT_LOG sets the level (debug, info, warn, error) and
+	//GOSCRIPT_LOG_FORMAT=json switches from text to JSON output.
+	"log": `log := func() *slog.Logger {
+	var level slog.Level
+	level.UnmarshalText([]byte(os.Getenv("GOSCRIPT_LOG")))
+	opts := &slog.HandlerOptions{Level: level}
+	if os.Getenv("GOSCRIPT_LOG_FORMAT") == "json" {
+		return slog.New(slog.NewJSONHandler(os.Stderr, opts))
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, opts))
+}()
+slog.SetDefault(log)
+`,
+	//chars splits a string into the characters a reader sees, rather than bytes or runes: a rune with the combining
+	//marks, variation selectors, skin tones and zero-width joined runes that follow it, a pair of regional
+	//indicators (a flag), or \r\n. It approximates the grapheme clusters of Unicode, which the standard library
+	//lacks. truncate and reverse work on those characters, so they never split one, and length counts them.
+	"text": `chars := func(s string) []string {
+	out := []string{}
+	start, prev, regional := 0, rune(-1), 0
+	for i, r := range s {
+		joins := unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc, unicode.Variation_Selector) ||
+			r == '\u200d' || prev == '\u200d' || (r >= 0x1f3fb && r <= 0x1f3ff) || (prev == '\r' && r == '\n')
+		if r >= 0x1f1e6 && r <= 0x1f1ff {
+			joins = joins || regional%2 == 1
+			regional++
+		} else {
+			regional = 0
+		}
+		if i > 0 && !joins {
+			out = append(out, s[start:i])
+			start = i
+		}
+		prev = r
+	}
+	if start < len(s) {
+		out = append(out, s[start:])
+	}
+	return out
+}
+truncate := func(s string, n int) string {
+	if c := chars(s); len(c) > n {
+		return strings.Join(c[:n], "")
+	}
+	return s
+}
+reverse := func(s string) string {
+	c := chars(s)
+	slices.Reverse(c)
+	return strings.Join(c, "")
+}
+length := func(s string) int { return len(chars(s)) }
+_, _, _ = truncate, reverse, length
+`,
+}
+
+// Set by --with.
+var withPreludes []string
+
+// Returns the values of //goscript:<name> directives in the source, split on commas and spaces.
+func directiveArgs(src string, name string) []string {
+	args := []string{}
+	for _, line := range strings.Split(src, "\n") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), "//goscript:"+name+" "); ok {
+			args = append(args, engine.SplitList(value)...)
+		}
+	}
+	return args
+}
+
+// Returns the code with the requested preludes added in front of it.
+func addPreludes(code string) string {
+	names := []string{}
+	for _, list := range withPreludes {
+		names = append(names, engine.SplitList(list)...)
+	}
+	names = append(names, directiveArgs(code, "with")...)
+
+	var prelude strings.Builder
+	added := map[string]bool{}
+	for _, name := range names {
+		if added[name] {
+			continue
+		}
+		text, ok := preludes[name]
+		if !ok {
+			check(fmt.Errorf("unknown prelude %q (available: %s)", name, strings.Join(preludeNames(), ", ")), 2, "")
+		}
+		prelude.WriteString(text)
+		added[name] = true
+	}
+	if prelude.Len() == 0 {
+		return code
+	}
+	return prelude.String() + code
+}
+
+func preludeNames() []string {
+	names := []string{}
+	for name := range preludes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Runs the text prelude's helpers in a program of their own, as wrapped code gets them.
+func TestTextPrelude(t *testing.T) {
+	dir := t.TempDir()
+	src := "package main\n\nimport (\n\t\"fmt\"\n\t\"slices\"\n\t\"strings\"\n\t\"unicode\"\n)\n\nfunc main() {\n" + preludes["text"] + `
+for _, s := range []string{"caf\u00e9", "cafe\u0301", "\U0001f44d\U0001f3fd!", "\U0001f1eb\U0001f1f7\U0001f1e9\U0001f1ea", "\U0001f469\u200d\U0001f4bbx", "a\r\nb", "", "\xff"} {
+	fmt.Printf("%+q %d %+q %+q\n", chars(s), length(s), truncate(s, 1), reverse(s))
+}
+}
+`
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module text\n\ngo 1.22\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command("go", "run", ".")
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%v: %s", err, out)
+	}
+	want := []string{
+		`["c" "a" "f" "\u00e9"] 4 "c" "\u00e9fac"`,
+		`["c" "a" "f" "e\u0301"] 4 "c" "e\u0301fac"`,
+		`["\U0001f44d\U0001f3fd" "!"] 2 "\U0001f44d\U0001f3fd" "!\U0001f44d\U0001f3fd"`,
+		`["\U0001f1eb\U0001f1f7" "\U0001f1e9\U0001f1ea"] 2 "\U0001f1eb\U0001f1f7" "\U0001f1e9\U0001f1ea\U0001f1eb\U0001f1f7"`,
+		`["\U0001f469\u200d\U0001f4bb" "x"] 2 "\U0001f469\u200d\U0001f4bb" "x\U0001f469\u200d\U0001f4bb"`,
+		`["a" "\r\n" "b"] 3 "a" "b\r\na"`,
+		`[] 0 "" ""`,
+		`["\xff"] 1 "\xff" "\xff"`,
+	}
+	if got := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n"); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"go/token"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fkmiec/goscript/engine"
+)
+
+// A preset is a project's environment without its scripts, in one JSON file a team can share: the import aliases
+// of imports.json, the modules they come from and the project's templates. --preset export <name> writes one, and
+// --preset import <file|url> adds one to a project. Aliases and templates the project already has with different
+// content are resolved as conflicts (see merge.go), and modules it already requires are left at their versions.
+
+const presetSuffix = ".goscript-preset.json"
+
+type preset struct {
+	Name      string            `json:"name"`
+	Imports   map[string]string `json:"imports,omitempty"`   //import aliases, as in imports.json
+	Modules   []string          `json:"modules,omitempty"`   //module@version, as for go get
+	Templates map[string]string `json:"templates,omitempty"` //template text keyed by name; "script" is script.tmpl
+}
+
+// Returns the project's environment as a preset.
+func projectPreset(name string) preset {
+	p := preset{Name: name, Imports: readUserImports(), Templates: map[string]string{}}
+	mod := goModJSON(projectDir)
+	local := map[string]bool{}
+	for _, replace := range mod.Replace {
+		if replace.New.Version == "" {
+			local[replace.Old.Path] = true //a directory on this machine, which the preset can't carry
+		}
+	}
+	for _, req := range mod.Require {
+		if !local[req.Path] {
+			p.Modules = append(p.Modules, req.Path+"@"+req.Version)
+		}
+	}
+	for _, t := range project().Templates() {
+		if t.File == "" {
+			continue //built in, so every project has it
+		}
+		data, err := os.ReadFile(t.File)
+		check(err, 2, "")
+		p.Templates[t.Name] = string(data)
+	}
+	return p
+}
+
+// Writes the project's preset to <name>.goscript-preset.json in the current directory.
+func exportPreset(name string) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		check(fmt.Errorf("invalid preset name %q", name), 2, "")
+	}
+	p := projectPreset(name)
+	data, err := json.MarshalIndent(p, "", "    ")
+	check(err, 2, "")
+	data = append(data, '\n')
+	filename := name + presetSuffix
+	if !confirmOverwrite(filename, data) {
+		cancelled()
+	}
+	check(os.WriteFile(filename, data, 0644), 2, "")
+	fmt.Printf("Exported %d import alias(es), %d module(s) and %d template(s) to %s. Import it with 'goscript --preset import %s'.\n", len(p.Imports), len(p.Modules), len(p.Templates), filename, filename)
+}
+
+// Reads a preset from a file or an https URL.
+func readPreset(source string) preset {
+	var data []byte
+	var err error
+	if strings.HasPrefix(source, "https://") || strings.HasPrefix(source, "http://") {
+		checkScriptURL(source)
+		client := &http.Client{Timeout: 30 * time.Second}
+		resp, err := client.Get(source)
+		check(err, 2, "Unable to fetch the preset.")
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			check(fmt.Errorf("%s: %s", source, resp.Status), 2, "Unable to fetch the preset.")
+		}
+		data, err = io.ReadAll(io.LimitReader(resp.Body, maxScriptSize+1))
+		check(err, 2, "Unable to fetch the preset.")
+		if len(data) > maxScriptSize {
+			check(fmt.Errorf("%s is larger than %d bytes", source, maxScriptSize), 2, "")
+		}
+	} else {
+		data, err = os.ReadFile(source)
+		check(err, 2, "")
+	}
+	var p preset
+	check(json.Unmarshal(data, &p), 2, "Invalid preset "+source)
+	for name, text := range p.Templates {
+		if !validTemplateName(name) {
+			check(fmt.Errorf("invalid template name %q", name), 2, "Invalid preset "+source)
+		}
+		_, err := engine.ParseTemplate(name, text)
+		check(err, 2, fmt.Sprintf("Template %s in the preset is not valid.", name))
+	}
+	for _, module := range p.Modules {
+		if path, version, ok := strings.Cut(module, "@"); !ok || path == "" || !strings.HasPrefix(version, "v") {
+			check(fmt.Errorf("invalid module %q: expected path@version", module), 2, "Invalid preset "+source)
+		}
+	}
+	return p
+}
+
+func validTemplateName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, `/\.`)
+}
+
+// Returns the file a template of the preset is written to in the project.
+func presetTemplateFile(name string) string {
+	if name == "script" {
+		return project().TemplateFile("script")
+	}
+	return project().TemplatesDir() + "/" + name + ".tmpl"
+}
+
+// Adds a preset to the project (see --preset import).
+func importPreset(source string) {
+	p := readPreset(source)
+	r := &report{title: "Preset " + p.Name, columns: []string{"Kind", "Name", "Result"}}
+
+	userImports := readUserImports()
+	if userImports == nil {
+		userImports = map[string]string{}
+	}
+	newImports := map[string]string{}
+	aliasTaken := func(name string) bool {
+		_, inProject := userImports[name]
+		_, inPreset := p.Imports[name]
+		_, added := newImports[name]
+		return inProject || inPreset || added
+	}
+	for _, alias := range sortedKeys(p.Imports) {
+		incoming := p.Imports[alias]
+		existing, ok := userImports[alias]
+		if !ok {
+			newImports[alias] = incoming
+			r.add("import", alias, "added "+incoming)
+			continue
+		}
+		if existing == incoming {
+			continue
+		}
+		switch choice, name := resolveConflict(conflict{kind: "import alias", name: alias, local: existing, incoming: incoming, taken: aliasTaken, valid: token.IsIdentifier}); choice {
+		case "take":
+			newImports[alias] = incoming
+			r.add("import", alias, fmt.Sprintf("replaced %s with %s", existing, incoming))
+		case "rename":
+			newImports[name] = incoming
+			r.add("import", name, fmt.Sprintf("added %s (%s in the preset)", incoming, alias))
+		default:
+			r.add("import", alias, fmt.Sprintf("kept %s (the preset has %s)", existing, incoming))
+		}
+	}
+
+	required := requiredModules()
+	newModules := []string{}
+	for _, module := range p.Modules {
+		path, _, _ := strings.Cut(module, "@")
+		if !slices.Contains(required, path) {
+			newModules = append(newModules, module)
+			r.add("module", module, "added")
+		}
+	}
+
+	newTemplates := map[string]string{}
+	templateTaken := func(name string) bool {
+		_, inPreset := p.Templates[name]
+		_, added := newTemplates[name]
+		return inPreset || added || checkFileExists(presetTemplateFile(name))
+	}
+	for _, name := range sortedKeys(p.Templates) {
+		incoming := p.Templates[name]
+		existing, err := os.ReadFile(presetTemplateFile(name))
+		if err != nil {
+			newTemplates[name] = incoming
+			r.add("template", name, "added")
+			continue
+		}
+		if string(existing) == incoming {
+			continue
+		}
+		switch choice, newName := resolveConflict(conflict{kind: "template", name: name, local: string(existing), incoming: incoming, taken: templateTaken, valid: validTemplateName}); choice {
+		case "take":
+			newTemplates[name] = incoming
+			r.add("template", name, "replaced")
+		case "rename":
+			newTemplates[newName] = incoming
+			r.add("template", newName, "added ("+name+" in the preset)")
+		default:
+			r.add("template", name, "kept yours (it differs from the preset's)")
+		}
+	}
+
+	if len(newImports)+len(newModules)+len(newTemplates) == 0 {
+		note := "Nothing to import: the project already has everything in the preset."
+		if len(r.rows) > 0 {
+			note = "Nothing to import: the project has the rest of the preset, and keeps its own versions of these."
+		}
+		r.notes = append(r.notes, note)
+		r.print()
+		return
+	}
+	r.print()
+	if !confirm(fmt.Sprintf("This will add or replace %d import alias(es) and %d template(s), and add %d module(s).", len(newImports), len(newTemplates), len(newModules))) {
+		cancelled()
+	}
+
+	defer lockProject()()
+	for _, module := range newModules {
+		out, err := goModify(projectDir, "get", module)
+		check(err, 2, fmt.Sprintf("%v: %s\n", err, out))
+	}
+	if len(newImports) > 0 {
+		for alias, path := range newImports {
+			userImports[alias] = path
+		}
+		writeUserImports(userImports)
+	}
+	for name, text := range newTemplates {
+		filename := presetTemplateFile(name)
+		check(os.MkdirAll(filepath.Dir(filename), 0755), 2, "")
+		check(os.WriteFile(filename, []byte(text), 0644), 2, "")
+	}
+	fmt.Printf("Imported preset %s.\n", p.Name)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Runs --preset export or import with the name or source in args.
+func presetCommand(action string, args []string) {
+	if len(args) != 1 {
+		check(fmt.Errorf("--preset %s takes one argument, e.g. goscript --preset export team or goscript --preset import team%s", action, presetSuffix), 2, "")
+	}
+	switch action {
+	case "export":
+		exportPreset(args[0])
+	case "import":
+		importPreset(args[0])
+	default:
+		check(fmt.Errorf("unknown --preset action %q: use export or import", action), 2, "")
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Projects are given names in a registry kept with the user's config (e.g. ~/.config/goscript/projects.json), so
+// separate collections of scripts, such as one for work and one for personal use, can be switched between with
+// --project <name> instead of by changing GOSCRIPT_PROJECT_DIR:
+//
+//	{
+//	    "work": "/home/me/work-scripts",
+//	    "personal": "/home/me/goscript"
+//	}
+//
+// A project is only registered when asked to, with --register <name>, which registers the project in use (e.g.
+// --project <path> --register work). --projects lists them.
+
+// Returns the file of the project registry, or "" if the user has no config directory.
+func projectsFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "goscript", "projects.json")
+}
+
+// Returns the registered projects, keyed by name.
+func readProjects() map[string]string {
+	projects := map[string]string{}
+	if projectsFile() == "" {
+		return projects
+	}
+	data, err := os.ReadFile(projectsFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return projects
+	}
+	check(err, 2, "")
+	check(json.Unmarshal(data, &projects), 2, "Invalid "+projectsFile())
+	return projects
+}
+
+func writeProjects(projects map[string]string) {
+	data, err := json.MarshalIndent(projects, "", "    ")
+	check(err, 2, "")
+	check(os.MkdirAll(filepath.Dir(projectsFile()), 0755), 2, "")
+	check(writeFileAtomic(projectsFile(), append(data, '\n'), 0644), 2, "Unable to update "+projectsFile())
+}
+
+// Returns the name a project directory is registered under, or "" if it isn't.
+func registeredName(dir string) string {
+	for name, registered := range readProjects() {
+		if samePath(registered, dir) {
+			return name
+		}
+	}
+	return ""
+}
+
+// Registers a project directory under a name (see --register), replacing any name it had. A name that is taken
+// by another project is an error rather than given a number, so each name is one the user chose.
+func registerProject(name, dir string) error {
+	if projectsFile() == "" {
+		return errors.New("there is no user config directory to keep the project registry in")
+	}
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return fmt.Errorf("invalid project name %q: --project takes a name with a slash as a path", name)
+	}
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if !checkFileExists(dir + "/go.mod") {
+		return fmt.Errorf("%s is not a goscript project: it has no go.mod", dir)
+	}
+	projects := readProjects()
+	if registered, ok := projects[name]; ok && !samePath(registered, dir) {
+		return fmt.Errorf("the name %s is taken by the project at %s", name, registered)
+	}
+	for other, registered := range projects {
+		if samePath(registered, dir) {
+			delete(projects, other)
+		}
+	}
+	projects[name] = dir
+	writeProjects(projects)
+	return nil
+}
+
+// Makes the project given to --project, by name or path, the one this run of goscript, and the commands it runs,
+// use.
+func selectProject(arg string) {
+	projects := readProjects()
+	dir, ok := projects[arg]
+	if !ok {
+		if !strings.ContainsAny(arg, `/\`) && !checkFileExists(arg) {
+			hint := "No projects are registered yet. Give the path of one, and register it with --register <name>."
+			if len(projects) > 0 {
+				hint = "The registered projects are " + strings.Join(sortedKeys(projects), ", ") + "."
+			}
+			check(fmt.Errorf("there is no project named %s", arg), 2, hint)
+		}
+		abs, err := filepath.Abs(arg)
+		check(err, 2, "")
+		dir = abs
+	}
+	if !checkFileExists(dir + "/go.mod") {
+		check(fmt.Errorf("%s is not a goscript project: it has no go.mod", dir), 2, "Create one there with --setup.")
+	}
+	check(os.Setenv("GOSCRIPT_PROJECT_DIR", dir), 2, "")
+}
+
+// Prints the registered projects, marking the one in use (see --projects).
+func listProjects() {
+	projects := readProjects()
+	if len(projects) == 0 {
+		fmt.Println("No projects are registered. Register the project in use with 'goscript --register <name>', or another with 'goscript --project <path> --register <name>'.")
+		return
+	}
+	r := &report{title: "Projects", columns: []string{"Project", "Directory", "Note"}}
+	for _, name := range sortedKeys(projects) {
+		note := ""
+		switch {
+		case samePath(projects[name], projectDir):
+			note = "in use"
+		case !checkFileExists(projects[name] + "/go.mod"):
+			note = "missing"
+		}
+		r.add(name, projects[name], note)
+	}
+	r.notes = append(r.notes, "Use one with 'goscript --project <name> ...'. The registry is "+projectsFile()+".")
+	r.print()
+}
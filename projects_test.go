@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// Projects are registered only under the names they are given, and a name that is taken is refused.
+func TestRegisterProject(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the registry is found with XDG_CONFIG_HOME")
+	}
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	work, personal := t.TempDir(), t.TempDir()
+	for _, dir := range []string{work, personal} {
+		if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte("module scripts\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := registerProject("work", work); err != nil {
+		t.Fatal(err)
+	}
+	if err := registerProject("work", personal); err == nil {
+		t.Error("registered a second project as work")
+	}
+	if err := registerProject("personal", personal); err != nil {
+		t.Fatal(err)
+	}
+	//Registering a project again renames it
+	if err := registerProject("office", work); err != nil {
+		t.Fatal(err)
+	}
+	projects := readProjects()
+	if len(projects) != 2 || projects["office"] != work || projects["personal"] != personal {
+		t.Errorf("registry = %v, want office and personal", projects)
+	}
+	if name := registeredName(personal); name != "personal" {
+		t.Errorf("registeredName = %q, want personal", name)
+	}
+	if name := registeredName(t.TempDir()); name != "" {
+		t.Errorf("registeredName of an unregistered project = %q", name)
+	}
+
+	for _, name := range []string{"", "a/b", ".."} {
+		if err := registerProject(name, personal); err == nil {
+			t.Errorf("registered a project as %q", name)
+		}
+	}
+	if err := registerProject("empty", t.TempDir()); err == nil {
+		t.Error("registered a directory without a go.mod")
+	}
+}
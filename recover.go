@@ -0,0 +1,83 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Set by --no-recover. The //goscript:norecover directive turns recovery off for a single script.
+var noRecover bool
+
+// Helper appended to wrapped code, which defers it first thing in main. Panics in the main goroutine are reported
+// as a one-line error with exit status 2 (the status of an unrecovered panic) instead of a goroutine dump.
+// It also completes exit(), which unwinds with a goscriptExit panic so deferred functions run before os.Exit.
+const recoverHelper = `
+// goscriptExit is the panic value used by exit() to unwind main. Added by goscript.
+type goscriptExit struct{ code int }
+
+// goscriptRecover reports a panic as a short error. Set GOSCRIPT_TRACE=1 to print the stack as well.
+// Added by goscript; use --no-recover to leave panics alone.
+func goscriptRecover() {
+	if r := recover(); r != nil {
+		if e, ok := r.(goscriptExit); ok {
+			os.Exit(e.code)
+		}
+		fmt.Fprintf(os.Stderr, "error: %v\n", r)
+		if os.Getenv("GOSCRIPT_TRACE") != "" {
+			os.Stderr.Write(debug.Stack())
+		} else {
+			fmt.Fprintln(os.Stderr, "(set GOSCRIPT_TRACE=1 to see where)")
+		}
+		os.Exit(2)
+	}
+}
+`
+
+// exit() and fail() for wrapped code. Unlike os.Exit, exit runs deferred functions (such as the cleanup added by
+// --with) first. It must be called from the main goroutine.
+const exitHelper = `
+// exit ends the script with the status code after deferred functions have run. Added by goscript.
+func exit(code int) {
+	panic(goscriptExit{code})
+}
+
+// fail prints the message to stderr and exits with status 1. Added by goscript.
+func fail(msg ...any) {
+	fmt.Fprintln(os.Stderr, msg...)
+	exit(1)
+}
+`
+
+// With --no-recover there is nothing to unwind to, so exit() is os.Exit and deferred functions don't run.
+const plainExitHelper = `
+// exit ends the script with the status code. Deferred functions don't run (see --no-recover). Added by goscript.
+func exit(code int) {
+	os.Exit(code)
+}
+
+// fail prints the message to stderr and exits with status 1. Added by goscript.
+func fail(msg ...any) {
+	fmt.Fprintln(os.Stderr, msg...)
+	exit(1)
+}
+`
+
+var exitCallMatcher = regexp.MustCompile(`(?:^|[^\w.])(exit|fail)\(`)
+var osExitMatcher = regexp.MustCompile(`\bos\.Exit\(`)
+var deferMatcher = regexp.MustCompile(`\bdefer\s`)
+
+// Reports whether the code calls os.Exit while it has deferred functions, which os.Exit skips. The defer of
+// goscriptRecover added in front of the code doesn't count: there is nothing for it to do on os.Exit.
+func osExitSkipsDefers(code string) bool {
+	code = strings.Replace(code, "defer goscriptRecover()\n", "", 1)
+	return osExitMatcher.MatchString(code) && deferMatcher.MatchString(code)
+}
+
+// Reports whether the code calls the exit() or fail() helpers and doesn't declare its own.
+func usesExitHelpers(code string) bool {
+	if !exitCallMatcher.MatchString(code) {
+		return false
+	}
+	declared := regexp.MustCompile(`\b(exit|fail)\s*:?=`)
+	return !declared.MatchString(code)
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+// The warning about os.Exit is for deferred functions of the code, not for the recover goscript defers.
+func TestOsExitSkipsDefers(t *testing.T) {
+	tests := []struct {
+		code string
+		want bool
+	}{
+		{"defer goscriptRecover()\nos.Exit(7)\n", false},
+		{"os.Exit(7)\n", false},
+		{"defer goscriptRecover()\nf, _ := os.Create(\"x\")\ndefer f.Close()\nos.Exit(1)\n", true},
+		{"defer goscriptRecover()\ndefer\tcleanup()\nif failed {\n\tos.Exit(1)\n}\n", true},
+		{"defer goscriptRecover()\ndefer cleanup()\nexit(1)\n", false},
+		{"defer goscriptRecover()\ndeferred := 1\nos.Exit(deferred)\n", false},
+	}
+	for _, test := range tests {
+		if got := osExitSkipsDefers(test.code); got != test.want {
+			t.Errorf("osExitSkipsDefers(%q) = %v, want %v", test.code, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fkmiec/goscript/engine"
+)
+
+// Commands can be described without editing their source in <project>/manifest.json, which is used for
+// commands that declare no description of their own (in frontmatter or a goscript:desc directive):
+//
+//	{
+//	    "gofind": {"description": "Find config files matching a pattern"}
+//	}
+//
+// An entry can also mark the command as deprecated (see deprecate.go).
+
+type manifestEntry struct {
+	Description string `json:"description"`
+	ReplacedBy  string `json:"replaced_by"` //set by --deprecate
+	Forward     bool   `json:"forward"`     //whether running the command runs its replacement instead
+}
+
+func manifestFile() string {
+	return projectDir + "/manifest.json"
+}
+
+// Reads the project manifest. A missing file is the same as an empty one; an invalid one is reported.
+func readManifest() map[string]manifestEntry {
+	manifest := map[string]manifestEntry{}
+	data, err := os.ReadFile(manifestFile())
+	if err != nil {
+		return manifest
+	}
+	check(json.Unmarshal(data, &manifest), 1, "Ignoring invalid "+manifestFile())
+	return manifest
+}
+
+// What --list --long and --list --json show about a command.
+type commandInfo struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Deleted     bool      `json:"deleted"` //soft-deleted, requires --restore
+	Source      string    `json:"source"`
+	Modified    time.Time `json:"modified"` //of the newest of its source files
+	Binary      string    `json:"binary,omitempty"`
+	BinarySize  int64     `json:"binary_size,omitempty"`
+	Examples    []string  `json:"examples,omitempty"`
+	ReplacedBy  string    `json:"replaced_by,omitempty"` //the command that replaces a deprecated one
+	Forwards    bool      `json:"forwards,omitempty"`    //whether a deprecated command runs its replacement
+	Redirect    bool      `json:"redirect,omitempty"`    //a deprecated name with no source of its own
+}
+
+// Gathers the details of the commands listed by getSourceList.
+func commandInfos(cmds []string) []commandInfo {
+	filenames := []string{}
+	for _, cmd := range cmds {
+		filenames = append(filenames, sourcePath(cmd))
+	}
+	descriptions := describeScripts(filenames)
+	manifest := readManifest()
+
+	infos := []commandInfo{}
+	for _, cmd := range cmds {
+		name, active := strings.CutSuffix(cmd, ".go")
+		srcFilename := sourcePath(cmd)
+		entry := manifest[name]
+		if !active && entry.ReplacedBy != "" && !checkFileExists(srcFilename) {
+			info := commandInfo{Name: name, Description: entry.Description, ReplacedBy: entry.ReplacedBy, Forwards: entry.Forward, Redirect: true}
+			if stat, err := os.Stat(binaryPath(name)); err == nil {
+				info.Binary, info.BinarySize, info.Modified = binaryPath(name), stat.Size(), stat.ModTime()
+			}
+			infos = append(infos, info)
+			continue
+		}
+		info := commandInfo{Name: name, Description: descriptions[srcFilename], Deleted: !active, Source: srcFilename, ReplacedBy: entry.ReplacedBy, Forwards: entry.Forward}
+		for _, filename := range commandFiles(srcFilename) {
+			if stat, err := os.Stat(filename); err == nil && stat.ModTime().After(info.Modified) {
+				info.Modified = stat.ModTime()
+			}
+		}
+		if stat, err := os.Stat(binaryPath(name)); err == nil && active {
+			info.Binary = binaryPath(name)
+			info.BinarySize = stat.Size()
+		}
+		info.Examples = engine.ReadMetadata(srcFilename).Examples
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// Prints the commands as a JSON array (see --list --json).
+func listCommandsJSON(cmds []string) {
+	data, err := json.MarshalIndent(commandInfos(cmds), "", "    ")
+	check(err, 2, "")
+	os.Stdout.Write(append(data, '\n'))
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// --rename <old>:<new> renames a command: its source file or directory, its binaries (including those built for
+// other platforms), its saved versions and its schedule log. References to it by name in the project are updated
+// too: its manifest.json entry and those of the commands it replaces (see --deprecate), its schedule and the client
+// allow lists in config.json, its //goscript:example directives and, for an isolated command, its module path. The
+// command is then recompiled.
+
+// Reports whether a name can be used for a command.
+func validCommandName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, `/\:`) && !strings.HasPrefix(name, ".") && !strings.HasPrefix(name, "-")
+}
+
+// Parses the argument of --rename.
+func parseRename(arg string) (string, string, error) {
+	oldName, newName, ok := strings.Cut(arg, ":")
+	if !ok || oldName == "" || newName == "" {
+		return "", "", fmt.Errorf("%q is not of the form <old>:<new>", arg)
+	}
+	if !validCommandName(newName) {
+		return "", "", fmt.Errorf("%q is not a valid command name", newName)
+	}
+	return oldName, newName, nil
+}
+
+// Replaces the command name in a JSON object whose keys are command names. Returns false if the name isn't a key.
+func renameKey(obj map[string]json.RawMessage, oldName, newName string) bool {
+	value, ok := obj[oldName]
+	if !ok {
+		return false
+	}
+	delete(obj, oldName)
+	obj[newName] = value
+	return true
+}
+
+// Rewrites a JSON file of the project with the command renamed, using update to change the decoded file. Other
+// settings are kept as they are. Returns true if the file was changed.
+func renameInJSON(filename string, update func(map[string]json.RawMessage) bool) bool {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return false
+	}
+	obj := map[string]json.RawMessage{}
+	if check(json.Unmarshal(data, &obj), 1, "Not updating invalid "+filename) || !update(obj) {
+		return false
+	}
+	data, err = json.MarshalIndent(obj, "", "    ")
+	check(err, 2, "")
+	return !check(os.WriteFile(filename, append(data, '\n'), 0644), 1, "Unable to update "+filename)
+}
+
+// Renames the command where the manifest names it as the replacement of a deprecated one (see --deprecate).
+// Returns the deprecated commands.
+func renameReplacement(manifest map[string]json.RawMessage, oldName, newName string) []string {
+	deprecated := []string{}
+	for name, raw := range manifest {
+		entry := map[string]json.RawMessage{}
+		replacedBy := ""
+		if json.Unmarshal(raw, &entry) != nil || json.Unmarshal(entry["replaced_by"], &replacedBy) != nil || replacedBy != oldName {
+			continue
+		}
+		entry["replaced_by"], _ = json.Marshal(newName)
+		manifest[name], _ = json.Marshal(entry)
+		deprecated = append(deprecated, name)
+	}
+	return deprecated
+}
+
+// Renames the command in the schedule and the client allow lists of the project config.
+func renameInConfig(oldName, newName string) bool {
+	return renameInJSON(projectConfigFile(), func(config map[string]json.RawMessage) bool {
+		changed := false
+		schedule := map[string]json.RawMessage{}
+		if json.Unmarshal(config["schedule"], &schedule) == nil && renameKey(schedule, oldName, newName) {
+			config["schedule"], _ = json.Marshal(schedule)
+			changed = true
+		}
+		serve := map[string]json.RawMessage{}
+		clients := map[string]map[string]json.RawMessage{}
+		if json.Unmarshal(config["serve"], &serve) != nil || json.Unmarshal(serve["clients"], &clients) != nil {
+			return changed
+		}
+		clientsChanged := false
+		for _, client := range clients {
+			allow := []string{}
+			if json.Unmarshal(client["allow"], &allow) != nil {
+				continue
+			}
+			for i, cmd := range allow {
+				if cmd == oldName {
+					allow[i] = newName
+					client["allow"], _ = json.Marshal(allow)
+					clientsChanged = true
+				}
+			}
+		}
+		if clientsChanged {
+			serve["clients"], _ = json.Marshal(clients)
+			config["serve"], _ = json.Marshal(serve)
+		}
+		return changed || clientsChanged
+	})
+}
+
+// Renames the command in the //goscript:example directives of its source files.
+func renameExamples(srcFilename, oldName, newName string) bool {
+	matcher := regexp.MustCompile(`(?m)^(\s*//goscript:example\s+)` + regexp.QuoteMeta(oldName) + `(\s|$)`)
+	changed := false
+	for _, filename := range commandFiles(srcFilename) {
+		data, err := os.ReadFile(filename)
+		if err != nil || !matcher.Match(data) {
+			continue
+		}
+		data = matcher.ReplaceAll(data, []byte("${1}"+newName+"${2}"))
+		changed = !check(os.WriteFile(filename, data, 0644), 1, "") || changed
+	}
+	return changed
+}
+
+// Renames a command (see --rename).
+func renameCommand(oldName, newName string) {
+	srcFilename := sourceFile(oldName)
+	if !checkFileExists(srcFilename) {
+		if checkFileExists(strings.TrimSuffix(srcFilename, ".go")) {
+			check(fmt.Errorf("%s is deleted", oldName), 2, "Restore it with --restore first.")
+		}
+		check(fmt.Errorf("there is no command named %s", oldName), 2, "")
+	}
+	for _, taken := range []string{projectDir + "/src/" + newName + ".go", projectDir + "/src/" + newName} {
+		if checkFileExists(taken) {
+			check(fmt.Errorf("%s already exists", taken), 2, "Choose another name, or delete that command first.")
+		}
+	}
+
+	updated := []string{}
+	//The source, and the directory it is in for a directory command
+	if isDirCommand(oldName) {
+		check(os.Rename(commandDir(oldName), commandDir(newName)), 2, "")
+	} else {
+		check(os.Rename(srcFilename, projectDir+"/src/"+newName+".go"), 2, "")
+	}
+	srcFilename = sourceFile(newName)
+
+	//Binaries, for this platform and the others built with --os and --arch
+	binaries, _ := filepath.Glob(projectDir + "/bin/*_*/" + oldName)
+	windows, _ := filepath.Glob(projectDir + "/bin/windows_*/" + oldName + ".exe")
+	for _, binFilename := range append(append(binaries, windows...), hostBinaryPath(oldName)) {
+		if checkFileExists(binFilename) {
+			base := newName + strings.TrimPrefix(filepath.Base(binFilename), oldName)
+			check(os.Rename(binFilename, filepath.Join(filepath.Dir(binFilename), base)), 1, "")
+		}
+	}
+
+	//Saved versions and the schedule log
+	if checkFileExists(historyDir(oldName)) && !checkFileExists(historyDir(newName)) {
+		if !check(os.Rename(historyDir(oldName), historyDir(newName)), 1, "Unable to move the saved versions.") {
+			updated = append(updated, "saved versions")
+		}
+	}
+	if checkFileExists(runLogFile(oldName)) && !checkFileExists(runLogFile(newName)) {
+		check(os.Rename(runLogFile(oldName), runLogFile(newName)), 1, "")
+	}
+
+	//References to the command by name
+	deprecated := []string{}
+	if renameInJSON(manifestFile(), func(manifest map[string]json.RawMessage) bool {
+		deprecated = renameReplacement(manifest, oldName, newName)
+		return renameKey(manifest, oldName, newName) || len(deprecated) > 0
+	}) {
+		updated = append(updated, filepath.Base(manifestFile()))
+	}
+	if renameInConfig(oldName, newName) {
+		updated = append(updated, filepath.Base(projectConfigFile()))
+	}
+	if renameExamples(srcFilename, oldName, newName) {
+		updated = append(updated, "examples")
+	}
+	//An isolated command's module is renamed if it has the name --isolate gave it
+	if isIsolated(newName) {
+		oldModule, newModule := sanitizeModuleName(oldName), sanitizeModuleName(newName)
+		if project := moduleName(); project != "" {
+			oldModule, newModule = project+"/"+oldModule, project+"/"+newModule
+		}
+		data, _ := os.ReadFile(commandDir(newName) + "/go.mod")
+		if m := moduleMatcher.FindSubmatch(data); m != nil && strings.Trim(string(m[1]), `"`) == oldModule {
+			_, err := goModify(commandDir(newName), "mod", "edit", "-module", newModule)
+			if !check(err, 1, "Unable to rename the module of "+newName+".") {
+				updated = append(updated, "module path")
+			}
+		}
+	}
+
+	fmt.Printf("Renamed %s to %s\n", oldName, newName)
+	if len(updated) > 0 {
+		fmt.Printf("Updated: %s\n", strings.Join(updated, ", "))
+	}
+	fmt.Printf("To keep %s working for those used to it, run 'goscript --deprecate %s:%s --forward'.\n", oldName, oldName, newName)
+	if !compileBinary(srcFilename, binaryPath(newName)) {
+		exitProgram(1)
+	}
+	//The commands it replaces warn with, or run, the new name
+	for _, name := range deprecated {
+		if entry, _ := deprecation(name); entry.Forward || !checkFileExists(sourceFile(name)) {
+			buildRedirect(name, entry, binaryPath(name))
+		} else {
+			compileBinary(sourceFile(name), binaryPath(name))
+		}
+	}
+}
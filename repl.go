@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/fkmiec/goscript/engine"
+)
+
+// --repl reads statements one at a time and keeps those that compile and run in an accumulating main body.
+// Each statement is run by building and running the whole body, so earlier statements run again every time.
+// Their output is hidden: a marker printed just before the new statement separates old output from new.
+
+const replMarker = "\x1egoscript-repl\x1e"
+
+const replHelp = `Enter Go statements. A bare expression is printed. Statements that compile and run are kept.
+  :show           print the statements kept so far
+  :reset          forget all statements and imports
+  :import <pkg>   import a package (e.g. :import github.com/google/uuid)
+  :save <name>    save the statements as a command and compile it
+  :help           print this help
+  :quit           exit (or Ctrl-D)
+`
+
+type replSession struct {
+	body    []string //statements kept so far
+	imports []engine.ImportSpec
+	name    string //temporary command name used to build each run
+}
+
+// Returns the variables and constants declared at the top level of the statements, so that they can be marked
+// as used. Go rejects unused variables, and a REPL declares them before using them.
+func declaredNames(code string) []string {
+	names := []string{}
+	f, err := parser.ParseFile(token.NewFileSet(), "", "package main\n\nfunc main() {\n"+code+"\n}\n", 0)
+	if err != nil {
+		return names
+	}
+	add := func(id *ast.Ident) {
+		if id.Name != "_" {
+			names = append(names, id.Name)
+		}
+	}
+	for _, stmt := range f.Decls[0].(*ast.FuncDecl).Body.List {
+		switch stmt := stmt.(type) {
+		case *ast.AssignStmt:
+			if stmt.Tok == token.DEFINE {
+				for _, lhs := range stmt.Lhs {
+					if id, ok := lhs.(*ast.Ident); ok {
+						add(id)
+					}
+				}
+			}
+		case *ast.DeclStmt:
+			if decl, ok := stmt.Decl.(*ast.GenDecl); ok && decl.Tok != token.TYPE && decl.Tok != token.IMPORT {
+				for _, spec := range decl.Specs {
+					for _, id := range spec.(*ast.ValueSpec).Names {
+						add(id)
+					}
+				}
+			}
+		}
+	}
+	return names
+}
+
+// Returns the code for the session's statements, followed by stmt if it is not blank. Declared variables are
+// marked as used, and only the imports the code refers to are included.
+func (s *replSession) code(stmt string, marker bool) string {
+	var b strings.Builder
+	statements := s.body
+	if stmt != "" {
+		statements = append(statements[:len(statements):len(statements)], stmt)
+	}
+	for i, statement := range statements {
+		if marker && i == len(statements)-1 {
+			fmt.Fprintf(&b, "print(%q)\n", replMarker)
+		}
+		b.WriteString(statement + "\n")
+		for _, name := range declaredNames(statement) {
+			fmt.Fprintf(&b, "_ = %s\n", name)
+		}
+	}
+	body := b.String()
+	imports := ""
+	for _, spec := range s.imports {
+		if strings.Contains(body, spec.LocalName()+".") {
+			imports += "import " + spec.String() + "\n"
+		}
+	}
+	return imports + body
+}
+
+// Builds and runs the session's statements plus stmt. Output of the earlier statements is discarded. Returns
+// false if stmt doesn't compile or the run fails.
+func (s *replSession) run(stmt string) bool {
+	buf := wrapCode(s.code(stmt, true))
+	srcFilename := projectDir + "/src/" + s.name + ".go"
+	binFilename := hostBinaryPath(s.name)
+	unlock := lockProject()
+	writeSourceFile(srcFilename, buf)
+	ok := compileBinary(srcFilename, binFilename)
+	unlock()
+	savedErrors.flush()
+	if !ok {
+		return false
+	}
+
+	out := &markerWriter{w: os.Stdout}
+	cmd := exec.Command(binFilename)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	err := cmd.Run()
+	out.Flush()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return false
+	}
+	return true
+}
+
+// Saves the session's statements as a named command and compiles it.
+func (s *replSession) save(name string) {
+	if name == "" || len(s.body) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: :save <name>, after entering some statements.")
+		return
+	}
+	buf := wrapCode(s.code("", false))
+	srcFilename := sourceFile(name)
+	if !confirmOverwrite(srcFilename, buf.Bytes()) {
+		fmt.Fprintln(os.Stderr, "Not saved.")
+		return
+	}
+	unlock := lockProject()
+	defer unlock()
+	writeSourceFile(srcFilename, buf)
+	if compileBinary(srcFilename, hostBinaryPath(name)) {
+		fmt.Printf("Saved command %s (%s)\n", name, srcFilename)
+	}
+}
+
+// Passes through everything written after the REPL marker. If the marker never appears (e.g. an earlier statement
+// failed), all of the output is written at Flush so the failure can be seen.
+type markerWriter struct {
+	w       io.Writer
+	pending bytes.Buffer
+	found   bool
+}
+
+func (m *markerWriter) Write(p []byte) (int, error) {
+	if m.found {
+		return m.w.Write(p)
+	}
+	m.pending.Write(p)
+	if i := bytes.Index(m.pending.Bytes(), []byte(replMarker)); i >= 0 {
+		m.found = true
+		m.w.Write(m.pending.Bytes()[i+len(replMarker):])
+		m.pending.Reset()
+	}
+	return len(p), nil
+}
+
+func (m *markerWriter) Flush() {
+	if !m.found {
+		m.w.Write(m.pending.Bytes())
+	}
+}
+
+// Returns true once the braces, brackets and parentheses in the input are balanced, so multi-line statements
+// such as loops can be entered over several lines.
+func balanced(input string) bool {
+	depth := 0
+	for _, r := range input {
+		switch r {
+		case '{', '(', '[':
+			depth++
+		case '}', ')', ']':
+			depth--
+		}
+	}
+	return depth <= 0
+}
+
+func runRepl() {
+	checkProjectModule()
+	s := &replSession{name: fmt.Sprintf("gocmd-repl-%d", time.Now().UnixNano())}
+	defer cleanTemporaryFiles(s.name)
+
+	fmt.Printf("goscript REPL. Type :help for help.\n")
+	in := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("> ")
+		if !in.Scan() {
+			fmt.Println()
+			return
+		}
+		input := in.Text()
+		for !balanced(input) {
+			fmt.Print("... ")
+			if !in.Scan() {
+				break
+			}
+			input += "\n" + in.Text()
+		}
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
+
+		command, arg, _ := strings.Cut(input, " ")
+		arg = strings.TrimSpace(arg)
+		switch command {
+		case ":quit", ":q", ":exit":
+			return
+		case ":help":
+			fmt.Print(replHelp)
+		case ":show":
+			for _, spec := range s.imports {
+				fmt.Printf("import %s\n", spec)
+			}
+			for _, statement := range s.body {
+				fmt.Println(statement)
+			}
+		case ":reset":
+			s.body = nil
+			s.imports = nil
+		case ":import":
+			if arg == "" {
+				fmt.Fprintln(os.Stderr, "Usage: :import <package>")
+				continue
+			}
+			spec := engine.ImportSpec{Path: strings.Trim(arg, `"`)}
+			if name, path, ok := strings.Cut(arg, " "); ok {
+				spec = engine.ImportSpec{Name: name, Path: strings.Trim(strings.TrimSpace(path), `"`)}
+			}
+			s.imports = append(s.imports, spec)
+		case ":save":
+			s.save(arg)
+		default:
+			if strings.HasPrefix(command, ":") {
+				fmt.Fprintf(os.Stderr, "Unknown command %s. Type :help for help.\n", command)
+				continue
+			}
+			//An expression that was printed is not kept, since Go doesn't allow an unused value in the body
+			if s.run(input) && !autoPrinted {
+				s.body = append(s.body, input)
+			}
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Runs of commands started by --serve, from a route or a schedule, are recorded in .goscript/runs.jsonl with their
+// duration, CPU time and peak memory, so that a script that has quietly become slow or hungry shows up in --runs
+// --stats, or in GET /_goscript/stats when GOSCRIPT_API_TOKEN is set for --serve. Runs with --exec are recorded the
+// same way in the project's history.jsonl, with their arguments, which --history lists. GOSCRIPT_NO_RUN_LOG=1 stops
+// them being recorded, e.g. when their arguments hold secrets.
+
+const defaultRunsShown = 20
+
+var runsMutex sync.Mutex
+
+type runRecord struct {
+	Command  string        `json:"command"`
+	Trigger  string        `json:"trigger"`        //what started the run: "exec", "schedule", or the route (e.g. "POST /hooks/deploy")
+	Args     []string      `json:"args,omitempty"` //the arguments of an exec run
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	CPU      time.Duration `json:"cpu,omitempty"`     //user and system time
+	MaxRSS   int64         `json:"max_rss,omitempty"` //peak resident memory in bytes
+	ExitCode int           `json:"exit_code"`
+	Error    string        `json:"error,omitempty"` //why the command couldn't be run or didn't finish, if so
+}
+
+// Per-command totals over the recorded runs.
+type runStats struct {
+	Command     string        `json:"command"`
+	Runs        int           `json:"runs"`
+	Failures    int           `json:"failures"`
+	AvgDuration time.Duration `json:"avg_duration"`
+	MaxDuration time.Duration `json:"max_duration"`
+	AvgCPU      time.Duration `json:"avg_cpu"`
+	MaxCPU      time.Duration `json:"max_cpu"`
+	MaxRSS      int64         `json:"max_rss"`
+	LastRun     time.Time     `json:"last_run"`
+}
+
+func runsFile() string {
+	return stateDir() + "/runs.jsonl"
+}
+
+// The record of the runs with --exec (including --run and shebang scripts, e.g. from cron), which --history lists.
+func historyFile() string {
+	return projectDir + "/history.jsonl"
+}
+
+// Reports whether runs with --exec are recorded.
+func runLogEnabled() bool {
+	value := os.Getenv("GOSCRIPT_NO_RUN_LOG")
+	return value == "" || value == "0"
+}
+
+// Fills in the exit code and resource usage of a finished run.
+func (record *runRecord) measure(state *os.ProcessState) {
+	record.ExitCode = state.ExitCode()
+	record.CPU = state.UserTime() + state.SystemTime()
+	record.MaxRSS = maxRSS(state)
+}
+
+func (record runRecord) failed() bool {
+	return record.Error != "" || record.ExitCode != 0
+}
+
+// Describes how a run ended: "ok", "exit N", or why it couldn't be run.
+func (record runRecord) result() string {
+	switch {
+	case record.Error != "":
+		return record.Error
+	case record.ExitCode != 0:
+		return fmt.Sprintf("exit %d", record.ExitCode)
+	}
+	return "ok"
+}
+
+// Appends a run to the runs file.
+func recordRun(record runRecord) {
+	appendRunRecord(runsFile(), record)
+}
+
+func readRuns() []runRecord {
+	return readRunRecords(runsFile())
+}
+
+// Appends a run with --exec to the history file.
+func recordHistory(record runRecord) {
+	appendRunRecord(historyFile(), record)
+}
+
+// Appends a run to a file of runs, creating it if need be. Runs are recorded from goroutines of --serve, so
+// writes are serialized.
+func appendRunRecord(filename string, record runRecord) {
+	runsMutex.Lock()
+	defer runsMutex.Unlock()
+	if check(os.MkdirAll(filepath.Dir(filename), 0755), 1, "") {
+		return
+	}
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if check(err, 1, "Unable to record run in "+filename) {
+		return
+	}
+	defer file.Close()
+	line, err := json.Marshal(record)
+	check(err, 2, "")
+	file.Write(append(line, '\n'))
+}
+
+// Reads a file of runs, oldest first. Lines that can't be read are skipped.
+func readRunRecords(filename string) []runRecord {
+	records := []runRecord{}
+	file, err := os.Open(filename)
+	if err != nil {
+		return records
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record runRecord
+		if json.Unmarshal(scanner.Bytes(), &record) == nil {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// Totals the runs of each command, or only of the named command if name isn't "all". Sorted by command.
+func computeRunStats(records []runRecord, name string) []runStats {
+	byCommand := map[string]*runStats{}
+	for _, record := range records {
+		if name != "all" && record.Command != name {
+			continue
+		}
+		s := byCommand[record.Command]
+		if s == nil {
+			s = &runStats{Command: record.Command}
+			byCommand[record.Command] = s
+		}
+		s.Runs++
+		if record.failed() {
+			s.Failures++
+		}
+		s.AvgDuration += record.Duration //summed here, divided below
+		s.MaxDuration = max(s.MaxDuration, record.Duration)
+		s.AvgCPU += record.CPU
+		s.MaxCPU = max(s.MaxCPU, record.CPU)
+		s.MaxRSS = max(s.MaxRSS, record.MaxRSS)
+		if record.Start.After(s.LastRun) {
+			s.LastRun = record.Start
+		}
+	}
+	stats := []runStats{}
+	for _, s := range byCommand {
+		s.AvgDuration /= time.Duration(s.Runs)
+		s.AvgCPU /= time.Duration(s.Runs)
+		stats = append(stats, *s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Command < stats[j].Command })
+	return stats
+}
+
+func formatRunTime(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(100 * time.Millisecond).String()
+}
+
+// Prints the recent runs of --serve of the named command, or of all commands if name is "all". With stats, prints
+// the totals for each command instead.
+func printRuns(name string, stats bool) {
+	printRunRecords(readRuns(), name, stats, "No runs recorded. The runs of the schedules and routes of --serve are recorded, and those with --exec are listed by --history.")
+}
+
+// Prints the recent runs with --exec of the named command, or of all commands if name is "all". With stats,
+// prints the totals for each command instead.
+func printHistory(name string, stats bool) {
+	printRunRecords(readRunRecords(historyFile()), name, stats, "No runs recorded in "+historyFile()+". Runs with --exec are recorded unless GOSCRIPT_NO_RUN_LOG=1.")
+}
+
+// Prints the last of the runs of the named command, or of all commands if name is "all", or with stats the totals
+// for each command. Prints none if there are no such runs.
+func printRunRecords(records []runRecord, name string, stats bool, none string) {
+	if stats {
+		all := computeRunStats(records, name)
+		if len(all) == 0 {
+			fmt.Println(none)
+			return
+		}
+		r := &report{title: "Run statistics", columns: []string{"Command", "Runs", "Failed", "Avg time", "Max time", "Avg CPU", "Max CPU", "Max memory", "Last run"}}
+		for _, s := range all {
+			r.add(s.Command, strconv.Itoa(s.Runs), strconv.Itoa(s.Failures), formatRunTime(s.AvgDuration), formatRunTime(s.MaxDuration),
+				formatRunTime(s.AvgCPU), formatRunTime(s.MaxCPU), formatSize(s.MaxRSS), s.LastRun.Format("2006-01-02 15:04"))
+		}
+		r.notes = append(r.notes, "Times are wall clock and CPU (user and system) times; memory is peak resident memory.")
+		r.print()
+		return
+	}
+
+	shown := []runRecord{}
+	for _, record := range records {
+		if name == "all" || record.Command == name {
+			shown = append(shown, record)
+		}
+	}
+	if len(shown) == 0 {
+		fmt.Println(none)
+		return
+	}
+	total := len(shown)
+	shown = shown[max(0, total-defaultRunsShown):]
+	r := &report{title: "Runs", columns: []string{"Started", "Command", "Trigger", "Result", "Time", "CPU", "Memory", "Args"}}
+	for _, record := range shown {
+		args := []string{}
+		for _, arg := range record.Args {
+			if arg == "" || strings.ContainsAny(arg, " \t\n'\"\\$`|&;<>()*?[]#~") {
+				arg = shellQuote(arg)
+			}
+			args = append(args, arg)
+		}
+		r.add(record.Start.Format("2006-01-02 15:04:05"), record.Command, record.Trigger, record.result(),
+			formatRunTime(record.Duration), formatRunTime(record.CPU), formatSize(record.MaxRSS), strings.Join(args, " "))
+	}
+	if total > len(shown) {
+		r.notes = append(r.notes, fmt.Sprintf("Showing the last %d of %d runs. Add --stats for totals.", len(shown), total))
+	}
+	r.print()
+}
+
+// Serves the run statistics as JSON, to callers with the token in GOSCRIPT_API_TOKEN. A "command" query
+// parameter limits them to one command.
+func serveRunStats(w http.ResponseWriter, r *http.Request) {
+	expected := os.Getenv("GOSCRIPT_API_TOKEN")
+	given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if expected == "" {
+		http.NotFound(w, r)
+		return
+	}
+	if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(expected)) != 1 {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := r.URL.Query().Get("command")
+	if name == "" {
+		name = "all"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(computeRunStats(readRuns(), name))
+}
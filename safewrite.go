@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// go.mod, go.sum and imports.json are never written in place, so a goscript killed part way through a change
+// can't leave them truncated. imports.json is written to a temporary file, synced to disk and renamed over the
+// original. The go command writes go.mod and go.sum in place itself, so it is given copies to change instead
+// (with -modfile) and they are renamed over the originals once it has succeeded. Before each change, the
+// version being replaced is kept beside the file as go.mod.bak, go.sum.bak or imports.json.bak, and
+// --rollback-config puts the project back to those versions.
+
+// The files of a module directory that are backed up before they change.
+var configFiles = []string{"go.mod", "go.sum", "imports.json"}
+
+// Reports whether the content of a config file is complete enough to keep as a backup. A file truncated by a
+// crash must not replace a good backup.
+func validConfig(filename string, data []byte) bool {
+	switch filepath.Base(filename) {
+	case "go.mod":
+		return moduleMatcher.Match(data)
+	case "go.sum":
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			if line != "" && len(strings.Fields(line)) != 3 {
+				return false
+			}
+		}
+		return len(data) == 0 || strings.HasSuffix(string(data), "\n")
+	case "imports.json":
+		return json.Valid(data)
+	}
+	return true
+}
+
+// Writes data to a file by way of a temporary file in the same directory, synced before it is renamed over the
+// file, so the file has either its old content or the new, never part of it.
+func writeFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) //gone after the rename, unless something failed
+	_, err = tmp.Write(data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), perm)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// Keeps the current version of a config file as <file>.bak, unless it is missing or incomplete.
+func backupConfig(filename string) {
+	data, err := os.ReadFile(filename)
+	if err != nil || !validConfig(filename, data) {
+		return
+	}
+	check(writeFileAtomic(filename+".bak", data, 0644), 1, "Unable to back up "+filename)
+}
+
+// Replaces a config file, keeping the version it replaces as <file>.bak.
+func writeConfig(filename string, data []byte) error {
+	backupConfig(filename)
+	return writeFileAtomic(filename, data, 0644)
+}
+
+// Reports whether the arguments to the go command change go.mod and go.sum.
+func changesModule(args []string) bool {
+	if len(args) > 0 && args[0] == "get" {
+		return true
+	}
+	return len(args) > 1 && args[0] == "mod" && (args[1] == "tidy" || args[1] == "edit")
+}
+
+// Runs a go command that changes go.mod and go.sum in the module directory, such as go get or go mod tidy, on
+// copies of them that replace the originals only if it succeeds. Returns its combined output.
+func goModify(dir string, args ...string) ([]byte, error) {
+	if !changesModule(args) {
+		return goCommandIn(dir, args...).CombinedOutput()
+	}
+	modFilename, sumFilename := filepath.Join(dir, "go.mod"), filepath.Join(dir, "go.sum")
+	modData, err := os.ReadFile(modFilename)
+	if err != nil {
+		return nil, err
+	}
+	//The go command derives the name of the go.sum it writes from the go.mod it is given
+	tmpMod, tmpSum := filepath.Join(dir, ".goscript-edit.mod"), filepath.Join(dir, ".goscript-edit.sum")
+	defer os.Remove(tmpMod)
+	defer os.Remove(tmpSum)
+	if err := os.WriteFile(tmpMod, modData, 0644); err != nil {
+		return nil, err
+	}
+	if sumData, err := os.ReadFile(sumFilename); err == nil {
+		if err := os.WriteFile(tmpSum, sumData, 0644); err != nil {
+			return nil, err
+		}
+	}
+
+	if args[0] == "mod" && args[1] == "edit" {
+		args = append(args[:len(args):len(args)], tmpMod) //go mod edit takes the file to edit as an argument
+	} else {
+		at := 1
+		if args[0] == "mod" {
+			at = 2
+		}
+		args = append(append(append([]string{}, args[:at]...), "-modfile="+tmpMod), args[at:]...)
+	}
+	out, err := goCommandIn(dir, args...).CombinedOutput()
+	if err != nil {
+		return out, err
+	}
+
+	//go.sum first, so go.mod never requires a module whose checksum isn't there yet
+	for _, file := range [][2]string{{tmpSum, sumFilename}, {tmpMod, modFilename}} {
+		data, err := os.ReadFile(file[0])
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if current, readErr := os.ReadFile(file[1]); err == nil && readErr == nil && string(current) == string(data) {
+			continue //unchanged, so the backup of the last real change is kept
+		}
+		if err == nil {
+			err = writeConfig(file[1], data)
+		}
+		if err != nil {
+			return out, fmt.Errorf("unable to update %s: %v", file[1], err)
+		}
+	}
+	return out, nil
+}
+
+// Puts go.mod, go.sum and imports.json back to the versions they had before they were last changed (see
+// --rollback-config). The versions replaced are kept as the backups, so running it again undoes the rollback.
+func rollbackConfig() {
+	type rollback struct {
+		filename      string
+		current, prev []byte
+	}
+	rollbacks := []rollback{}
+	for _, file := range configFiles {
+		filename := filepath.Join(projectDir, file)
+		prev, err := os.ReadFile(filename + ".bak")
+		if err != nil {
+			continue
+		}
+		current, _ := os.ReadFile(filename)
+		if string(current) != string(prev) {
+			rollbacks = append(rollbacks, rollback{filename, current, prev})
+		}
+	}
+	if len(rollbacks) == 0 {
+		fmt.Println("Nothing to roll back: go.mod, go.sum and imports.json are the same as their backups, or have none.")
+		return
+	}
+	names := []string{}
+	for _, r := range rollbacks {
+		names = append(names, filepath.Base(r.filename))
+	}
+	if !confirm(fmt.Sprintf("This will restore %s from their .bak files.", strings.Join(names, ", "))) {
+		cancelled()
+	}
+	for _, r := range rollbacks {
+		if len(r.current) > 0 {
+			check(writeFileAtomic(r.filename+".bak", r.current, 0644), 2, "Unable to keep the current "+r.filename)
+		}
+		check(writeFileAtomic(r.filename, r.prev, 0644), 2, "Unable to restore "+r.filename)
+	}
+	fmt.Printf("Restored %s. Run --rollback-config again to undo.\n", strings.Join(names, ", "))
+}
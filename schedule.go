@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"time"
+)
+
+// --serve also runs the commands scheduled in the project config, so a machine that already runs goscript as a
+// service doesn't need cron or systemd timers as well:
+//
+//	"schedule": {"backup-db": "0 3 * * *", "sync-feeds": "*/5 * * * *"}
+//
+// A scheduled run holds the command's run lock (as with --exclusive), so a run that is still going when the
+// next one is due, or a run of the same command started with --exclusive from a terminal, makes the new run
+// skip rather than overlap. Only one --serve per project runs the schedules, the one holding the scheduler
+// lock. The output of each run is appended to .goscript/logs/<name>.log and the run is recorded in
+// .goscript/runs.jsonl (see runs.go), which --status reads to show the last and next run of each command.
+
+type scheduledCommand struct {
+	command  string
+	spec     string
+	schedule cronSchedule
+}
+
+func runLogFile(cmd string) string {
+	return stateDir() + "/logs/" + cmd + ".log"
+}
+
+func schedulerLockFile() string {
+	return stateDir() + "/run/scheduler.lock"
+}
+
+// Returns the schedules in the project config, sorted by command. Invalid schedules and schedules of commands
+// that don't exist are reported and left out.
+func loadSchedules() []scheduledCommand {
+	schedules := []scheduledCommand{}
+	for cmd, spec := range readProjectConfig().Schedule {
+		schedule, err := parseCron(spec)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: %s: %v\n", cmd, err)
+			continue
+		}
+		if !checkFileExists(sourceFile(cmd)) {
+			fmt.Fprintf(os.Stderr, "warning: %s is scheduled but there is no command with that name\n", cmd)
+			continue
+		}
+		schedules = append(schedules, scheduledCommand{command: cmd, spec: spec, schedule: schedule})
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].command < schedules[j].command })
+	return schedules
+}
+
+// Runs a scheduled command, unless it is already running, appending its output to its log file.
+func runScheduled(cmd string) {
+	start := time.Now()
+	release, err := lockRun(cmd, false)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s schedule %s skipped: %v\n", start.Format(time.RFC3339), cmd, err)
+		return
+	}
+	defer release()
+
+	record := runRecord{Command: cmd, Trigger: "schedule", Start: start, ExitCode: -1}
+	defer func() {
+		record.Duration = time.Since(start)
+		recordRun(record)
+		fmt.Fprintf(os.Stderr, "%s schedule %s %s %v\n", start.Format(time.RFC3339), cmd, record.result(), record.Duration.Round(time.Millisecond))
+	}()
+	if status, err := ensureBuilt(cmd); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		record.Error = "failed to compile"
+		if status == http.StatusServiceUnavailable {
+			record.Error = "skipped: " + err.Error()
+		}
+		return
+	}
+	if err := os.MkdirAll(stateDir()+"/logs", 0755); err != nil {
+		record.Error = err.Error()
+		return
+	}
+	log, err := os.OpenFile(runLogFile(cmd), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		record.Error = err.Error()
+		return
+	}
+	defer log.Close()
+	fmt.Fprintf(log, "==> %s (schedule)\n", start.Format(time.RFC3339))
+	run := exec.Command(hostBinaryPath(cmd))
+	run.Stdout = log
+	run.Stderr = log
+	if err := run.Run(); run.ProcessState == nil {
+		record.Error = err.Error()
+		fmt.Fprintf(log, "<== %v\n", err)
+		return
+	}
+	record.measure(run.ProcessState)
+	fmt.Fprintf(log, "<== exit %d after %v\n", record.ExitCode, time.Since(start).Round(time.Millisecond))
+}
+
+// Calls start with each schedule's command at each matching time, until stop is closed.
+func runSchedules(schedules []scheduledCommand, stop <-chan struct{}, start func(cmd string)) {
+	for _, s := range schedules {
+		go func(s scheduledCommand) {
+			for {
+				next := s.schedule.next(time.Now())
+				if next.IsZero() {
+					return
+				}
+				select {
+				case <-stop:
+					return
+				case <-time.After(time.Until(next)):
+					start(s.command)
+				}
+			}
+		}(s)
+	}
+}
+
+// Prints the schedules in the project config with the last and next run of each command.
+func printStatus() {
+	schedules := loadSchedules()
+	if len(schedules) == 0 {
+		fmt.Println("No commands are scheduled. Add them to the \"schedule\" section of " + projectConfigFile() + ", e.g. \"schedule\": {\"backup-db\": \"0 3 * * *\"}.")
+		return
+	}
+	last := map[string]runRecord{}
+	for _, record := range readRuns() {
+		if record.Trigger == "schedule" {
+			last[record.Command] = record
+		}
+	}
+	r := &report{title: "Schedule", columns: []string{"Command", "Schedule", "Last run", "Next run"}}
+	for _, s := range schedules {
+		lastRun := "last never"
+		if record, ok := last[s.command]; ok {
+			lastRun = fmt.Sprintf("last %s %s in %v", record.Start.Format("2006-01-02 15:04"), record.result(), record.Duration.Round(time.Second))
+		}
+		nextRun := "next never"
+		if next := s.schedule.next(time.Now()); !next.IsZero() {
+			nextRun = "next " + next.Format("2006-01-02 15:04")
+		}
+		r.add(s.command, s.spec, lastRun, nextRun)
+	}
+	if release, err := tryAcquireLock(schedulerLockFile(), 0, "the scheduler lock"); err == nil {
+		release()
+		r.notes = append(r.notes, "The scheduler is not running. Start it with 'goscript --serve <address>'.")
+	} else {
+		r.notes = append(r.notes, "The scheduler is running in goscript --serve"+lockHolder(schedulerLockFile())+".")
+	}
+	r.print()
+}
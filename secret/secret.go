@@ -0,0 +1,179 @@
+// Package secret reads the secrets of a goscript project, stored with 'goscript --secret set'. Code wrapped by
+// goscript calls it as goscript.Secret; other programs, such as --file scripts and directory commands, import it
+// under that name to read secrets the same way:
+//
+//	import goscript "github.com/fkmiec/goscript/secret"
+//
+//	func main() {
+//		token := goscript.Secret("API_TOKEN")
+//		...
+//	}
+//
+// The store is <project>/secrets.json, which maps each name to its value sealed with AES-256-GCM, with the name as
+// additional data so a value can't be moved to another name. The names are left readable, so the store can be
+// listed without the key, and it can be committed with the project. The key is kept outside the project, in the
+// user's config directory (e.g. ~/.config/goscript/secret.key), or given base64-encoded in GOSCRIPT_SECRET_KEY
+// (e.g. on a server running goscript --serve).
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// KeySize is the size of a key in bytes, for AES-256.
+const KeySize = 32
+
+// Secret returns the named secret of the project the program belongs to (see ProjectDir), or panics if it can't be
+// read, which goscript reports as a short error for wrapped code.
+func Secret(name string) string {
+	value, err := Lookup(name)
+	if err != nil {
+		panic(err)
+	}
+	return value
+}
+
+// Lookup returns the named secret of the project the program belongs to (see ProjectDir).
+func Lookup(name string) (string, error) {
+	dir, err := ProjectDir()
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %v", name, err)
+	}
+	filename := StoreFile(dir)
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("secret %s: no secret store (set GOSCRIPT_PROJECT_DIR to the project): %v", name, err)
+	}
+	secrets := map[string]string{}
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return "", fmt.Errorf("secret %s: invalid %s: %v", name, filename, err)
+	}
+	sealed, ok := secrets[name]
+	if !ok {
+		return "", fmt.Errorf("secret %s: not in %s", name, filename)
+	}
+	key, err := Key()
+	if err != nil {
+		return "", fmt.Errorf("secret %s: %v", name, err)
+	}
+	return Open(key, name, sealed)
+}
+
+// ProjectDir returns the directory of the project: GOSCRIPT_PROJECT_DIR if it is set, or else the project whose
+// bin directory the running program is in.
+func ProjectDir() (string, error) {
+	if dir := os.Getenv("GOSCRIPT_PROJECT_DIR"); dir != "" {
+		return dir, nil
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Dir(filepath.Dir(exe)), nil
+}
+
+// StoreFile returns the file the secrets of the project in dir are stored in.
+func StoreFile(dir string) string {
+	return filepath.Join(dir, "secrets.json")
+}
+
+// KeyFile returns the file the key is kept in when GOSCRIPT_SECRET_KEY isn't set.
+func KeyFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "goscript", "secret.key"), nil
+}
+
+// Key returns the key secrets are sealed with: GOSCRIPT_SECRET_KEY if it is set, or else the key in KeyFile.
+func Key() ([]byte, error) {
+	if encoded := os.Getenv("GOSCRIPT_SECRET_KEY"); encoded != "" {
+		key, err := DecodeKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid GOSCRIPT_SECRET_KEY: %v", err)
+		}
+		return key, nil
+	}
+	filename, err := KeyFile()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("no secret key: %v", err)
+	}
+	key, err := DecodeKey(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret key in %s: %v", filename, err)
+	}
+	return key, nil
+}
+
+// NewKey returns a random key, base64-encoded as it is kept in KeyFile and GOSCRIPT_SECRET_KEY.
+func NewKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// DecodeKey decodes a base64-encoded key. Surrounding white space is ignored.
+func DecodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("the key is %d bytes, not %d", len(key), KeySize)
+	}
+	return key, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Seal encrypts the value of the named secret, returning the nonce and ciphertext, base64-encoded, as they are
+// stored in secrets.json. The name is authenticated with the value, so it opens only under the same name.
+func Seal(key []byte, name, value string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, []byte(value), []byte(name))), nil
+}
+
+// Open decrypts a value sealed with Seal under the same name and key.
+func Open(key []byte, name, sealed string) (string, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", fmt.Errorf("secret %s is corrupt", name)
+	}
+	value, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("secret %s can't be decrypted with this key", name)
+	}
+	return string(value), nil
+}
@@ -0,0 +1,94 @@
+package secret
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testKey(t *testing.T) []byte {
+	encoded, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := DecodeKey(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestSealOpen(t *testing.T) {
+	key := testKey(t)
+	sealed, err := Seal(key, "API_KEY", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(sealed, "s3cret") {
+		t.Errorf("Seal left the value readable: %s", sealed)
+	}
+	if value, err := Open(key, "API_KEY", sealed); err != nil || value != "s3cret" {
+		t.Errorf("Open = %q, %v, want s3cret", value, err)
+	}
+	//A fresh nonce each time, so equal values don't give equal ciphertexts
+	if again, _ := Seal(key, "API_KEY", "s3cret"); again == sealed {
+		t.Error("Seal gave the same ciphertext twice")
+	}
+
+	//The name is authenticated with the value, so a value moved to another name doesn't open
+	if _, err := Open(key, "OTHER_KEY", sealed); err == nil {
+		t.Error("Open succeeded under another name")
+	}
+	if _, err := Open(testKey(t), "API_KEY", sealed); err == nil || !strings.Contains(err.Error(), "can't be decrypted") {
+		t.Errorf("Open with another key = %v, want a decryption error", err)
+	}
+	for _, corrupt := range []string{"not base64!", "", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := Open(key, "API_KEY", corrupt); err == nil || !strings.Contains(err.Error(), "corrupt") {
+			t.Errorf("Open(%q) = %v, want a corrupt error", corrupt, err)
+		}
+	}
+}
+
+func TestDecodeKey(t *testing.T) {
+	key := testKey(t)
+	encoded := base64.StdEncoding.EncodeToString(key)
+	if decoded, err := DecodeKey(" " + encoded + "\n"); err != nil || string(decoded) != string(key) {
+		t.Errorf("DecodeKey with white space = %v, %v", decoded, err)
+	}
+	for _, invalid := range []string{"", "not base64!", base64.StdEncoding.EncodeToString(make([]byte, 16))} {
+		if _, err := DecodeKey(invalid); err == nil {
+			t.Errorf("DecodeKey(%q) succeeded", invalid)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	dir := t.TempDir()
+	key := testKey(t)
+	sealed, err := Seal(key, "API_KEY", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "secrets.json"), []byte(`{"API_KEY": "`+sealed+`"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOSCRIPT_PROJECT_DIR", dir)
+	t.Setenv("GOSCRIPT_SECRET_KEY", base64.StdEncoding.EncodeToString(key))
+
+	if value := Secret("API_KEY"); value != "s3cret" {
+		t.Errorf("Secret = %q, want s3cret", value)
+	}
+	if _, err := Lookup("MISSING"); err == nil || !strings.Contains(err.Error(), "MISSING") {
+		t.Errorf("Lookup of a missing secret = %v", err)
+	}
+	t.Setenv("GOSCRIPT_SECRET_KEY", base64.StdEncoding.EncodeToString(testKey(t)))
+	if _, err := Lookup("API_KEY"); err == nil {
+		t.Error("Lookup succeeded with another key")
+	}
+	t.Setenv("GOSCRIPT_SECRET_KEY", "short")
+	if _, err := Lookup("API_KEY"); err == nil || !strings.Contains(err.Error(), "GOSCRIPT_SECRET_KEY") {
+		t.Errorf("Lookup with an invalid key = %v", err)
+	}
+}
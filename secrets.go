@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/fkmiec/goscript/secret"
+)
+
+// Scripts read credentials from the project's secret store with goscript.Secret("API_KEY") rather than having
+// them written into their source. goscript.Secret is the secret package (github.com/fkmiec/goscript/secret), which
+// wrapped code gets imported under that name and other programs import themselves; it documents the store. This
+// file is the --secret command that manages the store. The key is created by the first --secret set.
+
+// The import path of the package scripts read secrets with.
+const secretPackage = "github.com/fkmiec/goscript/secret"
+
+var secretNameMatcher = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+var secretCallMatcher = regexp.MustCompile(`\bgoscript\.Secret\(`)
+
+func secretsFile() string {
+	return secret.StoreFile(projectDir)
+}
+
+// Returns the file the secret key is kept in when GOSCRIPT_SECRET_KEY isn't set.
+func secretKeyFile() string {
+	filename, err := secret.KeyFile()
+	check(err, 2, "Unable to find the user config directory for the secret key. Set GOSCRIPT_SECRET_KEY instead.")
+	return filename
+}
+
+// Returns the key that seals the secrets. If there is none yet and create is true, a new one is generated and
+// saved, readable only by the user.
+func secretKey(create bool) []byte {
+	if os.Getenv("GOSCRIPT_SECRET_KEY") == "" {
+		filename := secretKeyFile()
+		if _, err := os.Stat(filename); errors.Is(err, os.ErrNotExist) && create {
+			encoded, err := secret.NewKey()
+			check(err, 2, "Unable to generate a secret key.")
+			check(os.MkdirAll(filepath.Dir(filename), 0700), 2, "")
+			check(writeFileAtomic(filename, []byte(encoded+"\n"), 0600), 2, "Unable to save the secret key.")
+			fmt.Fprintf(os.Stderr, "Created the secret key %s. Keep a copy of it: the secrets can't be read without it.\n", filename)
+		}
+	}
+	key, err := secret.Key()
+	check(err, 2, "Set GOSCRIPT_SECRET_KEY, or copy the key of the machine that stored the secrets to "+secretKeyFile()+".")
+	return key
+}
+
+// Returns the sealed secrets in the store, keyed by name.
+func readSecrets() map[string]string {
+	secrets := map[string]string{}
+	data, err := os.ReadFile(secretsFile())
+	if errors.Is(err, os.ErrNotExist) {
+		return secrets
+	}
+	check(err, 2, "")
+	check(json.Unmarshal(data, &secrets), 2, "Invalid "+secretsFile())
+	return secrets
+}
+
+func writeSecrets(secrets map[string]string) {
+	data, err := json.MarshalIndent(secrets, "", "    ")
+	check(err, 2, "")
+	check(writeFileAtomic(secretsFile(), append(data, '\n'), 0600), 2, "Unable to write "+secretsFile())
+}
+
+// Reads the value of a secret from stdin, without echoing it if stdin is a terminal.
+func readSecretValue(name string) string {
+	if isTerminal(os.Stdin) {
+		fmt.Fprintf(os.Stderr, "Value of %s: ", name)
+		stty := func(arg string) {
+			cmd := exec.Command("stty", arg)
+			cmd.Stdin = os.Stdin
+			cmd.Run() //no stty (e.g. on Windows) only means the value is echoed
+		}
+		stty("-echo")
+		defer fmt.Fprintln(os.Stderr)
+		defer stty("echo")
+	}
+	value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && value == "" {
+		check(errors.New("no value given on stdin"), 2, "")
+	}
+	return strings.TrimRight(value, "\r\n")
+}
+
+// Runs --secret set, get, list or delete with the names in args.
+func secretCommand(action string, args []string) {
+	if action != "list" && len(args) != 1 {
+		check(fmt.Errorf("--secret %s takes the name of a secret, e.g. goscript --secret %s API_KEY", action, action), 2, "")
+	}
+	switch action {
+	case "set":
+		name := args[0]
+		if !secretNameMatcher.MatchString(name) {
+			check(fmt.Errorf("invalid secret name %q: use letters, digits, '_', '.' and '-'", name), 2, "")
+		}
+		value := readSecretValue(name)
+		defer lockProject()()
+		secrets := readSecrets()
+		sealed, err := secret.Seal(secretKey(true), name, value)
+		check(err, 2, "")
+		secrets[name] = sealed
+		writeSecrets(secrets)
+		fmt.Printf("Stored secret %s.\n", name)
+	case "get":
+		sealed, ok := readSecrets()[args[0]]
+		if !ok {
+			check(fmt.Errorf("there is no secret named %s", args[0]), 2, "")
+		}
+		value, err := secret.Open(secretKey(false), args[0], sealed)
+		check(err, 2, "")
+		fmt.Println(value)
+	case "list":
+		names := []string{}
+		for name := range readSecrets() {
+			names = append(names, name)
+		}
+		if len(names) == 0 {
+			fmt.Println("No secrets are stored. Add one with 'goscript --secret set <name>'.")
+			return
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	case "delete":
+		//Asked before the project is locked, so other goscripts aren't kept waiting on the answer
+		if _, ok := readSecrets()[args[0]]; !ok {
+			check(fmt.Errorf("there is no secret named %s", args[0]), 2, "")
+		}
+		if !confirm(fmt.Sprintf("This will delete the secret %s.", args[0])) {
+			cancelled()
+		}
+		defer lockProject()()
+		secrets := readSecrets()
+		if _, ok := secrets[args[0]]; !ok {
+			check(fmt.Errorf("there is no secret named %s", args[0]), 2, "")
+		}
+		delete(secrets, args[0])
+		writeSecrets(secrets)
+		fmt.Printf("Deleted secret %s.\n", args[0])
+	default:
+		check(fmt.Errorf("unknown --secret action %q: use set, get, list or delete", action), 2, "")
+	}
+}
+
+// Reports whether the code reads secrets with goscript.Secret and doesn't declare its own goscript, so goscript is
+// the secret package.
+func usesSecrets(code string) bool {
+	return secretCallMatcher.MatchString(code) && !regexp.MustCompile(`\bgoscript\s*:?=`).MatchString(code)
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fkmiec/goscript/engine"
+)
+
+// --export-selfrun <name> writes a command to the current directory as one executable that carries its
+// provenance: the command is built with a file added (by way of an overlay, so the project is left as it is)
+// holding its source files, the go.mod and go.sum it was built with and metadata about the build. goscript then
+// appends the SHA-256 of the executable to it. Every time it starts, the executable checks itself against that
+// checksum and refuses to run if it has been changed. Run with --source as its only argument, it writes its
+// source to <name>-source/ in the current directory, ready for go build, and with --metadata it prints the
+// metadata as JSON.
+
+// Appended to the executable, followed by the hex SHA-256 of everything before it and a newline.
+const selfrunTrailer = "\ngoscript-selfrun sha256 "
+
+// What a self-contained executable records about its build.
+type selfrunMetadata struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Version     string            `json:"version"` //as for --package
+	Built       time.Time         `json:"built"`
+	Platform    string            `json:"platform"`
+	Goscript    string            `json:"goscript"`
+	Module      string            `json:"module"`
+	Requires    []string          `json:"requires,omitempty"` //module@version, from go.mod
+	Sources     map[string]string `json:"sources"`            //the SHA-256 of each file written by --source
+}
+
+// Builds a command as a self-contained executable in the current directory (see --export-selfrun).
+func exportSelfrun(name string) {
+	srcFilename := sourceFile(name)
+	if !checkFileExists(srcFilename) {
+		check(fmt.Errorf("there is no command named %s", name), 2, "")
+	}
+	goos, goarch := buildPlatform()
+	exportName := exeName(name, goos)
+	if checkFileExists(exportName) && !confirm(fmt.Sprintf("The existing file ./%s will be overwritten.", exportName)) {
+		cancelled()
+	}
+	//Exported binaries should be traceable to verified module content
+	if !verifyModules() {
+		check(errors.New("module verification failed"), 2, "The executable was not exported.")
+	}
+
+	meta := engine.ReadMetadata(srcFilename)
+	modDir := moduleDir(srcFilename)
+	ensureDeps(modDir, meta.Deps)
+	sources := map[string]string{}
+	for _, filename := range commandFiles(srcFilename) {
+		data, err := os.ReadFile(filename)
+		check(err, 2, "")
+		sources[filepath.Base(filename)] = string(data)
+	}
+	for _, file := range []string{"go.mod", "go.sum"} {
+		if data, err := os.ReadFile(filepath.Join(modDir, file)); err == nil {
+			sources[file] = string(data)
+		}
+	}
+	stamp := packageVersion(name, meta)
+	metadata := selfrunMetadata{Name: name, Description: describeScripts([]string{srcFilename})[srcFilename], Version: stamp,
+		Built: time.Now().UTC().Truncate(time.Second), Platform: goos + "/" + goarch, Goscript: strings.TrimPrefix(version, "goscript "),
+		Module: moduleName(), Sources: map[string]string{}}
+	for _, req := range goModJSON(modDir).Require {
+		metadata.Requires = append(metadata.Requires, req.Path+"@"+req.Version)
+	}
+	for file, text := range sources {
+		metadata.Sources[file] = hashBytes([]byte(text))
+	}
+
+	//The file is added to the command's package, beside its source
+	dir, err := os.MkdirTemp("", "goscript-selfrun-*")
+	check(err, 2, "")
+	defer os.RemoveAll(dir)
+	absSrcFilename, err := filepath.Abs(srcFilename)
+	check(err, 2, "")
+	added := filepath.Join(filepath.Dir(absSrcFilename), "goscript_selfrun.go")
+	check(os.WriteFile(dir+"/selfrun.go", selfrunSource(metadata, sources), 0644), 2, "")
+	overlay, err := json.Marshal(map[string]any{"Replace": map[string]string{added: dir + "/selfrun.go"}})
+	check(err, 2, "")
+	check(os.WriteFile(dir+"/overlay.json", overlay, 0644), 2, "")
+
+	absExportName, err := filepath.Abs(exportName)
+	check(err, 2, "")
+	ldflags, tags, other := stampedBuildFlags(meta, stamp)
+	args := append([]string{"build", "-overlay=" + dir + "/overlay.json", "-ldflags=" + ldflags}, other...)
+	if len(tags) > 0 {
+		args = append(args, "-tags="+strings.Join(tags, ","))
+	}
+	args = append(args, "-o", absExportName)
+	if target := buildTarget(absSrcFilename); target == absSrcFilename {
+		args = append(args, absSrcFilename, added)
+	} else {
+		args = append(args, target)
+	}
+	cmd := goEngine().GoCommand(modDir, args...)
+	if env := crossEnv(); env != nil {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(cmd.Env, env...)
+	}
+	out, err := cmd.CombinedOutput()
+	check(err, 2, fmt.Sprintf("Unable to build %s: %s", name, out))
+
+	//The checksum covers everything before it, so any change to the executable is caught
+	data, err := os.ReadFile(exportName)
+	check(err, 2, "")
+	data = append(data, selfrunTrailer+hashBytes(data)+"\n"...)
+	check(writeFileAtomic(exportName, data, 0755), 2, "")
+	fmt.Printf("Exported %s (%s, %s) with its source. Run './%s --source' to extract it, or './%s --metadata' to see how it was built.\n",
+		exportName, metadata.Platform, formatSize(int64(len(data))), exportName, exportName)
+}
+
+// Returns the file added to a self-contained executable's package. Its names are prefixed with goscriptSelfrun,
+// and the packages it imports are renamed the same way, so they can't clash with the command's own.
+func selfrunSource(metadata selfrunMetadata, sources map[string]string) []byte {
+	data, err := json.MarshalIndent(metadata, "", "    ")
+	check(err, 2, "")
+	files := []string{}
+	for file := range sources {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	var b strings.Builder
+	b.WriteString(selfrunHelperHeader)
+	fmt.Fprintf(&b, "const goscriptSelfrunName = %q\n\n", metadata.Name)
+	fmt.Fprintf(&b, "const goscriptSelfrunTrailer = %q\n\n", selfrunTrailer)
+	fmt.Fprintf(&b, "const goscriptSelfrunMetadata = %q\n\n", string(data))
+	b.WriteString("var goscriptSelfrunSources = map[string]string{\n")
+	for _, file := range files {
+		fmt.Fprintf(&b, "\t%q: %q,\n", file, sources[file])
+	}
+	b.WriteString("}\n")
+	b.WriteString(selfrunHelper)
+	return []byte(b.String())
+}
+
+const selfrunHelperHeader = `// Added by goscript --export-selfrun: the command's source and build metadata, and a check of the executable
+// against the checksum goscript appended to it.
+
+package main
+
+import (
+	goscriptSelfrunBytes "bytes"
+	goscriptSelfrunSHA256 "crypto/sha256"
+	goscriptSelfrunHex "encoding/hex"
+	goscriptSelfrunFmt "fmt"
+	goscriptSelfrunOS "os"
+	goscriptSelfrunFilepath "path/filepath"
+	goscriptSelfrunRuntime "runtime"
+	goscriptSelfrunStrings "strings"
+)
+
+`
+
+const selfrunHelper = `
+func init() {
+	fail := func(format string, args ...any) {
+		goscriptSelfrunFmt.Fprintf(goscriptSelfrunOS.Stderr, format+"\n", args...)
+		goscriptSelfrunOS.Exit(1)
+	}
+	exe, err := goscriptSelfrunOS.Executable()
+	if err != nil {
+		fail("unable to verify the executable: %v", err)
+	}
+	data, err := goscriptSelfrunOS.ReadFile(exe)
+	if err != nil {
+		fail("unable to verify the executable: %v", err)
+	}
+	i := goscriptSelfrunBytes.LastIndex(data, []byte(goscriptSelfrunTrailer))
+	if i < 0 || len(data) != i+len(goscriptSelfrunTrailer)+64+1 {
+		fail("%s has no checksum: it has been changed since it was exported", exe)
+	}
+	sum := goscriptSelfrunSHA256.Sum256(data[:i])
+	checksum := string(data[i+len(goscriptSelfrunTrailer) : len(data)-1])
+	if goscriptSelfrunHex.EncodeToString(sum[:]) != checksum {
+		fail("%s does not match its checksum: it has been changed since it was exported", exe)
+	}
+	if len(goscriptSelfrunOS.Args) != 2 {
+		return
+	}
+	switch goscriptSelfrunOS.Args[1] {
+	case "--metadata":
+		metadata := goscriptSelfrunStrings.TrimSuffix(goscriptSelfrunMetadata, "\n}")
+		goscriptSelfrunFmt.Printf("%s,\n    \"go\": %q,\n    \"sha256\": %q\n}\n", metadata, goscriptSelfrunRuntime.Version(), checksum)
+		goscriptSelfrunOS.Exit(0)
+	case "--source":
+		dir := goscriptSelfrunName + "-source"
+		if _, err := goscriptSelfrunOS.Stat(dir); err == nil {
+			fail("%s exists already", dir)
+		}
+		if err := goscriptSelfrunOS.Mkdir(dir, 0755); err != nil {
+			fail("%v", err)
+		}
+		for file, text := range goscriptSelfrunSources {
+			if err := goscriptSelfrunOS.WriteFile(goscriptSelfrunFilepath.Join(dir, file), []byte(text), 0644); err != nil {
+				fail("%v", err)
+			}
+		}
+		goscriptSelfrunFmt.Printf("Wrote the source to %s. Build it there with 'go build'.\n", dir)
+		goscriptSelfrunOS.Exit(0)
+	}
+}
+`
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fkmiec/goscript/engine"
+)
+
+// --serve exposes commands over HTTP so that CI jobs and chat-ops bots can trigger them. Only commands that
+// declare a route in their frontmatter are reachable, and only through that route:
+//
+//	//---
+//	// flag: env string default=staging Environment to deploy to
+//	// route: POST /hooks/deploy token=env:DEPLOY_TOKEN timeout=5m
+//	//---
+//
+// Callers pass the token in an "Authorization: Bearer <token>" header. Query parameters and the fields of a JSON
+// or form body become flags of the command (e.g. ?env=prod runs it with -env=prod); a parameter the command
+// doesn't declare with a 'flag:' line is rejected. The response is the command's combined output, with the exit
+// status in the X-Goscript-Exit-Status header. Clients with their own tokens or certificates and allow lists
+// can be configured as well (see auth.go). The commands scheduled in the project config are run too (see
+// schedule.go), and each run is recorded (see runs.go).
+
+const defaultRouteTimeout = 10 * time.Minute
+
+type route struct {
+	command string
+	spec    RouteSpec
+	flags   map[string]bool
+}
+
+// Returns the routes declared by the commands in the project, keyed by method and path (e.g. "POST /hooks/deploy").
+// A route must have a token, or be declared open, unless clients are configured to call it.
+func loadRoutes(hasClients bool) map[string]route {
+	routes := map[string]route{}
+	for _, filename := range getSourceList() {
+		cmd, ok := strings.CutSuffix(filename, ".go")
+		if !ok {
+			continue
+		}
+		meta := engine.ReadMetadata(sourcePath(filename))
+		for _, spec := range meta.Routes {
+			key := spec.Method + " " + spec.Path
+			if existing, ok := routes[key]; ok {
+				fmt.Fprintf(os.Stderr, "warning: %s is declared by both %s and %s; using %s\n", key, existing.command, cmd, existing.command)
+				continue
+			}
+			if !spec.Open && spec.TokenEnv == "" && !hasClients {
+				fmt.Fprintf(os.Stderr, "warning: %s (%s) has no token; add token=env:<VAR> or token=none\n", key, cmd)
+				continue
+			}
+			flags := map[string]bool{}
+			for _, flag := range meta.Flags {
+				flags[flag.Name] = true
+			}
+			routes[key] = route{command: cmd, spec: spec, flags: flags}
+		}
+	}
+	return routes
+}
+
+// Returns the request parameters: the query string, plus the fields of a JSON object or form body.
+func requestParams(r *http.Request) (map[string]string, error) {
+	params := map[string]string{}
+	for key, values := range r.URL.Query() {
+		params[key] = values[len(values)-1]
+	}
+	if r.Body == nil || r.ContentLength == 0 {
+		return params, nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		fields := map[string]any{}
+		if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20)).Decode(&fields); err != nil {
+			return nil, fmt.Errorf("invalid JSON body: %v", err)
+		}
+		for key, value := range fields {
+			switch value := value.(type) {
+			case string:
+				params[key] = value
+			case float64, bool:
+				params[key] = fmt.Sprint(value)
+			default:
+				return nil, fmt.Errorf("parameter %s must be a string, number or boolean", key)
+			}
+		}
+	case "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+		for key, values := range r.PostForm {
+			params[key] = values[len(values)-1]
+		}
+	}
+	return params, nil
+}
+
+// How long a build for a request waits for another goscript to release the project lock.
+const buildLockTimeout = 30 * time.Second
+
+// Serializes the builds of the server's own requests, which would otherwise wait for each other's project lock.
+var buildMu sync.Mutex
+
+// Compiles the command if its binary is missing or older than its source. A server must keep running whatever
+// goes wrong, so unlike compileBinary, this never exits: it returns the error, with the HTTP status to answer
+// it with. That is 503 if another goscript holds the project lock for too long, and 500 if the build fails.
+// Missing dependencies are reported rather than fetched, since a request shouldn't change go.mod.
+func ensureBuilt(cmd string) (int, error) {
+	srcFilename := sourceFile(cmd)
+	binFilename := hostBinaryPath(cmd)
+	if binaryUpToDate(srcFilename, binFilename) {
+		return http.StatusOK, nil
+	}
+	buildMu.Lock()
+	defer buildMu.Unlock()
+	unlock, err := tryAcquireLock(projectLockFile(), buildLockTimeout, "the project lock")
+	if err != nil {
+		return http.StatusServiceUnavailable, err
+	}
+	defer unlock()
+	//Built while this waited, by another request or another goscript
+	if binaryUpToDate(srcFilename, binFilename) {
+		return http.StatusOK, nil
+	}
+	e, err := tryGoEngine()
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("%v\n%s", err, goMissingMessage)
+	}
+	err = buildBinary(e, srcFilename, binFilename, nil)
+	savedErrors.flush()
+	if err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("unable to build %s: %w", cmd, err)
+	}
+	return http.StatusOK, nil
+}
+
+// Runs the route's command for an authorized request and writes its output. Returns the flags it was run
+// with, or nil if the request was rejected before that.
+func (rt route) run(w http.ResponseWriter, r *http.Request) []string {
+	params, err := requestParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	args := []string{}
+	for key, value := range params {
+		if !rt.flags[key] {
+			http.Error(w, fmt.Sprintf("unknown parameter %q", key), http.StatusBadRequest)
+			return nil
+		}
+		args = append(args, "-"+key+"="+value)
+	}
+	sort.Strings(args)
+
+	if status, err := ensureBuilt(rt.command); err != nil {
+		//The details are for the server's log, not for callers
+		fmt.Fprintln(os.Stderr, err)
+		if status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", "30")
+			http.Error(w, "the command is being rebuilt; try again later", status)
+		} else {
+			http.Error(w, "the command failed to compile", status)
+		}
+		return args
+	}
+	timeout := rt.spec.Timeout
+	if timeout == 0 {
+		timeout = defaultRouteTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, hostBinaryPath(rt.command), args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	record := runRecord{Command: rt.command, Trigger: rt.spec.Method + " " + rt.spec.Path, Start: time.Now(), ExitCode: -1}
+	err = cmd.Run()
+	record.Duration = time.Since(record.Start)
+	if cmd.ProcessState == nil {
+		record.Error = err.Error()
+		recordRun(record)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return args
+	}
+	record.measure(cmd.ProcessState)
+
+	exitCode := cmd.ProcessState.ExitCode()
+	status := http.StatusOK
+	if ctx.Err() == context.DeadlineExceeded {
+		status = http.StatusGatewayTimeout
+		record.Error = "timed out"
+	} else if exitCode != 0 {
+		status = http.StatusInternalServerError
+	}
+	recordRun(record)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("X-Goscript-Exit-Status", fmt.Sprint(exitCode))
+	w.WriteHeader(status)
+	w.Write(out.Bytes())
+	return args
+}
+
+// How long --serve waits for runs in progress to finish when it is asked to stop.
+const drainTimeout = 10 * time.Minute
+
+// A running --serve. The routes and schedules are replaced when it is sent SIGHUP.
+type server struct {
+	mu               sync.RWMutex
+	routes           map[string]route
+	clients          map[string]serveClient
+	schedules        []scheduledCommand
+	stopSchedules    chan struct{}
+	releaseScheduler func()         //set while this server holds the scheduler lock
+	scheduled        sync.WaitGroup //scheduled runs in progress
+	active           atomic.Int64   //route and scheduled runs in progress
+	stopping         bool           //no more scheduled runs are started
+	started          time.Time
+}
+
+// Loads the routes and schedules from the project, replacing any loaded before. Schedules that were running
+// stop, but runs in progress are left to finish. The scheduler lock is released once no schedule is left.
+func (s *server) load() {
+	clients := checkClients(readProjectConfig().Serve)
+	routes := loadRoutes(len(clients) > 0)
+	schedules := loadSchedules()
+	keys := []string{}
+	for key := range routes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(os.Stderr, "  %s -> %s\n", key, routes[key].command)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.routes = routes
+	s.clients = clients
+	if s.stopSchedules != nil {
+		close(s.stopSchedules)
+		s.stopSchedules = nil
+	}
+	s.schedules = nil
+	//With no schedules left, another --serve of the project may take the lock for schedules of its own
+	if len(schedules) == 0 && s.releaseScheduler != nil {
+		s.releaseScheduler()
+		s.releaseScheduler = nil
+	}
+	if len(schedules) > 0 && s.releaseScheduler == nil {
+		release, err := tryAcquireLock(schedulerLockFile(), 0, "the scheduler lock")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: not running the schedules: %v\n", err)
+			return
+		}
+		s.releaseScheduler = release
+	}
+	if len(schedules) > 0 {
+		for _, schedule := range schedules {
+			fmt.Fprintf(os.Stderr, "  %s -> %s\n", schedule.spec, schedule.command)
+		}
+		s.schedules = schedules
+		s.stopSchedules = make(chan struct{})
+		runSchedules(schedules, s.stopSchedules, s.startScheduled)
+	}
+}
+
+// Starts a scheduled run in the background, unless the server is stopping.
+func (s *server) startScheduled(cmd string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.stopping {
+		return
+	}
+	s.scheduled.Add(1)
+	s.active.Add(1)
+	go func() {
+		defer s.scheduled.Done()
+		defer s.active.Add(-1)
+		runScheduled(cmd)
+	}()
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	s.mu.RLock()
+	rt, ok := s.routes[r.Method+" "+r.URL.Path]
+	clients := s.clients
+	s.mu.RUnlock()
+	switch {
+	case r.URL.Path == "/healthz":
+		s.serveHealth(rec, r)
+	case ok:
+		s.callRoute(rec, r, rt, clients)
+	case r.URL.Path == "/_goscript/stats":
+		serveRunStats(rec, r)
+	default:
+		http.NotFound(rec, r)
+	}
+	if r.URL.Path != "/healthz" { //health checks would drown out the rest of the log
+		fmt.Fprintf(os.Stderr, "%s %s %s %d %v\n", start.Format(time.RFC3339), r.Method, r.URL.Path, rec.status, time.Since(start).Round(time.Millisecond))
+	}
+}
+
+// Runs a route's command if the caller may, recording the call in the audit log either way.
+func (s *server) callRoute(w *statusRecorder, r *http.Request, rt route, clients map[string]serveClient) {
+	who, status, denied := authorizeRoute(r, rt, clients)
+	entry := auditEntry{Time: time.Now(), Client: who, Remote: r.RemoteAddr, Route: rt.spec.Method + " " + rt.spec.Path, Command: rt.command}
+	if denied != "" {
+		http.Error(w, http.StatusText(status), status)
+		entry.Denied = denied
+	} else {
+		s.active.Add(1)
+		entry.Args = rt.run(w, r)
+		s.active.Add(-1)
+		entry.ExitCode = w.Header().Get("X-Goscript-Exit-Status")
+	}
+	entry.Status = w.status
+	recordAudit(entry)
+}
+
+// Reports that the server is up, for load balancers and reverse proxies. No token is needed.
+func (s *server) serveHealth(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	health := map[string]any{
+		"status":    "ok",
+		"routes":    len(s.routes),
+		"schedules": len(s.schedules),
+		"running":   s.active.Load(),
+		"uptime":    time.Since(s.started).Round(time.Second).String(),
+	}
+	s.mu.RUnlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(health)
+}
+
+// Serves the routes declared by the project's commands on the given address (e.g. ":8080"), and runs the
+// scheduled commands. SIGHUP reloads the routes and schedules. SIGINT or SIGTERM stops the server: it stops
+// accepting requests and starting scheduled runs, and waits up to drainTimeout for the runs in progress to
+// finish. A second signal stops it at once.
+func serve(addr string) {
+	s := &server{started: time.Now()}
+	s.load()
+	if len(s.routes) == 0 && len(s.schedules) == 0 {
+		check(fmt.Errorf("no command declares a route or is scheduled"), 2, "Add a 'route:' line to a command's frontmatter, e.g. '// route: POST /hooks/deploy token=env:DEPLOY_TOKEN', or a schedule to "+projectConfigFile()+".")
+	}
+
+	httpServer := &http.Server{Addr: addr, Handler: s, TLSConfig: serveTLSConfig(readProjectConfig().Serve)}
+	stopped := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		for sig := range signals {
+			if sig == syscall.SIGHUP {
+				fmt.Fprintf(os.Stderr, "Reloading routes and schedules\n")
+				s.load()
+				continue
+			}
+			break
+		}
+		go func() {
+			<-signals
+			fmt.Fprintf(os.Stderr, "Stopping now\n")
+			exitProgram(1)
+		}()
+		if running := s.active.Load(); running > 0 {
+			fmt.Fprintf(os.Stderr, "Waiting for %d run(s) to finish. Interrupt again to stop now.\n", running)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+		defer cancel()
+		s.mu.Lock()
+		s.stopping = true
+		if s.stopSchedules != nil {
+			close(s.stopSchedules)
+			s.stopSchedules = nil
+		}
+		s.mu.Unlock()
+		httpServer.Shutdown(ctx) //waits for the route runs in progress
+		done := make(chan struct{})
+		go func() {
+			s.scheduled.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			fmt.Fprintf(os.Stderr, "warning: stopped with runs still in progress after %v\n", drainTimeout)
+		}
+		close(stopped)
+	}()
+
+	scheme := "http"
+	if httpServer.TLSConfig != nil {
+		scheme = "https"
+	}
+	s.mu.RLock()
+	fmt.Fprintf(os.Stderr, "Serving %d route(s) on %s (%s)\n", len(s.routes), addr, scheme)
+	if len(s.schedules) > 0 {
+		fmt.Fprintf(os.Stderr, "Running %d schedule(s)\n", len(s.schedules))
+	}
+	s.mu.RUnlock()
+	var err error
+	if httpServer.TLSConfig != nil {
+		err = httpServer.ListenAndServeTLS("", "") //the certificate is in the TLS config
+	} else {
+		err = httpServer.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		check(err, 2, "")
+	}
+	<-stopped
+	if s.releaseScheduler != nil {
+		s.releaseScheduler()
+	}
+}
+
+// Records the status code of a response for the request log.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fkmiec/goscript/engine"
+)
+
+// Defaults for the project are kept in the "defaults" section of <project>/config.json, so they don't have to be
+// exported in every shell that uses the project:
+//
+//	"defaults": {
+//	    "editor": "code --wait",
+//	    "build_flags": "-trimpath -ldflags=-s",
+//	    "template": "cli",
+//	    "cache_max_age": "168h",
+//	    "cache_max_size": "500MB",
+//	    "temp_max_age": "1h",
+//	    "os": "linux",
+//	    "arch": "arm64",
+//	    "verbose": true
+//	}
+//
+// Each can be overridden by an environment variable, GOSCRIPT_<NAME> (e.g. GOSCRIPT_BUILD_FLAGS), and the
+// environment variables by the options that set the same thing, such as --template, --os and --verbose.
+
+type defaultsConfig struct {
+	Editor       string `json:"editor"`         //for --edit, after GOSCRIPT_EDITOR and before EDITOR
+	BuildFlags   string `json:"build_flags"`    //go build flags for every build, before a script's own
+	Template     string `json:"template"`       //for code whose frontmatter names none
+	CacheMaxAge  string `json:"cache_max_age"`  //how long an unused cached binary is kept
+	CacheMaxSize string `json:"cache_max_size"` //the size the build cache is pruned to, e.g. 500MB
+	TempMaxAge   string `json:"temp_max_age"`   //how long files left by interrupted runs are kept
+	OS           string `json:"os"`             //the platform to build for
+	Arch         string `json:"arch"`
+	Verbose      *bool  `json:"verbose"` //print the go commands goscript runs
+}
+
+// Set by --verbose.
+var verbose bool
+
+// Set by --ldflags, --tags, --race and --trimpath.
+var ldflagsOption, tagsOption string
+var raceOption, trimpathOption bool
+
+var loadedDefaults *defaultsConfig
+
+// Returns the defaults section of the project config, read once.
+func projectDefaults() defaultsConfig {
+	if loadedDefaults == nil {
+		defaults := readProjectConfig().Defaults
+		loadedDefaults = &defaults
+	}
+	return *loadedDefaults
+}
+
+// Returns a setting: the GOSCRIPT_<NAME> environment variable if it is set, otherwise the configured value.
+func setting(name, configured string) string {
+	if value, ok := os.LookupEnv("GOSCRIPT_" + name); ok {
+		return value
+	}
+	return configured
+}
+
+// Returns a duration setting (see setting), or def if it is unset or invalid.
+func durationSetting(name, configured string, def time.Duration) time.Duration {
+	value := setting(name, configured)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "warning: ignoring %s %q: %v\n", strings.ToLower(name), value, err)
+		return def
+	}
+	return d
+}
+
+// Parses a size such as 500MB, 2GB or 1048576.
+func parseSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		bytes  int64
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"B", 1}} {
+		if number, ok := strings.CutSuffix(value, unit.suffix); ok {
+			value, multiplier = strings.TrimSpace(number), unit.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return n * multiplier, nil
+}
+
+// Applies the configured platform and verbosity where the options didn't set them. Called once the project is known.
+func applyDefaults() {
+	defaults := projectDefaults()
+	if targetOS == "" {
+		targetOS = setting("OS", defaults.OS)
+	}
+	if targetArch == "" {
+		targetArch = setting("ARCH", defaults.Arch)
+	}
+	if !verbose {
+		configured := ""
+		if defaults.Verbose != nil {
+			configured = strconv.FormatBool(*defaults.Verbose)
+		}
+		value := setting("VERBOSE", configured)
+		verbose = value != "" && value != "0" && value != "false"
+	}
+}
+
+// Returns the build flags for every build of the project.
+func defaultBuildFlags() []string {
+	return strings.Fields(setting("BUILD_FLAGS", projectDefaults().BuildFlags))
+}
+
+// Returns the build flags for every build in this run: the project's, and those of the options, which are merged
+// with them and with the flags in a script's frontmatter (see engine.MergeBuildFlags).
+func buildFlags() []string {
+	flags := defaultBuildFlags()
+	if ldflagsOption != "" {
+		flags = append(flags, "-ldflags="+ldflagsOption)
+	}
+	if tagsOption != "" {
+		flags = append(flags, "-tags="+tagsOption)
+	}
+	if raceOption {
+		flags = append(flags, "-race")
+	}
+	if trimpathOption {
+		flags = append(flags, "-trimpath")
+	}
+	return flags
+}
+
+// Returns the template for code whose frontmatter names none.
+func defaultTemplate() string {
+	return setting("TEMPLATE", projectDefaults().Template)
+}
+
+// Returns the editor for --edit: GOSCRIPT_EDITOR, the configured editor or EDITOR, split into the program and its
+// arguments.
+func defaultEditor() []string {
+	editor := setting("EDITOR", projectDefaults().Editor)
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	return strings.Fields(editor)
+}
+
+// Returns how long an unused binary is kept in the build cache, and the size the cache is pruned to (0 for no limit).
+func buildCacheLimits() (time.Duration, int64) {
+	defaults := projectDefaults()
+	maxAge := durationSetting("CACHE_MAX_AGE", defaults.CacheMaxAge, buildCacheMaxAge)
+	var maxSize int64
+	if value := setting("CACHE_MAX_SIZE", defaults.CacheMaxSize); value != "" {
+		size, err := parseSize(value)
+		if check(err, 1, "Ignoring cache_max_size.") {
+			size = 0
+		}
+		maxSize = size
+	}
+	return maxAge, maxSize
+}
+
+// Returns how long the files left behind by interrupted runs of unnamed code are kept.
+func tempMaxAge() time.Duration {
+	return durationSetting("TEMP_MAX_AGE", projectDefaults().TempMaxAge, 24*time.Hour)
+}
+
+// Adds the defaults that apply to go commands to an engine.
+func configureEngine(e *engine.Engine) *engine.Engine {
+	e.BuildFlags = buildFlags()
+	if verbose {
+		e.Trace = os.Stderr
+	}
+	return e
+}
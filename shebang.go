@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Returns the portable shebang line for scripts run by this goscript executable.
+// The bare command name is used when the goscript found on the PATH is this executable,
+// so the script keeps working if goscript is reinstalled elsewhere.
+func shebangLine() string {
+	return "#!/usr/bin/env -S " + goscriptCommand()
+}
+
+func goscriptCommand() string {
+	self, err := os.Executable()
+	if err != nil {
+		return filepath.Base(os.Args[0])
+	}
+	name := filepath.Base(self)
+	onPath, err := exec.LookPath(name)
+	if err == nil && sameFile(onPath, self) {
+		return name
+	}
+	return self
+}
+
+func sameFile(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
+
+// Splits a shebang line into the interpreter, whether 'env -S' is used, the goscript command and its arguments.
+func parseShebang(line string) (interpreter string, splitArgs bool, command string, args []string) {
+	fields := strings.Fields(strings.TrimPrefix(line, "#!"))
+	if len(fields) == 0 {
+		return "", false, "", nil
+	}
+	interpreter = fields[0]
+	fields = fields[1:]
+	if filepath.Base(interpreter) != "env" {
+		return interpreter, false, interpreter, fields
+	}
+	//BSD and macOS pass shebang arguments already split, Linux passes them as one string. 'env -S' handles both.
+	for len(fields) > 0 && strings.HasPrefix(fields[0], "-") {
+		if fields[0] == "-S" || fields[0] == "--split-string" {
+			splitArgs = true
+		} else if strings.HasPrefix(fields[0], "-S") {
+			splitArgs = true
+			fields[0] = strings.TrimPrefix(fields[0], "-S")
+			break
+		}
+		fields = fields[1:]
+	}
+	if len(fields) == 0 {
+		return interpreter, splitArgs, "", nil
+	}
+	return interpreter, splitArgs, fields[0], fields[1:]
+}
+
+// Returns warnings for shebang forms that are known to break on some platforms or after goscript is moved.
+func lintShebang(line string) []string {
+	if !strings.HasPrefix(line, "#!") {
+		return nil
+	}
+	warnings := []string{}
+	interpreter, splitArgs, command, args := parseShebang(line)
+	if filepath.Base(interpreter) != "env" {
+		if !checkFileExists(interpreter) {
+			warnings = append(warnings, fmt.Sprintf("interpreter %s does not exist", interpreter))
+		}
+		warnings = append(warnings, "an absolute path to goscript breaks when goscript is moved; use '/usr/bin/env -S goscript'")
+		return warnings
+	}
+	if len(args) > 0 && !splitArgs {
+		warnings = append(warnings, "arguments after the command require 'env -S' on Linux")
+	}
+	if filepath.IsAbs(command) && !checkFileExists(command) {
+		warnings = append(warnings, fmt.Sprintf("%s does not exist (was goscript moved?)", command))
+	}
+	return warnings
+}
+
+// Returns the portable form of a shebang line, keeping any goscript arguments.
+func fixShebangLine(line string) string {
+	_, _, _, args := parseShebang(line)
+	return strings.TrimSpace(shebangLine() + " " + strings.Join(args, " "))
+}
+
+// Reads the first line of a file, without the line ending.
+func firstLine(filename string) string {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return ""
+	}
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	return strings.TrimRight(string(line), "\r")
+}
+
+// Prints warnings for a non-portable shebang in the named script file.
+func warnShebang(filename string) {
+	for _, w := range lintShebang(firstLine(filename)) {
+		fmt.Fprintf(os.Stderr, "warning: %s: shebang: %s (run 'goscript --fix-shebang %s' to fix)\n", filename, w, filename)
+	}
+}
+
+// Rewrites the shebang of a script file in the portable '/usr/bin/env -S goscript' form.
+func fixShebang(filename string) {
+	info, err := os.Stat(filename)
+	check(err, 2, "")
+	data, err := os.ReadFile(filename)
+	check(err, 2, "")
+
+	line, rest, _ := bytes.Cut(data, []byte("\n"))
+	old := strings.TrimRight(string(line), "\r")
+	if !strings.HasPrefix(old, "#!") {
+		fmt.Printf("%s has no shebang line. Add this line to the top of the file:\n%s\n", filename, shebangLine())
+		return
+	}
+	fixed := fixShebangLine(old)
+	if fixed == old {
+		fmt.Printf("%s: shebang is already portable\n", filename)
+		return
+	}
+	out := append([]byte(fixed+"\n"), rest...)
+	err = os.WriteFile(filename, out, info.Mode().Perm())
+	check(err, 2, "Unable to rewrite "+filename)
+	fmt.Printf("%s:\n  - %s\n  + %s\n", filename, old, fixed)
+}
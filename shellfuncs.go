@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// --shell-functions prints a shell function for each command, so a shell can source one file instead of putting
+// the project bin directory on the PATH. Each function runs its command with goscript --run, which compiles the
+// command first if its binary is missing or older than its source (e.g. right after cloning the project).
+
+// Shell function names may not contain every character a command file name can.
+var shellFunctionName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// Quotes a string for POSIX shells and fish.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func printShellFunctions(shell string) {
+	goscriptBin, err := os.Executable()
+	check(err, 2, "Unable to locate the goscript executable.")
+	goscriptBin, _ = filepath.EvalSymlinks(goscriptBin)
+
+	var format string
+	switch shell {
+	case "sh", "bash", "zsh":
+		format = "%s() { GOSCRIPT_PROJECT_DIR=%s %s --run %s -- \"$@\"; }\n"
+	case "fish":
+		format = "function %s; env GOSCRIPT_PROJECT_DIR=%s %s --run %s -- $argv; end\n"
+	default:
+		check(fmt.Errorf("unsupported shell %q", shell), 2, "Supported shells are sh, bash, zsh and fish.")
+	}
+
+	fmt.Printf("# Generated by goscript --shell-functions for the project at %s\n", projectDir)
+	for _, filename := range getSourceList() {
+		cmd, ok := strings.CutSuffix(filename, ".go")
+		if !ok {
+			continue
+		}
+		if !shellFunctionName.MatchString(cmd) {
+			fmt.Fprintf(os.Stderr, "warning: skipping %s, which is not a valid shell function name\n", cmd)
+			continue
+		}
+		fmt.Printf(format, cmd, shellQuote(projectDir), shellQuote(goscriptBin), cmd)
+	}
+}
+
+// Returns true if the binary exists and was built after the last change to its source and to go.mod.
+func binaryUpToDate(srcFilename, binFilename string) bool {
+	bin, err := os.Stat(binFilename)
+	if err != nil {
+		return false
+	}
+	for _, filename := range append(commandFiles(srcFilename), moduleDir(srcFilename)+"/go.mod") {
+		if info, err := os.Stat(filename); err == nil && info.ModTime().After(bin.ModTime()) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Binary size history is recorded when GOSCRIPT_SIZE_HISTORY is set (e.g. GOSCRIPT_SIZE_HISTORY=1).
+// An entry is added to .goscript/sizes.jsonl each time a command's binary changes size, so a dependency
+// that bloats a binary shows up in --size-history.
+
+type sizeEntry struct {
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+	Size    int64     `json:"size"`
+}
+
+func sizeHistoryFile() string {
+	return stateDir() + "/sizes.jsonl"
+}
+
+func readSizeHistory(name string) []sizeEntry {
+	entries := []sizeEntry{}
+	file, err := os.Open(sizeHistoryFile())
+	if err != nil {
+		return entries
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry sizeEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil && entry.Command == name {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Records the size of a freshly built binary, if size history is enabled and the size has changed.
+// Binaries of unnamed (temporary) commands are not recorded.
+func recordBinarySize(binFilename string) {
+	if os.Getenv("GOSCRIPT_SIZE_HISTORY") == "" {
+		return
+	}
+	name := filepath.Base(binFilename)
+	if strings.HasPrefix(name, "gocmd-") {
+		return
+	}
+	info, err := os.Stat(binFilename)
+	if err != nil {
+		return
+	}
+	if history := readSizeHistory(name); len(history) > 0 && history[len(history)-1].Size == info.Size() {
+		return
+	}
+	data, err := json.Marshal(sizeEntry{Time: time.Now(), Command: name, Size: info.Size()})
+	if check(err, 0, "") || check(os.MkdirAll(stateDir(), 0755), 0, "") {
+		return
+	}
+	file, err := os.OpenFile(sizeHistoryFile(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if check(err, 0, "Unable to record binary size.") {
+		return
+	}
+	defer file.Close()
+	file.Write(append(data, '\n'))
+}
+
+// Renders values as a sparkline scaled between their minimum and maximum.
+func sparkline(values []int64) string {
+	ticks := []rune("▁▂▃▄▅▆▇█")
+	lo, hi := values[0], values[0]
+	for _, v := range values {
+		lo = min(lo, v)
+		hi = max(hi, v)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if hi > lo {
+			i = int((v - lo) * int64(len(ticks)-1) / (hi - lo))
+		}
+		b.WriteRune(ticks[i])
+	}
+	return b.String()
+}
+
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
+// Prints the recorded binary size history of a command as a sparkline followed by each change.
+func printSizeHistory(name string) {
+	history := readSizeHistory(name)
+	if len(history) == 0 {
+		fmt.Printf("No size history for %s. Set GOSCRIPT_SIZE_HISTORY=1 to record binary sizes on each build.\n", name)
+		return
+	}
+	sizes := []int64{}
+	for _, entry := range history {
+		sizes = append(sizes, entry.Size)
+	}
+	first, last := sizes[0], sizes[len(sizes)-1]
+	change := fmt.Sprintf("%+.0f%%", float64(last-first)*100/float64(first))
+	if plainOutput {
+		fmt.Printf("%s: %s to %s (%s) over %d changes\n", name, formatSize(first), formatSize(last), change, len(sizes))
+	} else {
+		fmt.Printf("%s  %s  %s -> %s (%s) over %d changes\n", name, sparkline(sizes), formatSize(first), formatSize(last), change, len(sizes))
+	}
+	prev := int64(0)
+	for _, entry := range history {
+		delta := ""
+		if prev > 0 {
+			delta = fmt.Sprintf("%+.0f%%", float64(entry.Size-prev)*100/float64(prev))
+		}
+		if plainOutput {
+			fmt.Printf("%s: %s%s\n", entry.Time.Format("2006-01-02 15:04"), formatSize(entry.Size), strings.TrimSuffix(", "+delta, ", "))
+		} else {
+			fmt.Printf("  %s  %10s  %s\n", entry.Time.Format("2006-01-02 15:04"), formatSize(entry.Size), delta)
+		}
+		prev = entry.Size
+	}
+}
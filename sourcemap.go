@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Code given with --code, and a script given with --file, is wrapped with a template (and with helpers, an
+// auto-print of its last expression, rewritten error checks, ...) before it is built, so the compiler reports
+// errors at lines of the generated file, which is removed after the run. The generated file is matched back to
+// the input token by token, ignoring layout, and each error is reported at the place in the input it comes from,
+// with the line it is on:
+//
+//	--code:2:13: undefined: y
+//	    2 | fmt.Println(y)
+//	      |             ^
+//
+// An error in code that isn't from the input, such as the template's, is shown with the generated line instead.
+
+// The code a source file was generated from.
+type sourceOrigin struct {
+	name      string //how errors name it: the script's path, stdin or --code
+	text      string
+	generated string //the source file built from it
+}
+
+// Set where the input is read, and given the name of the source file generated from it before it is built.
+var inputOrigin *sourceOrigin
+
+// A token of a source, for matching the generated file to its input.
+type sourceToken struct {
+	key       string //the kind of token and its text
+	line, col int
+}
+
+// Returns the tokens of Go source, leaving out comments and the semicolons inserted at line ends, which
+// depend on the layout rather than the code.
+func sourceTokens(src string) []sourceToken {
+	var s scanner.Scanner
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(src))
+	s.Init(file, []byte(src), func(token.Position, string) {}, 0)
+	tokens := []sourceToken{}
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			return tokens
+		}
+		if tok == token.SEMICOLON && lit == "\n" {
+			continue
+		}
+		position := fset.Position(pos)
+		tokens = append(tokens, sourceToken{key: tok.String() + " " + lit, line: position.Line, col: position.Column})
+	}
+}
+
+// Matches the tokens of b to those of a by the shortest edit script between them (Myers' algorithm). Returns
+// the index in a of each token of b, or -1 for a token not in a. Gives up, returning nil, when the sequences
+// differ by more than maxEdits tokens.
+func matchTokens(a, b []sourceToken, maxEdits int) []int {
+	n, m := len(a), len(b)
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	trace := [][]int{}
+	for d := 0; d <= n+m && d <= maxEdits; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			x := v[offset+k-1] + 1
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			}
+			y := x - k
+			for x < n && y < m && a[x].key == b[y].key {
+				x, y = x+1, y+1
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrackMatches(trace, n, m)
+			}
+		}
+	}
+	return nil
+}
+
+// Walks the edit script found by matchTokens back from its end, recording the tokens on its diagonals.
+func backtrackMatches(trace [][]int, n, m int) []int {
+	matches := make([]int, m)
+	for i := range matches {
+		matches[i] = -1
+	}
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d] //v as it was before step d, from k = -d
+		k := x - y
+		prevK := k - 1
+		if k == -d || (k != d && prev[k-1+d] < prev[k+1+d]) {
+			prevK = k + 1
+		}
+		prevX := prev[prevK+d]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x, y = x-1, y-1
+			matches[y] = x
+		}
+		x, y = prevX, prevY
+	}
+	for x > 0 && y > 0 {
+		x, y = x-1, y-1
+		matches[y] = x
+	}
+	return matches
+}
+
+// A compiler error: file:line:col: message, or file:line: message.
+var diagnosticPattern = regexp.MustCompile(`^(.+\.go):(\d+)(?::(\d+))?: (.*)$`)
+
+// Rewrites the errors go build reported for a source file generated from the input to point at the input,
+// each followed by the line it is on. Output for other files is returned as it is.
+func (o *sourceOrigin) mapDiagnostics(srcFilename string, out []byte) []byte {
+	if o == nil || o.generated != srcFilename {
+		return out
+	}
+	src, err := os.ReadFile(srcFilename)
+	if err != nil {
+		return out
+	}
+	data := string(src)
+	generated := sourceTokens(data)
+	input := sourceTokens(o.text)
+	matches := matchTokens(input, generated, 5000)
+	generatedLines := strings.Split(data, "\n")
+	inputLines := strings.Split(o.text, "\n")
+
+	var mapped bytes.Buffer
+	for _, line := range strings.SplitAfter(string(out), "\n") {
+		m := diagnosticPattern.FindStringSubmatch(strings.TrimRight(line, "\r\n"))
+		if m == nil || filepath.Base(m[1]) != filepath.Base(srcFilename) {
+			mapped.WriteString(line)
+			continue
+		}
+		lineNo, _ := strconv.Atoi(m[2])
+		col, _ := strconv.Atoi(m[3])
+		if inputLine, inputCol, ok := mapPosition(generated, input, matches, lineNo, col); ok {
+			fmt.Fprintf(&mapped, "%s:%d:%d: %s\n", o.name, inputLine, inputCol, m[4])
+			mapped.WriteString(sourceExcerpt(inputLines, inputLine, inputCol))
+		} else {
+			fmt.Fprintf(&mapped, "%s (in code added to %s)\n", strings.TrimRight(line, "\r\n"), o.name)
+			mapped.WriteString(sourceExcerpt(generatedLines, lineNo, col))
+		}
+	}
+	return mapped.Bytes()
+}
+
+// Returns the position in the input of a position in the generated file: that of the input token matched to the
+// token it falls in, or ok false if that token isn't from the input.
+func mapPosition(generated, input []sourceToken, matches []int, line, col int) (int, int, bool) {
+	if matches == nil {
+		return 0, 0, false
+	}
+	found := -1
+	for i, t := range generated {
+		if t.line > line || (t.line == line && found >= 0 && (col == 0 || t.col > col)) {
+			break
+		}
+		if t.line == line {
+			found = i
+		}
+	}
+	if found < 0 || matches[found] < 0 {
+		return 0, 0, false
+	}
+	t := input[matches[found]]
+	if col == 0 {
+		return t.line, 0, true
+	}
+	return t.line, t.col + col - generated[found].col, true
+}
+
+// Returns a line of source numbered as in an error, with a caret under the column (if there is one).
+func sourceExcerpt(lines []string, line, col int) string {
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+	text := strings.TrimRight(lines[line-1], "\r")
+	number := strconv.Itoa(line)
+	excerpt := fmt.Sprintf("    %s | %s\n", number, text)
+	if col > 0 && col <= len(text)+1 {
+		//Tabs are kept, so the caret lines up however wide they are shown
+		pad := strings.Map(func(r rune) rune {
+			if r == '\t' {
+				return r
+			}
+			return ' '
+		}, text[:col-1])
+		excerpt += fmt.Sprintf("    %s | %s^\n", strings.Repeat(" ", len(number)), pad)
+	}
+	return excerpt
+}
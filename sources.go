@@ -0,0 +1,150 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/fkmiec/goscript/engine"
+)
+
+// A command's source is either a single file, src/<name>.go, or a directory, src/<name>/, holding main.go and
+// any number of helper files in package main. A directory with its own go.mod is an isolated command (see
+// isolate.go). A soft-deleted directory command keeps its directory, with main.go renamed to main, just as a
+// soft-deleted single-file command loses its .go extension.
+
+// The layout is defined by engine.Project; these helpers apply it to the current project.
+func project() engine.Project {
+	return engine.Project{Dir: projectDir}
+}
+
+func commandDir(cmd string) string {
+	return project().CommandDir(cmd)
+}
+
+func isDirCommand(cmd string) bool {
+	return project().IsDirCommand(cmd)
+}
+
+func sourceFile(cmd string) string {
+	return project().SourceFile(cmd)
+}
+
+func sourcePath(filename string) string {
+	return project().SourcePath(filename)
+}
+
+func sourceDir(srcFilename string) string {
+	return project().SourceDir(srcFilename)
+}
+
+func sourceListName(srcFilename string) string {
+	return project().SourceListName(srcFilename)
+}
+
+func commandFiles(srcFilename string) []string {
+	return project().CommandFiles(srcFilename)
+}
+
+func buildTarget(srcFilename string) string {
+	return project().BuildTarget(srcFilename)
+}
+
+// Returns a hash of all the Go files of the command a source file belongs to. Blank if it can't be read.
+func sourcesHash(srcFilename string) string {
+	files := commandFiles(srcFilename)
+	if len(files) == 1 {
+		return fileHash(srcFilename)
+	}
+	h := sha256.New()
+	for _, filename := range files {
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return ""
+		}
+		fmt.Fprintf(h, "%s %d\n", filepath.Base(filename), len(data))
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Returns the helper files (Go files other than main.go, and not tests) of a directory given with --file.
+func helperFiles(dir string) []string {
+	helpers := []string{}
+	entries, err := os.ReadDir(dir)
+	check(err, 2, "")
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasSuffix(name, ".go") && !strings.HasSuffix(name, "_test.go") && name != "main.go" {
+			helpers = append(helpers, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(helpers)
+	return helpers
+}
+
+// Copies the helper files of a directory given with --file into a command's directory, creating it if needed.
+// Helper files left over from an earlier version of the command are removed.
+func writeHelperFiles(cmd string, helpers []string) {
+	dir := commandDir(cmd)
+	check(os.MkdirAll(dir, 0755), 2, "")
+	keep := map[string]bool{"main.go": true}
+	for _, helper := range helpers {
+		data, err := os.ReadFile(helper)
+		check(err, 2, "")
+		check(os.WriteFile(dir+"/"+filepath.Base(helper), data, 0644), 2, "")
+		keep[filepath.Base(helper)] = true
+	}
+	for _, filename := range commandFiles(dir + "/main.go") {
+		if !keep[filepath.Base(filename)] {
+			check(os.Remove(filename), 1, "")
+		}
+	}
+}
+
+// Prints the source of a command to stdout. A directory command is printed file by file, each preceded by a
+// header comment with its file name.
+func printSources(srcFilename string, shebang bool) {
+	files := commandFiles(srcFilename)
+	if shebang && len(files) == 1 && !windowsScripts() {
+		fmt.Println(shebangLine()) //Add the shebang line (assumption is outside project it will be a shebang script)
+	}
+	for i, filename := range files {
+		if len(files) > 1 {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("// ==> %s <==\n", filepath.Base(filename))
+		}
+		buf = readSourceFile(filename)
+		_, err := buf.WriteTo(os.Stdout)
+		check(err, 2, "Failed to print "+filename)
+	}
+}
+
+// Copies a command's source, including the helper files of a directory command, to the command named copy.
+func copySources(srcFilename string, copy string) {
+	files := commandFiles(srcFilename)
+	if len(files) == 1 {
+		buf = readSourceFile(srcFilename)
+		dest := sourceFile(copy)
+		if !confirmOverwrite(dest, buf.Bytes()) {
+			cancelled()
+		}
+		writeSourceFile(dest, buf)
+		return
+	}
+	if checkFileExists(projectDir + "/src/" + copy + ".go") {
+		check(fmt.Errorf("%s already exists as a single-file command", copy), 2, "Delete it first, or copy to another name.")
+	}
+	buf = readSourceFile(srcFilename)
+	if !confirmOverwrite(commandDir(copy)+"/main.go", buf.Bytes()) {
+		cancelled()
+	}
+	writeHelperFiles(copy, files[1:])
+	writeSourceFile(commandDir(copy)+"/main.go", buf)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/fkmiec/goscript/engine"
+)
+
+// A starter pack is a curated set of dependencies for a domain, added to a project at setup with --starter.
+// Aliases are the short names scripts use for the packages and are preloaded into imports.json.
+type starterPack struct {
+	Description string
+	Deps        []string
+	Aliases     map[string]string
+}
+
+var starterPacks = map[string]starterPack{
+	"text": {
+		Description: "Text processing: pipelines, YAML, TOML and JSON queries",
+		Deps:        []string{"github.com/bitfield/script", "gopkg.in/yaml.v3", "github.com/BurntSushi/toml", "github.com/tidwall/gjson"},
+		Aliases: map[string]string{
+			"script": "github.com/bitfield/script",
+			"yaml":   "gopkg.in/yaml.v3",
+			"toml":   "github.com/BurntSushi/toml",
+			"gjson":  "github.com/tidwall/gjson",
+		},
+	},
+	"http": {
+		Description: "HTTP clients, routing and HTML scraping",
+		Deps:        []string{"github.com/go-resty/resty/v2", "github.com/gorilla/mux", "github.com/PuerkitoBio/goquery"},
+		Aliases: map[string]string{
+			"resty":   "github.com/go-resty/resty/v2",
+			"mux":     "github.com/gorilla/mux",
+			"goquery": "github.com/PuerkitoBio/goquery",
+		},
+	},
+	"aws": {
+		Description: "AWS SDK v2 with config, S3 and STS",
+		Deps:        []string{"github.com/aws/aws-sdk-go-v2", "github.com/aws/aws-sdk-go-v2/config", "github.com/aws/aws-sdk-go-v2/service/s3", "github.com/aws/aws-sdk-go-v2/service/sts"},
+		Aliases: map[string]string{
+			"aws":       "github.com/aws/aws-sdk-go-v2/aws",
+			"awsconfig": "github.com/aws/aws-sdk-go-v2/config",
+			"s3":        "github.com/aws/aws-sdk-go-v2/service/s3",
+			"sts":       "github.com/aws/aws-sdk-go-v2/service/sts",
+		},
+	},
+	"kubernetes": {
+		Description: "Kubernetes client-go and API types",
+		Deps:        []string{"k8s.io/client-go", "k8s.io/apimachinery", "k8s.io/api"},
+		Aliases: map[string]string{
+			"kubernetes": "k8s.io/client-go/kubernetes",
+			"clientcmd":  "k8s.io/client-go/tools/clientcmd",
+			"metav1":     "k8s.io/apimachinery/pkg/apis/meta/v1",
+			"corev1":     "k8s.io/api/core/v1",
+		},
+	},
+	"data": {
+		Description: "Data wrangling: spreadsheets, SQL and statistics",
+		Deps:        []string{"github.com/xuri/excelize/v2", "github.com/jmoiron/sqlx", "modernc.org/sqlite", "gonum.org/v1/gonum"},
+		Aliases: map[string]string{
+			"excelize": "github.com/xuri/excelize/v2",
+			"sqlx":     "github.com/jmoiron/sqlx",
+			"sqlite":   "modernc.org/sqlite",
+			"stat":     "gonum.org/v1/gonum/stat",
+		},
+	},
+}
+
+// Prints the available starter packs, each line starting with indent.
+func printStarterPacks(indent string) {
+	names := []string{}
+	for name := range starterPacks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, name := range names {
+		pack := starterPacks[name]
+		if plainOutput {
+			fmt.Printf("%s: %s\n", name, pack.Description)
+			continue
+		}
+		fmt.Fprintf(w, "%s%s\t%s\n", indent, name, pack.Description)
+	}
+	w.Flush()
+}
+
+// Parses a comma-separated list of starter pack names, exiting with the list of available packs on an unknown name.
+func parseStarterPacks(value string) []string {
+	names := engine.SplitList(value)
+	for _, name := range names {
+		if _, ok := starterPacks[name]; !ok {
+			fmt.Fprintf(os.Stderr, "Unknown starter pack %q. Available starter packs:\n", name)
+			printStarterPacks("  ")
+			exitProgram(1)
+		}
+	}
+	return names
+}
+
+// Adds the dependencies of a starter pack to the project and preloads its aliases into imports.json.
+// Dependencies already in go.mod and aliases the user has already defined are left alone.
+// Returns a description of each change made.
+func installStarterPack(name string) []string {
+	pack := starterPacks[name]
+	done := []string{}
+	for _, dep := range pack.Deps {
+		if slices.Contains(requiredModules(), dep) {
+			continue
+		}
+		out, err := goModify(projectDir, "get", dep)
+		check(err, 2, fmt.Sprintf("%v: %s\n", err, out))
+		done = append(done, fmt.Sprintf("added dependency %s (%s)", dep, name))
+	}
+
+	userImports := readUserImports()
+	if userImports == nil {
+		userImports = make(map[string]string)
+	}
+	added := 0
+	for alias, pkg := range pack.Aliases {
+		if _, ok := userImports[alias]; !ok {
+			userImports[alias] = pkg
+			added++
+		}
+	}
+	if added > 0 {
+		writeUserImports(userImports)
+		done = append(done, fmt.Sprintf("added %d import aliases (%s)", added, name))
+	}
+	return done
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/fkmiec/goscript/engine"
+)
+
+// --template <kind> wraps code with a named template instead of script.tmpl: one in the project's templates
+// directory, or a built-in one (see engine/builtin_templates.go). --template-list shows the templates there are,
+// and --template-add adds one to the project. A template that can't be executed, e.g. because of a syntax error
+// or a field the template data doesn't have, is reported and the code is wrapped with the default template
+// instead, so that scripts keep working while it is fixed. --check-template checks a template more thoroughly.
+
+// Set by --template. "script" (the default, when --template is given without a kind) keeps the template named in
+// the code's frontmatter.
+var templateKind string
+
+// Returns the template to wrap code with: the one given with --template, or else the one in the frontmatter, or
+// else the project's default template (see settings.go).
+func selectedTemplate(meta Metadata) string {
+	if templateKind != "" && templateKind != "script" {
+		return templateKind
+	}
+	if meta.Template == "" && templateKind == "" {
+		return defaultTemplate()
+	}
+	return meta.Template
+}
+
+// Prints the templates available to the project (see --template-list).
+func listTemplates() {
+	r := &report{title: "Templates", columns: []string{"Template", "Source", "Description"}}
+	for _, t := range project().Templates() {
+		source := "built-in"
+		if t.File != "" {
+			source, _ = filepath.Rel(projectDir, t.File)
+		}
+		if t.Name == "script" && t.Description == "" {
+			t.Description = "The default template"
+		}
+		r.add(t.Name, source, t.Description)
+	}
+	r.notes = append(r.notes, "Use one with --template <name>. Add your own with --template-add <file>.")
+	r.print()
+}
+
+// Adds a template to the project's templates directory: a template file, or a copy of a built-in template to
+// customize. The template is named after the file unless a name is given.
+func addTemplate(source, name string) {
+	var text string
+	if data, err := os.ReadFile(source); err == nil {
+		text = string(data)
+	} else if builtin, ok := engine.BuiltinTemplates[source]; ok {
+		text = builtin
+	} else {
+		check(err, 2, "Give a template file or the name of a built-in template (see --template-list).")
+	}
+	if name == "" {
+		name = filepath.Base(source)
+	}
+	name = strings.TrimSuffix(name, ".tmpl")
+	_, err := engine.ParseTemplate(name, text)
+	check(err, 2, "The template is not valid.")
+
+	filename := project().TemplatesDir() + "/" + name + ".tmpl"
+	check(os.MkdirAll(project().TemplatesDir(), 0755), 2, "")
+	if !confirmOverwrite(filename, []byte(text)) {
+		cancelled()
+	}
+	check(os.WriteFile(filename, []byte(text), 0644), 2, "")
+	fmt.Printf("Template %s written to %s. Use it with --template %s.\n", name, filename, name)
+}
+
+// Checks that a template wraps code into a Go program (see --check-template).
+func checkTemplate(name string) {
+	text, err := project().ReadTemplate(name)
+	check(err, 2, "See --template-list for the templates there are.")
+	filename := project().TemplateFile(name)
+	if checkFileExists(filename) {
+		filename, _ = filepath.Rel(projectDir, filename)
+	} else {
+		filename = "The built-in template " + strings.TrimSuffix(name, ".tmpl")
+	}
+	check(templateError(filepath.Base(project().TemplateFile(name)), text), 2, filename+" can't wrap code:")
+	fmt.Printf("%s is valid.\n", filename)
+}
+
+// Returns what stops a template from wrapping code: an error parsing or executing it, or a problem with the
+// program it produces for sample code, which must be a main package with a main function, the code and its imports.
+func templateError(name, text string) error {
+	code := "fmt.Println(strings.ToUpper(\"hello\"))"
+	sample := engine.Script{Imports: []string{`"fmt"`, `"strings"`}, Code: code, Uses: engine.DetectFeatures(code)}
+	src, err := engine.RenderText(name, text, sample)
+	if err != nil {
+		return err
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), name, src, 0)
+	if err != nil {
+		//The positions are in the produced program, so the line is shown
+		var list scanner.ErrorList
+		if errors.As(err, &list) && len(list) > 0 {
+			lines := strings.Split(string(src), "\n")
+			if line := list[0].Pos.Line; line > 0 && line <= len(lines) {
+				return fmt.Errorf("the program it produces is not valid Go: %s, at %q", list[0].Msg, strings.TrimSpace(lines[line-1]))
+			}
+		}
+		return fmt.Errorf("the program it produces is not valid Go: %w", err)
+	}
+	if file.Name.Name != "main" {
+		return fmt.Errorf("it produces package %s rather than package main", file.Name.Name)
+	}
+	hasMain := false
+	for _, decl := range file.Decls {
+		if fn, ok := decl.(*ast.FuncDecl); ok && fn.Recv == nil && fn.Name.Name == "main" {
+			hasMain = true
+		}
+	}
+	if !hasMain {
+		return errors.New("the program it produces has no main function")
+	}
+	if !strings.Contains(string(src), code) {
+		return errors.New("it leaves out the code: insert it with {{.Code}}")
+	}
+	imported := map[string]bool{}
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		imported[path] = true
+	}
+	if !imported["fmt"] || !imported["strings"] {
+		return errors.New("it leaves out the imports of the code: insert them with {{range .Imports}}{{.}}{{end}} in an import declaration")
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fkmiec/goscript/engine"
+)
+
+// --test runs the unit tests kept next to a command: src/<name>_test.go for a single-file command, or the
+// _test.go files in the directory of a directory command. Tests are in package main, so they can call the
+// command's functions directly. They are compiled with the command's source and run with go test, in the
+// command's own module if it is isolated.
+
+// Returns the test files of a command, or nil if it has none.
+func testFiles(cmd string) []string {
+	if isDirCommand(cmd) {
+		files, _ := filepath.Glob(commandDir(cmd) + "/*_test.go")
+		return files
+	}
+	if testFilename := projectDir + "/src/" + cmd + "_test.go"; checkFileExists(testFilename) {
+		return []string{testFilename}
+	}
+	return nil
+}
+
+// Runs go test for a command, with any extra go test arguments (e.g. -run or -v). The output goes straight to
+// the terminal. Returns true if the tests pass.
+func testCommand(cmd string, args []string) bool {
+	srcFilename := sourceFile(cmd)
+	meta := engine.ReadMetadata(srcFilename)
+	dir := moduleDir(srcFilename)
+	ensureDeps(dir, meta.Deps)
+	absSrcFilename, err := filepath.Abs(srcFilename)
+	check(err, 2, "")
+	goArgs := append([]string{"test"}, engine.MergeBuildFlags(buildFlags(), meta.BuildFlags)...)
+	goArgs = append(goArgs, args...)
+	if target := buildTarget(absSrcFilename); target != absSrcFilename {
+		goArgs = append(goArgs, target)
+	} else {
+		//A single-file command is tested as a list of files, since src holds many commands in package main
+		goArgs = append(goArgs, absSrcFilename)
+		goArgs = append(goArgs, testFiles(cmd)...)
+	}
+	run := goCommandIn(dir, goArgs...)
+	run.Stdout = os.Stdout
+	run.Stderr = os.Stderr
+	return run.Run() == nil
+}
+
+// Runs the tests of the named command, or of every command that has tests if name is "all". Arguments are
+// passed to go test. Exits with an error if any tests fail.
+func runTests(name string, args []string) {
+	if name != "all" {
+		if !checkFileExists(sourceFile(name)) {
+			check(fmt.Errorf("no command named %s", name), 2, "")
+		}
+		if testFiles(name) == nil {
+			check(fmt.Errorf("%s has no tests", name), 2, "Add them to "+projectDir+"/src/"+name+"_test.go, in package main.")
+		}
+		if !testCommand(name, args) {
+			exitProgram(1)
+		}
+		return
+	}
+
+	passed, failed := []string{}, []string{}
+	for _, filename := range getSourceList() {
+		cmd, ok := strings.CutSuffix(filename, ".go")
+		if !ok || testFiles(cmd) == nil {
+			continue
+		}
+		fmt.Printf("==> %s\n", cmd)
+		if testCommand(cmd, args) {
+			passed = append(passed, cmd)
+		} else {
+			failed = append(failed, cmd)
+		}
+	}
+	if len(passed)+len(failed) == 0 {
+		fmt.Println("No commands have tests. Add them to src/<name>_test.go, in package main.")
+		return
+	}
+
+	r := &report{title: "Test", columns: []string{"Result", "Command"}, indent: "  "}
+	for _, cmd := range passed {
+		r.add("ok", cmd)
+	}
+	for _, cmd := range failed {
+		r.add("FAIL", cmd)
+	}
+	r.notes = append(r.notes, fmt.Sprintf("Tested %d command(s): %d ok, %d failed", len(passed)+len(failed), len(passed), len(failed)))
+	r.print()
+	if len(failed) > 0 {
+		exitProgram(1)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fkmiec/goscript/engine"
+)
+
+// --export-toolbox <dir|file.tar[.gz]> exports every command as a toolbox for machines without Go: the binaries
+// in bin/, completions of their flags for bash and fish in completions/, a manifest.json describing each command
+// and an install.sh that copies the binaries to a directory on the PATH. Missing and stale binaries are built
+// first, for the platform given with --os and --arch if any. Unlike --export-bin, the commands stay in the project.
+
+type toolboxCommand struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Binary      string   `json:"binary"`
+	Size        int64    `json:"size"`
+	SHA256      string   `json:"sha256"`
+	Flags       []string `json:"flags,omitempty"`
+	Examples    []string `json:"examples,omitempty"`
+}
+
+type toolboxManifest struct {
+	Created  time.Time        `json:"created"`
+	Goscript string           `json:"goscript"`
+	Platform string           `json:"platform"`
+	Commands []toolboxCommand `json:"commands"`
+}
+
+// Where the files of a toolbox are written: a directory, or a tar file.
+type toolboxWriter interface {
+	add(name string, data []byte, mode os.FileMode) error
+	close() error
+}
+
+type dirToolbox struct{ dir string }
+
+func (t dirToolbox) add(name string, data []byte, mode os.FileMode) error {
+	filename := filepath.Join(t.dir, name)
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filename, data, mode)
+}
+
+func (t dirToolbox) close() error {
+	return nil
+}
+
+type tarToolbox struct {
+	file *os.File
+	gz   *gzip.Writer //nil for an uncompressed tar
+	tw   *tar.Writer
+	root string //the directory the files are in within the archive
+}
+
+func (t *tarToolbox) add(name string, data []byte, mode os.FileMode) error {
+	header := &tar.Header{Name: t.root + "/" + name, Mode: int64(mode), Size: int64(len(data)), ModTime: time.Now()}
+	if err := t.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := t.tw.Write(data)
+	return err
+}
+
+func (t *tarToolbox) close() error {
+	err := t.tw.Close()
+	if t.gz != nil {
+		err = errors.Join(err, t.gz.Close())
+	}
+	return errors.Join(err, t.file.Close())
+}
+
+// Opens the destination of a toolbox: a tar file if it ends in .tar, .tar.gz or .tgz, otherwise a directory.
+func openToolbox(dest string) (toolboxWriter, error) {
+	base := filepath.Base(dest)
+	root, isTar := strings.CutSuffix(base, ".tar")
+	compressed := false
+	for _, ext := range []string{".tar.gz", ".tgz"} {
+		if strings.HasSuffix(base, ext) {
+			root, isTar, compressed = strings.TrimSuffix(base, ext), true, true
+		}
+	}
+	if !isTar {
+		return dirToolbox{dest}, os.MkdirAll(dest, 0755)
+	}
+	file, err := os.Create(dest)
+	if err != nil {
+		return nil, err
+	}
+	t := &tarToolbox{file: file, root: root}
+	var w io.Writer = file
+	if compressed {
+		t.gz = gzip.NewWriter(file)
+		w = t.gz
+	}
+	t.tw = tar.NewWriter(w)
+	return t, nil
+}
+
+// Returns a bash completion script for the flags the commands declare in their frontmatter.
+func toolboxBashCompletion(commands []toolboxCommand) string {
+	var b strings.Builder
+	b.WriteString("# Completion of the flags of the toolbox commands for bash. Add to ~/.bashrc: source <this file>\n")
+	for _, cmd := range commands {
+		if len(cmd.Flags) > 0 {
+			fmt.Fprintf(&b, "complete -o default -W %s %s\n", shellQuote(strings.Join(cmd.Flags, " ")), cmd.Name)
+		}
+	}
+	return b.String()
+}
+
+// Returns a fish completion script for the flags the commands declare in their frontmatter.
+func toolboxFishCompletion(commands []toolboxCommand, meta map[string]Metadata) string {
+	var b strings.Builder
+	b.WriteString("# Completion of the flags of the toolbox commands for fish. Copy to ~/.config/fish/completions/ or source it.\n")
+	for _, cmd := range commands {
+		for _, flag := range meta[cmd.Name].Flags {
+			line := fmt.Sprintf("complete -c %s -o %s", cmd.Name, flag.Name)
+			if flag.Type != "bool" {
+				line += " -r"
+			}
+			if flag.Usage != "" {
+				line += " -d " + shellQuote(flag.Usage)
+			}
+			b.WriteString(line + "\n")
+		}
+	}
+	return b.String()
+}
+
+const toolboxInstaller = `#!/bin/sh
+# Installs the toolbox commands to $PREFIX/bin (default /usr/local/bin).
+set -e
+cd "$(dirname "$0")"
+PREFIX="${PREFIX:-/usr/local}"
+mkdir -p "$PREFIX/bin"
+for bin in bin/*; do
+	install -m 0755 "$bin" "$PREFIX/bin/"
+	echo "installed $PREFIX/bin/$(basename "$bin")"
+done
+echo "For completion of command flags, source completions/toolbox.bash (bash) or completions/toolbox.fish (fish)."
+`
+
+// Exports every command in the project as a toolbox (see --export-toolbox).
+func exportToolbox(dest string) {
+	if checkFileExists(dest) && !confirm(fmt.Sprintf("%s exists. Files in it will be overwritten.", dest)) {
+		cancelled()
+	}
+	//Exported binaries should be traceable to verified module content
+	if !verifyModules() {
+		check(errors.New("module verification failed"), 2, "The toolbox was not exported.")
+	}
+	goos, goarch := buildPlatform()
+	r := &report{title: "Toolbox", columns: []string{"Result", "Command", "Note"}, indent: "  "}
+	commands := []toolboxCommand{}
+	metas := map[string]Metadata{}
+	failed := 0
+	states := readBuildStates()
+	for _, info := range commandInfos(getSourceList()) {
+		if info.Deleted {
+			continue
+		}
+		name, srcFilename := info.Name, info.Source
+		meta := engine.ReadMetadata(srcFilename)
+		if !supportsTarget(meta) {
+			r.add("skip", name, "runs only on "+strings.Join(meta.OS, ", "))
+			continue
+		}
+		binFilename := binaryPath(name)
+		if !binaryCurrent(states, srcFilename, binFilename) && !compileBinary(srcFilename, binFilename) {
+			r.add("FAIL", name, "failed to compile")
+			failed++
+			continue
+		}
+		cmd := toolboxCommand{Name: name, Description: info.Description, Binary: "bin/" + filepath.Base(binFilename),
+			SHA256: fileHash(binFilename), Examples: info.Examples}
+		if info, err := os.Stat(binFilename); err == nil {
+			cmd.Size = info.Size()
+		}
+		for _, flag := range meta.Flags {
+			cmd.Flags = append(cmd.Flags, "-"+flag.Name)
+		}
+		commands = append(commands, cmd)
+		metas[name] = meta
+	}
+	if len(commands) == 0 {
+		r.notes = append(r.notes, "No commands to export.")
+		r.print()
+		exitProgram(1)
+	}
+	sort.Slice(commands, func(i, j int) bool { return commands[i].Name < commands[j].Name })
+
+	toolbox, err := openToolbox(dest)
+	check(err, 2, "Unable to create the toolbox.")
+	for _, cmd := range commands {
+		data, err := os.ReadFile(binaryPath(cmd.Name))
+		check(err, 2, "")
+		check(toolbox.add(cmd.Binary, data, 0755), 2, "")
+		r.add("ok", cmd.Name, formatSize(cmd.Size))
+	}
+	manifest, err := json.MarshalIndent(toolboxManifest{Created: time.Now().UTC(), Goscript: version, Platform: goos + "/" + goarch, Commands: commands}, "", "    ")
+	check(err, 2, "")
+	check(toolbox.add("manifest.json", append(manifest, '\n'), 0644), 2, "")
+	check(toolbox.add("completions/toolbox.bash", []byte(toolboxBashCompletion(commands)), 0644), 2, "")
+	check(toolbox.add("completions/toolbox.fish", []byte(toolboxFishCompletion(commands, metas)), 0644), 2, "")
+	check(toolbox.add("install.sh", []byte(toolboxInstaller), 0755), 2, "")
+	check(toolbox.close(), 2, "Unable to write the toolbox.")
+
+	r.notes = append(r.notes, fmt.Sprintf("Exported %d command(s) for %s/%s to %s. Run install.sh there to install them.", len(commands), goos, goarch, dest))
+	r.print()
+	if failed > 0 {
+		exitProgram(1)
+	}
+}
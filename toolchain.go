@@ -0,0 +1,339 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/fkmiec/goscript/engine"
+)
+
+var errGoNotFound = errors.New("go toolchain not found")
+
+const goMissingMessage = `Goscript requires the Go toolchain, but 'go' was not found on your PATH.
+Install Go from https://go.dev/dl/ and make sure 'go' is on your PATH,
+or run 'goscript --install-go' to download a toolchain into the project.`
+
+// Path to the toolchain installed in the project with --install-go or --toolchain.
+func projectToolchainDir() string {
+	return projectDir + "/toolchain/go"
+}
+
+// Path to the file recording the Go version pinned for the project with --toolchain.
+func pinnedVersionFile() string {
+	return projectDir + "/toolchain/VERSION"
+}
+
+// Returns the Go version pinned for the project (e.g. "go1.22.1"), or blank if none.
+func pinnedGoVersion() string {
+	data, err := os.ReadFile(pinnedVersionFile())
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Returns the version of the toolchain installed in the project, or blank if none.
+// Go distributions carry a VERSION file whose first line is the version (e.g. "go1.22.1").
+func installedGoVersion() string {
+	data, err := os.ReadFile(projectToolchainDir() + "/VERSION")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.SplitN(string(data), "\n", 2)[0])
+}
+
+// Pins the project to a Go version and installs it. The pin is a plain text file so it can be
+// committed with the project while the downloaded toolchain itself is not.
+func pinToolchain(goVersion string) {
+	if goVersion == "latest" {
+		latest, err := latestGoVersion()
+		check(err, 2, "Unable to determine the latest Go release.")
+		goVersion = latest
+	}
+	if !strings.HasPrefix(goVersion, "go") {
+		goVersion = "go" + goVersion
+	}
+	err := os.MkdirAll(filepath.Dir(pinnedVersionFile()), 0755)
+	check(err, 2, "")
+	err = os.WriteFile(pinnedVersionFile(), []byte(goVersion+"\n"), 0644)
+	check(err, 2, "Unable to write "+pinnedVersionFile())
+	fmt.Printf("Pinned project toolchain to %s\n", goVersion)
+	if installedGoVersion() != goVersion {
+		installGo(goVersion)
+	}
+}
+
+// Returns the go executable used for all builds. A toolchain installed in the project takes precedence over
+// the go found on the PATH.
+func goExecutable() (string, error) {
+	//A pinned toolchain that is missing or out of date (e.g. on a fresh clone of the project) is installed on first use
+	if pinned := pinnedGoVersion(); pinned != "" && installedGoVersion() != pinned {
+		installGo(pinned)
+	}
+	local := projectToolchainDir() + "/bin/go"
+	if runtime.GOOS == "windows" {
+		local += ".exe"
+	}
+	if checkFileExists(local) {
+		return local, nil
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		return "", errGoNotFound
+	}
+	return goBin, nil
+}
+
+// Creates an exec.Cmd for the go tool that runs in the project directory.
+// Exits with install guidance if no toolchain can be found.
+func goCommand(args ...string) *exec.Cmd {
+	return goEngine().GoCommand(projectDir, args...)
+}
+
+// Returns an engine for the project that builds with the project's toolchain.
+// Exits with install guidance if no toolchain can be found.
+func goEngine() *engine.Engine {
+	e, err := tryGoEngine()
+	check(err, 2, goMissingMessage)
+	return e
+}
+
+// Like goEngine, but returns an error instead of exiting if there is no go command.
+func tryGoEngine() (*engine.Engine, error) {
+	goBin, err := goExecutable()
+	if err != nil {
+		return nil, err
+	}
+	return configureEngine(&engine.Engine{Project: project(), Go: goBin, Env: toolchainEnv(goBin)}), nil
+}
+
+// Isolates the go command from the system Go when the project toolchain is in use, so that the
+// toolchain's own bin directory comes first on the PATH and go does not switch to another version.
+func toolchainEnv(goBin string) []string {
+	env := os.Environ()
+	if !strings.HasPrefix(goBin, projectToolchainDir()) {
+		return env
+	}
+	goRoot := projectToolchainDir()
+	isolated := []string{}
+	for _, kv := range env {
+		if strings.HasPrefix(kv, "PATH=") || strings.HasPrefix(kv, "GOROOT=") || strings.HasPrefix(kv, "GOTOOLCHAIN=") {
+			continue
+		}
+		isolated = append(isolated, kv)
+	}
+	isolated = append(isolated,
+		"GOROOT="+goRoot,
+		"GOTOOLCHAIN=local",
+		"PATH="+goRoot+"/bin"+string(os.PathListSeparator)+os.Getenv("PATH"),
+	)
+	return isolated
+}
+
+// Looks up the latest stable Go release (e.g. "go1.22.1").
+func latestGoVersion() (string, error) {
+	resp, err := http.Get("https://go.dev/VERSION?m=text")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response from go.dev: %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(strings.SplitN(string(body), "\n", 2)[0]), nil
+}
+
+// Looks up the published SHA256 checksum for a Go release archive.
+func goArchiveChecksum(archive string) (string, error) {
+	resp, err := http.Get("https://go.dev/dl/?mode=json&include=all")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var releases []struct {
+		Files []struct {
+			Filename string `json:"filename"`
+			Sha256   string `json:"sha256"`
+		} `json:"files"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&releases)
+	if err != nil {
+		return "", err
+	}
+	for _, release := range releases {
+		for _, f := range release.Files {
+			if f.Filename == archive {
+				return f.Sha256, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no published checksum for %s", archive)
+}
+
+// Downloads the official Go toolchain for the host platform into <project>/toolchain/go, verifying the
+// archive against the checksum published on go.dev. All subsequent go invocations by goscript will use it.
+// If goVersion is blank, the pinned version is used, or the latest release if nothing is pinned.
+func installGo(goVersion string) {
+	if goVersion == "" {
+		goVersion = pinnedGoVersion()
+	}
+	if goVersion == "" {
+		latest, err := latestGoVersion()
+		check(err, 2, "Unable to determine the latest Go release.")
+		goVersion = latest
+	}
+
+	archive := fmt.Sprintf("%s.%s-%s.tar.gz", goVersion, runtime.GOOS, runtime.GOARCH)
+	sum, err := goArchiveChecksum(archive)
+	check(err, 2, "Unable to verify "+archive)
+
+	url := "https://go.dev/dl/" + archive
+	fmt.Printf("Downloading %s ...\n", url)
+	resp, err := http.Get(url)
+	check(err, 2, "Failed to download "+url)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		check(fmt.Errorf("unexpected response: %s", resp.Status), 2, "Failed to download "+url)
+	}
+
+	//Download to a temporary file so nothing is extracted until the checksum has been verified
+	toolchainDir := filepath.Dir(projectToolchainDir())
+	err = os.MkdirAll(toolchainDir, 0755)
+	check(err, 2, "")
+	tmp, err := os.CreateTemp(toolchainDir, archive+".*")
+	check(err, 2, "")
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), resp.Body)
+	check(err, 2, "Failed to download "+url)
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != sum {
+		check(fmt.Errorf("checksum mismatch for %s: expected %s, got %s", archive, sum, actual), 2, "")
+	}
+
+	_, err = tmp.Seek(0, io.SeekStart)
+	check(err, 2, "")
+	err = os.RemoveAll(projectToolchainDir())
+	check(err, 2, "Unable to remove previous toolchain.")
+	err = extractTarGz(tmp, toolchainDir)
+	check(err, 2, "Failed to extract "+archive)
+
+	fmt.Printf("Installed %s to %s\n", goVersion, projectToolchainDir())
+}
+
+// Extracts a gzipped tar stream into the destination directory.
+func extractTarGz(r io.Reader, dest string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, hdr.Name)
+		if !strings.HasPrefix(target, filepath.Clean(dest)+string(os.PathSeparator)) {
+			return fmt.Errorf("illegal path in archive: %s", hdr.Name)
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode)&0777)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return err
+			}
+			f.Close()
+		case tar.TypeSymlink:
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Prints a report on the environment goscript depends on and flags anything missing.
+func doctor() {
+	ok := true
+	report := func(good bool, msg string, args ...any) {
+		status := "ok  "
+		if !good {
+			status = "FAIL"
+			ok = false
+		}
+		fmt.Printf("[%s] %s\n", status, fmt.Sprintf(msg, args...))
+	}
+
+	fmt.Println(version)
+	report(checkFileExists(projectDir), "project directory: %s", projectDir)
+
+	goBin, err := goExecutable()
+	if err != nil {
+		report(false, "go toolchain: not found on PATH (install from https://go.dev/dl/ or run 'goscript --install-go')")
+	} else {
+		out, err := exec.Command(goBin, "version").CombinedOutput()
+		report(err == nil, "go toolchain: %s (%s)", strings.TrimSpace(string(out)), goBin)
+	}
+	if pinned := pinnedGoVersion(); pinned != "" {
+		report(installedGoVersion() == pinned, "project toolchain pinned to %s (installed: %s)", pinned, installedGoVersion())
+	}
+
+	report(checkFileExists(projectDir+"/go.mod"), "go.mod present")
+	report(checkFileExists(projectDir+"/script.tmpl"), "script.tmpl present")
+	if text, err := os.ReadFile(projectDir + "/script.tmpl"); err == nil {
+		if err := templateError("script.tmpl", string(text)); err != nil {
+			report(false, "script.tmpl can't wrap code: %v (see --check-template)", err)
+		} else {
+			report(true, "script.tmpl wraps code")
+		}
+	}
+	report(checkFileExists(projectDir+"/src"), "src directory present")
+	report(checkFileExists(projectDir+"/bin"), "bin directory present")
+
+	binDir := projectDir + "/bin"
+	onPath := false
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		if samePath(dir, binDir) {
+			onPath = true
+		}
+	}
+	report(onPath, "%s on PATH", binDir)
+
+	if !ok {
+		exitProgram(1)
+	}
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/fkmiec/goscript/util"
+)
+
+// Returns the modules required directly (not // indirect) in the project's go.mod file.
+func directModules() []string {
+	data, err := os.ReadFile(projectDir + "/go.mod")
+	if err != nil {
+		return nil
+	}
+	re := regexp.MustCompile(`^\s*(?:require\s+)?([^\s()]+)\s+v\S+`)
+	mods := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.Contains(line, "// indirect") {
+			continue
+		}
+		if m := re.FindStringSubmatch(line); m != nil {
+			mods = append(mods, m[1])
+		}
+	}
+	return mods
+}
+
+// Returns true if any of the import paths is in the module (or package tree) mod.
+func importedBy(imports map[string]bool, mod string) bool {
+	for path := range imports {
+		if path == mod || strings.HasPrefix(path, mod+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports what the project carries that no command uses (soft-deleted sources count, since they can be restored): aliases in imports.json and modules required in go.mod.
+// go mod tidy only removes modules no source imports; it can't tell that an alias is stale.
+func reportUnused() {
+	used := map[string]bool{}
+	usedByProject := map[string]bool{} //imports of commands built with the project go.mod (not isolated)
+	for filename, entry := range importIndex() {
+		isolated := isIsolated(strings.TrimSuffix(filename, ".go"))
+		for _, path := range entry.Imports {
+			used[path] = true
+			if !isolated {
+				usedByProject[path] = true
+			}
+		}
+	}
+
+	unusedAliases := []string{}
+	for alias, path := range readUserImports() {
+		if util.IsExpansion(path) && importedBy(used, util.ExpansionPrefix(path)) {
+			continue
+		}
+		if !used[path] {
+			unusedAliases = append(unusedAliases, fmt.Sprintf("%s (%s)", alias, path))
+		}
+	}
+	sort.Strings(unusedAliases)
+
+	unusedModules := []string{}
+	for _, mod := range directModules() {
+		if !importedBy(usedByProject, mod) {
+			unusedModules = append(unusedModules, mod)
+		}
+	}
+
+	if len(unusedAliases) == 0 && len(unusedModules) == 0 {
+		fmt.Println("Nothing unused found.")
+		return
+	}
+	if len(unusedAliases) > 0 {
+		fmt.Printf("Aliases in imports.json not used by any command:\n")
+		for _, alias := range unusedAliases {
+			fmt.Printf("  %s\n", alias)
+		}
+	}
+	if len(unusedModules) > 0 {
+		fmt.Printf("Modules in go.mod not imported by any command:\n")
+		for _, mod := range unusedModules {
+			fmt.Printf("  %s\n", mod)
+		}
+		fmt.Printf("Run 'goscript --gotidy' to remove them from go.mod.\n")
+	}
+}
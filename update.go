@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// --update replaces the goscript executable with the latest release on GitHub. A release has a binary for each
+// platform, named goscript_<os>_<arch> (with .exe on Windows), and a checksums.txt listing their SHA-256 sums in
+// the format of sha256sum. The binary is downloaded beside the executable, checked against checksums.txt and run
+// with --version before it is renamed over the executable, so a failed update leaves the old one in place.
+// --update --check only reports whether there is a newer release. GOSCRIPT_RELEASES_URL points both at another
+// copy of the GitHub releases API, such as a fork's or a mirror's.
+
+const releasesURL = "https://api.github.com/repos/fkmiec/goscript/releases/latest"
+
+// Set by --check.
+var updateCheckOnly bool
+
+type release struct {
+	Tag    string `json:"tag_name"`
+	URL    string `json:"html_url"`
+	Assets []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// Returns the download URL of the release asset with the given name, or "".
+func (r release) asset(name string) string {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset.URL
+		}
+	}
+	return ""
+}
+
+var updateClient = &http.Client{Timeout: 5 * time.Minute}
+
+// Fetches a URL, failing unless the response is 200 OK. The caller closes the body.
+func fetch(url string) io.ReadCloser {
+	resp, err := updateClient.Get(url)
+	check(err, 2, "Unable to reach "+url)
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		check(fmt.Errorf("%s: %s", url, resp.Status), 2, "")
+	}
+	return resp.Body
+}
+
+// Looks up the latest release.
+func latestRelease() release {
+	url := releasesURL
+	if override := os.Getenv("GOSCRIPT_RELEASES_URL"); override != "" {
+		url = override
+	}
+	body := fetch(url)
+	defer body.Close()
+	var r release
+	check(json.NewDecoder(body).Decode(&r), 2, "Unexpected response from "+url)
+	if r.Tag == "" {
+		check(fmt.Errorf("no release tag in the response from %s", url), 2, "")
+	}
+	return r
+}
+
+// Returns the SHA-256 that a release's checksums.txt lists for a file.
+func releaseChecksum(r release, filename string) string {
+	url := r.asset("checksums.txt")
+	if url == "" {
+		check(fmt.Errorf("release %s has no checksums.txt", r.Tag), 2, "The update can't be verified, so it was not installed.")
+	}
+	body := fetch(url)
+	defer body.Close()
+	lines := bufio.NewScanner(io.LimitReader(body, 1<<20))
+	for lines.Scan() {
+		if fields := strings.Fields(lines.Text()); len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == filename {
+			return strings.ToLower(fields[0])
+		}
+	}
+	check(fmt.Errorf("checksums.txt of release %s doesn't list %s", r.Tag, filename), 2, "The update can't be verified, so it was not installed.")
+	return ""
+}
+
+// Updates goscript to the latest release, or with checkOnly, reports whether there is one (see --update).
+func selfUpdate(checkOnly bool) {
+	current := strings.TrimPrefix(version, "goscript ")
+	r := latestRelease()
+	if compareVersions(r.Tag, current) <= 0 {
+		fmt.Printf("goscript %s is the latest release.\n", current)
+		return
+	}
+	if checkOnly {
+		fmt.Printf("goscript %s is available (this is %s): %s\nRun 'goscript --update' to install it.\n", r.Tag, current, r.URL)
+		return
+	}
+
+	exe, err := os.Executable()
+	check(err, 2, "Unable to find the goscript executable.")
+	exe, err = filepath.EvalSymlinks(exe)
+	check(err, 2, "")
+	filename := exeName(fmt.Sprintf("goscript_%s_%s", runtime.GOOS, runtime.GOARCH), runtime.GOOS)
+	url := r.asset(filename)
+	if url == "" {
+		check(fmt.Errorf("release %s has no %s", r.Tag, filename), 2, "Download it for this platform from "+r.URL+".")
+	}
+	sum := releaseChecksum(r, filename)
+	if !confirm(fmt.Sprintf("This will replace %s (%s) with goscript %s.", exe, current, r.Tag)) {
+		cancelled()
+	}
+
+	fmt.Printf("Downloading %s ...\n", url)
+	check(replaceExecutable(exe, url, sum, r.Tag, runtime.GOOS), 2, "The update was not installed.")
+	fmt.Printf("Updated goscript from %s to %s.\n", current, r.Tag)
+}
+
+// Renames a file. A variable so tests can make the rename over the executable fail.
+var renameFile = os.Rename
+
+// Downloads the goscript binary of release tag from url beside exe, checks it against its SHA-256 sum and that
+// it runs and reports tag with --version, and renames it over exe. On goos windows, where a running executable
+// can't be replaced, exe is moved to exe.old first, and back if the rename fails. Whatever fails, the download is
+// removed and exe is left as it was.
+func replaceExecutable(exe, url, sum, tag, goos string) error {
+	//Downloaded beside the executable, so it can be renamed over it
+	tmp, err := os.CreateTemp(filepath.Dir(exe), ".goscript-update-*"+filepath.Ext(exe))
+	if err != nil {
+		return fmt.Errorf("unable to write to %s (run the update as a user who can, or reinstall goscript): %v", filepath.Dir(exe), err)
+	}
+	installed := false
+	defer func() {
+		if !installed {
+			os.Remove(tmp.Name())
+		}
+	}()
+	resp, err := updateClient.Get(url)
+	if err == nil && resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		err = fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(tmp, hash), resp.Body)
+	resp.Body.Close()
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %v", url, err)
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != sum {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", path.Base(url), sum, actual)
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return err
+	}
+	out, err := exec.Command(tmp.Name(), "--version").Output()
+	if err == nil && !strings.Contains(string(out), strings.TrimPrefix(tag, "v")) {
+		err = fmt.Errorf("it reports %q", strings.TrimSpace(string(out)))
+	}
+	if err != nil {
+		return fmt.Errorf("the downloaded goscript %s doesn't run as expected: %v", tag, err)
+	}
+
+	//A running executable can't be replaced on Windows, but it can be moved out of the way
+	if goos == "windows" {
+		os.Remove(exe + ".old")
+		if err := renameFile(exe, exe+".old"); err != nil {
+			return fmt.Errorf("unable to replace %s: %v", exe, err)
+		}
+	}
+	if err := renameFile(tmp.Name(), exe); err != nil {
+		if goos == "windows" {
+			renameFile(exe+".old", exe)
+		}
+		return fmt.Errorf("unable to replace %s: %v", exe, err)
+	}
+	installed = true
+	return nil
+}
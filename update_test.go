@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.0", "1.2.0", 0},
+		{"v1.10.0", "v1.9.3", 1},
+		{"v1.2", "v1.2.1", -1},
+		{"v2.0.0", "v2.0.0-rc.1", 1},
+		{"v2.0.0-rc.1", "v2.0.0-rc.2", -1},
+		{"v0.9.0", "v1.0.0-beta", -1},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// Serves a release of goscript v9.9.9 as the GitHub releases API does, with a binary that prints reported for
+// --version and a checksums.txt listing sum for it ("" for the binary's real sum). Returns the binary's URL.
+func serveRelease(t *testing.T, reported, sum string) string {
+	binary := "#!/bin/sh\necho goscript " + reported + "\n"
+	if sum == "" {
+		hash := sha256.Sum256([]byte(binary))
+		sum = hex.EncodeToString(hash[:])
+	}
+	filename := exeName(fmt.Sprintf("goscript_%s_%s", runtime.GOOS, runtime.GOARCH), runtime.GOOS)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest":
+			fmt.Fprintf(w, `{"tag_name": "v9.9.9", "html_url": "%[1]s/v9.9.9", "assets": [
+				{"name": "%[2]s", "browser_download_url": "%[1]s/%[2]s"},
+				{"name": "checksums.txt", "browser_download_url": "%[1]s/checksums.txt"}]}`, server.URL, filename)
+		case "/checksums.txt":
+			fmt.Fprintf(w, "%s  %s\n", sum, filename)
+		case "/" + filename:
+			fmt.Fprint(w, binary)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("GOSCRIPT_RELEASES_URL", server.URL+"/latest")
+	return server.URL + "/" + filename
+}
+
+// Installs the latest release served by serveRelease over exe, as selfUpdate does after the user confirms.
+func installLatest(exe, goos string) error {
+	r := latestRelease()
+	filename := exeName(fmt.Sprintf("goscript_%s_%s", runtime.GOOS, runtime.GOARCH), runtime.GOOS)
+	return replaceExecutable(exe, r.asset(filename), releaseChecksum(r, filename), r.Tag, goos)
+}
+
+// Writes a stand-in for the running goscript in a directory of its own.
+func testExecutable(t *testing.T) string {
+	exe := filepath.Join(t.TempDir(), "goscript")
+	if err := os.WriteFile(exe, []byte("old goscript"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return exe
+}
+
+// Checks that exe is the old goscript and that the update left nothing beside it.
+func checkNotReplaced(t *testing.T, exe string) {
+	t.Helper()
+	if data, err := os.ReadFile(exe); err != nil || string(data) != "old goscript" {
+		t.Errorf("the executable was replaced: %q, %v", data, err)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(exe)); len(entries) != 1 {
+		t.Errorf("the update left %d files beside the executable", len(entries)-1)
+	}
+}
+
+func TestReplaceExecutable(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the served binary is a shell script")
+	}
+
+	t.Run("wrong checksum", func(t *testing.T) {
+		serveRelease(t, "v9.9.9", strings.Repeat("0", 64))
+		exe := testExecutable(t)
+		if err := installLatest(exe, runtime.GOOS); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+			t.Errorf("installed with a wrong checksum: %v", err)
+		}
+		checkNotReplaced(t, exe)
+	})
+
+	t.Run("wrong version", func(t *testing.T) {
+		serveRelease(t, "v1.0.0", "")
+		exe := testExecutable(t)
+		if err := installLatest(exe, runtime.GOOS); err == nil || !strings.Contains(err.Error(), `reports "goscript v1.0.0"`) {
+			t.Errorf("installed a binary reporting another version: %v", err)
+		}
+		checkNotReplaced(t, exe)
+	})
+
+	t.Run("missing binary", func(t *testing.T) {
+		url := serveRelease(t, "v9.9.9", "")
+		exe := testExecutable(t)
+		if err := replaceExecutable(exe, url+".missing", strings.Repeat("0", 64), "v9.9.9", runtime.GOOS); err == nil {
+			t.Error("installed a binary that wasn't found")
+		}
+		checkNotReplaced(t, exe)
+	})
+
+	t.Run("installed", func(t *testing.T) {
+		serveRelease(t, "v9.9.9", "")
+		exe := testExecutable(t)
+		if err := installLatest(exe, runtime.GOOS); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(exe); !strings.Contains(string(data), "echo goscript v9.9.9") {
+			t.Errorf("the executable is %q after the update", data)
+		}
+	})
+
+	//On Windows the executable is moved aside first, and moved back when the new one can't take its place
+	t.Run("windows rollback", func(t *testing.T) {
+		serveRelease(t, "v9.9.9", "")
+		exe := testExecutable(t)
+		defer func() { renameFile = os.Rename }()
+		renameFile = func(from, to string) error {
+			if to == exe && !strings.HasSuffix(from, ".old") {
+				return errors.New("access is denied")
+			}
+			return os.Rename(from, to)
+		}
+		if err := installLatest(exe, "windows"); err == nil || !strings.Contains(err.Error(), "access is denied") {
+			t.Errorf("installLatest = %v, want the failed rename", err)
+		}
+		checkNotReplaced(t, exe)
+
+		renameFile = os.Rename
+		if err := installLatest(exe, "windows"); err != nil {
+			t.Fatal(err)
+		}
+		if data, _ := os.ReadFile(exe + ".old"); string(data) != "old goscript" {
+			t.Errorf("the old executable is %q, want it kept as .old", data)
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+)
+
+// --url fetches a script from the web (a raw GitHub file, a gist, ...) and runs it like --file --exec. Fetched
+// sources are kept in .goscript/urls, keyed by a hash of the URL, and revalidated with their ETag (or
+// Last-Modified date), so running a script again downloads it only if it has changed. Code is only run once
+// you have trusted it: goscript asks the first time it sees a source, and again whenever the source changes.
+
+const maxScriptSize = 4 << 20
+
+type fetchedScript struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag"`
+	LastModified string    `json:"last_modified"` //for servers that don't send an ETag
+	Hash         string    `json:"hash"`          //of the source
+	Trusted      string    `json:"trusted"`       //hash of the source last trusted to run
+	Fetched      time.Time `json:"fetched"`
+}
+
+func urlCacheDir() string {
+	return stateDir() + "/urls"
+}
+
+// Checks that a script URL is one goscript will fetch: https, or http to the local machine (for testing).
+func checkScriptURL(rawURL string) {
+	u, err := url.Parse(rawURL)
+	check(err, 2, "Invalid --url.")
+	if !scriptURLAllowed(u) {
+		check(fmt.Errorf("refusing to fetch %s", rawURL), 2, "Scripts are only fetched over https.")
+	}
+}
+
+func scriptURLAllowed(u *url.URL) bool {
+	switch {
+	case u.Scheme == "https":
+		return true
+	case u.Scheme == "http" && (u.Hostname() == "localhost" || u.Hostname() == "127.0.0.1" || u.Hostname() == "::1"):
+		return true
+	}
+	return false
+}
+
+// Follows a redirect only to a URL goscript would fetch in the first place, and never from https to http, so a
+// redirect can't take the download off https.
+func checkScriptRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if via[len(via)-1].URL.Scheme == "https" && req.URL.Scheme != "https" {
+		return fmt.Errorf("refusing to follow a redirect from https to %s", req.URL)
+	}
+	if !scriptURLAllowed(req.URL) {
+		return fmt.Errorf("refusing to follow a redirect to %s", req.URL)
+	}
+	return nil
+}
+
+// Downloads the script at the URL, or revalidates the cached copy. Returns the path of the cached source. If
+// the script can't be fetched but was fetched before, the cached copy is used.
+func fetchScript(rawURL string) (string, fetchedScript) {
+	checkScriptURL(rawURL)
+	key := hashBytes([]byte(rawURL))[:32]
+	srcFilename := urlCacheDir() + "/" + key + ".go"
+	metaFilename := urlCacheDir() + "/" + key + ".json"
+	var meta fetchedScript
+	if data, err := os.ReadFile(metaFilename); err == nil && checkFileExists(srcFilename) {
+		json.Unmarshal(data, &meta)
+	}
+
+	req, err := http.NewRequest("GET", rawURL, nil)
+	check(err, 2, "")
+	if meta.ETag != "" {
+		req.Header.Set("If-None-Match", meta.ETag)
+	} else if meta.LastModified != "" {
+		req.Header.Set("If-Modified-Since", meta.LastModified)
+	}
+	client := &http.Client{Timeout: 30 * time.Second, CheckRedirect: checkScriptRedirect}
+	resp, err := client.Do(req)
+	if err != nil {
+		if meta.Hash != "" {
+			fmt.Fprintf(os.Stderr, "warning: %v; using the copy fetched %s\n", err, meta.Fetched.Format(time.RFC1123))
+			return cachedScript(srcFilename, meta)
+		}
+		check(err, 2, "Unable to fetch the script.")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && meta.Hash != "" {
+		return cachedScript(srcFilename, meta)
+	}
+	if resp.StatusCode != http.StatusOK {
+		check(fmt.Errorf("%s: %s", rawURL, resp.Status), 2, "Unable to fetch the script.")
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxScriptSize+1))
+	check(err, 2, "Unable to fetch the script.")
+	if len(data) > maxScriptSize {
+		check(fmt.Errorf("%s is larger than %d bytes", rawURL, maxScriptSize), 2, "")
+	}
+
+	check(os.MkdirAll(urlCacheDir(), 0755), 2, "")
+	check(os.WriteFile(srcFilename, data, 0644), 2, "Unable to cache the script.")
+	meta.URL = rawURL
+	meta.ETag = resp.Header.Get("ETag")
+	meta.LastModified = resp.Header.Get("Last-Modified")
+	meta.Hash = hashBytes(data)
+	meta.Fetched = time.Now()
+	writeFetchedScript(metaFilename, meta)
+	return srcFilename, meta
+}
+
+// Returns the cached copy of a script with the hash of the file as it is now, rather than as it was fetched, so a
+// copy changed since it was trusted must be trusted again.
+func cachedScript(srcFilename string, meta fetchedScript) (string, fetchedScript) {
+	data, err := os.ReadFile(srcFilename)
+	check(err, 2, "Unable to read the cached script.")
+	meta.Hash = hashBytes(data)
+	return srcFilename, meta
+}
+
+func writeFetchedScript(metaFilename string, meta fetchedScript) {
+	data, err := json.MarshalIndent(meta, "", "    ")
+	if !check(err, 1, "") {
+		check(os.WriteFile(metaFilename, data, 0644), 1, "Unable to cache the script.")
+	}
+}
+
+// Fetches the script at the URL and makes sure it is trusted to run: with --trust, or by asking when this
+// source hasn't been trusted before. --yes doesn't answer the question, since it is meant for prompts about the
+// project, not for running code nobody has looked at. Returns the path of the source to build.
+func trustedScript(rawURL string, trust bool) string {
+	srcFilename, meta := fetchScript(rawURL)
+	if meta.Trusted == meta.Hash {
+		return srcFilename
+	}
+	if !trust {
+		question := fmt.Sprintf("%s has not been run before (sha256 %s).\nReview it with 'cat %s'.\nRun it?", rawURL, meta.Hash[:16], srcFilename)
+		if meta.Trusted != "" {
+			question = fmt.Sprintf("%s has changed since it was last run (sha256 %s).\nReview it with 'cat %s'.\nRun it?", rawURL, meta.Hash[:16], srcFilename)
+		}
+		if !isTerminal(os.Stdin) || !prompt(question) {
+			check(fmt.Errorf("%s is not trusted", rawURL), 2, "Pass --trust to run it without asking.")
+		}
+	}
+	meta.Trusted = meta.Hash
+	writeFetchedScript(urlCacheDir()+"/"+hashBytes([]byte(rawURL))[:32]+".json", meta)
+	return srcFilename
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCheckScriptRedirect(t *testing.T) {
+	tests := []struct {
+		from, to string
+		ok       bool
+	}{
+		{"https://example.com/a.go", "https://raw.example.com/a.go", true},
+		{"https://example.com/a.go", "http://example.com/a.go", false},
+		{"https://example.com/a.go", "http://localhost/a.go", false},
+		{"http://localhost:8080/a.go", "http://127.0.0.1:8080/a.go", true},
+		{"http://localhost:8080/a.go", "http://example.com/a.go", false},
+		{"http://localhost:8080/a.go", "https://example.com/a.go", true},
+		{"https://example.com/a.go", "ftp://example.com/a.go", false},
+	}
+	for _, tt := range tests {
+		from, _ := http.NewRequest("GET", tt.from, nil)
+		to, _ := http.NewRequest("GET", tt.to, nil)
+		err := checkScriptRedirect(to, []*http.Request{from})
+		if (err == nil) != tt.ok {
+			t.Errorf("redirect from %s to %s: got %v, want allowed %v", tt.from, tt.to, err, tt.ok)
+		}
+	}
+}
+
+// A cached copy changed after it was trusted is no longer trusted, even if the server says it is unchanged.
+func TestFetchScriptNotModified(t *testing.T) {
+	defer func(dir string) { projectDir = dir }(projectDir)
+	projectDir = t.TempDir()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, "fmt.Println(\"hi\")\n")
+	}))
+	defer server.Close()
+
+	srcFilename := trustedScript(server.URL+"/hi.go", true)
+	if _, meta := fetchScript(server.URL + "/hi.go"); meta.Hash != meta.Trusted {
+		t.Fatalf("unchanged copy: hash %s, trusted %s", meta.Hash, meta.Trusted)
+	}
+	if err := os.WriteFile(srcFilename, []byte("os.RemoveAll(\"/\")\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, meta := fetchScript(server.URL + "/hi.go"); meta.Hash == meta.Trusted {
+		t.Errorf("changed copy is still trusted (hash %s)", meta.Hash)
+	}
+}
+
+// A redirect from https to http is refused before the http URL is requested, even to the local machine.
+func TestScriptRedirectToHTTP(t *testing.T) {
+	requested := false
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = true
+		io.WriteString(w, "fmt.Println(\"hi\")\n")
+	}))
+	defer plain.Close()
+	secure := httptest.NewTLSServer(http.RedirectHandler(plain.URL+"/hi.go", http.StatusFound))
+	defer secure.Close()
+
+	client := secure.Client()
+	client.CheckRedirect = checkScriptRedirect
+	resp, err := client.Get(secure.URL + "/hi.go")
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("the redirect to http was followed")
+	}
+	if !strings.Contains(err.Error(), "refusing to follow a redirect from https") {
+		t.Errorf("got %v", err)
+	}
+	if requested {
+		t.Error("the http URL was requested")
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// Returns the peak resident set size of a finished process in bytes, or 0 if unknown.
+func maxRSS(state *os.ProcessState) int64 {
+	return 0
+}
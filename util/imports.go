@@ -243,9 +243,9 @@ var ImportsMap = map[string]string{
 	//"math":             "runtime/internal/math",
 	"startlinetest": "runtime/internal/startlinetest",
 	"sys":           "runtime/internal/sys",
-	"syscall":       "runtime/internal/syscall",
-	"wasitest":      "runtime/internal/wasitest",
-	"metrics":       "runtime/metrics",
+	//"syscall":       "runtime/internal/syscall",
+	"wasitest": "runtime/internal/wasitest",
+	"metrics":  "runtime/metrics",
 	//"pprof":            "runtime/pprof",
 	//"race":             "runtime/race",
 	"amd64v1": "runtime/race/internal/amd64v1",
@@ -256,7 +256,7 @@ var ImportsMap = map[string]string{
 	"strings": "strings",
 	"sync":    "sync",
 	//"atomic":           "sync/atomic",
-	//"syscall":          "syscall",
+	"syscall":  "syscall",
 	"testing":  "testing",
 	"fstest":   "testing/fstest",
 	"testdeps": "testing/internal/testdeps",
@@ -291,4 +291,8 @@ var ImportsMap = map[string]string{
 	"transform": "vendor/golang.org/x/text/transform",
 	"bidi":      "vendor/golang.org/x/text/unicode/bidi",
 	"norm":      "vendor/golang.org/x/text/unicode/norm",
+
+	//Expansions for modules that publish many similarly named packages (see resolve.go)
+	"aws-sdk-go-v2/service": "github.com/aws/aws-sdk-go-v2/service/...",
+	"k8s.io/api":            "k8s.io/api/.../v1",
 }
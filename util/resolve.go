@@ -0,0 +1,33 @@
+package util
+
+import "strings"
+
+// Most ImportsMap values are a single import path. A value ending in "/..." is an expansion instead: it maps every
+// subpackage of the path, so a selector resolves to <path>/<selector>. A value of the form "<path>/.../<version>"
+// maps version-suffixed subpackages, so both "corev1" and "core" resolve to k8s.io/api/core/v1 under
+// "k8s.io/api/.../v1". The key of an expansion only names it and is never matched as a selector.
+
+// Reports whether an ImportsMap value is an expansion.
+func IsExpansion(value string) bool {
+	return strings.HasSuffix(value, "/...") || strings.Contains(value, "/.../")
+}
+
+// Returns the path an expansion covers (e.g. "k8s.io/api" for "k8s.io/api/.../v1").
+func ExpansionPrefix(value string) string {
+	prefix, _, _ := strings.Cut(value, "/...")
+	return prefix
+}
+
+// Returns the import path a selector resolves to under an expansion, or blank if it can't.
+func Expand(value string, selector string) string {
+	prefix, version, _ := strings.Cut(value, "/...")
+	version = strings.TrimPrefix(version, "/")
+	if version == "" {
+		return prefix + "/" + selector
+	}
+	pkg := strings.TrimSuffix(selector, version)
+	if pkg == "" {
+		return ""
+	}
+	return prefix + "/" + pkg + "/" + version
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/fkmiec/goscript/engine"
+)
+
+// Every script that is built is also checked with go vet, for mistakes that compile but go wrong at run time, such
+// as a Printf verb that doesn't match its argument or a lock copied by value. The check runs after go build, so it
+// is fast with the build cache warm, and its findings are warnings that don't stop the script from running.
+// --no-vet or GOSCRIPT_NO_VET=1 turns it off. --vet [name] checks a command, or all of them, on demand, with
+// staticcheck too if it is on the PATH, and exits nonzero if there are findings.
+
+// Set by --no-vet.
+var noVet bool
+
+// Reports whether scripts are vetted when they are built.
+func vetEnabled() bool {
+	value := os.Getenv("GOSCRIPT_NO_VET")
+	return !noVet && (value == "" || value == "0")
+}
+
+// Returns the findings in the output of go vet or staticcheck, without the headers naming the package.
+func vetFindings(out []byte) []string {
+	findings := []string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			findings = append(findings, line)
+		}
+	}
+	return findings
+}
+
+// Prints the findings of go vet for a script that was just built as warnings.
+func warnVet(srcFilename string, env []string) {
+	out, err := goEngine().VetFile(srcFilename, env...)
+	if err == nil {
+		return
+	}
+	name := strings.TrimSuffix(filepath.Base(buildTarget(srcFilename)), ".go")
+	if strings.HasPrefix(name, "gocmd-") {
+		name = "the code"
+	}
+	fmt.Fprintf(os.Stderr, "warning: go vet found problems in %s (turn this off with --no-vet):\n", name)
+	for _, finding := range vetFindings(out) {
+		fmt.Fprintf(os.Stderr, "  %s\n", finding)
+	}
+}
+
+// Returns the findings of staticcheck for a script, or nil if staticcheck isn't installed.
+func staticcheckFindings(srcFilename string) []string {
+	staticcheck, err := exec.LookPath("staticcheck")
+	if err != nil {
+		return nil
+	}
+	absSrcFilename, _ := filepath.Abs(srcFilename)
+	args := []string{}
+	for _, flag := range engine.MergeBuildFlags(buildFlags(), engine.ReadMetadata(srcFilename).BuildFlags) {
+		if value, ok := strings.CutPrefix(flag, "-tags="); ok {
+			args = append(args, "-tags", value)
+		}
+	}
+	cmd := exec.Command(staticcheck, append(args, buildTarget(absSrcFilename))...)
+	cmd.Dir = moduleDir(srcFilename)
+	cmd.Env = goCommand().Env //staticcheck runs the project's go to load packages
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		return nil
+	}
+	return vetFindings(out)
+}
+
+// Vets the named command, or every command if the name is "all" (see --vet).
+func vetCommands(name string) {
+	names := []string{name}
+	if name == "all" {
+		names = []string{}
+		for _, filename := range getSourceList() {
+			if cmd, active := strings.CutSuffix(filename, ".go"); active {
+				names = append(names, cmd)
+			}
+		}
+	} else if !checkFileExists(sourceFile(name)) {
+		check(fmt.Errorf("there is no command named %s", name), 2, "")
+	}
+
+	r := &report{title: "Vet", columns: []string{"Command", "Tool", "Finding"}}
+	flagged := 0
+	for _, cmd := range names {
+		srcFilename := sourceFile(cmd)
+		findings := 0
+		out, err := goEngine().VetFile(srcFilename, crossEnv()...)
+		if err != nil {
+			for _, finding := range vetFindings(out) {
+				r.add(cmd, "vet", finding)
+				findings++
+			}
+		}
+		for _, finding := range staticcheckFindings(srcFilename) {
+			r.add(cmd, "staticcheck", finding)
+			findings++
+		}
+		if findings > 0 {
+			flagged++
+		}
+	}
+	tools := "go vet"
+	if _, err := exec.LookPath("staticcheck"); err == nil {
+		tools += " and staticcheck"
+	}
+	r.notes = append(r.notes, fmt.Sprintf("Vetted %d command(s) with %s: %d clean, %d with findings.", len(names), tools, len(names)-flagged, flagged))
+	r.print()
+	if flagged > 0 {
+		exitProgram(1)
+	}
+}
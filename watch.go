@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// --watch polls a command's source and recompiles it whenever it is saved. Polling needs nothing outside the
+// standard library and is cheap for a single file.
+
+const watchInterval = 500 * time.Millisecond
+
+// Returns a value that changes whenever the command's source (or one of the helper files of a directory command)
+// is saved. Blank if the source can't be read.
+func watchStamp(filename string) string {
+	stamp := ""
+	for _, filename := range commandFiles(filename) {
+		info, err := os.Stat(filename)
+		if err != nil {
+			return ""
+		}
+		stamp += fmt.Sprintf("%s:%d/%d ", filename, info.ModTime().UnixNano(), info.Size())
+	}
+	return stamp
+}
+
+// Recompiles the named command each time its source changes, until interrupted. With run, the binary is run with
+// args after each successful build; a run still in progress is stopped first.
+func watchCommand(name string, run bool, args []string) {
+	srcFilename := sourceFile(name)
+	binFilename := hostBinaryPath(name)
+	if !checkFileExists(srcFilename) {
+		check(fmt.Errorf("no command named %s", name), 2, "")
+	}
+	fmt.Fprintf(os.Stderr, "Watching %s. Press Ctrl-C to stop.\n", srcFilename)
+
+	var running *exec.Cmd
+	var done chan struct{} //closed when the running binary exits
+	stamp := ""
+	for {
+		if current := watchStamp(srcFilename); current != stamp && current != "" {
+			stamp = current
+			if running != nil {
+				select {
+				case <-done:
+				default:
+					running.Process.Kill()
+					<-done
+				}
+				running = nil
+			}
+			unlock := lockProject()
+			ok := compileBinary(srcFilename, binFilename)
+			unlock()
+			savedErrors.flush()
+			if ok {
+				fmt.Fprintf(os.Stderr, "[%s] Built %s\n", time.Now().Format("15:04:05"), name)
+			} else {
+				fmt.Fprintf(os.Stderr, "[%s] Build of %s failed; waiting for the next save\n", time.Now().Format("15:04:05"), name)
+			}
+			if ok && run {
+				running = exec.Command(binFilename, args...)
+				running.Stdin = os.Stdin
+				running.Stdout = os.Stdout
+				running.Stderr = os.Stderr
+				if check(running.Start(), 1, "") {
+					running = nil
+				} else {
+					done = make(chan struct{})
+					go func(cmd *exec.Cmd, done chan struct{}) {
+						cmd.Wait()
+						close(done)
+					}(running, done)
+				}
+			}
+		}
+		time.Sleep(watchInterval)
+	}
+}